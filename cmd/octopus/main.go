@@ -2,6 +2,7 @@ package main
 
 import (
 	_ "embed"
+	"errors"
 	"fmt"
 	"github.com/OctopusDeploy/cli/pkg/util"
 	"os"
@@ -15,6 +16,7 @@ import (
 
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/OctopusDeploy/cli/pkg/config"
+	cliErrors "github.com/OctopusDeploy/cli/pkg/errors"
 	"github.com/OctopusDeploy/cli/pkg/factory"
 	"github.com/OctopusDeploy/cli/pkg/question"
 	"github.com/OctopusDeploy/cli/pkg/usage"
@@ -73,12 +75,21 @@ func main() {
 	cmd.SetErr(terminal.NewAnsiStderr(os.Stderr))
 
 	if err := cmd.Execute(); err != nil {
-		cmd.PrintErr(err)
-		cmd.Println()
+		var silentError *cliErrors.SilentError
+		if !errors.As(err, &silentError) {
+			cmd.PrintErr(err)
+			cmd.Println()
+
+			if usageError, ok := err.(*usage.UsageError); ok {
+				// if the code returns a UsageError, print the usage information
+				cmd.Println(usageError.Command().UsageString())
+			}
+		}
 
-		if usageError, ok := err.(*usage.UsageError); ok {
-			// if the code returns a UsageError, print the usage information
-			cmd.Println(usageError.Command().UsageString())
+		// some errors (e.g. a failed or timed out task wait) map to a distinct exit code for scripts to check
+		var exitCodeError cliErrors.ExitCodeError
+		if errors.As(err, &exitCodeError) {
+			os.Exit(exitCodeError.ExitCode())
 		}
 
 		os.Exit(1)
@@ -64,6 +64,8 @@ func promptMissing(ask question.Asker) (string, error) {
 		constants.ConfigOutputFormat,
 		constants.ConfigShowOctopus,
 		constants.ConfigEditor,
+		constants.ConfigWaitTimeout,
+		constants.ConfigWaitPollInterval,
 		// 	constants.ConfigProxyUrl,
 	}
 
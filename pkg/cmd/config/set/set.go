@@ -72,6 +72,12 @@ func setRun(isPromptEnabled bool, ask question.Asker, key string, value string)
 			return fmt.Errorf("the provided value %s is not valid for NoPrompt, please use true of false", value)
 		}
 		localViper.Set(key, boolValue)
+	} else if key == strings.ToLower(constants.ConfigWaitTimeout) || key == strings.ToLower(constants.ConfigWaitPollInterval) {
+		intValue, err := strconv.Atoi(value)
+		if err != nil || intValue < 0 {
+			return fmt.Errorf("the provided value %s is not valid for %s, please use a number of seconds", value, key)
+		}
+		localViper.Set(key, intValue)
 	} else {
 		localViper.Set(key, value)
 	}
@@ -90,6 +96,8 @@ func promptMissing(ask question.Asker, key string) (string, string, error) {
 		constants.ConfigOutputFormat,
 		constants.ConfigShowOctopus,
 		constants.ConfigEditor,
+		constants.ConfigWaitTimeout,
+		constants.ConfigWaitPollInterval,
 		// constants.ConfigProxyUrl,
 	}
 
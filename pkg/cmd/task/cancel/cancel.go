@@ -0,0 +1,111 @@
+package cancel
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/OctopusDeploy/cli/pkg/cmd"
+	"github.com/OctopusDeploy/cli/pkg/cmd/task/wait"
+	"github.com/OctopusDeploy/cli/pkg/constants"
+	"github.com/OctopusDeploy/cli/pkg/factory"
+	"github.com/OctopusDeploy/cli/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+const (
+	FlagWait    = "wait"
+	FlagTimeout = wait.FlagTimeout
+
+	// canceledState is the state a task ends in once it has been cancelled, which is what we're waiting for
+	canceledState = "Canceled"
+	// successState is the state of tasks which managed to finish before they could be cancelled
+	successState = "Success"
+)
+
+type CancelOptions struct {
+	*cmd.Dependencies
+	TaskIDs            []string
+	CancelTaskCallback wait.CancelTaskCallback
+	Wait               bool
+	// WaitOptions configures the wait for the cancellations to take effect when Wait is set
+	WaitOptions *wait.WaitOptions
+}
+
+func NewCancelOps(dependencies *cmd.Dependencies, taskIDs []string) *CancelOptions {
+	return &CancelOptions{
+		Dependencies:       dependencies,
+		TaskIDs:            taskIDs,
+		CancelTaskCallback: wait.GetCancelTaskCallback(dependencies.Client, wait.SpaceID(dependencies)),
+		WaitOptions:        wait.NewWaitOps(dependencies, taskIDs),
+	}
+}
+
+func NewCmdCancel(f factory.Factory) *cobra.Command {
+	var waitForCancel bool
+	var timeout int
+	cmd := &cobra.Command{
+		Use:   "cancel [TaskIDs]",
+		Short: "Cancel task(s)",
+		Long:  "Cancel a provided list of running or queued task(s)",
+		Example: heredoc.Docf(`
+			$ %[1]s task cancel ServerTasks-12345
+			$ %[1]s task cancel ServerTasks-12345 ServerTasks-12346 --wait --timeout 120
+		`, constants.ExecutableName),
+		RunE: func(c *cobra.Command, args []string) error {
+			taskIDs := make([]string, len(args))
+			copy(taskIDs, args)
+			taskIDs = append(taskIDs, util.ReadValuesFromPipe()...)
+
+			dependencies := cmd.NewDependencies(f, c)
+			opts := NewCancelOps(dependencies, taskIDs)
+			opts.Wait = waitForCancel
+			opts.WaitOptions.Context = c.Context()
+			opts.WaitOptions.Timeout = timeout
+
+			return CancelRun(opts)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.BoolVar(&waitForCancel, FlagWait, false, "Wait for the task(s) to finish cancelling")
+	flags.IntVar(&timeout, FlagTimeout, wait.DefaultTimeout, "Duration to wait (in seconds) for the task(s) to finish cancelling")
+
+	return cmd
+}
+
+func CancelRun(opts *CancelOptions) error {
+	taskIDs, err := wait.NormalizeTaskIDs(opts.TaskIDs)
+	if err != nil {
+		return err
+	}
+	if len(taskIDs) == 0 {
+		return fmt.Errorf("no server task IDs provided, at least one is required")
+	}
+
+	// carry on cancelling the rest if one fails, so a single bad ID doesn't leave other tasks running
+	cancelledTaskIDs := make([]string, 0, len(taskIDs))
+	failures := make([]string, 0)
+	for _, taskID := range taskIDs {
+		if _, err := opts.CancelTaskCallback(taskID); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", taskID, err))
+			continue
+		}
+		cancelledTaskIDs = append(cancelledTaskIDs, taskID)
+		fmt.Fprintf(opts.Out, "Requested cancellation of %s\n", taskID)
+	}
+
+	if opts.Wait && len(cancelledTaskIDs) != 0 {
+		waitOpts := opts.WaitOptions
+		waitOpts.TaskIDs = cancelledTaskIDs
+		waitOpts.SuccessStates = []string{successState, canceledState}
+		if err := wait.WaitRun(waitOpts); err != nil {
+			return err
+		}
+	}
+
+	if len(failures) != 0 {
+		return fmt.Errorf("failed to cancel %d task(s):\n%s", len(failures), strings.Join(failures, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package cancel_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/OctopusDeploy/cli/pkg/cmd"
+	taskCancel "github.com/OctopusDeploy/cli/pkg/cmd/task/cancel"
+	"github.com/OctopusDeploy/cli/pkg/cmd/task/wait"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCancel(t *testing.T) {
+	out := bytes.Buffer{}
+	cancelledTaskIDs := make([]string, 0)
+	cancelTaskCallback := func(taskID string) (*tasks.Task, error) {
+		cancelledTaskIDs = append(cancelledTaskIDs, taskID)
+		return tasks.NewTask(), nil
+	}
+
+	opts := &taskCancel.CancelOptions{
+		Dependencies: &cmd.Dependencies{
+			Out: &out,
+		},
+		TaskIDs:            []string{"ServerTasks-1", " ServerTasks-2 ", "ServerTasks-1"},
+		CancelTaskCallback: cancelTaskCallback,
+	}
+
+	err := taskCancel.CancelRun(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ServerTasks-1", "ServerTasks-2"}, cancelledTaskIDs)
+	assert.Equal(t, heredoc.Doc(`
+		Requested cancellation of ServerTasks-1
+		Requested cancellation of ServerTasks-2
+	`), out.String())
+}
+
+func TestCancel_NoTaskIDs(t *testing.T) {
+	opts := &taskCancel.CancelOptions{
+		Dependencies: &cmd.Dependencies{
+			Out: &bytes.Buffer{},
+		},
+	}
+
+	err := taskCancel.CancelRun(opts)
+	assert.EqualError(t, err, "no server task IDs provided, at least one is required")
+}
+
+func TestCancel_CarriesOnAfterFailure(t *testing.T) {
+	out := bytes.Buffer{}
+	cancelledTaskIDs := make([]string, 0)
+	cancelTaskCallback := func(taskID string) (*tasks.Task, error) {
+		if taskID == "ServerTasks-1" {
+			return nil, errors.New("task not found")
+		}
+		cancelledTaskIDs = append(cancelledTaskIDs, taskID)
+		return tasks.NewTask(), nil
+	}
+
+	opts := &taskCancel.CancelOptions{
+		Dependencies: &cmd.Dependencies{
+			Out: &out,
+		},
+		TaskIDs:            []string{"ServerTasks-1", "ServerTasks-2"},
+		CancelTaskCallback: cancelTaskCallback,
+	}
+
+	err := taskCancel.CancelRun(opts)
+	assert.EqualError(t, err, "failed to cancel 1 task(s):\nServerTasks-1: task not found")
+	assert.Equal(t, []string{"ServerTasks-2"}, cancelledTaskIDs)
+	assert.Equal(t, "Requested cancellation of ServerTasks-2\n", out.String())
+}
+
+func TestCancel_WaitTreatsCanceledAsSuccess(t *testing.T) {
+	out := bytes.Buffer{}
+	boolFalse := false
+	boolTrue := true
+
+	task := tasks.NewTask()
+	task.ID = "ServerTasks-1"
+	task.Description = "Deploy Bar 1 release 0.0.2 to Foo"
+	task.IsCompleted = &boolFalse
+	task.State = "Cancelling"
+
+	cancelTaskCallback := func(taskID string) (*tasks.Task, error) {
+		return task, nil
+	}
+	timesCalled := 0
+	getServerTaskCallback := func(taskIDs []string) ([]*tasks.Task, error) {
+		timesCalled++
+		assert.Equal(t, []string{"ServerTasks-1"}, taskIDs)
+		if timesCalled > 1 {
+			task.IsCompleted = &boolTrue
+			task.FinishedSuccessfully = &boolFalse
+			task.State = "Canceled"
+		}
+		return []*tasks.Task{task}, nil
+	}
+
+	dependencies := &cmd.Dependencies{
+		Out: &out,
+	}
+	opts := &taskCancel.CancelOptions{
+		Dependencies:       dependencies,
+		TaskIDs:            []string{"ServerTasks-1"},
+		CancelTaskCallback: cancelTaskCallback,
+		Wait:               true,
+		WaitOptions: &wait.WaitOptions{
+			Dependencies:           dependencies,
+			GetServerTasksCallback: getServerTaskCallback,
+			Timeout:                wait.DefaultTimeout,
+			PollInterval:           1,
+			MaxPollInterval:        1,
+		},
+	}
+
+	err := taskCancel.CancelRun(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, timesCalled)
+	assert.Contains(t, out.String(), "Requested cancellation of ServerTasks-1\nServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Cancelling\nServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Canceled\n")
+}
@@ -0,0 +1,141 @@
+package details
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/OctopusDeploy/cli/pkg/cmd"
+	"github.com/OctopusDeploy/cli/pkg/cmd/task/wait"
+	"github.com/OctopusDeploy/cli/pkg/constants"
+	"github.com/OctopusDeploy/cli/pkg/factory"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+	"github.com/spf13/cobra"
+)
+
+const (
+	FlagErrorsOnly = "errors-only"
+)
+
+type DetailsOptions struct {
+	*cmd.Dependencies
+	TaskID                 string
+	GetTaskDetailsCallback wait.TaskDetailsCallback
+	ErrorsOnly             bool
+	OutputFormat           string
+}
+
+func NewDetailsOps(dependencies *cmd.Dependencies, taskID string) *DetailsOptions {
+	return &DetailsOptions{
+		Dependencies:           dependencies,
+		TaskID:                 taskID,
+		GetTaskDetailsCallback: wait.GetTaskDetailsCallback(dependencies.Client, wait.SpaceID(dependencies)),
+		OutputFormat:           constants.OutputFormatTable,
+	}
+}
+
+func NewCmdDetails(f factory.Factory) *cobra.Command {
+	var errorsOnly bool
+	cmd := &cobra.Command{
+		Use:   "details <TaskID>",
+		Short: "Show the activity log of a task",
+		Long:  "Show the full activity log of a task, such as to find out why it failed",
+		Example: heredoc.Docf(`
+			$ %[1]s task details ServerTasks-12345
+			$ %[1]s task details ServerTasks-12345 --errors-only
+			$ %[1]s task details ServerTasks-12345 --output-format json
+		`, constants.ExecutableName),
+		Args: cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			dependencies := cmd.NewDependencies(f, c)
+			opts := NewDetailsOps(dependencies, args[0])
+			opts.ErrorsOnly = errorsOnly
+			if outputFormat, err := c.Flags().GetString(constants.FlagOutputFormat); err == nil {
+				opts.OutputFormat = outputFormat
+			}
+
+			return DetailsRun(opts)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.BoolVar(&errorsOnly, FlagErrorsOnly, false, "Only show failed activities and error or fatal log messages")
+
+	return cmd
+}
+
+func DetailsRun(opts *DetailsOptions) error {
+	taskIDs, err := wait.NormalizeTaskIDs([]string{opts.TaskID})
+	if err != nil {
+		return err
+	}
+	if len(taskIDs) == 0 {
+		return fmt.Errorf("no server task ID provided")
+	}
+
+	details, err := opts.GetTaskDetailsCallback(taskIDs[0])
+	if err != nil {
+		return err
+	}
+
+	if opts.ErrorsOnly {
+		details.ActivityLogs = filterErrors(details.ActivityLogs)
+	}
+
+	switch strings.ToLower(opts.OutputFormat) {
+	case constants.OutputFormatJson:
+		data, err := json.MarshalIndent(details, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(opts.Out, string(data))
+		return err
+
+	case constants.OutputFormatTable, constants.OutputFormatBasic, "":
+		formatter := wait.NewTaskOutputFormatter(opts.Out, wait.LogLevelInfo)
+		// this is the full activity log, so steps which succeeded aren't collapsed as they are while waiting
+		formatter.ExpandAllActivities()
+		if details.Task != nil {
+			formatter.PrintTaskInfo(details.Task)
+		}
+		for _, activity := range details.ActivityLogs {
+			formatter.PrintActivityElement("", activity, 0, make(wait.PrintedActivities))
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported output format %s. Valid values are 'json', 'table', 'basic'. Defaults to table", opts.OutputFormat)
+	}
+}
+
+// filterErrors returns copies of the activities keeping only error and fatal log messages, along with the
+// failed activities and those leading to them, so the shape of the tree is preserved
+func filterErrors(activities []*tasks.ActivityElement) []*tasks.ActivityElement {
+	filtered := make([]*tasks.ActivityElement, 0)
+	for _, activity := range activities {
+		if activity == nil {
+			continue
+		}
+		logElements := make([]*tasks.ActivityLogElement, 0)
+		for _, logElement := range activity.LogElements {
+			if logElement == nil {
+				continue
+			}
+			switch strings.ToLower(logElement.Category) {
+			case "error", "fatal":
+				logElements = append(logElements, logElement)
+			}
+		}
+		children := filterErrors(activity.Children)
+
+		if activity.Status != "Failed" && len(logElements) == 0 && len(children) == 0 {
+			continue
+		}
+		activityCopy := *activity
+		activityCopy.LogElements = logElements
+		activityCopy.Children = children
+		filtered = append(filtered, &activityCopy)
+	}
+	return filtered
+}
@@ -0,0 +1,122 @@
+package details_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/OctopusDeploy/cli/pkg/cmd"
+	taskDetails "github.com/OctopusDeploy/cli/pkg/cmd/task/details"
+	"github.com/OctopusDeploy/cli/pkg/constants"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTaskDetails() *tasks.TaskDetailsResource {
+	occurredAt := time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)
+	task := tasks.NewTask()
+	task.ID = "ServerTasks-1"
+	task.Description = "Deploy Bar 1 release 0.0.2 to Foo"
+	task.State = "Failed"
+
+	return &tasks.TaskDetailsResource{
+		Task: task,
+		ActivityLogs: []*tasks.ActivityElement{{
+			ID:     "ServerTasks-1_root",
+			Status: "Failed",
+			Children: []*tasks.ActivityElement{
+				{
+					ID:     "ServerTasks-1_step1",
+					Name:   "Step 1",
+					Status: "Success",
+					Children: []*tasks.ActivityElement{{
+						ID:          "ServerTasks-1_step1_target",
+						Status:      "Success",
+						LogElements: []*tasks.ActivityLogElement{{OccurredAt: occurredAt, Category: "Info", MessageText: "Installed package"}},
+					}},
+				},
+				{
+					ID:     "ServerTasks-1_step2",
+					Name:   "Step 2",
+					Status: "Failed",
+					Children: []*tasks.ActivityElement{{
+						ID:     "ServerTasks-1_step2_target",
+						Status: "Failed",
+						LogElements: []*tasks.ActivityLogElement{
+							{OccurredAt: occurredAt, Category: "Info", MessageText: "Running script"},
+							{OccurredAt: occurredAt, Category: "Error", MessageText: "Script returned exit code 1"},
+						},
+					}},
+				},
+			},
+		}},
+	}
+}
+
+func newDetailsOptions(out *bytes.Buffer) *taskDetails.DetailsOptions {
+	return &taskDetails.DetailsOptions{
+		Dependencies: &cmd.Dependencies{
+			Out: out,
+		},
+		TaskID: "ServerTasks-1",
+		GetTaskDetailsCallback: func(taskID string) (*tasks.TaskDetailsResource, error) {
+			return newTaskDetails(), nil
+		},
+		OutputFormat: constants.OutputFormatTable,
+	}
+}
+
+func TestDetails(t *testing.T) {
+	out := bytes.Buffer{}
+	opts := newDetailsOptions(&out)
+
+	err := taskDetails.DetailsRun(opts)
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Failed\n")
+	assert.Contains(t, out.String(), "Success: Step 1")
+	assert.Contains(t, out.String(), "Installed package")
+	assert.Contains(t, out.String(), "Failed: Step 2")
+	assert.Contains(t, out.String(), "Running script")
+	assert.Contains(t, out.String(), "Script returned exit code 1")
+}
+
+func TestDetails_ErrorsOnly(t *testing.T) {
+	out := bytes.Buffer{}
+	opts := newDetailsOptions(&out)
+	opts.ErrorsOnly = true
+
+	err := taskDetails.DetailsRun(opts)
+	assert.NoError(t, err)
+	assert.NotContains(t, out.String(), "Step 1")
+	assert.NotContains(t, out.String(), "Installed package")
+	assert.Contains(t, out.String(), "Failed: Step 2")
+	assert.NotContains(t, out.String(), "Running script")
+	assert.Contains(t, out.String(), "Script returned exit code 1")
+}
+
+func TestDetails_Json(t *testing.T) {
+	out := bytes.Buffer{}
+	opts := newDetailsOptions(&out)
+	opts.ErrorsOnly = true
+	opts.OutputFormat = constants.OutputFormatJson
+
+	err := taskDetails.DetailsRun(opts)
+	assert.NoError(t, err)
+	var details tasks.TaskDetailsResource
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &details))
+	assert.Equal(t, "ServerTasks-1", details.Task.ID)
+	steps := details.ActivityLogs[0].Children
+	assert.Len(t, steps, 1)
+	assert.Equal(t, "Step 2", steps[0].Name)
+	assert.Len(t, steps[0].Children[0].LogElements, 1)
+	assert.Equal(t, "Script returned exit code 1", steps[0].Children[0].LogElements[0].MessageText)
+}
+
+func TestDetails_InvalidTaskID(t *testing.T) {
+	opts := newDetailsOptions(&bytes.Buffer{})
+	opts.TaskID = "Deployments-1"
+
+	err := taskDetails.DetailsRun(opts)
+	assert.EqualError(t, err, "invalid server task ID(s): Deployments-1; expected IDs in the form ServerTasks-123 or 123")
+}
@@ -0,0 +1,225 @@
+package list
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/OctopusDeploy/cli/pkg/cmd"
+	"github.com/OctopusDeploy/cli/pkg/cmd/task/wait"
+	"github.com/OctopusDeploy/cli/pkg/constants"
+	"github.com/OctopusDeploy/cli/pkg/factory"
+	"github.com/OctopusDeploy/cli/pkg/output"
+	"github.com/OctopusDeploy/cli/pkg/question/selectors"
+	"github.com/OctopusDeploy/cli/pkg/util"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/client"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+	"github.com/spf13/cobra"
+)
+
+const (
+	FlagState       = "state"
+	FlagName        = "name"
+	FlagProject     = "project"
+	FlagEnvironment = "environment"
+	FlagSince       = "since"
+	FlagLimit       = "limit"
+	DefaultLimit    = 30
+)
+
+var environmentIDPattern = regexp.MustCompile(`^Environments-\d+$`)
+
+type ListOptions struct {
+	*cmd.Dependencies
+	ListTasksCallback          ListTasksCallback
+	ResolveProjectCallback     ResolveIDCallback
+	ResolveEnvironmentCallback ResolveIDCallback
+	States                     []string
+	Name                       string
+	Project                    string
+	Environment                string
+	Since                      string
+	Limit                      int
+	OutputFormat               string
+	Now                        func() time.Time
+}
+
+// ListTasksCallback fetches the tasks matching query, stopping after limit tasks if limit is greater than zero. With
+// since, it also stops once it reaches the tasks queued before since, though some of those may still be returned.
+type ListTasksCallback func(query tasks.TasksQuery, since time.Time, limit int) ([]*tasks.Task, error)
+
+// ResolveIDCallback looks up the ID of a resource from its name or ID
+type ResolveIDCallback func(string) (string, error)
+
+func NewListOps(dependencies *cmd.Dependencies) *ListOptions {
+	return &ListOptions{
+		Dependencies:               dependencies,
+		ListTasksCallback:          GetListTasksCallback(dependencies.Client),
+		ResolveProjectCallback:     GetResolveProjectCallback(dependencies.Client),
+		ResolveEnvironmentCallback: GetResolveEnvironmentCallback(dependencies.Client),
+		Limit:                      DefaultLimit,
+		OutputFormat:               constants.OutputFormatTable,
+		Now:                        time.Now,
+	}
+}
+
+func NewCmdList(f factory.Factory) *cobra.Command {
+	var states []string
+	var name string
+	var project string
+	var environment string
+	var since string
+	var limit int
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List tasks",
+		Long:  "List server tasks in Octopus Deploy, most recently queued first",
+		Example: heredoc.Docf(`
+			$ %[1]s task list
+			$ %[1]s task list --state Executing,Queued --project MyProject
+			$ %[1]s task list --environment Production --since 24h --limit 100 --output-format json
+			$ %[1]s task list --state Executing --output-format basic | %[1]s task wait
+		`, constants.ExecutableName),
+		Aliases: []string{"ls"},
+		RunE: func(c *cobra.Command, args []string) error {
+			dependencies := cmd.NewDependencies(f, c)
+			opts := NewListOps(dependencies)
+			opts.States = states
+			opts.Name = name
+			opts.Project = project
+			opts.Environment = environment
+			opts.Since = since
+			opts.Limit = limit
+			if outputFormat, err := c.Flags().GetString(constants.FlagOutputFormat); err == nil {
+				opts.OutputFormat = outputFormat
+			}
+
+			return ListRun(opts)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringSliceVar(&states, FlagState, nil, fmt.Sprintf("Only list tasks in the given state(s). One or more of %s", strings.Join(wait.TaskStates, ", ")))
+	flags.StringVar(&name, FlagName, "", "Only list tasks of the given type, e.g. Deploy or RunbookRun")
+	flags.StringVarP(&project, FlagProject, "p", "", "Only list tasks for the project with the given name or ID")
+	flags.StringVarP(&environment, FlagEnvironment, "e", "", "Only list tasks for the environment with the given name or ID")
+	flags.StringVar(&since, FlagSince, "", "Only list tasks queued since the given duration ago (e.g. 24h) or date (e.g. 2024-01-31 or 2024-01-31T09:00:00Z)")
+	flags.IntVarP(&limit, FlagLimit, "n", DefaultLimit, "Maximum number of tasks to list, or 0 for all of them")
+
+	return cmd
+}
+
+func ListRun(opts *ListOptions) error {
+	if opts.Limit < 0 {
+		return fmt.Errorf("--%s must not be negative", FlagLimit)
+	}
+
+	query := tasks.TasksQuery{Name: opts.Name}
+	if len(opts.States) != 0 {
+		states, err := wait.NormalizeTaskStates(opts.States)
+		if err != nil {
+			return err
+		}
+		query.States = states
+	}
+
+	var since time.Time
+	if opts.Since != "" {
+		var err error
+		since, err = wait.ParseSince(opts.Since, opts.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.Project != "" {
+		projectID, err := opts.ResolveProjectCallback(opts.Project)
+		if err != nil {
+			return err
+		}
+		query.Project = projectID
+	}
+
+	if opts.Environment != "" {
+		environmentID, err := opts.ResolveEnvironmentCallback(opts.Environment)
+		if err != nil {
+			return err
+		}
+		query.Environment = environmentID
+	}
+
+	serverTasks, err := opts.ListTasksCallback(query, since, opts.Limit)
+	if err != nil {
+		return err
+	}
+
+	// the server can't filter by queue time, so the tasks queued before since which were fetched are left out here
+	if !since.IsZero() {
+		serverTasks = util.SliceFilter(serverTasks, func(t *tasks.Task) bool {
+			return t.QueueTime != nil && !t.QueueTime.Before(since)
+		})
+	}
+
+	return printTasks(opts, serverTasks)
+}
+
+func printTasks(opts *ListOptions, serverTasks []*tasks.Task) error {
+	switch strings.ToLower(opts.OutputFormat) {
+	case constants.OutputFormatJson, wait.OutputFormatYaml:
+		results := make([]*wait.TaskResult, 0, len(serverTasks))
+		for _, t := range serverTasks {
+			results = append(results, wait.NewTaskResult(t))
+		}
+		return wait.NewTaskOutputFormatter(opts.Out, wait.LogLevelInfo).PrintResults(results, opts.OutputFormat)
+
+	case constants.OutputFormatBasic:
+		// one ID per line, so the output can be piped into other task commands
+		for _, t := range serverTasks {
+			fmt.Fprintln(opts.Out, t.ID)
+		}
+		return nil
+
+	case constants.OutputFormatTable, "":
+		t := output.NewTable(opts.Out)
+		t.AddRow(output.Bold("ID"), output.Bold("NAME"), output.Bold("STATE"), output.Bold("QUEUED"))
+		for _, task := range serverTasks {
+			queued := ""
+			if task.QueueTime != nil {
+				queued = task.QueueTime.Format(time.RFC1123Z)
+			}
+			t.AddRow(task.ID, task.Description, task.State, queued)
+		}
+		return t.Print()
+
+	default:
+		return fmt.Errorf("unsupported output format %s. Valid values are 'json', 'yaml', 'table', 'basic'. Defaults to table", opts.OutputFormat)
+	}
+}
+
+func GetListTasksCallback(octopus *client.Client) ListTasksCallback {
+	return func(query tasks.TasksQuery, since time.Time, limit int) ([]*tasks.Task, error) {
+		if !since.IsZero() {
+			return wait.QueryTasksSince(octopus, query, since, limit)
+		}
+		return wait.QueryTasks(octopus, query, limit)
+	}
+}
+
+func GetResolveProjectCallback(octopus *client.Client) ResolveIDCallback {
+	return ResolveIDCallback(wait.GetResolveProjectCallback(octopus))
+}
+
+func GetResolveEnvironmentCallback(octopus *client.Client) ResolveIDCallback {
+	return func(environmentIdentifier string) (string, error) {
+		if environmentIDPattern.MatchString(environmentIdentifier) {
+			return environmentIdentifier, nil
+		}
+		environment, err := selectors.FindEnvironment(octopus, environmentIdentifier)
+		if err != nil {
+			return "", err
+		}
+		return environment.GetID(), nil
+	}
+}
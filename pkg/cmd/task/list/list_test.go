@@ -0,0 +1,144 @@
+package list_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/OctopusDeploy/cli/pkg/cmd"
+	taskList "github.com/OctopusDeploy/cli/pkg/cmd/task/list"
+	"github.com/OctopusDeploy/cli/pkg/cmd/task/wait"
+	"github.com/OctopusDeploy/cli/pkg/constants"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+	"github.com/stretchr/testify/assert"
+)
+
+var now = time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)
+
+func newTask(id string, state string, queuedAgo time.Duration) *tasks.Task {
+	queueTime := now.Add(-queuedAgo)
+	task := tasks.NewTask()
+	task.ID = id
+	task.Description = "Deploy " + id
+	task.State = state
+	task.QueueTime = &queueTime
+	return task
+}
+
+func newListOptions(out *bytes.Buffer, listTasksCallback taskList.ListTasksCallback) *taskList.ListOptions {
+	return &taskList.ListOptions{
+		Dependencies: &cmd.Dependencies{
+			Out: out,
+		},
+		ListTasksCallback: listTasksCallback,
+		Limit:             taskList.DefaultLimit,
+		OutputFormat:      constants.OutputFormatTable,
+		Now:               func() time.Time { return now },
+	}
+}
+
+func TestList_Table(t *testing.T) {
+	out := bytes.Buffer{}
+	opts := newListOptions(&out, func(query tasks.TasksQuery, since time.Time, limit int) ([]*tasks.Task, error) {
+		assert.Equal(t, tasks.TasksQuery{}, query)
+		assert.True(t, since.IsZero())
+		assert.Equal(t, taskList.DefaultLimit, limit)
+		return []*tasks.Task{
+			newTask("ServerTasks-2", "Executing", time.Minute),
+			newTask("ServerTasks-1", "Success", time.Hour),
+		}, nil
+	})
+
+	err := taskList.ListRun(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, heredoc.Doc(`
+		ID             NAME                  STATE      QUEUED
+		ServerTasks-2  Deploy ServerTasks-2  Executing  Wed, 31 Jan 2024 11:59:00 +0000
+		ServerTasks-1  Deploy ServerTasks-1  Success    Wed, 31 Jan 2024 11:00:00 +0000
+	`), out.String())
+}
+
+func TestList_Filters(t *testing.T) {
+	out := bytes.Buffer{}
+	wantLimit := 1
+	opts := newListOptions(&out, func(query tasks.TasksQuery, since time.Time, limit int) ([]*tasks.Task, error) {
+		assert.Equal(t, tasks.TasksQuery{
+			Name:        "Deploy",
+			States:      []string{"Executing", "Queued"},
+			Project:     "Projects-1",
+			Environment: "Environments-2",
+		}, query)
+		assert.Equal(t, now.Add(-150*time.Minute), since)
+		assert.Equal(t, wantLimit, limit)
+		// paging stops once tasks were queued before since, so some of those can still come back to be filtered out
+		serverTasks := []*tasks.Task{
+			newTask("ServerTasks-3", "Executing", time.Minute),
+			newTask("ServerTasks-2", "Queued", 2*time.Hour),
+			newTask("ServerTasks-1", "Queued", 3*time.Hour),
+		}
+		if limit > 0 {
+			serverTasks = serverTasks[:limit]
+		}
+		return serverTasks, nil
+	})
+	opts.ResolveProjectCallback = func(project string) (string, error) {
+		assert.Equal(t, "My Project", project)
+		return "Projects-1", nil
+	}
+	opts.ResolveEnvironmentCallback = func(environment string) (string, error) {
+		assert.Equal(t, "Production", environment)
+		return "Environments-2", nil
+	}
+	opts.States = []string{"executing", "Queued"}
+	opts.Name = "Deploy"
+	opts.Project = "My Project"
+	opts.Environment = "Production"
+	opts.Since = "150m"
+	opts.Limit = 1
+	opts.OutputFormat = constants.OutputFormatBasic
+
+	err := taskList.ListRun(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, "ServerTasks-3\n", out.String())
+
+	out.Reset()
+	opts.Limit = 0
+	wantLimit = 0
+	err = taskList.ListRun(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, "ServerTasks-3\nServerTasks-2\n", out.String())
+}
+
+func TestList_Json(t *testing.T) {
+	out := bytes.Buffer{}
+	opts := newListOptions(&out, func(query tasks.TasksQuery, since time.Time, limit int) ([]*tasks.Task, error) {
+		return []*tasks.Task{newTask("ServerTasks-1", "Executing", time.Minute)}, nil
+	})
+	opts.OutputFormat = constants.OutputFormatJson
+
+	err := taskList.ListRun(opts)
+	assert.NoError(t, err)
+	var results []wait.TaskResult
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &results))
+	assert.Equal(t, []wait.TaskResult{{ID: "ServerTasks-1", Name: "Deploy ServerTasks-1", State: "Executing"}}, results)
+}
+
+func TestList_InvalidOptions(t *testing.T) {
+	opts := newListOptions(&bytes.Buffer{}, func(query tasks.TasksQuery, since time.Time, limit int) ([]*tasks.Task, error) {
+		assert.Fail(t, "tasks should not be listed with invalid options")
+		return nil, nil
+	})
+
+	opts.Since = "yesterday"
+	assert.EqualError(t, taskList.ListRun(opts), "invalid --since value yesterday; expected a duration such as 24h or a date such as 2024-01-31")
+
+	opts.Since = ""
+	opts.States = []string{"Running"}
+	assert.EqualError(t, taskList.ListRun(opts), "unknown task state(s): Running; valid states are Queued, Executing, Cancelling, Success, Failed, Canceled, TimedOut")
+
+	opts.States = nil
+	opts.Limit = -1
+	assert.EqualError(t, taskList.ListRun(opts), "--limit must not be negative")
+}
@@ -0,0 +1,152 @@
+package rerun
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/OctopusDeploy/cli/pkg/cmd"
+	"github.com/OctopusDeploy/cli/pkg/cmd/task/wait"
+	"github.com/OctopusDeploy/cli/pkg/constants"
+	"github.com/OctopusDeploy/cli/pkg/factory"
+	"github.com/OctopusDeploy/cli/pkg/util"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/client"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+	"github.com/spf13/cobra"
+)
+
+const (
+	FlagWait     = "wait"
+	FlagProgress = wait.FlagProgress
+	FlagTimeout  = wait.FlagTimeout
+)
+
+type RerunOptions struct {
+	*cmd.Dependencies
+	TaskIDs                []string
+	GetServerTasksCallback wait.ServerTasksCallback
+	RerunTaskCallback      RerunTaskCallback
+	Wait                   bool
+	// WaitOptions configures the wait for the new tasks when Wait is set
+	WaitOptions *wait.WaitOptions
+}
+
+type RerunTaskCallback = wait.RerunTaskCallback
+
+func NewRerunOps(dependencies *cmd.Dependencies, taskIDs []string) *RerunOptions {
+	return &RerunOptions{
+		Dependencies:           dependencies,
+		TaskIDs:                taskIDs,
+		GetServerTasksCallback: wait.GetServerTasksCallback(dependencies.Client),
+		RerunTaskCallback:      GetRerunTaskCallback(dependencies.Client, wait.SpaceID(dependencies)),
+		WaitOptions:            wait.NewWaitOps(dependencies, nil),
+	}
+}
+
+func NewCmdRerun(f factory.Factory) *cobra.Command {
+	var waitForRerun bool
+	var showProgress bool
+	var timeout int
+	cmd := &cobra.Command{
+		Use:   "rerun [TaskIDs]",
+		Short: "Rerun task(s)",
+		Long:  "Rerun a provided list of finished task(s), printing the ID of each new task",
+		Example: heredoc.Docf(`
+			$ %[1]s task rerun ServerTasks-12345
+			$ %[1]s task rerun ServerTasks-12345 --wait --progress
+			$ cat failed-task-ids.txt | %[1]s task rerun
+		`, constants.ExecutableName),
+		RunE: func(c *cobra.Command, args []string) error {
+			taskIDs := make([]string, len(args))
+			copy(taskIDs, args)
+			taskIDs = append(taskIDs, util.ReadValuesFromPipe()...)
+
+			dependencies := cmd.NewDependencies(f, c)
+			opts := NewRerunOps(dependencies, taskIDs)
+			opts.Wait = waitForRerun
+			opts.WaitOptions.Context = c.Context()
+			opts.WaitOptions.ShowProgress = showProgress
+			opts.WaitOptions.Timeout = timeout
+
+			return RerunRun(opts)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.BoolVar(&waitForRerun, FlagWait, false, "Wait for the new task(s) to finish")
+	flags.BoolVar(&showProgress, FlagProgress, false, "Show detailed progress of the new task(s) while waiting")
+	flags.IntVar(&timeout, FlagTimeout, wait.DefaultTimeout, "Duration to wait (in seconds) for the new task(s) to finish")
+
+	return cmd
+}
+
+func RerunRun(opts *RerunOptions) error {
+	taskIDs, err := wait.NormalizeTaskIDs(opts.TaskIDs)
+	if err != nil {
+		return err
+	}
+	if len(taskIDs) == 0 {
+		return fmt.Errorf("no server task IDs provided, at least one is required")
+	}
+
+	if opts.WaitOptions != nil && opts.WaitOptions.ShowProgress && !opts.Wait {
+		return fmt.Errorf("--%s can only be used with --%s", FlagProgress, FlagWait)
+	}
+
+	// check every task up front, so we don't rerun some of them and then stop part way through
+	sourceTasks, err := opts.GetServerTasksCallback(taskIDs)
+	if err != nil {
+		return err
+	}
+	if err := validateRerunnable(taskIDs, sourceTasks); err != nil {
+		return err
+	}
+
+	newTaskIDs := make([]string, 0, len(taskIDs))
+	for _, taskID := range taskIDs {
+		newTask, err := opts.RerunTaskCallback(taskID)
+		if err != nil {
+			return fmt.Errorf("failed to rerun %s: %w", taskID, err)
+		}
+		newTaskIDs = append(newTaskIDs, newTask.ID)
+		fmt.Fprintf(opts.Out, "%s -> %s\n", taskID, newTask.ID)
+	}
+
+	if opts.Wait {
+		waitOpts := opts.WaitOptions
+		waitOpts.TaskIDs = newTaskIDs
+		return wait.WaitRun(waitOpts)
+	}
+	return nil
+}
+
+// validateRerunnable returns an error describing every task which can't be rerun, either because it
+// doesn't exist, is still running, or the server doesn't allow it
+func validateRerunnable(taskIDs []string, sourceTasks []*tasks.Task) error {
+	tasksByID := make(map[string]*tasks.Task, len(sourceTasks))
+	for _, t := range sourceTasks {
+		tasksByID[t.ID] = t
+	}
+
+	problems := make([]string, 0)
+	for _, taskID := range taskIDs {
+		t, ok := tasksByID[taskID]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s was not found", taskID))
+		case t.IsCompleted == nil || !*t.IsCompleted:
+			problems = append(problems, fmt.Sprintf("%s is %s; only finished tasks can be rerun", taskID, t.State))
+		case !t.CanRerun:
+			problems = append(problems, fmt.Sprintf("%s (%s) cannot be rerun", taskID, t.State))
+		}
+	}
+
+	if len(problems) != 0 {
+		return fmt.Errorf("cannot rerun task(s):\n%s", strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+func GetRerunTaskCallback(octopus *client.Client, spaceID string) RerunTaskCallback {
+	return wait.GetRerunTaskCallback(octopus, spaceID)
+}
@@ -0,0 +1,133 @@
+package rerun_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/OctopusDeploy/cli/pkg/cmd"
+	taskRerun "github.com/OctopusDeploy/cli/pkg/cmd/task/rerun"
+	"github.com/OctopusDeploy/cli/pkg/cmd/task/wait"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTask(id string, state string, isCompleted bool, canRerun bool) *tasks.Task {
+	finishedSuccessfully := state == "Success"
+	task := tasks.NewTask()
+	task.ID = id
+	task.Description = "Deploy " + id
+	task.State = state
+	task.IsCompleted = &isCompleted
+	task.FinishedSuccessfully = &finishedSuccessfully
+	task.CanRerun = canRerun
+	return task
+}
+
+func TestRerun(t *testing.T) {
+	out := bytes.Buffer{}
+	getServerTaskCallback := func(taskIDs []string) ([]*tasks.Task, error) {
+		assert.Equal(t, []string{"ServerTasks-1", "ServerTasks-2"}, taskIDs)
+		return []*tasks.Task{
+			newTask("ServerTasks-1", "Failed", true, true),
+			newTask("ServerTasks-2", "TimedOut", true, true),
+		}, nil
+	}
+	newTaskIDs := map[string]string{"ServerTasks-1": "ServerTasks-11", "ServerTasks-2": "ServerTasks-12"}
+	rerunTaskCallback := func(taskID string) (*tasks.Task, error) {
+		return newTask(newTaskIDs[taskID], "Queued", false, false), nil
+	}
+
+	opts := &taskRerun.RerunOptions{
+		Dependencies: &cmd.Dependencies{
+			Out: &out,
+		},
+		TaskIDs:                []string{"ServerTasks-1", "ServerTasks-2"},
+		GetServerTasksCallback: getServerTaskCallback,
+		RerunTaskCallback:      rerunTaskCallback,
+	}
+
+	err := taskRerun.RerunRun(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, heredoc.Doc(`
+		ServerTasks-1 -> ServerTasks-11
+		ServerTasks-2 -> ServerTasks-12
+	`), out.String())
+}
+
+func TestRerun_NotRerunnable(t *testing.T) {
+	getServerTaskCallback := func(taskIDs []string) ([]*tasks.Task, error) {
+		return []*tasks.Task{
+			newTask("ServerTasks-1", "Executing", false, false),
+			newTask("ServerTasks-2", "Success", true, false),
+			newTask("ServerTasks-4", "Failed", true, true),
+		}, nil
+	}
+	rerunTaskCallback := func(taskID string) (*tasks.Task, error) {
+		assert.Fail(t, "no tasks should be rerun when any of them can't be")
+		return nil, nil
+	}
+
+	opts := &taskRerun.RerunOptions{
+		Dependencies: &cmd.Dependencies{
+			Out: &bytes.Buffer{},
+		},
+		TaskIDs:                []string{"ServerTasks-1", "ServerTasks-2", "ServerTasks-3", "ServerTasks-4"},
+		GetServerTasksCallback: getServerTaskCallback,
+		RerunTaskCallback:      rerunTaskCallback,
+	}
+
+	err := taskRerun.RerunRun(opts)
+	assert.EqualError(t, err, heredoc.Doc(`
+		cannot rerun task(s):
+		ServerTasks-1 is Executing; only finished tasks can be rerun
+		ServerTasks-2 (Success) cannot be rerun
+		ServerTasks-3 was not found`))
+}
+
+func TestRerun_Wait(t *testing.T) {
+	out := bytes.Buffer{}
+	boolTrue := true
+
+	rerunTask := newTask("ServerTasks-11", "Queued", false, false)
+	getServerTaskCallback := func(taskIDs []string) ([]*tasks.Task, error) {
+		return []*tasks.Task{newTask("ServerTasks-1", "Failed", true, true)}, nil
+	}
+	rerunTaskCallback := func(taskID string) (*tasks.Task, error) {
+		return rerunTask, nil
+	}
+	timesCalled := 0
+	waitServerTaskCallback := func(taskIDs []string) ([]*tasks.Task, error) {
+		timesCalled++
+		assert.Equal(t, []string{"ServerTasks-11"}, taskIDs)
+		if timesCalled > 1 {
+			rerunTask.IsCompleted = &boolTrue
+			rerunTask.FinishedSuccessfully = &boolTrue
+			rerunTask.State = "Success"
+		}
+		return []*tasks.Task{rerunTask}, nil
+	}
+
+	dependencies := &cmd.Dependencies{
+		Out: &out,
+	}
+	opts := &taskRerun.RerunOptions{
+		Dependencies:           dependencies,
+		TaskIDs:                []string{"ServerTasks-1"},
+		GetServerTasksCallback: getServerTaskCallback,
+		RerunTaskCallback:      rerunTaskCallback,
+		Wait:                   true,
+		WaitOptions: &wait.WaitOptions{
+			Dependencies:           dependencies,
+			GetServerTasksCallback: waitServerTaskCallback,
+			Timeout:                wait.DefaultTimeout,
+			PollInterval:           1,
+			MaxPollInterval:        1,
+		},
+	}
+
+	err := taskRerun.RerunRun(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, timesCalled)
+	assert.Contains(t, out.String(), "ServerTasks-1 -> ServerTasks-11\nServerTasks-11: Deploy ServerTasks-11: Queued\nServerTasks-11: Deploy ServerTasks-11: Success\n")
+}
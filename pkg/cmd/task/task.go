@@ -1,6 +1,10 @@
 package config
 
 import (
+	cancelCmd "github.com/OctopusDeploy/cli/pkg/cmd/task/cancel"
+	detailsCmd "github.com/OctopusDeploy/cli/pkg/cmd/task/details"
+	listCmd "github.com/OctopusDeploy/cli/pkg/cmd/task/list"
+	rerunCmd "github.com/OctopusDeploy/cli/pkg/cmd/task/rerun"
 	waitCmd "github.com/OctopusDeploy/cli/pkg/cmd/task/wait"
 	"github.com/OctopusDeploy/cli/pkg/constants/annotations"
 	"github.com/OctopusDeploy/cli/pkg/factory"
@@ -17,6 +21,10 @@ func NewCmdTask(f factory.Factory) *cobra.Command {
 		},
 	}
 
+	cmd.AddCommand(cancelCmd.NewCmdCancel(f))
+	cmd.AddCommand(detailsCmd.NewCmdDetails(f))
+	cmd.AddCommand(listCmd.NewCmdList(f))
+	cmd.AddCommand(rerunCmd.NewCmdRerun(f))
 	cmd.AddCommand(waitCmd.NewCmdWait(f))
 
 	return cmd
@@ -0,0 +1,144 @@
+package wait
+
+import (
+	"sync"
+	"time"
+
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+)
+
+// the kinds of API call made while waiting, in the order they are reported
+const (
+	apiCallGetTasks       = "Fetch tasks by ID"
+	apiCallGetTaskDetails = "Fetch task details"
+	apiCallQueryTasks     = "Query tasks"
+)
+
+var apiCalls = []string{apiCallGetTasks, apiCallGetTaskDetails, apiCallQueryTasks}
+
+// apiCallStats summarizes the calls of one kind
+type apiCallStats struct {
+	count int
+	total time.Duration
+	min   time.Duration
+	max   time.Duration
+}
+
+func (s *apiCallStats) add(duration time.Duration) {
+	if s.count == 0 || duration < s.min {
+		s.min = duration
+	}
+	if duration > s.max {
+		s.max = duration
+	}
+	s.count++
+	s.total += duration
+}
+
+func (s *apiCallStats) average() time.Duration {
+	if s.count == 0 {
+		return 0
+	}
+	return s.total / time.Duration(s.count)
+}
+
+// apiProfile records how long the API calls made while waiting take, so that a slow server can be told apart from
+// a slow client. Details are fetched by several workers at once, so everything is guarded by a mutex.
+type apiProfile struct {
+	mutex sync.Mutex
+	calls map[string]*apiCallStats
+	// polls is the total time spent in API calls by each poll, the first being the initial fetch of the tasks
+	polls []time.Duration
+}
+
+func newAPIProfile() *apiProfile {
+	return &apiProfile{
+		calls: make(map[string]*apiCallStats),
+		polls: []time.Duration{0},
+	}
+}
+
+func (p *apiProfile) record(call string, duration time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	stats, ok := p.calls[call]
+	if !ok {
+		stats = &apiCallStats{}
+		p.calls[call] = stats
+	}
+	stats.add(duration)
+	p.polls[len(p.polls)-1] += duration
+}
+
+func (p *apiProfile) startPoll() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.polls = append(p.polls, 0)
+}
+
+// pollStats summarizes the API time of each poll as if each poll were a single call
+func (p *apiProfile) pollStats() apiCallStats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	stats := apiCallStats{}
+	for _, duration := range p.polls {
+		stats.add(duration)
+	}
+	return stats
+}
+
+// callStats returns a copy of the stats of each kind of call which was made, keyed by kind
+func (p *apiProfile) callStats() map[string]apiCallStats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	calls := make(map[string]apiCallStats, len(p.calls))
+	for call, stats := range p.calls {
+		calls[call] = *stats
+	}
+	return calls
+}
+
+// addAPIProfile records the duration of each API call made while waiting in profile, timed by the Clock of config. It is
+// only added when profiling, so normal waits don't pay for the bookkeeping.
+func addAPIProfile(config *WaitConfig, profile *apiProfile) {
+	clock := config.Clock
+	onPoll := config.OnPoll
+	config.OnPoll = func(pendingTaskIDs []string) {
+		profile.startPoll()
+		if onPoll != nil {
+			onPoll(pendingTaskIDs)
+		}
+	}
+
+	if getServerTasks := config.GetServerTasksCallback; getServerTasks != nil {
+		config.GetServerTasksCallback = func(taskIDs []string) ([]*tasks.Task, error) {
+			started := clock.Now()
+			defer func() { profile.record(apiCallGetTasks, clock.Now().Sub(started)) }()
+			return getServerTasks(taskIDs)
+		}
+	}
+
+	if queryTasks := config.QueryTasksCallback; queryTasks != nil {
+		config.QueryTasksCallback = func(query tasks.TasksQuery) ([]*tasks.Task, error) {
+			started := clock.Now()
+			defer func() { profile.record(apiCallQueryTasks, clock.Now().Sub(started)) }()
+			return queryTasks(query)
+		}
+	}
+
+	if queryRecentTasks := config.QueryRecentTasksCallback; queryRecentTasks != nil {
+		config.QueryRecentTasksCallback = func(query RecentTasksQuery) ([]*tasks.Task, error) {
+			started := clock.Now()
+			defer func() { profile.record(apiCallQueryTasks, clock.Now().Sub(started)) }()
+			return queryRecentTasks(query)
+		}
+	}
+
+	if getTaskDetails := config.GetTaskDetailsCallback; getTaskDetails != nil {
+		config.GetTaskDetailsCallback = func(taskID string) (*tasks.TaskDetailsResource, error) {
+			started := clock.Now()
+			defer func() { profile.record(apiCallGetTaskDetails, clock.Now().Sub(started)) }()
+			return getTaskDetails(taskID)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package wait
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIProfile(t *testing.T) {
+	profile := newAPIProfile()
+
+	// the initial fetch, followed by two polls
+	profile.record(apiCallGetTasks, 120*time.Millisecond)
+	profile.startPoll()
+	profile.record(apiCallGetTasks, 80*time.Millisecond)
+	profile.record(apiCallGetTaskDetails, 200*time.Millisecond)
+	profile.record(apiCallGetTaskDetails, 400*time.Millisecond)
+	profile.startPoll()
+	profile.record(apiCallGetTasks, 100*time.Millisecond)
+
+	out := bytes.Buffer{}
+	formatter := NewTaskOutputFormatter(&out, LogLevelError)
+	assert.NoError(t, formatter.PrintAPIProfile(profile))
+
+	assert.Equal(t, "\n"+
+		"API CALL            CALLS  TOTAL  MIN    AVG    MAX\n"+
+		"Fetch tasks by ID   3      300ms  80ms   100ms  120ms\n"+
+		"Fetch task details  2      600ms  200ms  300ms  400ms\n"+
+		"Per poll            3      900ms  100ms  300ms  680ms\n", out.String())
+}
@@ -0,0 +1,50 @@
+package wait
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	backoffMultiplier = 1.5
+	backoffJitter     = 0.2
+)
+
+// pollBackoff computes the delay between successive polls of the server. The delay starts at
+// the initial interval and grows multiplicatively up to the maximum interval, with a random
+// jitter applied to each delay so that many concurrent waits don't poll in lockstep.
+type pollBackoff struct {
+	initial time.Duration
+	max     time.Duration
+	current time.Duration
+	random  func() float64
+}
+
+func newPollBackoff(initial time.Duration, max time.Duration) *pollBackoff {
+	return &pollBackoff{
+		initial: initial,
+		max:     max,
+		current: initial,
+		random:  rand.Float64,
+	}
+}
+
+// Next returns the delay to use before the next poll and advances the backoff.
+func (b *pollBackoff) Next() time.Duration {
+	delay := b.current
+
+	b.current = time.Duration(float64(b.current) * backoffMultiplier)
+	if b.current > b.max {
+		b.current = b.max
+	}
+
+	// random() is in [0, 1), so this scales the delay by a factor in [1-jitter, 1+jitter)
+	jitter := 1 + backoffJitter*(2*b.random()-1)
+	return time.Duration(float64(delay) * jitter)
+}
+
+// Reset returns the backoff to its initial interval, typically because a task changed state
+// and further changes are likely to follow soon.
+func (b *pollBackoff) Reset() {
+	b.current = b.initial
+}
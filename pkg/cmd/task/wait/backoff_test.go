@@ -0,0 +1,39 @@
+package wait
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPollBackoff_GrowsUpToMax(t *testing.T) {
+	b := newPollBackoff(2*time.Second, 5*time.Second)
+	b.random = func() float64 { return 0.5 } // no jitter
+
+	assert.Equal(t, 2*time.Second, b.Next())
+	assert.Equal(t, 3*time.Second, b.Next())
+	assert.Equal(t, 4500*time.Millisecond, b.Next())
+	assert.Equal(t, 5*time.Second, b.Next())
+	assert.Equal(t, 5*time.Second, b.Next())
+}
+
+func TestPollBackoff_Reset(t *testing.T) {
+	b := newPollBackoff(2*time.Second, 30*time.Second)
+	b.random = func() float64 { return 0.5 }
+
+	b.Next()
+	b.Next()
+	b.Reset()
+	assert.Equal(t, 2*time.Second, b.Next())
+}
+
+func TestPollBackoff_Jitter(t *testing.T) {
+	b := newPollBackoff(10*time.Second, 10*time.Second)
+
+	b.random = func() float64 { return 0 }
+	assert.Equal(t, 8*time.Second, b.Next())
+
+	b.random = func() float64 { return 0.75 }
+	assert.Equal(t, 11*time.Second, b.Next())
+}
@@ -0,0 +1,26 @@
+package wait
+
+import "time"
+
+// Clock tells the time and waits for it to pass on behalf of a wait, so that tests can drive the polls, timeouts and
+// heartbeats of a wait through time rather than sitting through it
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the clock a wait uses unless it is given another
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
@@ -0,0 +1,113 @@
+package wait
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OctopusDeploy/cli/pkg/apiclient"
+	"github.com/OctopusDeploy/cli/pkg/constants"
+	"github.com/OctopusDeploy/cli/pkg/factory"
+	"github.com/OctopusDeploy/cli/pkg/util"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/client"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// MaxTaskIDCompletions is the most task IDs suggested when completing the tasks to wait for
+const MaxTaskIDCompletions = 50
+
+// CompletionTimeout is how long completing task IDs waits for the server before giving up without suggestions
+const CompletionTimeout = 3 * time.Second
+
+// taskIDCompleter suggests the tasks to wait for. The tasks are fetched the first time it is asked, and not again.
+type taskIDCompleter struct {
+	// fetch finds at most limit tasks to suggest
+	fetch   func(limit int) ([]*tasks.Task, error)
+	limit   int
+	timeout time.Duration
+	// clock times out the fetch
+	clock Clock
+
+	once  sync.Once
+	found []*tasks.Task
+}
+
+// complete suggests the tasks starting with toComplete which haven't been given already, each with its description
+// and state. A server which can't be reached, or doesn't answer in time, leaves nothing to suggest rather than
+// printing an error in the middle of the command line.
+func (c *taskIDCompleter) complete(args []string, toComplete string) []string {
+	c.once.Do(func() {
+		fetched := make(chan []*tasks.Task, 1)
+		go func() {
+			found, err := c.fetch(c.limit)
+			if err != nil {
+				found = nil
+			}
+			fetched <- found
+		}()
+		select {
+		case c.found = <-fetched:
+		case <-c.clock.After(c.timeout):
+		}
+	})
+
+	completions := make([]string, 0, len(c.found))
+	for _, t := range c.found {
+		if util.SliceContains(args, t.ID) || !strings.HasPrefix(strings.ToLower(t.ID), strings.ToLower(toComplete)) {
+			continue
+		}
+		completions = append(completions, fmt.Sprintf("%s\t%s (%s)", t.ID, t.Description, t.State))
+	}
+	return completions
+}
+
+// newTaskIDCompletion returns the ValidArgsFunction of task wait, which suggests running tasks and then the most
+// recent finished ones
+func newTaskIDCompletion(f factory.Factory) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	completer := &taskIDCompleter{limit: MaxTaskIDCompletions, timeout: CompletionTimeout, clock: realClock{}}
+	return func(c *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if completer.fetch == nil {
+			completer.fetch = func(limit int) ([]*tasks.Task, error) {
+				// the root command set up the client before the flags of this one were parsed, so it is told about
+				// them again, such as a --space to complete the tasks of
+				if preRun := c.Root().PersistentPreRun; preRun != nil {
+					preRun(c, args)
+				}
+				// without a space, getting a client prompts for one, which completing can't answer
+				if viper.GetString(constants.ConfigSpace) == "" {
+					return nil, nil
+				}
+				octopus, err := f.GetSpacedClient(apiclient.NewRequester(c))
+				if err != nil {
+					return nil, err
+				}
+				return fetchCompletionTasks(octopus, limit)
+			}
+		}
+		return completer.complete(args, toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// fetchCompletionTasks fetches the running tasks, followed by the most recent finished ones, up to limit tasks
+func fetchCompletionTasks(octopus *client.Client, limit int) ([]*tasks.Task, error) {
+	running, err := QueryTasks(octopus, tasks.TasksQuery{States: runningTaskStates}, limit)
+	if err != nil || len(running) >= limit {
+		return running, err
+	}
+	recent, err := QueryTasks(octopus, tasks.TasksQuery{}, limit)
+	if err != nil {
+		return running, nil
+	}
+	for _, t := range recent {
+		if len(running) == limit {
+			break
+		}
+		if !util.SliceContainsAny(running, func(r *tasks.Task) bool { return r.ID == t.ID }) {
+			running = append(running, t)
+		}
+	}
+	return running, nil
+}
@@ -0,0 +1,72 @@
+package wait
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/OctopusDeploy/cli/test/testutil"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskIDCompleter_Complete(t *testing.T) {
+	fetches := 0
+	completer := &taskIDCompleter{
+		fetch: func(limit int) ([]*tasks.Task, error) {
+			fetches++
+			assert.Equal(t, 10, limit)
+			return []*tasks.Task{
+				testutil.NewFakeTask("ServerTasks-12", "Deploy Bar 1 release 0.0.2 to Foo", "Executing"),
+				testutil.NewFakeTask("ServerTasks-13", "Deploy Bar 2 release 0.0.2 to Foo", "Queued"),
+				testutil.NewFakeTask("ServerTasks-2", "Deploy Bar 3 release 0.0.2 to Foo", "Success"),
+			}, nil
+		},
+		limit:   10,
+		timeout: time.Second,
+		clock:   realClock{},
+	}
+
+	assert.Equal(t, []string{
+		"ServerTasks-12\tDeploy Bar 1 release 0.0.2 to Foo (Executing)",
+		"ServerTasks-13\tDeploy Bar 2 release 0.0.2 to Foo (Queued)",
+		"ServerTasks-2\tDeploy Bar 3 release 0.0.2 to Foo (Success)",
+	}, completer.complete(nil, ""))
+
+	// tasks already given aren't suggested again, and only those starting with what has been typed so far are
+	assert.Equal(t, []string{
+		"ServerTasks-13\tDeploy Bar 2 release 0.0.2 to Foo (Queued)",
+	}, completer.complete([]string{"ServerTasks-12"}, "servertasks-1"))
+	assert.Equal(t, 1, fetches)
+}
+
+func TestTaskIDCompleter_ServerUnavailable(t *testing.T) {
+	completer := &taskIDCompleter{
+		fetch: func(limit int) ([]*tasks.Task, error) {
+			return nil, errors.New("dial tcp: connection refused")
+		},
+		limit:   10,
+		timeout: time.Second,
+		clock:   realClock{},
+	}
+	assert.Empty(t, completer.complete(nil, ""))
+
+	// a server which doesn't answer in time is no better than one which can't be reached
+	answer := make(chan struct{})
+	defer close(answer)
+	clock := testutil.NewFakeClock(time.Date(2024, 1, 31, 18, 0, 0, 0, time.UTC))
+	completer = &taskIDCompleter{
+		fetch: func(limit int) ([]*tasks.Task, error) {
+			<-answer
+			return []*tasks.Task{testutil.NewFakeTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing")}, nil
+		},
+		limit:   10,
+		timeout: CompletionTimeout,
+		clock:   clock,
+	}
+	go func() {
+		clock.BlockUntilTimers(1)
+		clock.Advance(CompletionTimeout)
+	}()
+	assert.Empty(t, completer.complete(nil, ""))
+}
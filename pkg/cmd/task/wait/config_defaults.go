@@ -0,0 +1,73 @@
+package wait
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/OctopusDeploy/cli/pkg/constants"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// configDefault is a flag which takes its default from the CLI config when it isn't given. The config's setting
+// comes from the environment variable if it is set, or else the config file.
+type configDefault struct {
+	flag string
+	key  string
+	env  string
+}
+
+// configDefaults are the flags which take their defaults from the CLI config, which takes precedence over the
+// built-in defaults but never over a flag given on the command line
+var configDefaults = []configDefault{
+	{flag: FlagTimeout, key: constants.ConfigWaitTimeout, env: constants.EnvTaskWaitTimeout},
+	{flag: FlagPollInterval, key: constants.ConfigWaitPollInterval, env: constants.EnvTaskWaitPollInterval},
+}
+
+// applyConfigDefaults sets each of the configDefaults flags which wasn't given on the command line from config. A
+// malformed setting is an error rather than being ignored, since it was most likely meant to apply. The flags are
+// still reported as not changed afterwards, so that a setting from config is only ever taken as a default.
+func applyConfigDefaults(flags *pflag.FlagSet, config *viper.Viper) error {
+	for _, d := range configDefaults {
+		if flags.Changed(d.flag) || !config.IsSet(d.key) {
+			continue
+		}
+		value := config.GetString(d.key)
+		// the flag is only set once the value is known to be good, as pflag zeroes an int flag given a bad one
+		if seconds, err := strconv.Atoi(value); err != nil || seconds < 0 {
+			if _, ok := os.LookupEnv(d.env); ok {
+				return fmt.Errorf("invalid %s environment variable %q for --%s, expected a number of seconds", d.env, value, d.flag)
+			}
+			return fmt.Errorf("invalid %s setting %q for --%s, expected a number of seconds", d.key, value, d.flag)
+		}
+		// set through its value rather than flags.Set, which would mark it as given on the command line
+		if err := flags.Lookup(d.flag).Value.Set(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commandTimeout is the timeout of a wait run from the command line. --deadline and --watch replace the default
+// timeout, including one from config; only a --timeout given alongside them still applies.
+func commandTimeout(flags *pflag.FlagSet, timeout int, deadline string, watch bool) int {
+	if (deadline != "" || watch) && !flags.Changed(FlagTimeout) {
+		return 0
+	}
+	return timeout
+}
+
+// commandPollIntervals are the poll interval and longest poll interval of a wait run from the command line. Without
+// --max-poll-interval, the longest poll interval is never shorter than the poll interval, however long that is and
+// wherever it came from; without --poll-interval, a poll interval from config is cut down to a --max-poll-interval.
+// Only when both are given can they disagree.
+func commandPollIntervals(flags *pflag.FlagSet, pollInterval int, maxPollInterval int) (int, int) {
+	if !flags.Changed(FlagMaxPollInterval) {
+		return pollInterval, max(pollInterval, maxPollInterval)
+	}
+	if !flags.Changed(FlagPollInterval) {
+		return min(pollInterval, maxPollInterval), maxPollInterval
+	}
+	return pollInterval, maxPollInterval
+}
@@ -0,0 +1,140 @@
+package wait
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/OctopusDeploy/cli/pkg/constants"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// newConfigDefaultsFixture returns the timeout flags as task wait has them, parsed from args, and a config with
+// the given config file, bound to the environment variables as the CLI's config is
+func newConfigDefaultsFixture(t *testing.T, configFile string, args ...string) (*pflag.FlagSet, *int, *int, *viper.Viper) {
+	flags := pflag.NewFlagSet("wait", pflag.ContinueOnError)
+	timeout := flags.Int(FlagTimeout, DefaultTimeout, "")
+	pollInterval := flags.Int(FlagPollInterval, DefaultPollInterval, "")
+	assert.NoError(t, flags.Parse(args))
+
+	config := viper.New()
+	config.SetConfigType("json")
+	assert.NoError(t, config.ReadConfig(strings.NewReader(configFile)))
+	assert.NoError(t, config.BindEnv(constants.ConfigWaitTimeout, constants.EnvTaskWaitTimeout))
+	assert.NoError(t, config.BindEnv(constants.ConfigWaitPollInterval, constants.EnvTaskWaitPollInterval))
+	return flags, timeout, pollInterval, config
+}
+
+func TestApplyConfigDefaults_Precedence(t *testing.T) {
+	// built-in defaults, without any config
+	flags, timeout, pollInterval, config := newConfigDefaultsFixture(t, `{}`)
+	assert.NoError(t, applyConfigDefaults(flags, config))
+	assert.Equal(t, DefaultTimeout, *timeout)
+	assert.Equal(t, DefaultPollInterval, *pollInterval)
+
+	// the config file overrides the built-in defaults
+	flags, timeout, pollInterval, config = newConfigDefaultsFixture(t, `{"WaitTimeout": 1800, "WaitPollInterval": 10}`)
+	assert.NoError(t, applyConfigDefaults(flags, config))
+	assert.Equal(t, 1800, *timeout)
+	assert.Equal(t, 10, *pollInterval)
+
+	// environment variables override the config file
+	t.Setenv(constants.EnvTaskWaitTimeout, "3600")
+	flags, timeout, pollInterval, config = newConfigDefaultsFixture(t, `{"WaitTimeout": 1800, "WaitPollInterval": 10}`)
+	assert.NoError(t, applyConfigDefaults(flags, config))
+	assert.Equal(t, 3600, *timeout)
+	assert.Equal(t, 10, *pollInterval)
+
+	// flags given on the command line override everything, even when they're given the built-in default
+	flags, timeout, pollInterval, config = newConfigDefaultsFixture(t, `{"WaitTimeout": 1800, "WaitPollInterval": 10}`, "--timeout", "0", "--poll-interval", "2")
+	assert.NoError(t, applyConfigDefaults(flags, config))
+	assert.Equal(t, 0, *timeout)
+	assert.Equal(t, DefaultPollInterval, *pollInterval)
+}
+
+func TestApplyConfigDefaults_Invalid(t *testing.T) {
+	flags, timeout, _, config := newConfigDefaultsFixture(t, `{"WaitTimeout": "-5"}`)
+	assert.EqualError(t, applyConfigDefaults(flags, config), `invalid WaitTimeout setting "-5" for --timeout, expected a number of seconds`)
+	assert.Equal(t, DefaultTimeout, *timeout)
+
+	// a malformed environment variable is reported as such, rather than as the config file's setting
+	t.Setenv(constants.EnvTaskWaitPollInterval, "ten")
+	flags, _, pollInterval, config := newConfigDefaultsFixture(t, `{"WaitPollInterval": 10}`)
+	assert.EqualError(t, applyConfigDefaults(flags, config), `invalid OCTOPUS_TASK_WAIT_POLL_INTERVAL environment variable "ten" for --poll-interval, expected a number of seconds`)
+	assert.Equal(t, DefaultPollInterval, *pollInterval)
+
+	// a bad setting doesn't matter when the flag is given
+	flags, _, pollInterval, config = newConfigDefaultsFixture(t, `{}`, "--poll-interval", "5")
+	assert.NoError(t, applyConfigDefaults(flags, config))
+	assert.Equal(t, 5, *pollInterval)
+}
+
+func TestApplyConfigDefaults_NotGivenOnTheCommandLine(t *testing.T) {
+	flags, timeout, _, config := newConfigDefaultsFixture(t, `{"WaitTimeout": 1800}`)
+	assert.NoError(t, applyConfigDefaults(flags, config))
+	assert.Equal(t, 1800, *timeout)
+	assert.False(t, flags.Changed(FlagTimeout))
+
+	// --watch and --deadline replace a timeout from config as they do the built-in default
+	assert.Equal(t, 0, commandTimeout(flags, *timeout, "", true))
+	assert.Equal(t, 0, commandTimeout(flags, *timeout, "2024-01-31T09:00:00Z", false))
+	assert.Equal(t, 1800, commandTimeout(flags, *timeout, "", false))
+
+	// the same goes for one from the environment
+	t.Setenv(constants.EnvTaskWaitTimeout, "3600")
+	flags, timeout, _, config = newConfigDefaultsFixture(t, `{}`)
+	assert.NoError(t, applyConfigDefaults(flags, config))
+	assert.False(t, flags.Changed(FlagTimeout))
+	assert.Equal(t, 0, commandTimeout(flags, *timeout, "", true))
+
+	// while a --timeout given alongside them still applies
+	flags, timeout, _, config = newConfigDefaultsFixture(t, `{"WaitTimeout": 1800}`, "--timeout", "60")
+	assert.NoError(t, applyConfigDefaults(flags, config))
+	assert.Equal(t, 60, commandTimeout(flags, *timeout, "", true))
+	assert.Equal(t, 60, commandTimeout(flags, *timeout, "2024-01-31T09:00:00Z", false))
+}
+
+func TestCommandPollIntervals(t *testing.T) {
+	newFlags := func(args ...string) (*pflag.FlagSet, *int, *int) {
+		flags := pflag.NewFlagSet("wait", pflag.ContinueOnError)
+		pollInterval := flags.Int(FlagPollInterval, DefaultPollInterval, "")
+		maxPollInterval := flags.Int(FlagMaxPollInterval, DefaultMaxPollInterval, "")
+		assert.NoError(t, flags.Parse(args))
+		return flags, pollInterval, maxPollInterval
+	}
+
+	flags, pollInterval, maxPollInterval := newFlags()
+	pollIntervalSeconds, maxPollIntervalSeconds := commandPollIntervals(flags, *pollInterval, *maxPollInterval)
+	assert.Equal(t, DefaultPollInterval, pollIntervalSeconds)
+	assert.Equal(t, DefaultMaxPollInterval, maxPollIntervalSeconds)
+
+	// a poll interval longer than the default longest one raises it, rather than being refused
+	flags, pollInterval, maxPollInterval = newFlags("--poll-interval", "60")
+	pollIntervalSeconds, maxPollIntervalSeconds = commandPollIntervals(flags, *pollInterval, *maxPollInterval)
+	assert.Equal(t, 60, pollIntervalSeconds)
+	assert.Equal(t, 60, maxPollIntervalSeconds)
+
+	// as does one from config, which isn't given on the command line either
+	t.Setenv(constants.EnvTaskWaitPollInterval, "60")
+	config := viper.New()
+	assert.NoError(t, config.BindEnv(constants.ConfigWaitPollInterval, constants.EnvTaskWaitPollInterval))
+	flags, pollInterval, maxPollInterval = newFlags()
+	assert.NoError(t, applyConfigDefaults(flags, config))
+	pollIntervalSeconds, maxPollIntervalSeconds = commandPollIntervals(flags, *pollInterval, *maxPollInterval)
+	assert.Equal(t, 60, pollIntervalSeconds)
+	assert.Equal(t, 60, maxPollIntervalSeconds)
+
+	// while one from config longer than a --max-poll-interval is cut down to it
+	flags, pollInterval, maxPollInterval = newFlags("--max-poll-interval", "10")
+	assert.NoError(t, applyConfigDefaults(flags, config))
+	pollIntervalSeconds, maxPollIntervalSeconds = commandPollIntervals(flags, *pollInterval, *maxPollInterval)
+	assert.Equal(t, 10, pollIntervalSeconds)
+	assert.Equal(t, 10, maxPollIntervalSeconds)
+
+	// only both given on the command line are left to disagree, for WaitRun to refuse
+	flags, pollInterval, maxPollInterval = newFlags("--poll-interval", "60", "--max-poll-interval", "10")
+	pollIntervalSeconds, maxPollIntervalSeconds = commandPollIntervals(flags, *pollInterval, *maxPollInterval)
+	assert.Equal(t, 60, pollIntervalSeconds)
+	assert.Equal(t, 10, maxPollIntervalSeconds)
+}
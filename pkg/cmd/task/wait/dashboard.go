@@ -0,0 +1,119 @@
+package wait
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+)
+
+// dashboardNameWidth is how many characters of a task's name the dashboard shows, so that each task fits on a line
+const dashboardNameWidth = 40
+
+// dashboardStateWidth is how wide the state column of the dashboard is, which fits the longest state, Cancelling
+const dashboardStateWidth = 10
+
+// taskDashboard keeps the latest state of each task for --dashboard, which shows every task on a line of its own,
+// redrawn in place on each poll, rather than interleaving the activity of the tasks as it happens
+type taskDashboard struct {
+	// taskOrder is the order the tasks were first seen in, which is the order they're shown in
+	taskOrder []string
+	tasks     map[string]*tasks.Task
+	// steps are the steps each task is running, or an empty string if it isn't running one
+	steps map[string]string
+}
+
+func newTaskDashboard() *taskDashboard {
+	return &taskDashboard{
+		tasks: make(map[string]*tasks.Task),
+		steps: make(map[string]string),
+	}
+}
+
+// Update records the latest state of a task, along with the step it is running if details are given
+func (d *taskDashboard) Update(t *tasks.Task, details *tasks.TaskDetailsResource) {
+	if _, ok := d.tasks[t.ID]; !ok {
+		d.taskOrder = append(d.taskOrder, t.ID)
+	}
+	d.tasks[t.ID] = t
+	switch {
+	case t.IsCompleted != nil && *t.IsCompleted:
+		d.steps[t.ID] = ""
+	case details != nil:
+		d.steps[t.ID] = formatDashboardStep(details)
+	}
+}
+
+// Lines formats a line for each task, such as
+// "ServerTasks-1  Deploy Foo to Production  Executing  00:01:05  63% Step 2: Deploy package", with the columns
+// lined up across the tasks. With a width, the step is cut short so that a line doesn't wrap, which would throw out
+// the number of lines to redraw.
+func (d *taskDashboard) Lines(formatter *TaskOutputFormatter, now time.Time, width int) []string {
+	idWidth, nameWidth := 0, 0
+	for _, taskID := range d.taskOrder {
+		idWidth = max(idWidth, len(taskID))
+		nameWidth = max(nameWidth, len([]rune(truncateDashboardName(d.tasks[taskID].Description))))
+	}
+
+	lines := make([]string, 0, len(d.taskOrder))
+	for _, taskID := range d.taskOrder {
+		t := d.tasks[taskID]
+		// the state is padded outside of its color, as the color codes would throw fmt's padding out
+		line := fmt.Sprintf("%s  %s  %s  %s", padDashboardColumn(taskID, idWidth),
+			padDashboardColumn(truncateDashboardName(t.Description), nameWidth),
+			formatter.formatTaskStatus(t.State)+strings.Repeat(" ", max(0, dashboardStateWidth-len(t.State))),
+			formatClock(dashboardElapsed(t, now)))
+		step := []rune(d.steps[taskID])
+		if width > 0 {
+			// the ID, name, state and elapsed time with two spaces after each, leaving the last column free as some
+			// terminals wrap a line which fills it
+			used := idWidth + nameWidth + dashboardStateWidth + len("00:00:00") + 8
+			step = step[:max(0, min(len(step), width-used-1))]
+		}
+		if len(step) != 0 {
+			line = line + "  " + string(step)
+		}
+		lines = append(lines, strings.TrimRight(line, " "))
+	}
+	return lines
+}
+
+// formatDashboardStep describes how far through a task is, such as "63% Step 2: Deploy package", leaving out
+// whichever of the two the details don't have
+func formatDashboardStep(details *tasks.TaskDetailsResource) string {
+	parts := make([]string, 0, 2)
+	if percentage, ok := progressPercentage(details); ok && percentage > 0 {
+		parts = append(parts, fmt.Sprintf("%d%%", percentage))
+	}
+	if step := runningStep(details); step != "" {
+		parts = append(parts, step)
+	}
+	return strings.Join(parts, " ")
+}
+
+// padDashboardColumn pads s with spaces to width characters, counting characters rather than bytes
+func padDashboardColumn(s string, width int) string {
+	return s + strings.Repeat(" ", max(0, width-len([]rune(s))))
+}
+
+// truncateDashboardName shortens a task's name to dashboardNameWidth characters, ending it with … if it was longer
+func truncateDashboardName(name string) string {
+	runes := []rune(name)
+	if len(runes) <= dashboardNameWidth {
+		return name
+	}
+	return string(runes[:dashboardNameWidth-1]) + "…"
+}
+
+// dashboardElapsed is how long a task has been running, or ran for once it has finished. A task which hasn't
+// started yet hasn't been running at all.
+func dashboardElapsed(t *tasks.Task, now time.Time) time.Duration {
+	if duration, ok := taskDuration(t); ok {
+		return duration
+	}
+	if t.StartTime == nil {
+		return 0
+	}
+	return now.Sub(*t.StartTime)
+}
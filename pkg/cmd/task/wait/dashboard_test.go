@@ -0,0 +1,81 @@
+package wait
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/OctopusDeploy/cli/test/testutil"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskDashboard_Lines(t *testing.T) {
+	formatter := NewTaskOutputFormatter(&bytes.Buffer{}, LogLevelInfo)
+	now := time.Date(2024, 1, 1, 10, 5, 0, 0, time.UTC)
+	started := now.Add(-(time.Minute + 5*time.Second))
+	completed := now.Add(-time.Minute)
+
+	dashboard := newTaskDashboard()
+	running := testutil.NewFakeTask("ServerTasks-1", "Deploy Foo to Production", "Executing")
+	running.StartTime = &started
+	dashboard.Update(running,
+		&tasks.TaskDetailsResource{
+			Progress: &tasks.TaskProgress{ProgressPercentage: 63},
+			ActivityLogs: []*tasks.ActivityElement{{
+				Children: []*tasks.ActivityElement{{Name: "Step 1: Acquire packages", Status: "Success"}, {Name: "Step 2: Deploy package", Status: "Running"}},
+			}},
+		})
+	dashboard.Update(testutil.NewFakeTask("ServerTasks-12", "Deploy Bar", "Queued"), nil)
+
+	assert.Equal(t, []string{
+		"ServerTasks-1   Deploy Foo to Production  Executing   00:01:05  63% Step 2: Deploy package",
+		"ServerTasks-12  Deploy Bar                Queued      00:00:00",
+	}, dashboard.Lines(formatter, now, 0))
+
+	// a finished task is shown with how long it ran for, and without a step
+	finished := testutil.NewFakeTask("ServerTasks-1", "Deploy Foo to Production", "Success")
+	finished.StartTime = &started
+	finished.CompletedTime = &completed
+	dashboard.Update(finished, nil)
+	assert.Equal(t, []string{
+		"ServerTasks-1   Deploy Foo to Production  Success     00:00:05",
+		"ServerTasks-12  Deploy Bar                Queued      00:00:00",
+	}, dashboard.Lines(formatter, now, 0))
+}
+
+func TestTaskDashboard_LinesFitWidth(t *testing.T) {
+	formatter := NewTaskOutputFormatter(&bytes.Buffer{}, LogLevelInfo)
+
+	dashboard := newTaskDashboard()
+	dashboard.Update(testutil.NewFakeTask("ServerTasks-1", "Deploy a release whose name is far too long to fit", "Executing"),
+		&tasks.TaskDetailsResource{
+			ActivityLogs: []*tasks.ActivityElement{{Children: []*tasks.ActivityElement{{Name: "Step 2: Deploy package", Status: "Running"}}}},
+		})
+
+	assert.Equal(t, []string{
+		"ServerTasks-1  Deploy a release whose name is far too …  Executing   00:00:00  Step 2:",
+	}, dashboard.Lines(formatter, time.Now(), 88))
+	// without room for any of the step, it's left out
+	assert.Equal(t, []string{
+		"ServerTasks-1  Deploy a release whose name is far too …  Executing   00:00:00",
+	}, dashboard.Lines(formatter, time.Now(), 40))
+}
+
+func TestTaskOutputFormatter_PrintDashboard(t *testing.T) {
+	out := bytes.Buffer{}
+	formatter := NewTaskOutputFormatter(&out, LogLevelInfo)
+
+	// piped output gets the usual lines instead
+	formatter.PrintDashboard([]string{"ServerTasks-1  Executing"})
+	assert.Equal(t, "", out.String())
+
+	formatter.isTerminal = true
+	formatter.PrintDashboard([]string{"ServerTasks-1  Executing", "ServerTasks-2  Queued"})
+	formatter.PrintDashboard([]string{"ServerTasks-1  Success", "ServerTasks-2  Executing"})
+	formatter.PrintWarning("something happened")
+
+	assert.Equal(t, "ServerTasks-1  Executing\nServerTasks-2  Queued\n"+
+		"\033[2F\033[JServerTasks-1  Success\nServerTasks-2  Executing\n"+
+		"\033[2F\033[JWarning: something happened\n", out.String())
+}
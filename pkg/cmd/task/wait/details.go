@@ -0,0 +1,38 @@
+package wait
+
+import (
+	"sync"
+
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+)
+
+// fetchTaskDetails fetches the details of each task using a pool of at most workers goroutines. The returned
+// slices are in the same order as serverTasks regardless of the order the fetches finish in. Any task whose
+// details couldn't be fetched has a nil entry in details and the reason in errs.
+func fetchTaskDetails(serverTasks []*tasks.Task, workers int, getTaskDetails TaskDetailsCallback) (details []*tasks.TaskDetailsResource, errs []error) {
+	details = make([]*tasks.TaskDetailsResource, len(serverTasks))
+	errs = make([]error, len(serverTasks))
+	if workers > len(serverTasks) {
+		workers = len(serverTasks)
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				// each worker writes only its own slots, so the slice needs no locking
+				details[i], errs[i] = getTaskDetails(serverTasks[i].ID)
+			}
+		}()
+	}
+
+	for i := range serverTasks {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return details, errs
+}
@@ -0,0 +1,77 @@
+package wait
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchTaskDetails_KeepsOrderAndLimitsConcurrency(t *testing.T) {
+	serverTasks := make([]*tasks.Task, 0)
+	for i := 1; i <= 6; i++ {
+		task := tasks.NewTask()
+		task.ID = fmt.Sprintf("ServerTasks-%d", i)
+		serverTasks = append(serverTasks, task)
+	}
+
+	var lock sync.Mutex
+	running, maxRunning := 0, 0
+	getTaskDetails := func(taskID string) (*tasks.TaskDetailsResource, error) {
+		lock.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		lock.Unlock()
+		defer func() {
+			lock.Lock()
+			running--
+			lock.Unlock()
+		}()
+
+		// earlier tasks take longer, so fetches finish out of order
+		switch taskID {
+		case "ServerTasks-1":
+			time.Sleep(30 * time.Millisecond)
+		case "ServerTasks-2":
+			time.Sleep(20 * time.Millisecond)
+		case "ServerTasks-4":
+			return nil, errors.New("details unavailable")
+		}
+		task := tasks.NewTask()
+		task.ID = taskID
+		return &tasks.TaskDetailsResource{Task: task}, nil
+	}
+
+	details, errs := fetchTaskDetails(serverTasks, 2, getTaskDetails)
+
+	assert.LessOrEqual(t, maxRunning, 2)
+	assert.Len(t, details, 6)
+	for i, d := range details {
+		if i == 3 {
+			assert.Nil(t, d)
+			assert.EqualError(t, errs[i], "details unavailable")
+			continue
+		}
+		assert.Equal(t, serverTasks[i].ID, d.Task.ID)
+		assert.NoError(t, errs[i])
+	}
+}
+
+func TestFetchTaskDetails_MoreWorkersThanTasks(t *testing.T) {
+	task := tasks.NewTask()
+	task.ID = "ServerTasks-1"
+	getTaskDetails := func(taskID string) (*tasks.TaskDetailsResource, error) {
+		return &tasks.TaskDetailsResource{Task: task}, nil
+	}
+
+	details, _ := fetchTaskDetails([]*tasks.Task{task}, MaxDetailWorkers, getTaskDetails)
+
+	assert.Len(t, details, 1)
+	assert.Equal(t, task, details[0].Task)
+}
@@ -0,0 +1,405 @@
+package wait
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/OctopusDeploy/cli/pkg/constants"
+	"github.com/OctopusDeploy/cli/pkg/util"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/core"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+)
+
+// The exit codes of a wait which didn't succeed. 1 is any other error, and 3 is already taken by the CLI failing to load
+// its configuration before any command runs, so a timeout is 4 to keep the two apart.
+const (
+	ExitCodeTaskFailed      = 2
+	ExitCodeWaitTimeout     = 4
+	ExitCodeTaskInterrupted = 5
+	ExitCodeVerifyFailed    = 6
+)
+
+var (
+	// ErrTaskFailed matches (via errors.Is) any *TaskFailedError returned by WaitRun
+	ErrTaskFailed = errors.New("one or more tasks failed")
+	// ErrWaitTimeout matches (via errors.Is) any *WaitTimeoutError returned by WaitRun
+	ErrWaitTimeout = errors.New("timeout while waiting for pending tasks")
+	// ErrTaskInterrupted matches (via errors.Is) any *TaskInterruptedError returned by WaitRun
+	ErrTaskInterrupted = errors.New("one or more tasks are waiting for an intervention")
+)
+
+// TaskFailedError is returned when one or more of the waited tasks finished unsuccessfully, or exceeded
+// --per-task-timeout
+type TaskFailedError struct {
+	TaskIDs []string
+	// Failures are why each of TaskIDs failed, in the same order
+	Failures []*TaskFailure
+	// TimedOutTaskIDs are the tasks we stopped waiting for because they exceeded --per-task-timeout
+	TimedOutTaskIDs []string
+	// NotWaitedTaskIDs are the tasks which were still running when --fail-fast stopped the wait
+	NotWaitedTaskIDs []string
+	// Waited is how long the wait took, which tells a task failing straight away from one failing at the end of a
+	// long wait
+	Waited time.Duration
+}
+
+func NewTaskFailedError(failures []*TaskFailure) *TaskFailedError {
+	taskIDs := make([]string, 0, len(failures))
+	for _, failure := range failures {
+		taskIDs = append(taskIDs, failure.TaskID)
+	}
+	return &TaskFailedError{TaskIDs: taskIDs, Failures: failures}
+}
+
+func (e *TaskFailedError) Error() string {
+	var sb strings.Builder
+	outcomes := make([]string, 0, 2)
+	if len(e.TaskIDs) != 0 {
+		outcomes = append(outcomes, fmt.Sprintf("failed: %s", strings.Join(e.TaskIDs, ", ")))
+	}
+	if len(e.TimedOutTaskIDs) != 0 {
+		outcomes = append(outcomes, fmt.Sprintf("timed out: %s", strings.Join(e.TimedOutTaskIDs, ", ")))
+	}
+	sb.WriteString("One or more deployment tasks " + strings.Join(outcomes, "; "))
+	if len(e.NotWaitedTaskIDs) != 0 {
+		sb.WriteString(fmt.Sprintf(" (not waited for: %s)", strings.Join(e.NotWaitedTaskIDs, ", ")))
+	}
+	if e.Waited != 0 {
+		sb.WriteString(" after waiting " + formatDuration(e.Waited))
+	}
+	// each failure on its own line, with any further lines of its message indented under it
+	for _, failure := range e.Failures {
+		sb.WriteString("\n  " + strings.ReplaceAll(failure.Error(), "\n", "\n    "))
+	}
+	return sb.String()
+}
+
+// Unwrap gives the failure of each task, so that errors.As can pick out a *TaskFailure
+func (e *TaskFailedError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failures))
+	for _, failure := range e.Failures {
+		errs = append(errs, failure)
+	}
+	return errs
+}
+
+// Is matches ErrTaskFailed if any task failed, and ErrWaitTimeout if any task timed out
+func (e *TaskFailedError) Is(target error) bool {
+	return (target == ErrTaskFailed && len(e.TaskIDs) != 0) || (target == ErrWaitTimeout && len(e.TimedOutTaskIDs) != 0)
+}
+
+// ExitCode reports a failure if any task failed, and only reports a timeout if every other task succeeded
+func (e *TaskFailedError) ExitCode() int {
+	if len(e.TaskIDs) == 0 && len(e.TimedOutTaskIDs) != 0 {
+		return ExitCodeWaitTimeout
+	}
+	return ExitCodeTaskFailed
+}
+
+// TaskFailure is why a single task failed. A TaskFailedError is made up of one for each failed task, which
+// errors.As can pick out.
+type TaskFailure struct {
+	TaskID string `json:"TaskId" yaml:"taskId"`
+	Name   string `json:"Name" yaml:"name"`
+	// Message is the fatal message from the task's activity log, or else the task's own error message
+	Message string `json:"Message,omitempty" yaml:"message,omitempty"`
+	// Duration is how long the task ran for on the server, if it ran at all
+	Duration string `json:"Duration,omitempty" yaml:"duration,omitempty"`
+}
+
+// Error describes the failure like the task's state is printed while waiting, such as
+// "ServerTasks-1: Deploy Foo release 1.0.0 to Production (failed after 40m0s): The step failed"
+func (f *TaskFailure) Error() string {
+	var sb strings.Builder
+	sb.WriteString(f.TaskID)
+	if f.Name != "" {
+		sb.WriteString(": " + f.Name)
+	}
+	if f.Duration != "" {
+		sb.WriteString(" (failed after " + f.Duration + ")")
+	}
+	if f.Message != "" {
+		sb.WriteString(": " + f.Message)
+	}
+	return sb.String()
+}
+
+// WaitTimeoutError is returned when the timeout elapses before all waited tasks have finished
+type WaitTimeoutError struct {
+	// Timeout is set when the wait stopped after --timeout
+	Timeout time.Duration
+	// Deadline is set when the wait stopped at --deadline rather than after --timeout
+	Deadline time.Time
+	// PendingTaskIDs are the tasks which were still running when the wait timed out
+	PendingTaskIDs []string
+	// PendingStates holds the last state seen of each pending task, keyed by task ID
+	PendingStates map[string]string
+	// CancelledTaskIDs are the pending tasks cancelled because of --on-timeout cancel
+	CancelledTaskIDs []string
+	// CancelFailures holds why each pending task which couldn't be cancelled wasn't, keyed by task ID
+	CancelFailures map[string]error
+}
+
+func NewWaitTimeoutError() *WaitTimeoutError {
+	return &WaitTimeoutError{}
+}
+
+func (e *WaitTimeoutError) Error() string {
+	var sb strings.Builder
+	switch {
+	case !e.Deadline.IsZero():
+		sb.WriteString(fmt.Sprintf("deadline %s reached", e.Deadline.Format(time.RFC3339)))
+	case e.Timeout > 0:
+		sb.WriteString(fmt.Sprintf("timeout after %ds", int(e.Timeout.Seconds())))
+	default:
+		sb.WriteString("timeout")
+	}
+	if len(e.PendingTaskIDs) == 0 {
+		sb.WriteString(" while waiting for pending tasks")
+	} else {
+		pending := make([]string, 0, len(e.PendingTaskIDs))
+		for _, taskID := range e.PendingTaskIDs {
+			if state, ok := e.PendingStates[taskID]; ok && state != "" {
+				pending = append(pending, fmt.Sprintf("%s (%s)", taskID, state))
+			} else {
+				pending = append(pending, taskID)
+			}
+		}
+		sb.WriteString("; still pending: " + strings.Join(pending, ", "))
+	}
+	if len(e.CancelledTaskIDs) != 0 {
+		sb.WriteString(fmt.Sprintf("; cancelled: %s", strings.Join(e.CancelledTaskIDs, ", ")))
+	}
+	for _, taskID := range e.PendingTaskIDs {
+		if err, ok := e.CancelFailures[taskID]; ok {
+			sb.WriteString(fmt.Sprintf("\n  %s: failed to cancel: %v", taskID, err))
+		}
+	}
+	return sb.String()
+}
+
+func (e *WaitTimeoutError) Is(target error) bool { return target == ErrWaitTimeout }
+
+func (e *WaitTimeoutError) ExitCode() int { return ExitCodeWaitTimeout }
+
+// TaskInterruptedError is returned with --fail-on-intervention when a task is paused waiting for someone to resolve
+// a manual intervention or guided failure
+type TaskInterruptedError struct {
+	TaskIDs []string
+}
+
+func NewTaskInterruptedError(taskIDs []string) *TaskInterruptedError {
+	return &TaskInterruptedError{TaskIDs: taskIDs}
+}
+
+func (e *TaskInterruptedError) Error() string {
+	return fmt.Sprintf("One or more tasks are waiting for a manual intervention or guided failure to be resolved: %s", strings.Join(e.TaskIDs, ", "))
+}
+
+func (e *TaskInterruptedError) Is(target error) bool { return target == ErrTaskInterrupted }
+
+func (e *TaskInterruptedError) ExitCode() int { return ExitCodeTaskInterrupted }
+
+// RetryAfterError is a failed API call which the server asked us to retry no sooner than RetryAfter, such as through
+// the Retry-After header of a 429 Too Many Requests response
+type RetryAfterError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RetryAfterError) Error() string { return e.Err.Error() }
+
+func (e *RetryAfterError) Unwrap() error { return e.Err }
+
+// retryAfter returns how long the server asked us to wait before retrying the call which failed with err, or 0 if
+// it didn't say
+func retryAfter(err error) time.Duration {
+	var retryAfterErr *RetryAfterError
+	if errors.As(err, &retryAfterErr) {
+		return retryAfterErr.RetryAfter
+	}
+	return 0
+}
+
+// ConnectionError is an API call which couldn't get through to the server at all, such as because of a proxy or
+// TLS problem, along with a hint at what to check. These are most often down to how the machine running the CLI
+// reaches the server rather than the server itself, which a bare connection error gives no clue of.
+type ConnectionError struct {
+	Err  error
+	Hint string
+}
+
+func (e *ConnectionError) Error() string { return fmt.Sprintf("%v\n%s", e.Err, e.Hint) }
+
+func (e *ConnectionError) Unwrap() error { return e.Err }
+
+// withConnectionHint wraps err in a ConnectionError if it looks like a proxy, TLS or network problem, and returns
+// it as it is otherwise
+func withConnectionHint(err error) error {
+	if err == nil {
+		return nil
+	}
+	var connectionErr *ConnectionError
+	if errors.As(err, &connectionErr) {
+		return err
+	}
+	if hint := connectionHint(err); hint != "" {
+		return &ConnectionError{Err: err, Hint: hint}
+	}
+	return err
+}
+
+// connectionHint suggests what to check for an error reaching the server, or returns an empty string if err
+// doesn't look like one. The go client flattens some errors to strings, so their messages are checked as well as
+// their types.
+func connectionHint(err error) string {
+	message := strings.ToLower(err.Error())
+
+	var urlError *url.Error
+	isProxyError := (errors.As(err, &urlError) && strings.HasPrefix(urlError.Op, "proxyconnect")) ||
+		strings.Contains(message, "proxyconnect") || strings.Contains(message, "proxy authentication required") ||
+		strings.Contains(message, "invalid proxy")
+	if isProxyError {
+		if name, value, ok := malformedProxyEnvironment(); ok {
+			return fmt.Sprintf("Hint: the %s environment variable %s isn't a valid proxy URL; set it to one such as http://proxy.example.com:8080, or unset it to connect to the Octopus server directly", name, value)
+		}
+		return "Hint: the proxy couldn't be reached or refused the connection. Check the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables, including any credentials in the proxy URL, or unset them to connect to the Octopus server directly"
+	}
+
+	var certificateErr *tls.CertificateVerificationError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var certificateInvalidErr x509.CertificateInvalidError
+	var recordHeaderErr tls.RecordHeaderError
+	isTLSError := errors.As(err, &certificateErr) || errors.As(err, &unknownAuthorityErr) || errors.As(err, &hostnameErr) ||
+		errors.As(err, &certificateInvalidErr) || errors.As(err, &recordHeaderErr) ||
+		strings.Contains(message, "x509:") || strings.Contains(message, "tls:")
+	if isTLSError {
+		return fmt.Sprintf("Hint: the TLS connection to the Octopus server failed. If a proxy inspects TLS traffic, add its CA certificate to the system trust store, or point SSL_CERT_FILE or SSL_CERT_DIR at it; also check %s uses the right scheme (https or http)", constants.EnvOctopusUrl)
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) || strings.Contains(message, "no such host") {
+		return fmt.Sprintf("Hint: the server's host name couldn't be resolved. Check %s, and if the server is only reachable through a proxy, set HTTPS_PROXY", constants.EnvOctopusUrl)
+	}
+
+	var opErr *net.OpError
+	isDialError := (errors.As(err, &opErr) && opErr.Op == "dial") ||
+		strings.Contains(message, "connection refused") || strings.Contains(message, "i/o timeout")
+	if isDialError {
+		return fmt.Sprintf("Hint: couldn't connect to the Octopus server. Check %s, and if the server is only reachable through a proxy, set HTTPS_PROXY (or NO_PROXY if it should be reached directly)", constants.EnvOctopusUrl)
+	}
+	return ""
+}
+
+// proxyEnvironmentVariables are the variables Go's HTTP client reads its proxy from, in either case
+var proxyEnvironmentVariables = []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"}
+
+// malformedProxyEnvironment finds the first proxy environment variable which can't be parsed, if any, as an error
+// using the proxy doesn't say where the proxy came from
+func malformedProxyEnvironment() (string, string, bool) {
+	for _, name := range proxyEnvironmentVariables {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		// as with Go's HTTP client, a proxy without a scheme is taken to be an http one
+		proxy := value
+		if !strings.Contains(proxy, "://") {
+			proxy = "http://" + proxy
+		}
+		proxyURL, err := url.Parse(proxy)
+		if err != nil || proxyURL.Host == "" {
+			return name, value, true
+		}
+	}
+	return "", "", false
+}
+
+// isTransientError reports whether a failed API call is worth retrying. Definitive client errors such as
+// unauthorized, bad request or not found will fail the same way every time; anything else (5xx responses,
+// network failures) may succeed on a later attempt.
+func isTransientError(err error) bool {
+	// the server has told us when to try again, so it expects us to
+	if retryAfter(err) > 0 {
+		return true
+	}
+	// a request which hung may well get an answer when it is made again
+	if errors.Is(err, ErrServerTimeout) {
+		return true
+	}
+
+	var apiError *core.APIError
+	if errors.As(err, &apiError) {
+		return apiError.StatusCode == 0 || apiError.StatusCode >= http.StatusInternalServerError || apiError.StatusCode == http.StatusTooManyRequests
+	}
+
+	var netError net.Error
+	if errors.As(err, &netError) {
+		return true
+	}
+
+	// the go client flattens some errors to strings, so the best we can do is look for their messages
+	message := strings.ToLower(err.Error())
+	for _, definitive := range []string{"unauthorized", "bad request", "forbidden"} {
+		if strings.Contains(message, definitive) {
+			return false
+		}
+	}
+	return true
+}
+
+// taskFailureMessage extracts why a task failed from the error and fatal entries in its activity log,
+// falling back to the task's own error message if the log has none
+func taskFailureMessage(details *tasks.TaskDetailsResource) string {
+	if details == nil {
+		return ""
+	}
+	messages := activityLogMessages(details, "error", "fatal")
+	if len(messages) == 0 && details.Task != nil {
+		return strings.TrimSpace(details.Task.ErrorMessage)
+	}
+	return strings.Join(messages, "\n")
+}
+
+// taskWarnings extracts the warning entries from a task's activity log, such as those of a step which succeeded
+// with warnings
+func taskWarnings(details *tasks.TaskDetailsResource) []string {
+	if details == nil {
+		return nil
+	}
+	return activityLogMessages(details, "warning")
+}
+
+// activityLogMessages collects the non-empty messages of the entries in the given categories from the whole of a
+// task's activity log, in the order they appear in it
+func activityLogMessages(details *tasks.TaskDetailsResource, categories ...string) []string {
+	messages := make([]string, 0)
+	var walk func(activities []*tasks.ActivityElement)
+	walk = func(activities []*tasks.ActivityElement) {
+		for _, activity := range activities {
+			if activity == nil {
+				continue
+			}
+			for _, logElement := range activity.LogElements {
+				if logElement == nil || !util.SliceContains(categories, strings.ToLower(logElement.Category)) {
+					continue
+				}
+				if message := strings.TrimSpace(logElement.MessageText); message != "" {
+					messages = append(messages, message)
+				}
+			}
+			walk(activity.Children)
+		}
+	}
+	walk(details.ActivityLogs)
+	return messages
+}
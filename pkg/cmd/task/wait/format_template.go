@@ -0,0 +1,67 @@
+package wait
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// formatTemplateFuncs are the helper functions a --format-template can use on top of those text/template provides
+var formatTemplateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"trim":  strings.TrimSpace,
+	// replace takes the string last, so that it can be piped in, as in {{.Errors | replace "\n" " "}}
+	"replace": func(old string, new string, s string) string { return strings.ReplaceAll(s, old, new) },
+	"json": func(value any) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+}
+
+// parseFormatTemplate parses a --format-template, which is rendered once per task with its TaskResult as the data
+func parseFormatTemplate(text string) (*template.Template, error) {
+	return template.New(FlagFormatTemplate).Funcs(formatTemplateFuncs).Parse(text)
+}
+
+// renderFormatTemplate renders each result through tmpl, one per line
+func renderFormatTemplate(tmpl *template.Template, results []*TaskResult) (string, error) {
+	var rendered strings.Builder
+	for _, result := range results {
+		var line strings.Builder
+		if err := tmpl.Execute(&line, result); err != nil {
+			return "", fmt.Errorf("failed to render --%s for %s: %w", FlagFormatTemplate, result.ID, err)
+		}
+		// a template which ends its own line doesn't leave a blank one after it
+		rendered.WriteString(strings.TrimSuffix(line.String(), "\n"))
+		rendered.WriteString("\n")
+	}
+	return rendered.String(), nil
+}
+
+// formatTemplateValue is a flag holding a --format-template. It is parsed as it is set, so that a bad template is
+// reported while the flags are parsed rather than once the wait has finished.
+type formatTemplateValue struct {
+	value *string
+}
+
+func newFormatTemplateValue(value *string) *formatTemplateValue {
+	return &formatTemplateValue{value: value}
+}
+
+func (v *formatTemplateValue) Set(value string) error {
+	if _, err := parseFormatTemplate(value); err != nil {
+		return err
+	}
+	*v.value = value
+	return nil
+}
+
+func (v *formatTemplateValue) String() string {
+	return *v.value
+}
+
+func (v *formatTemplateValue) Type() string {
+	return "template"
+}
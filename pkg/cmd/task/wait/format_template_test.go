@@ -0,0 +1,45 @@
+package wait
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderFormatTemplate(t *testing.T) {
+	results := []*TaskResult{
+		{ID: "ServerTasks-1", Name: "Deploy Bar 1 release 0.0.2 to Foo", State: "Success", FinishedSuccessfully: true, Duration: "1m30s"},
+		{ID: "ServerTasks-2", Name: "Deploy Bar 2 release 0.0.2 to Foo", State: "Failed", Errors: " Something went wrong\n"},
+	}
+
+	tmpl, err := parseFormatTemplate(`{{.ID}} {{upper .State}}{{if .Errors}}: {{trim .Errors}}{{end}}`)
+	assert.NoError(t, err)
+	rendered, err := renderFormatTemplate(tmpl, results)
+	assert.NoError(t, err)
+	assert.Equal(t, "ServerTasks-1 SUCCESS\nServerTasks-2 FAILED: Something went wrong\n", rendered)
+
+	// a template ending its own line doesn't leave a blank line after each task
+	tmpl, err = parseFormatTemplate("{{lower .State}} {{json .Name}} {{.Errors | replace \"\\n\" \"|\"}}\n")
+	assert.NoError(t, err)
+	rendered, err = renderFormatTemplate(tmpl, results)
+	assert.NoError(t, err)
+	assert.Equal(t, "success \"Deploy Bar 1 release 0.0.2 to Foo\" \nfailed \"Deploy Bar 2 release 0.0.2 to Foo\"  Something went wrong|\n", rendered)
+
+	tmpl, err = parseFormatTemplate(`{{.Missing}}`)
+	assert.NoError(t, err)
+	_, err = renderFormatTemplate(tmpl, results)
+	assert.ErrorContains(t, err, "failed to render --format-template for ServerTasks-1: ")
+}
+
+func TestFormatTemplateValue(t *testing.T) {
+	var value string
+	flag := newFormatTemplateValue(&value)
+
+	assert.NoError(t, flag.Set("{{.ID}} {{.State}}"))
+	assert.Equal(t, "{{.ID}} {{.State}}", value)
+
+	// a bad template is rejected while the flags are parsed, keeping the last good one
+	assert.ErrorContains(t, flag.Set("{{.ID"), "unclosed action")
+	assert.ErrorContains(t, flag.Set("{{nope .ID}}"), `function "nope" not defined`)
+	assert.Equal(t, "{{.ID}} {{.State}}", value)
+}
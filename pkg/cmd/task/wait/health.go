@@ -0,0 +1,74 @@
+package wait
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/OctopusDeploy/cli/pkg/util"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+)
+
+// healthCheckTaskName is the name the server gives the tasks which check the health of deployment targets
+const healthCheckTaskName = "Health"
+
+// unhealthyActivityStates are the states a health check leaves the activity of a deployment target in when the
+// target isn't healthy: failed when it couldn't be reached, or succeeded with warnings when it could but something
+// is wrong with it
+var unhealthyActivityStates = []string{"failed", "successwithwarning"}
+
+func isHealthCheckTask(t *tasks.Task) bool {
+	return strings.EqualFold(t.Name, healthCheckTaskName)
+}
+
+// unhealthyTargets names the deployment targets a health check found unhealthy, in the order they were checked.
+// Each target is checked by an activity of its own, which is the innermost one of the activity log.
+func unhealthyTargets(details *tasks.TaskDetailsResource) []string {
+	targets := make([]string, 0)
+	var walk func(activities []*tasks.ActivityElement)
+	walk = func(activities []*tasks.ActivityElement) {
+		for _, activity := range activities {
+			if activity == nil {
+				continue
+			}
+			if len(activity.Children) != 0 {
+				walk(activity.Children)
+				continue
+			}
+			if util.SliceContains(unhealthyActivityStates, strings.ToLower(activity.Status)) {
+				targets = append(targets, activity.Name)
+			}
+		}
+	}
+	if details != nil {
+		walk(details.ActivityLogs)
+	}
+	return targets
+}
+
+// failUnhealthyChecks moves the health checks in result which succeeded even though some deployment targets were
+// unhealthy from its succeeded tasks to its failed ones, saying which targets those were. A check whose details can't
+// be fetched fails too if the server says it logged warnings or errors, as there's no telling it was healthy.
+func failUnhealthyChecks(config WaitConfig, result *WaitResult) {
+	checks := util.SliceFilter(result.SucceededTasks, isHealthCheckTask)
+	if len(checks) == 0 || config.GetTaskDetailsCallback == nil {
+		return
+	}
+
+	details, _ := fetchTaskDetails(checks, config.DetailWorkers, config.GetTaskDetailsCallback)
+	for i, t := range checks {
+		message := ""
+		if details[i] == nil {
+			if t.HasWarningsOrErrors {
+				message = "logged warnings or errors, but its details couldn't be fetched to find which deployment targets were unhealthy"
+			}
+		} else if targets := unhealthyTargets(details[i]); len(targets) != 0 {
+			message = fmt.Sprintf("%d unhealthy deployment target(s): %s", len(targets), strings.Join(targets, ", "))
+		}
+		if message == "" {
+			continue
+		}
+		result.SucceededTasks = util.SliceFilter(result.SucceededTasks, func(succeeded *tasks.Task) bool { return succeeded.ID != t.ID })
+		result.FailedTasks = append(result.FailedTasks, t)
+		result.FailureMessages[t.ID] = message
+	}
+}
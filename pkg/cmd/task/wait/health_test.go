@@ -0,0 +1,61 @@
+package wait
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/OctopusDeploy/cli/test/testutil"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnhealthyTargets(t *testing.T) {
+	assert.Empty(t, unhealthyTargets(nil))
+
+	details := &tasks.TaskDetailsResource{
+		ActivityLogs: []*tasks.ActivityElement{{
+			Name: "Check deployment target health",
+			Children: []*tasks.ActivityElement{
+				{Name: "Check Staging", Children: []*tasks.ActivityElement{{Name: "web01", Status: "Failed"}}},
+				nil,
+				// a check of an environment without any targets has nothing to say about their health
+				{Name: "Check Test", Status: "Success"},
+				{Name: "Check Production", Children: []*tasks.ActivityElement{
+					{Name: "web02", Status: "Success"},
+					{Name: "web03", Status: "SuccessWithWarning"},
+					{Name: "web04", Status: "Skipped"},
+				}},
+			},
+		}},
+	}
+	assert.Equal(t, []string{"web01", "web03"}, unhealthyTargets(details))
+}
+
+func TestFailUnhealthyChecks_DetailsUnavailable(t *testing.T) {
+	newCheck := func(id string, hasWarningsOrErrors bool) *tasks.Task {
+		check := testutil.NewFakeTask(id, "Check deployment target health", "Success")
+		check.Name = healthCheckTaskName
+		check.HasWarningsOrErrors = hasWarningsOrErrors
+		return check
+	}
+	warned := newCheck("ServerTasks-1", true)
+	clean := newCheck("ServerTasks-2", false)
+	result := WaitResult{
+		SucceededTasks:  []*tasks.Task{warned, clean},
+		FailedTasks:     []*tasks.Task{},
+		FailureMessages: map[string]string{},
+	}
+	config := WaitConfig{
+		DetailWorkers: 1,
+		GetTaskDetailsCallback: func(taskID string) (*tasks.TaskDetailsResource, error) {
+			return nil, errors.New("connection refused")
+		},
+	}
+
+	failUnhealthyChecks(config, &result)
+
+	// without its details, only a check the server says logged something can't be trusted to be healthy
+	assert.Equal(t, []*tasks.Task{clean}, result.SucceededTasks)
+	assert.Equal(t, []*tasks.Task{warned}, result.FailedTasks)
+	assert.Contains(t, result.FailureMessages["ServerTasks-1"], "details couldn't be fetched")
+}
@@ -0,0 +1,37 @@
+package wait
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// HookTimeout is how long an --on-success or --on-failure command can run for before it is killed. It is longer than
+// NotifyTimeout, as these commands are meant to do things such as rolling back or promoting a release.
+const HookTimeout = 10 * time.Minute
+
+// runOutcomeHook runs --on-success if the wait succeeded, or --on-failure if it didn't, with the same environment
+// variables as --notify. A wait which was cancelled, such as by Ctrl+C, neither succeeded nor failed, so it runs
+// neither. A command which fails gets a warning, and with --hook-strict, fails a wait which had succeeded; a wait
+// which had already failed keeps its own error, so that its exit code still says why.
+func runOutcomeHook(opts *WaitOptions, formatter *TaskOutputFormatter, result WaitResult, elapsed time.Duration, waitErr error) error {
+	flag, command := FlagOnSuccess, opts.OnSuccess
+	if waitErr != nil {
+		flag, command = FlagOnFailure, opts.OnFailure
+	}
+	if command == "" || errors.Is(waitErr, ErrWaitCancelled) {
+		return waitErr
+	}
+
+	env := append(os.Environ(), newNotifyEnv(result, elapsed, waitErr)...)
+	err := runNotifyCommand(command, env, HookTimeout)
+	if err == nil {
+		return waitErr
+	}
+	if opts.HookStrict && waitErr == nil {
+		return fmt.Errorf("--%s command failed: %w", flag, err)
+	}
+	formatter.PrintWarning(fmt.Sprintf("--%s command failed: %v", flag, err))
+	return waitErr
+}
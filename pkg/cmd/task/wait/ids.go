@@ -0,0 +1,272 @@
+package wait
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/OctopusDeploy/cli/pkg/constants"
+	"github.com/OctopusDeploy/cli/pkg/util"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+)
+
+var taskIDPattern = regexp.MustCompile(`^ServerTasks-\d+$`)
+
+// shortTaskIDPattern matches task IDs given as just their number, such as 12345 for ServerTasks-12345
+var shortTaskIDPattern = regexp.MustCompile(`^\d+$`)
+
+var deploymentIDPattern = regexp.MustCompile(`^Deployments-\d+$`)
+
+// childTaskIDPattern finds references to other server tasks in a task's log, such as the deployments
+// queued by a "Deploy a release" step
+var childTaskIDPattern = regexp.MustCompile(`ServerTasks-\d+`)
+
+// ReadTaskIDs reads newline separated task IDs, ignoring blank lines and lines starting with #
+func ReadTaskIDs(r io.Reader) ([]string, error) {
+	taskIDs := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		taskIDs = append(taskIDs, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return taskIDs, nil
+}
+
+// readTaskIDsFromFile reads task IDs from the file at path, or from stdin if path is "-"
+func readTaskIDsFromFile(path string) ([]string, error) {
+	if path == "-" {
+		return ReadTaskIDs(os.Stdin)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadTaskIDs(file)
+}
+
+// taskIDFields are the JSON fields task IDs are read from, matched case-insensitively: ServerTaskId is used by
+// release deploy and runbook run, TaskId by deployments and Id by the task commands' own output
+var taskIDFields = []string{"ServerTaskId", "TaskId", "Id"}
+
+// readTaskIDsFromPipe reads task IDs piped into stdin in the given input format, if anything is piped at all
+func readTaskIDsFromPipe(inputFormat string) ([]string, error) {
+	if !util.IsCalledFromPipe() {
+		return []string{}, nil
+	}
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTaskIDs(data, inputFormat)
+}
+
+// ParseTaskIDs reads task IDs from data. Text is split on new lines, spaces and commas. JSON may be an array of
+// task IDs, or an object or array of objects with a ServerTaskId, TaskId or Id field holding the task ID. With
+// the auto input format, data is read as JSON if it starts with { or [, and as text otherwise.
+func ParseTaskIDs(data []byte, inputFormat string) ([]string, error) {
+	switch strings.ToLower(inputFormat) {
+	case InputFormatAuto, "":
+		trimmed := bytes.TrimSpace(data)
+		if len(trimmed) != 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+			return parseJSONTaskIDs(data)
+		}
+		return util.ReadValues(bytes.NewReader(data)), nil
+	case InputFormatText:
+		return util.ReadValues(bytes.NewReader(data)), nil
+	case constants.OutputFormatJson:
+		return parseJSONTaskIDs(data)
+	default:
+		return nil, fmt.Errorf("unsupported --%s value %s. Valid values are '%s', '%s', '%s'. Defaults to %s", FlagInputFormat, inputFormat, InputFormatAuto, InputFormatText, constants.OutputFormatJson, InputFormatAuto)
+	}
+}
+
+func parseJSONTaskIDs(data []byte) ([]string, error) {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("invalid JSON task IDs: %w", err)
+	}
+
+	items, ok := value.([]any)
+	if !ok {
+		items = []any{value}
+	}
+
+	taskIDs := make([]string, 0, len(items))
+	for _, item := range items {
+		taskID, ok := jsonTaskID(item)
+		if !ok {
+			return nil, fmt.Errorf("unrecognized JSON task IDs; expected an array of task IDs, or an object or array of objects with a %s field", strings.Join(taskIDFields, ", "))
+		}
+		taskIDs = append(taskIDs, taskID)
+	}
+	return taskIDs, nil
+}
+
+// jsonTaskID returns the task ID held by a JSON value, which is either the ID itself or an object with one
+// of the taskIDFields. An Id field only counts if it holds a task ID, as plenty of other resources have IDs.
+func jsonTaskID(item any) (string, bool) {
+	switch item := item.(type) {
+	case string:
+		return item, true
+	case map[string]any:
+		for _, field := range taskIDFields {
+			for key, value := range item {
+				if !strings.EqualFold(key, field) {
+					continue
+				}
+				if taskID, ok := value.(string); ok && (field != "Id" || taskIDPattern.MatchString(taskID)) {
+					return taskID, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// NormalizeTaskIDs trims and de-duplicates the given task IDs, dropping any blanks and prefixing bare numbers
+// with ServerTasks-, and returns an error naming every ID that doesn't look like a server task ID
+func NormalizeTaskIDs(taskIDs []string) ([]string, error) {
+	normalized := make([]string, 0, len(taskIDs))
+	seen := make(map[string]bool, len(taskIDs))
+	invalid := make([]string, 0)
+	for _, id := range taskIDs {
+		id = normalizeTaskID(strings.TrimSpace(id))
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		if !taskIDPattern.MatchString(id) {
+			invalid = append(invalid, id)
+			continue
+		}
+		normalized = append(normalized, id)
+	}
+
+	if len(invalid) != 0 {
+		return nil, fmt.Errorf("invalid server task ID(s): %s; expected IDs in the form ServerTasks-123 or 123", strings.Join(invalid, ", "))
+	}
+	return normalized, nil
+}
+
+// NormalizeDeploymentIDs turns deployment IDs given as just their number into full deployment IDs, dropping
+// blanks and duplicates, and fails if any of them isn't a deployment ID
+func NormalizeDeploymentIDs(deploymentIDs []string) ([]string, error) {
+	normalized := make([]string, 0, len(deploymentIDs))
+	invalid := make([]string, 0)
+	for _, id := range deploymentIDs {
+		id = strings.TrimSpace(id)
+		if shortTaskIDPattern.MatchString(id) {
+			id = "Deployments-" + id
+		}
+		if id == "" || util.SliceContains(normalized, id) {
+			continue
+		}
+		if !deploymentIDPattern.MatchString(id) {
+			invalid = append(invalid, id)
+			continue
+		}
+		normalized = append(normalized, id)
+	}
+
+	if len(invalid) != 0 {
+		return nil, fmt.Errorf("invalid deployment ID(s): %s; expected IDs in the form Deployments-123 or 123", strings.Join(invalid, ", "))
+	}
+	return normalized, nil
+}
+
+// resolveDeploymentTasks finds the server task running each of the given deployments, in the same order. It fails if
+// any of them can't be found, or hasn't been given a task yet.
+func resolveDeploymentTasks(deploymentIDs []string, resolveDeployments ResolveDeploymentsCallback) ([]string, error) {
+	found, err := resolveDeployments(deploymentIDs)
+	if err != nil {
+		return nil, err
+	}
+	taskIDs := make(map[string]string, len(found))
+	for _, deployment := range found {
+		if deployment != nil {
+			taskIDs[deployment.GetID()] = deployment.TaskID
+		}
+	}
+
+	result := make([]string, 0, len(deploymentIDs))
+	missing := make([]string, 0)
+	withoutTask := make([]string, 0)
+	for _, id := range deploymentIDs {
+		taskID, ok := taskIDs[id]
+		switch {
+		case !ok:
+			missing = append(missing, id)
+		case taskID == "":
+			withoutTask = append(withoutTask, id)
+		default:
+			result = append(result, taskID)
+		}
+	}
+
+	if len(missing) != 0 {
+		return nil, fmt.Errorf("deployment(s) not found: %s", strings.Join(missing, ", "))
+	}
+	if len(withoutTask) != 0 {
+		return nil, fmt.Errorf("deployment(s) without a server task yet: %s", strings.Join(withoutTask, ", "))
+	}
+	return result, nil
+}
+
+// normalizeTaskID turns a task ID given as just its number into a full server task ID, leaving any other ID as it is
+func normalizeTaskID(id string) string {
+	if shortTaskIDPattern.MatchString(id) {
+		return "ServerTasks-" + id
+	}
+	return id
+}
+
+// findChildTaskIDs returns the IDs of the server tasks referenced in the activity log of a task, excluding the
+// task itself
+func findChildTaskIDs(details *tasks.TaskDetailsResource) []string {
+	if details == nil {
+		return []string{}
+	}
+	var taskID string
+	if details.Task != nil {
+		taskID = details.Task.ID
+	}
+
+	childTaskIDs := make([]string, 0)
+	var walk func(activities []*tasks.ActivityElement)
+	walk = func(activities []*tasks.ActivityElement) {
+		for _, activity := range activities {
+			if activity == nil {
+				continue
+			}
+			for _, logElement := range activity.LogElements {
+				if logElement == nil {
+					continue
+				}
+				for _, id := range childTaskIDPattern.FindAllString(logElement.MessageText, -1) {
+					if id != taskID {
+						childTaskIDs = append(childTaskIDs, id)
+					}
+				}
+			}
+			walk(activity.Children)
+		}
+	}
+	walk(details.ActivityLogs)
+
+	return util.SliceDistinct(childTaskIDs)
+}
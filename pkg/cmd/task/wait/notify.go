@@ -0,0 +1,154 @@
+package wait
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	cliErrors "github.com/OctopusDeploy/cli/pkg/errors"
+)
+
+// the environment variables a --notify command is run with, on top of those of the CLI itself
+const (
+	// NotifyEnvStatus is how the wait ended, one of the NotifyStatus values
+	NotifyEnvStatus = "OCTOPUS_WAIT_STATUS"
+	// NotifyEnvExitCode is the exit code the CLI exits with
+	NotifyEnvExitCode = "OCTOPUS_WAIT_EXIT_CODE"
+	// NotifyEnvTaskIDs are the comma separated IDs of the tasks waited for, when the wait got as far as finishing
+	NotifyEnvTaskIDs = "OCTOPUS_WAIT_TASK_IDS"
+	// NotifyEnvFailedTaskIDs are the comma separated IDs of the tasks which failed
+	NotifyEnvFailedTaskIDs = "OCTOPUS_WAIT_FAILED_TASK_IDS"
+	// NotifyEnvPendingTaskIDs are the comma separated IDs of the tasks still running when the wait timed out
+	NotifyEnvPendingTaskIDs = "OCTOPUS_WAIT_PENDING_TASK_IDS"
+	// NotifyEnvDuration is how long the wait took, such as 1m30s
+	NotifyEnvDuration = "OCTOPUS_WAIT_DURATION"
+	// NotifyEnvDurationSeconds is how long the wait took, in whole seconds
+	NotifyEnvDurationSeconds = "OCTOPUS_WAIT_DURATION_SECONDS"
+	// NotifyEnvError is the error the wait failed with, if any
+	NotifyEnvError = "OCTOPUS_WAIT_ERROR"
+)
+
+// the ways a wait can end, as given to a --notify command
+const (
+	NotifyStatusSuccess     = "success"
+	NotifyStatusFailed      = "failed"
+	NotifyStatusTimeout     = "timeout"
+	NotifyStatusInterrupted = "interrupted"
+	NotifyStatusCancelled   = "cancelled"
+	NotifyStatusError       = "error"
+	// NotifyStatusUnverified is when the tasks succeeded, but --verify-url didn't
+	NotifyStatusUnverified = "unverified"
+)
+
+// NotifyTimeout is how long a --notify command can run for before it is killed, so that a hung command doesn't
+// keep the wait from ending
+const NotifyTimeout = 30 * time.Second
+
+// notify runs the --notify command with the outcome of the wait. A command which fails only gets a warning; the
+// outcome of the wait is what decides the exit code, not whether anyone could be told about it.
+func notify(opts *WaitOptions, formatter *TaskOutputFormatter, result WaitResult, elapsed time.Duration, waitErr error) {
+	env := append(os.Environ(), newNotifyEnv(result, elapsed, waitErr)...)
+	if err := runNotifyCommand(opts.Notify, env, NotifyTimeout); err != nil {
+		formatter.PrintWarning(fmt.Sprintf("--%s command failed: %v", FlagNotify, err))
+	}
+}
+
+// newNotifyEnv describes the outcome of a wait as environment variables, in NAME=value form
+func newNotifyEnv(result WaitResult, elapsed time.Duration, waitErr error) []string {
+	taskIDs := make([]string, 0, len(result.Tasks))
+	for _, t := range result.Tasks {
+		taskIDs = append(taskIDs, t.ID)
+	}
+	failedTaskIDs := make([]string, 0, len(result.FailedTasks))
+	for _, t := range result.FailedTasks {
+		failedTaskIDs = append(failedTaskIDs, t.ID)
+	}
+	pendingTaskIDs := make([]string, 0)
+	var timeoutErr *WaitTimeoutError
+	if errors.As(waitErr, &timeoutErr) {
+		pendingTaskIDs = timeoutErr.PendingTaskIDs
+	}
+	// a failed wait reports the tasks which failed even when it didn't get as far as returning a result
+	var failedErr *TaskFailedError
+	if errors.As(waitErr, &failedErr) && len(failedTaskIDs) == 0 {
+		failedTaskIDs = failedErr.TaskIDs
+	}
+
+	errorMessage := ""
+	if waitErr != nil {
+		errorMessage = waitErr.Error()
+	}
+	return []string{
+		NotifyEnvStatus + "=" + notifyStatus(waitErr),
+		NotifyEnvExitCode + "=" + strconv.Itoa(exitCode(waitErr)),
+		NotifyEnvTaskIDs + "=" + strings.Join(taskIDs, ","),
+		NotifyEnvFailedTaskIDs + "=" + strings.Join(failedTaskIDs, ","),
+		NotifyEnvPendingTaskIDs + "=" + strings.Join(pendingTaskIDs, ","),
+		NotifyEnvDuration + "=" + formatDuration(elapsed),
+		NotifyEnvDurationSeconds + "=" + strconv.Itoa(int(elapsed.Seconds())),
+		NotifyEnvError + "=" + errorMessage,
+	}
+}
+
+// notifyStatus sums up how a wait ended. A task failing wins over another timing out, as it does for the exit code.
+func notifyStatus(waitErr error) string {
+	switch {
+	case waitErr == nil:
+		return NotifyStatusSuccess
+	case errors.Is(waitErr, ErrTaskFailed):
+		return NotifyStatusFailed
+	case errors.Is(waitErr, ErrWaitTimeout):
+		return NotifyStatusTimeout
+	case errors.Is(waitErr, ErrTaskInterrupted):
+		return NotifyStatusInterrupted
+	case errors.Is(waitErr, ErrWaitCancelled):
+		return NotifyStatusCancelled
+	case errors.Is(waitErr, ErrVerifyFailed):
+		return NotifyStatusUnverified
+	default:
+		return NotifyStatusError
+	}
+}
+
+// exitCode is the exit code the CLI exits with when a command returns err
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitCodeError cliErrors.ExitCodeError
+	if errors.As(err, &exitCodeError) {
+		return exitCodeError.ExitCode()
+	}
+	return 1
+}
+
+// runNotifyCommand runs command through the shell with the given environment, killing it if it runs for longer than
+// timeout. Its output goes to stderr, so that it doesn't get mixed up with structured output on stdout.
+func runNotifyCommand(command string, env []string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var notifyCmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		notifyCmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		notifyCmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	notifyCmd.Env = env
+	notifyCmd.Stdout = os.Stderr
+	notifyCmd.Stderr = os.Stderr
+	// anything the command started which is still holding on to its output doesn't hold up the wait either
+	notifyCmd.WaitDelay = time.Second
+
+	err := notifyCmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+	return err
+}
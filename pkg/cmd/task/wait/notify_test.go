@@ -0,0 +1,35 @@
+package wait
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifyStatus(t *testing.T) {
+	assert.Equal(t, NotifyStatusSuccess, notifyStatus(nil))
+	assert.Equal(t, NotifyStatusFailed, notifyStatus(NewTaskFailedError([]*TaskFailure{{TaskID: "ServerTasks-1"}})))
+	assert.Equal(t, NotifyStatusTimeout, notifyStatus(NewWaitTimeoutError()))
+	assert.Equal(t, NotifyStatusInterrupted, notifyStatus(NewTaskInterruptedError([]string{"ServerTasks-1"})))
+	assert.Equal(t, NotifyStatusCancelled, notifyStatus(fmt.Errorf("stopped: %w", ErrWaitCancelled)))
+	assert.Equal(t, NotifyStatusError, notifyStatus(errors.New("server unavailable")))
+
+	// a task failing wins over another timing out, as it does for the exit code
+	failedAndTimedOut := NewTaskFailedError([]*TaskFailure{{TaskID: "ServerTasks-1"}})
+	failedAndTimedOut.TimedOutTaskIDs = []string{"ServerTasks-2"}
+	assert.Equal(t, NotifyStatusFailed, notifyStatus(failedAndTimedOut))
+}
+
+func TestRunNotifyCommand_TimesOut(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the notify command is written for sh")
+	}
+	started := time.Now()
+	err := runNotifyCommand("exec sleep 10", nil, 100*time.Millisecond)
+	assert.EqualError(t, err, "timed out after 100ms")
+	assert.Less(t, time.Since(started), 5*time.Second)
+}
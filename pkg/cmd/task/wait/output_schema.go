@@ -0,0 +1,16 @@
+package wait
+
+import (
+	_ "embed"
+)
+
+// OutputSchemaVersion is the version of OutputSchema, which goes up whenever a field of the structured output is
+// changed or removed, so that tools built on it can tell. Adding a field doesn't change it.
+const OutputSchemaVersion = 1
+
+// OutputSchema is the JSON Schema of the structured output of task wait, printed by --schema: the array of
+// TaskResult written with --output-format json, and the events written with --output-format jsonl. The YAML output
+// has the same structure with lower camel case field names.
+//
+//go:embed output_schema.json
+var OutputSchema []byte
@@ -0,0 +1,245 @@
+package wait
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OctopusDeploy/cli/pkg/util"
+	"github.com/OctopusDeploy/cli/test/testutil"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// schemaValidator checks documents against the parts of JSON Schema which OutputSchema uses, which is enough to keep
+// the schema honest without depending on a full implementation of it
+type schemaValidator struct {
+	root map[string]any
+}
+
+func newSchemaValidator(t *testing.T) *schemaValidator {
+	var root map[string]any
+	require.NoError(t, json.Unmarshal(OutputSchema, &root))
+	return &schemaValidator{root: root}
+}
+
+func (v *schemaValidator) def(name string) map[string]any {
+	return v.root["$defs"].(map[string]any)[name].(map[string]any)
+}
+
+// validate returns what is wrong with value under schema, naming where it is with path
+func (v *schemaValidator) validate(schema map[string]any, value any, path string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		return v.validate(v.def(strings.TrimPrefix(ref, "#/$defs/")), value, path)
+	}
+
+	problems := make([]string, 0)
+	if oneOf, ok := schema["oneOf"].([]any); ok {
+		matches := 0
+		for _, option := range oneOf {
+			if len(v.validate(option.(map[string]any), value, path)) == 0 {
+				matches++
+			}
+		}
+		if matches != 1 {
+			problems = append(problems, fmt.Sprintf("%s matches %d of oneOf rather than 1", path, matches))
+		}
+	}
+	if expected, ok := schema["const"]; ok && expected != value {
+		problems = append(problems, fmt.Sprintf("%s is %v rather than %v", path, value, expected))
+	}
+	if types, ok := schema["type"]; ok && !matchesSchemaType(types, value) {
+		return append(problems, fmt.Sprintf("%s is %T rather than %v", path, value, types))
+	}
+	if n, ok := value.(float64); ok {
+		if minimum, ok := schema["minimum"].(float64); ok && n < minimum {
+			problems = append(problems, fmt.Sprintf("%s is %v, less than %v", path, n, minimum))
+		}
+		if maximum, ok := schema["maximum"].(float64); ok && n > maximum {
+			problems = append(problems, fmt.Sprintf("%s is %v, more than %v", path, n, maximum))
+		}
+	}
+	if s, ok := value.(string); ok && schema["format"] == "date-time" {
+		if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+			problems = append(problems, fmt.Sprintf("%s is %q, which isn't a date-time", path, s))
+		}
+	}
+	if items, ok := value.([]any); ok && schema["items"] != nil {
+		for i, item := range items {
+			problems = append(problems, v.validate(schema["items"].(map[string]any), item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	if object, ok := value.(map[string]any); ok {
+		properties, _ := schema["properties"].(map[string]any)
+		for _, required := range schemaRequired(schema) {
+			if _, ok := object[required]; !ok {
+				problems = append(problems, fmt.Sprintf("%s is missing %s", path, required))
+			}
+		}
+		for name, field := range object {
+			property, ok := properties[name]
+			if !ok {
+				if additional, ok := schema["additionalProperties"].(map[string]any); ok {
+					problems = append(problems, v.validate(additional, field, path+"."+name)...)
+				} else if schema["additionalProperties"] == false {
+					problems = append(problems, fmt.Sprintf("%s has %s, which isn't in the schema", path, name))
+				}
+				continue
+			}
+			problems = append(problems, v.validate(property.(map[string]any), field, path+"."+name)...)
+		}
+	}
+	return problems
+}
+
+func matchesSchemaType(types any, value any) bool {
+	allowed, ok := types.([]any)
+	if !ok {
+		allowed = []any{types}
+	}
+	return util.SliceContainsAny(allowed, func(t any) bool {
+		switch t {
+		case "object":
+			_, ok := value.(map[string]any)
+			return ok
+		case "array":
+			_, ok := value.([]any)
+			return ok
+		case "string":
+			_, ok := value.(string)
+			return ok
+		case "boolean":
+			_, ok := value.(bool)
+			return ok
+		case "integer":
+			n, ok := value.(float64)
+			return ok && n == float64(int64(n))
+		case "number":
+			_, ok := value.(float64)
+			return ok
+		case "null":
+			return value == nil
+		}
+		return false
+	})
+}
+
+func schemaRequired(schema map[string]any) []string {
+	required, _ := schema["required"].([]any)
+	return util.SliceTransform(required, func(r any) string { return r.(string) })
+}
+
+// jsonFieldNames are the names the fields of a struct are written with by encoding/json, including those of any
+// structs embedded in it
+func jsonFieldNames(t reflect.Type) []string {
+	names := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous {
+			names = append(names, jsonFieldNames(field.Type)...)
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestOutputSchema_MatchesTheOutputTypes(t *testing.T) {
+	v := newSchemaValidator(t)
+	defs := map[string]reflect.Type{
+		"taskResult":    reflect.TypeOf(TaskResult{}),
+		"taskFailure":   reflect.TypeOf(TaskFailure{}),
+		"verifyResult":  reflect.TypeOf(VerifyResult{}),
+		"stateEvent":    reflect.TypeOf(TaskStateEvent{}),
+		"progressEvent": reflect.TypeOf(TaskProgressEvent{}),
+		"logEvent":      reflect.TypeOf(TaskLogEvent{}),
+		"summaryEvent":  reflect.TypeOf(TaskSummaryEvent{}),
+	}
+	for def, outputType := range defs {
+		properties := make([]string, 0)
+		for name := range v.def(def)["properties"].(map[string]any) {
+			properties = append(properties, name)
+		}
+		sort.Strings(properties)
+		assert.Equal(t, jsonFieldNames(outputType), properties, "the properties of %s don't match %s", def, outputType.Name())
+	}
+}
+
+func TestOutputSchema_Version(t *testing.T) {
+	v := newSchemaValidator(t)
+	assert.True(t, strings.HasSuffix(v.root["$id"].(string), fmt.Sprintf(":v%d", OutputSchemaVersion)))
+}
+
+func TestOutputSchema_ValidatesJsonOutput(t *testing.T) {
+	v := newSchemaValidator(t)
+	results := []*TaskResult{
+		{ID: "ServerTasks-1", Name: "Deploy Bar 1 release 0.0.2 to Foo", State: "Success", FinishedSuccessfully: true, Duration: "1m0s"},
+		{
+			ID: "ServerTasks-3", Name: "Deploy Bar 2 release 0.0.2 to Foo", State: "Failed", Duration: "5s", Errors: "The step failed",
+			Warnings: 2, Link: "https://octopus.example.com/app#/Spaces-1/tasks/ServerTasks-3", Attempts: 2,
+			RetriedTaskIDs: []string{"ServerTasks-2"}, QueuedFor: "30s", ExecutingFor: "5s", QueueWaitObserved: true,
+			Project: "Bar 2", Environment: "Foo", Release: "0.0.2",
+		},
+		{
+			ID: "ServerTasks-4", Name: "Run Restart on Foo", State: "Success", FinishedSuccessfully: true,
+			Project: "Bar 1", Environment: "Foo", Runbook: "Restart", RunbookSnapshot: "Snapshot 3",
+			Outputs: map[string]string{"Octopus.Action[Restart].Output.RestartedAt": "2024-01-31T18:00:00Z"},
+		},
+	}
+	data, err := MarshalTaskResults(results, "json")
+	require.NoError(t, err)
+
+	var document any
+	require.NoError(t, json.Unmarshal(data, &document))
+	assert.Empty(t, v.validate(v.root, document, "$"))
+
+	// a field the schema doesn't know about is caught
+	var unknown any
+	require.NoError(t, json.Unmarshal([]byte(`[{"Id": "ServerTasks-1", "Name": "", "State": "Success", "FinishedSuccessfully": true, "Extra": 1}]`), &unknown))
+	assert.Equal(t, []string{"$[0] has Extra, which isn't in the schema"}, v.validate(v.root, unknown, "$"))
+}
+
+func TestOutputSchema_ValidatesJsonLinesOutput(t *testing.T) {
+	v := newSchemaValidator(t)
+	out := bytes.Buffer{}
+	events := NewTaskEventWriter(&out)
+
+	executing := testutil.NewFakeTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing")
+	details := &tasks.TaskDetailsResource{
+		Progress: &tasks.TaskProgress{ProgressPercentage: 40},
+		ActivityLogs: []*tasks.ActivityElement{{
+			ID:     "ServerTasks-1_step1",
+			Name:   "Step 1: Deploy package",
+			Status: "Running",
+			LogElements: []*tasks.ActivityLogElement{
+				{Category: "Info", MessageText: "Deploying package", OccurredAt: time.Date(2024, 1, 31, 18, 0, 0, 0, time.UTC)},
+			},
+		}},
+	}
+	require.NoError(t, events.WriteState(executing, ""))
+	require.NoError(t, events.WriteProgress(executing, details))
+	require.NoError(t, events.WriteLogs(executing, details))
+	require.NoError(t, events.WriteState(testutil.NewFakeTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Failed"), "Executing"))
+	failed := NewTaskFailedError([]*TaskFailure{{TaskID: "ServerTasks-1", Name: "Deploy Bar 1 release 0.0.2 to Foo", Message: "The step failed"}})
+	verification := &VerifyResult{URL: "https://myapp.example.com/health", Attempts: 1, Duration: "1s", Error: "connection refused"}
+	require.NoError(t, events.WriteSummary([]*TaskResult{{ID: "ServerTasks-1", State: "Failed"}}, verification, failed))
+
+	types := make([]string, 0)
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var event map[string]any
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		types = append(types, event["Type"].(string))
+		assert.Empty(t, v.validate(v.def("event"), event, "$"), scanner.Text())
+	}
+	assert.Equal(t, []string{TaskEventState, TaskEventProgress, TaskEventLog, TaskEventState, TaskEventSummary}, types)
+}
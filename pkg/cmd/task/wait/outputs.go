@@ -0,0 +1,138 @@
+package wait
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/client"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/newclient"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+)
+
+// verboseDetailsTemplate fetches the details of a task along with its verbose log, which is where the output variables
+// set by its steps are recorded
+const verboseDetailsTemplate = "/api/{spaceId}/tasks/{id}/details?verbose=true"
+
+// sensitiveOutputMask stands in for the value of an output variable which was set as sensitive
+const sensitiveOutputMask = "********"
+
+// TaskOutputsCallback finds the output variables set by the steps of a task, keyed by their full name
+type TaskOutputsCallback func(taskID string) (map[string]string, error)
+
+func GetTaskOutputsCallback(octopus *client.Client, spaceID string) TaskOutputsCallback {
+	hints := retryAfterHints(octopus)
+	return func(taskID string) (map[string]string, error) {
+		path, err := octopus.URITemplateCache().Expand(verboseDetailsTemplate, map[string]any{
+			"spaceId": spaceID,
+			"id":      taskID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		details, err := newclient.Get[tasks.TaskDetailsResource](octopus.HttpSession(), path)
+		if err != nil {
+			return nil, hints.wrap(err)
+		}
+		return parseOutputVariables(details), nil
+	}
+}
+
+// setVariablePattern matches the service message a step logs to set an output variable, such as
+// "##octopus[setVariable name='TXlWYXI=' value='dmFsdWU=']", whose attributes are base64 encoded
+var setVariablePattern = regexp.MustCompile(`##octopus\[setVariable ([^\]]*)\]`)
+
+var serviceMessageAttributePattern = regexp.MustCompile(`(\w+)='([^']*)'`)
+
+// parseOutputVariables finds the output variables set by the steps of a task in its log, keyed by the name they are
+// referred to by in later steps, such as "Octopus.Action[Deploy web app].Output.Url". A variable set more than once
+// keeps the value it was last set to, and the value of a sensitive one is masked.
+func parseOutputVariables(details *tasks.TaskDetailsResource) map[string]string {
+	outputs := make(map[string]string)
+	if details == nil {
+		return outputs
+	}
+	for _, activity := range details.ActivityLogs {
+		if activity == nil {
+			continue
+		}
+		for _, step := range activity.Children {
+			if step == nil {
+				continue
+			}
+			stepName := stepNumberPrefixPattern.ReplaceAllString(step.Name, "")
+			collectOutputVariables(step, stepName, outputs)
+		}
+	}
+	return outputs
+}
+
+func collectOutputVariables(activity *tasks.ActivityElement, stepName string, outputs map[string]string) {
+	for _, element := range activity.LogElements {
+		if element == nil {
+			continue
+		}
+		for _, match := range setVariablePattern.FindAllStringSubmatch(element.MessageText, -1) {
+			attributes := make(map[string]string)
+			for _, attribute := range serviceMessageAttributePattern.FindAllStringSubmatch(match[1], -1) {
+				value, err := base64.StdEncoding.DecodeString(attribute[2])
+				if err != nil {
+					continue
+				}
+				attributes[attribute[1]] = string(value)
+			}
+			name, ok := attributes["name"]
+			if !ok || name == "" {
+				continue
+			}
+			value := attributes["value"]
+			if strings.EqualFold(attributes["sensitive"], "true") {
+				value = sensitiveOutputMask
+			}
+			outputs[fmt.Sprintf("Octopus.Action[%s].Output.%s", stepName, name)] = value
+		}
+	}
+	for _, child := range activity.Children {
+		if child != nil {
+			collectOutputVariables(child, stepName, outputs)
+		}
+	}
+}
+
+// filterOutputs keeps the output variables whose full name, or own name after "Output.", starts with any of
+// prefixes, or all of them when there are no prefixes
+func filterOutputs(outputs map[string]string, prefixes []string) map[string]string {
+	if len(prefixes) == 0 {
+		return outputs
+	}
+	filtered := make(map[string]string)
+	for key, value := range outputs {
+		_, name, _ := strings.Cut(key, "].Output.")
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) || strings.HasPrefix(name, prefix) {
+				filtered[key] = value
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// fetchTaskOutputs finds the output variables of each task which succeeded, for --print-outputs, keyed by task ID.
+// A task whose output variables can't be fetched is left out with a warning, rather than failing a wait whose tasks
+// have already succeeded.
+func fetchTaskOutputs(opts *WaitOptions, formatter *TaskOutputFormatter, succeededTasks []*tasks.Task, printProgress bool) map[string]map[string]string {
+	outputs := make(map[string]map[string]string, len(succeededTasks))
+	for _, t := range succeededTasks {
+		taskOutputs, err := opts.TaskOutputsCallback(t.ID)
+		if err != nil {
+			if printProgress {
+				formatter.PrintWarning(fmt.Sprintf("failed to fetch the output variables of %s: %v", t.ID, err))
+			}
+			continue
+		}
+		outputs[t.ID] = filterOutputs(taskOutputs, opts.OutputsPrefixes)
+	}
+	return outputs
+}
@@ -0,0 +1,69 @@
+package wait
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+	"github.com/stretchr/testify/assert"
+)
+
+func setVariableMessage(name string, value string, sensitive bool) string {
+	message := fmt.Sprintf("##octopus[setVariable name='%s' value='%s'", base64.StdEncoding.EncodeToString([]byte(name)), base64.StdEncoding.EncodeToString([]byte(value)))
+	if sensitive {
+		message += fmt.Sprintf(" sensitive='%s'", base64.StdEncoding.EncodeToString([]byte("True")))
+	}
+	return message + "]"
+}
+
+func TestParseOutputVariables(t *testing.T) {
+	details := &tasks.TaskDetailsResource{
+		ActivityLogs: []*tasks.ActivityElement{{
+			Name: "Deploy Bar 1 release 0.0.2 to Foo",
+			Children: []*tasks.ActivityElement{
+				{
+					Name: "Step 1: Deploy web app",
+					Children: []*tasks.ActivityElement{{
+						Name: "Web01",
+						LogElements: []*tasks.ActivityLogElement{
+							{Category: "Info", MessageText: "Deploying package"},
+							{Category: "Verbose", MessageText: setVariableMessage("Url", "https://old.example.com", false)},
+							{Category: "Verbose", MessageText: setVariableMessage("Url", "https://myapp.example.com", false)},
+							{Category: "Verbose", MessageText: setVariableMessage("ApiKey", "API-123", true)},
+						},
+					}},
+				},
+				{
+					Name: "Step 2: Smoke test",
+					LogElements: []*tasks.ActivityLogElement{
+						{Category: "Verbose", MessageText: setVariableMessage("Passed", "True", false)},
+						{Category: "Verbose", MessageText: "##octopus[setVariable name='not base64!']"},
+					},
+				},
+			},
+		}},
+	}
+
+	assert.Equal(t, map[string]string{
+		"Octopus.Action[Deploy web app].Output.Url":    "https://myapp.example.com",
+		"Octopus.Action[Deploy web app].Output.ApiKey": sensitiveOutputMask,
+		"Octopus.Action[Smoke test].Output.Passed":     "True",
+	}, parseOutputVariables(details))
+	assert.Empty(t, parseOutputVariables(nil))
+}
+
+func TestFilterOutputs(t *testing.T) {
+	outputs := map[string]string{
+		"Octopus.Action[Deploy web app].Output.Url":    "https://myapp.example.com",
+		"Octopus.Action[Deploy web app].Output.ApiKey": sensitiveOutputMask,
+		"Octopus.Action[Smoke test].Output.Passed":     "True",
+	}
+
+	assert.Equal(t, outputs, filterOutputs(outputs, nil))
+	assert.Equal(t, map[string]string{
+		"Octopus.Action[Deploy web app].Output.Url": "https://myapp.example.com",
+		"Octopus.Action[Smoke test].Output.Passed":  "True",
+	}, filterOutputs(outputs, []string{"Url", "Octopus.Action[Smoke test]"}))
+	assert.Empty(t, filterOutputs(outputs, []string{"Missing"}))
+}
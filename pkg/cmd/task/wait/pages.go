@@ -0,0 +1,89 @@
+package wait
+
+import (
+	"time"
+
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/resources"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+)
+
+// PageRetries is how many times a page of results which fails to load is fetched again before the whole query fails
+const PageRetries = 3
+
+// pageRetryDelay is how long to wait before fetching a page again, multiplied by the number of the attempt
+const pageRetryDelay = 500 * time.Millisecond
+
+// DefaultIDBatchSize is how many task IDs are fetched by a single query unless --id-batch-size says otherwise
+const DefaultIDBatchSize = 100
+
+// PageRetryCallback is told about each page which failed to load and is about to be fetched again. Pages are
+// numbered from 1, which is the page the query itself returns.
+type PageRetryCallback func(page int, attempt int, err error)
+
+// collectPages follows the pages after first until all of them have been fetched, or just the first limit of the
+// items if limit is greater than zero. A page which fails to load is fetched again, up to PageRetries times, rather
+// than throwing away the pages which have already been fetched; a long query on a flaky connection otherwise has
+// to start over from the first page each time any page fails. The retries wait by calling sleep. With stop, the
+// pages after the first it returns true for aren't fetched at all.
+func collectPages[T any](first *resources.Resources[T], nextPage func(*resources.Resources[T]) (*resources.Resources[T], error), limit int, retryDelay time.Duration, sleep func(time.Duration), onRetry PageRetryCallback, stop func(*resources.Resources[T]) bool) ([]T, error) {
+	items := make([]T, 0)
+	pageNumber := 1
+	for page := first; page != nil; pageNumber++ {
+		items = append(items, page.Items...)
+		if limit > 0 && len(items) >= limit {
+			return items[:limit], nil
+		}
+		if stop != nil && stop(page) {
+			return items, nil
+		}
+
+		next, err := nextPage(page)
+		for attempt := 1; err != nil && attempt <= PageRetries; attempt++ {
+			if onRetry != nil {
+				onRetry(pageNumber+1, attempt, err)
+			}
+			sleep(time.Duration(attempt) * retryDelay)
+			next, err = nextPage(page)
+		}
+		if err != nil {
+			return nil, err
+		}
+		page = next
+	}
+	return items, nil
+}
+
+// batchServerTasks wraps getServerTasks so that more than batchSize task IDs are fetched in batches of at most that
+// many, one after another. The IDs of a query go in its URL, which the server, and any proxy in front of it, limit
+// the length of, so a single query for hundreds of tasks can fail. The tasks of each batch are merged in the order
+// of the batches.
+func batchServerTasks(getServerTasks ServerTasksCallback, batchSize int) ServerTasksCallback {
+	return func(taskIDs []string) ([]*tasks.Task, error) {
+		if len(taskIDs) <= batchSize {
+			return getServerTasks(taskIDs)
+		}
+		serverTasks := make([]*tasks.Task, 0, len(taskIDs))
+		for start := 0; start < len(taskIDs); start += batchSize {
+			batch, err := getServerTasks(taskIDs[start:min(start+batchSize, len(taskIDs))])
+			if err != nil {
+				return nil, err
+			}
+			serverTasks = append(serverTasks, batch...)
+		}
+		return serverTasks, nil
+	}
+}
+
+// queuedBefore stops paging through tasks, which the server lists newest first, at the first page whose tasks were
+// all queued before since, as every page after it will be too. A task which doesn't say when it was queued doesn't
+// stop it.
+func queuedBefore(since time.Time) func(*resources.Resources[*tasks.Task]) bool {
+	return func(page *resources.Resources[*tasks.Task]) bool {
+		for _, t := range page.Items {
+			if t.QueueTime == nil || !t.QueueTime.Before(since) {
+				return false
+			}
+		}
+		return len(page.Items) != 0
+	}
+}
@@ -0,0 +1,192 @@
+package wait
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/OctopusDeploy/cli/test/testutil"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/resources"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePages is a paginator over pages of items, failing to load each page as many times as it is scripted to
+type fakePages struct {
+	pages    [][]string
+	failures map[int]int
+	fetches  map[int]int
+}
+
+func (p *fakePages) page(number int) *resources.Resources[string] {
+	page := &resources.Resources[string]{Items: p.pages[number-1]}
+	if number < len(p.pages) {
+		page.Links.PageNext = fmt.Sprintf("/api/tasks?page=%d", number+1)
+	}
+	// collectPages doesn't read ItemsPerPage, so it can carry the page number along for nextPage
+	page.ItemsPerPage = number
+	return page
+}
+
+func (p *fakePages) nextPage(page *resources.Resources[string]) (*resources.Resources[string], error) {
+	if page.Links.PageNext == "" {
+		return nil, nil
+	}
+	number := page.ItemsPerPage + 1
+	p.fetches[number]++
+	if p.fetches[number] <= p.failures[number] {
+		return nil, errors.New("connection reset by peer")
+	}
+	return p.page(number), nil
+}
+
+func TestCollectPages_RetriesFailedPage(t *testing.T) {
+	pages := &fakePages{
+		pages:    [][]string{{"ServerTasks-1", "ServerTasks-2"}, {"ServerTasks-3", "ServerTasks-4"}, {"ServerTasks-5"}},
+		failures: map[int]int{2: 1},
+		fetches:  make(map[int]int),
+	}
+
+	retries := make([]string, 0)
+	items, err := collectPages(pages.page(1), pages.nextPage, 0, 0, time.Sleep, func(page int, attempt int, err error) {
+		retries = append(retries, fmt.Sprintf("page %d attempt %d: %v", page, attempt, err))
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ServerTasks-1", "ServerTasks-2", "ServerTasks-3", "ServerTasks-4", "ServerTasks-5"}, items)
+	assert.Equal(t, []string{"page 2 attempt 1: connection reset by peer"}, retries)
+	// only the page which failed is fetched again
+	assert.Equal(t, map[int]int{2: 2, 3: 1}, pages.fetches)
+}
+
+func TestCollectPages_GivesUpAfterRetries(t *testing.T) {
+	pages := &fakePages{
+		pages:    [][]string{{"ServerTasks-1"}, {"ServerTasks-2"}},
+		failures: map[int]int{2: PageRetries + 1},
+		fetches:  make(map[int]int),
+	}
+
+	sleeps := make([]time.Duration, 0)
+	items, err := collectPages(pages.page(1), pages.nextPage, 0, pageRetryDelay, func(d time.Duration) { sleeps = append(sleeps, d) }, nil, nil)
+	assert.EqualError(t, err, "connection reset by peer")
+	// each retry waits longer than the one before
+	assert.Equal(t, []time.Duration{500 * time.Millisecond, time.Second, 1500 * time.Millisecond}, sleeps)
+	assert.Nil(t, items)
+	assert.Equal(t, PageRetries+1, pages.fetches[2])
+}
+
+func TestCollectPages_Limit(t *testing.T) {
+	pages := &fakePages{
+		pages:    [][]string{{"ServerTasks-1", "ServerTasks-2"}, {"ServerTasks-3", "ServerTasks-4"}},
+		failures: map[int]int{},
+		fetches:  make(map[int]int),
+	}
+
+	items, err := collectPages(pages.page(1), pages.nextPage, 3, 0, time.Sleep, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ServerTasks-1", "ServerTasks-2", "ServerTasks-3"}, items)
+
+	// a limit which the first page already fills doesn't fetch any more pages
+	pages.fetches = make(map[int]int)
+	items, err = collectPages(pages.page(1), pages.nextPage, 2, 0, time.Sleep, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ServerTasks-1", "ServerTasks-2"}, items)
+	assert.Empty(t, pages.fetches)
+}
+
+func TestCollectPages_Stop(t *testing.T) {
+	pages := &fakePages{
+		pages:    [][]string{{"ServerTasks-5", "ServerTasks-4"}, {"ServerTasks-3", "ServerTasks-2"}, {"ServerTasks-1"}},
+		failures: map[int]int{},
+		fetches:  make(map[int]int),
+	}
+
+	items, err := collectPages(pages.page(1), pages.nextPage, 0, 0, time.Sleep, nil, func(page *resources.Resources[string]) bool {
+		return page.ItemsPerPage == 2
+	})
+	assert.NoError(t, err)
+	// the page it stops at is kept, but the pages after it aren't fetched
+	assert.Equal(t, []string{"ServerTasks-5", "ServerTasks-4", "ServerTasks-3", "ServerTasks-2"}, items)
+	assert.Equal(t, map[int]int{2: 1}, pages.fetches)
+}
+
+func TestQueuedBefore(t *testing.T) {
+	since := time.Date(2024, 1, 31, 10, 0, 0, 0, time.UTC)
+	newPage := func(queuedAgo ...time.Duration) *resources.Resources[*tasks.Task] {
+		page := &resources.Resources[*tasks.Task]{}
+		for i, ago := range queuedAgo {
+			task := testutil.NewFakeTask(fmt.Sprintf("ServerTasks-%d", i+1), "", "Success")
+			queueTime := since.Add(-ago)
+			task.QueueTime = &queueTime
+			page.Items = append(page.Items, task)
+		}
+		return page
+	}
+
+	stop := queuedBefore(since)
+	assert.True(t, stop(newPage(time.Minute, time.Hour)))
+	assert.False(t, stop(newPage(-time.Minute, time.Hour)))
+	assert.False(t, stop(newPage(0, time.Hour)))
+	assert.False(t, stop(newPage()))
+
+	unknown := newPage(time.Hour)
+	unknown.Items[0].QueueTime = nil
+	assert.False(t, stop(unknown))
+}
+
+func TestBatchServerTasks(t *testing.T) {
+	taskIDs := make([]string, 500)
+	for i := range taskIDs {
+		taskIDs[i] = fmt.Sprintf("ServerTasks-%d", i+1)
+	}
+
+	tests := []struct {
+		name       string
+		batchSize  int
+		batchSizes []int
+	}{
+		{"default batch size", DefaultIDBatchSize, []int{100, 100, 100, 100, 100}},
+		{"batch size which doesn't divide evenly", 200, []int{200, 200, 100}},
+		{"batch size larger than the IDs", 1000, []int{500}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			batchSizes := make([]int, 0)
+			getServerTasks := batchServerTasks(func(ids []string) ([]*tasks.Task, error) {
+				batchSizes = append(batchSizes, len(ids))
+				serverTasks := make([]*tasks.Task, 0, len(ids))
+				for _, id := range ids {
+					serverTasks = append(serverTasks, testutil.NewFakeTask(id, "Deploy "+id, "Success"))
+				}
+				return serverTasks, nil
+			}, test.batchSize)
+
+			serverTasks, err := getServerTasks(taskIDs)
+			assert.NoError(t, err)
+			assert.Equal(t, test.batchSizes, batchSizes)
+			fetchedIDs := make([]string, 0, len(serverTasks))
+			for _, task := range serverTasks {
+				fetchedIDs = append(fetchedIDs, task.ID)
+			}
+			// every task comes back exactly once, in the order it was asked for
+			assert.Equal(t, taskIDs, fetchedIDs)
+		})
+	}
+}
+
+func TestBatchServerTasks_FailedBatch(t *testing.T) {
+	calls := 0
+	getServerTasks := batchServerTasks(func(ids []string) ([]*tasks.Task, error) {
+		calls++
+		if calls == 2 {
+			return nil, errors.New("connection reset by peer")
+		}
+		return []*tasks.Task{}, nil
+	}, 2)
+
+	serverTasks, err := getServerTasks([]string{"ServerTasks-1", "ServerTasks-2", "ServerTasks-3", "ServerTasks-4", "ServerTasks-5"})
+	assert.EqualError(t, err, "connection reset by peer")
+	assert.Nil(t, serverTasks)
+	// the batches after the one which failed aren't fetched
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,126 @@
+package wait
+
+import (
+	"time"
+
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+)
+
+// QueueWait is how long a task spent queued before it started executing, and how long it spent executing, for
+// --print-queue-wait. Both run up to now for a task which hadn't got any further when the wait ended.
+type QueueWait struct {
+	Queued    time.Duration
+	Executing time.Duration
+	// Observed is set when the server didn't say when the task was queued, so the durations are from the state
+	// changes seen while waiting instead. Those only start from when the wait began, and are only as precise as the
+	// polls were frequent.
+	Observed bool
+}
+
+// taskTransitions are the times the wait saw a task in each of the stages of its life. The zero time means the task
+// hasn't been seen in that stage yet.
+type taskTransitions struct {
+	// queued is when the task was first seen, if it was still queued then
+	queued    time.Time
+	started   time.Time
+	completed time.Time
+}
+
+// transitionLog records when each task was seen to start executing and to finish, so that how long it was queued for
+// can still be worked out if the server doesn't say
+type transitionLog struct {
+	tasks map[string]*taskTransitions
+	now   func() time.Time
+}
+
+func newTransitionLog(clock Clock) *transitionLog {
+	return &transitionLog{tasks: make(map[string]*taskTransitions), now: clock.Now}
+}
+
+// observe records the stage t is in, if it is the first time it has been seen in it
+func (l *transitionLog) observe(t *tasks.Task) {
+	now := l.now()
+	transitions, ok := l.tasks[t.ID]
+	if !ok {
+		transitions = &taskTransitions{}
+		l.tasks[t.ID] = transitions
+		if t.State == "Queued" {
+			transitions.queued = now
+		}
+	}
+	// a task which finishes without ever executing, such as one cancelled while queued, starts and finishes at once
+	if t.State != "Queued" && transitions.started.IsZero() {
+		transitions.started = now
+	}
+	if t.IsCompleted != nil && *t.IsCompleted && transitions.completed.IsZero() {
+		transitions.completed = now
+	}
+}
+
+// queueWaits works out how long each of the given tasks was queued and executing for, going by the times the server
+// gives where it gives them, and by what was observed otherwise
+func (l *transitionLog) queueWaits(waitedTasks []*tasks.Task) map[string]QueueWait {
+	now := l.now()
+	waits := make(map[string]QueueWait, len(waitedTasks))
+	for _, t := range waitedTasks {
+		if t.QueueTime != nil {
+			waits[t.ID] = serverQueueWait(t, now)
+		} else if transitions, ok := l.tasks[t.ID]; ok {
+			waits[t.ID] = transitions.queueWait(now)
+		}
+	}
+	return waits
+}
+
+func serverQueueWait(t *tasks.Task, now time.Time) QueueWait {
+	switch {
+	case t.StartTime != nil:
+		completed := now
+		if t.CompletedTime != nil {
+			completed = *t.CompletedTime
+		}
+		return QueueWait{Queued: t.StartTime.Sub(*t.QueueTime), Executing: completed.Sub(*t.StartTime)}
+	case t.CompletedTime != nil:
+		return QueueWait{Queued: t.CompletedTime.Sub(*t.QueueTime)}
+	default:
+		return QueueWait{Queued: now.Sub(*t.QueueTime)}
+	}
+}
+
+func (t *taskTransitions) queueWait(now time.Time) QueueWait {
+	wait := QueueWait{Observed: true}
+	started := now
+	if !t.started.IsZero() {
+		started = t.started
+		completed := now
+		if !t.completed.IsZero() {
+			completed = t.completed
+		}
+		wait.Executing = completed.Sub(t.started)
+	}
+	// a task which was already executing when the wait began was queued for as long as it took to start before then,
+	// which there's no telling
+	if !t.queued.IsZero() {
+		wait.Queued = started.Sub(t.queued)
+	}
+	return wait
+}
+
+// addQueueWaitTracking records when the wait sees each task move from one stage of its life to the next
+func addQueueWaitTracking(config *WaitConfig, log *transitionLog) {
+	onTaskAdded := config.OnTaskAdded
+	config.OnTaskAdded = func(t *tasks.Task) {
+		log.observe(t)
+		if onTaskAdded != nil {
+			onTaskAdded(t)
+		}
+	}
+
+	onTaskPolled := config.OnTaskPolled
+	config.OnTaskPolled = func(t *tasks.Task, details *tasks.TaskDetailsResource, detailsErr error) {
+		log.observe(t)
+		if onTaskPolled != nil {
+			onTaskPolled(t, details, detailsErr)
+		}
+	}
+}
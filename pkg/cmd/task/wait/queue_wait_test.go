@@ -0,0 +1,89 @@
+package wait
+
+import (
+	"testing"
+	"time"
+
+	"github.com/OctopusDeploy/cli/test/testutil"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransitionLog_Observed(t *testing.T) {
+	now := time.Date(2024, 1, 31, 18, 0, 0, 0, time.UTC)
+	log := newTransitionLog(realClock{})
+	log.now = func() time.Time { return now }
+	step := func(d time.Duration, observed ...*tasks.Task) {
+		now = now.Add(d)
+		for _, t := range observed {
+			log.observe(t)
+		}
+	}
+
+	// ServerTasks-1 is queued when the wait begins, ServerTasks-2 is already executing, ServerTasks-3 is cancelled
+	// before it ever executes and ServerTasks-4 is still queued when the wait ends
+	step(0,
+		testutil.NewFakeTask("ServerTasks-1", "Deploy", "Queued"),
+		testutil.NewFakeTask("ServerTasks-2", "Deploy", "Executing"),
+		testutil.NewFakeTask("ServerTasks-3", "Deploy", "Queued"),
+		testutil.NewFakeTask("ServerTasks-4", "Deploy", "Queued"))
+	step(10*time.Second,
+		testutil.NewFakeTask("ServerTasks-1", "Deploy", "Queued"),
+		testutil.NewFakeTask("ServerTasks-2", "Deploy", "Success"),
+		testutil.NewFakeTask("ServerTasks-3", "Deploy", "Canceled"),
+		testutil.NewFakeTask("ServerTasks-4", "Deploy", "Queued"))
+	step(20*time.Second,
+		testutil.NewFakeTask("ServerTasks-1", "Deploy", "Executing"),
+		testutil.NewFakeTask("ServerTasks-4", "Deploy", "Queued"))
+	step(30*time.Second,
+		testutil.NewFakeTask("ServerTasks-1", "Deploy", "Executing"),
+		testutil.NewFakeTask("ServerTasks-4", "Deploy", "Queued"))
+	step(40*time.Second,
+		testutil.NewFakeTask("ServerTasks-1", "Deploy", "Failed"),
+		testutil.NewFakeTask("ServerTasks-4", "Deploy", "Queued"))
+	step(5 * time.Second)
+
+	waits := log.queueWaits([]*tasks.Task{
+		testutil.NewFakeTask("ServerTasks-1", "Deploy", "Failed"),
+		testutil.NewFakeTask("ServerTasks-2", "Deploy", "Success"),
+		testutil.NewFakeTask("ServerTasks-3", "Deploy", "Canceled"),
+		testutil.NewFakeTask("ServerTasks-4", "Deploy", "Queued"),
+		// never observed, and the server doesn't say either
+		testutil.NewFakeTask("ServerTasks-5", "Deploy", "Success"),
+	})
+	assert.Equal(t, map[string]QueueWait{
+		"ServerTasks-1": {Queued: 30 * time.Second, Executing: 70 * time.Second, Observed: true},
+		"ServerTasks-2": {Executing: 10 * time.Second, Observed: true},
+		"ServerTasks-3": {Queued: 10 * time.Second, Observed: true},
+		"ServerTasks-4": {Queued: 105 * time.Second, Observed: true},
+	}, waits)
+}
+
+func TestTransitionLog_FromServer(t *testing.T) {
+	now := time.Date(2024, 1, 31, 18, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+	log := newTransitionLog(realClock{})
+	log.now = func() time.Time { return now }
+
+	finished := testutil.NewFakeTask("ServerTasks-1", "Deploy", "Success")
+	finished.QueueTime, finished.StartTime, finished.CompletedTime = at(-10*time.Minute), at(-8*time.Minute), at(-time.Minute)
+	executing := testutil.NewFakeTask("ServerTasks-2", "Deploy", "Executing")
+	executing.QueueTime, executing.StartTime = at(-5*time.Minute), at(-4*time.Minute)
+	cancelled := testutil.NewFakeTask("ServerTasks-3", "Deploy", "Canceled")
+	cancelled.QueueTime, cancelled.CompletedTime = at(-3*time.Minute), at(-2*time.Minute)
+	queued := testutil.NewFakeTask("ServerTasks-4", "Deploy", "Queued")
+	queued.QueueTime = at(-30 * time.Second)
+	// what the server says wins over what was observed
+	log.observe(testutil.NewFakeTask("ServerTasks-1", "Deploy", "Executing"))
+
+	waits := log.queueWaits([]*tasks.Task{finished, executing, cancelled, queued})
+	assert.Equal(t, map[string]QueueWait{
+		"ServerTasks-1": {Queued: 2 * time.Minute, Executing: 7 * time.Minute},
+		"ServerTasks-2": {Queued: time.Minute, Executing: 4 * time.Minute},
+		"ServerTasks-3": {Queued: time.Minute},
+		"ServerTasks-4": {Queued: 30 * time.Second},
+	}, waits)
+}
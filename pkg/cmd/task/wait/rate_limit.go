@@ -0,0 +1,82 @@
+package wait
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// DefaultAPIRateLimit is how many requests a second task wait makes to the server at most unless --api-rate-limit
+// says otherwise. It is generous enough not to slow down any but the biggest waits.
+const DefaultAPIRateLimit = 20
+
+// rateLimiter is a token bucket shared by every request made while waiting, so that polls, detail fetches and
+// anything else the wait does all count towards the same limit however many workers are making them. The bucket
+// holds up to burst tokens and refills at rate tokens a second.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+	sleep  func(time.Duration)
+}
+
+// newRateLimiter allows rate requests a second by clock, with up to a second's worth of them at once, starting full
+func newRateLimiter(rate float64, clock Clock) *rateLimiter {
+	burst := max(1, math.Floor(rate))
+	return &rateLimiter{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   clock.Now(),
+		now:    clock.Now,
+		sleep:  clock.Sleep,
+	}
+}
+
+// Wait blocks until a request can be made. A request which has to wait takes its token there and then, leaving the
+// bucket in debt, so that requests waiting at the same time are let through one after the other in turn.
+func (l *rateLimiter) Wait() {
+	l.mu.Lock()
+	now := l.now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens--
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay > 0 {
+		l.sleep(delay)
+	}
+}
+
+// addRateLimit makes every call for the state or details of tasks, and every rerun, wait for limiter first
+func addRateLimit(config *WaitConfig, limiter *rateLimiter) {
+	if config.GetServerTasksCallback != nil {
+		config.GetServerTasksCallback = withRateLimit(config.GetServerTasksCallback, limiter)
+	}
+	if config.GetTaskDetailsCallback != nil {
+		config.GetTaskDetailsCallback = withRateLimit(config.GetTaskDetailsCallback, limiter)
+	}
+	if config.QueryTasksCallback != nil {
+		config.QueryTasksCallback = withRateLimit(config.QueryTasksCallback, limiter)
+	}
+	if config.QueryRecentTasksCallback != nil {
+		config.QueryRecentTasksCallback = withRateLimit(config.QueryRecentTasksCallback, limiter)
+	}
+	if config.RerunTaskCallback != nil {
+		config.RerunTaskCallback = withRateLimit(config.RerunTaskCallback, limiter)
+	}
+}
+
+func withRateLimit[T any, R any](call func(T) (R, error), limiter *rateLimiter) func(T) (R, error) {
+	return func(arg T) (R, error) {
+		limiter.Wait()
+		return call(arg)
+	}
+}
@@ -0,0 +1,93 @@
+package wait
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter_SpacesCallsOutOnceTheBurstIsUsedUp(t *testing.T) {
+	now := time.Date(2024, 1, 31, 18, 0, 0, 0, time.UTC)
+	delays := make([]time.Duration, 0)
+	l := newRateLimiter(4, realClock{})
+	l.last = now
+	l.now = func() time.Time { return now }
+	// the clock only moves on while a call is held back, as though each call were made as soon as it could be
+	l.sleep = func(d time.Duration) {
+		delays = append(delays, d)
+		now = now.Add(d)
+	}
+
+	for i := 0; i < 4; i++ {
+		l.Wait()
+	}
+	assert.Empty(t, delays)
+
+	l.Wait()
+	l.Wait()
+	assert.Equal(t, []time.Duration{250 * time.Millisecond, 250 * time.Millisecond}, delays)
+
+	// the bucket refills while nothing is asked for, but never beyond the burst
+	now = now.Add(time.Hour)
+	delays = delays[:0]
+	for i := 0; i < 5; i++ {
+		l.Wait()
+	}
+	assert.Equal(t, []time.Duration{250 * time.Millisecond}, delays)
+}
+
+func TestRateLimiter_SlowerThanOneASecond(t *testing.T) {
+	now := time.Date(2024, 1, 31, 18, 0, 0, 0, time.UTC)
+	delays := make([]time.Duration, 0)
+	l := newRateLimiter(0.5, realClock{})
+	l.last = now
+	l.now = func() time.Time { return now }
+	l.sleep = func(d time.Duration) { delays = append(delays, d) }
+
+	l.Wait()
+	l.Wait()
+	assert.Equal(t, []time.Duration{2 * time.Second}, delays)
+}
+
+func TestAddRateLimit_SharedBetweenPollsAndDetails(t *testing.T) {
+	var mu sync.Mutex
+	calls := make([]time.Time, 0)
+	record := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, time.Now())
+	}
+	config := WaitConfig{
+		GetServerTasksCallback: func(taskIDs []string) ([]*tasks.Task, error) {
+			record()
+			return nil, nil
+		},
+		GetTaskDetailsCallback: func(taskID string) (*tasks.TaskDetailsResource, error) {
+			record()
+			return nil, nil
+		},
+	}
+	addRateLimit(&config, newRateLimiter(20, realClock{}))
+
+	started := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 15; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, _ = config.GetServerTasksCallback([]string{"ServerTasks-1"})
+		}()
+		go func() {
+			defer wg.Done()
+			_, _ = config.GetTaskDetailsCallback("ServerTasks-1")
+		}()
+	}
+	wg.Wait()
+
+	// the first 20 calls make up the burst, and the other 10 are let through 50ms apart
+	assert.Len(t, calls, 30)
+	assert.GreaterOrEqual(t, time.Since(started), 450*time.Millisecond)
+}
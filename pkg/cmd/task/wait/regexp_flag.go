@@ -0,0 +1,46 @@
+package wait
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// regexpArrayValue is a repeatable flag holding regular expressions. Each one is compiled as it is set, so that an
+// invalid expression is reported while the flags are parsed rather than once the wait has started.
+type regexpArrayValue struct {
+	values *[]string
+}
+
+func newRegexpArrayValue(values *[]string) *regexpArrayValue {
+	return &regexpArrayValue{values: values}
+}
+
+func (v *regexpArrayValue) Set(value string) error {
+	if _, err := regexp.Compile(value); err != nil {
+		return err
+	}
+	*v.values = append(*v.values, value)
+	return nil
+}
+
+func (v *regexpArrayValue) String() string {
+	return "[" + strings.Join(*v.values, ",") + "]"
+}
+
+func (v *regexpArrayValue) Type() string {
+	return "regexp"
+}
+
+// compileRegexps compiles the given regular expressions, naming the flag they were given to if one is invalid
+func compileRegexps(flag string, patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --%s value %s: %w", flag, pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
@@ -0,0 +1,21 @@
+package wait
+
+import (
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegexpArrayValue(t *testing.T) {
+	var highlight []string
+	flags := pflag.NewFlagSet("wait", pflag.ContinueOnError)
+	flags.Var(newRegexpArrayValue(&highlight), FlagHighlight, "")
+
+	assert.NoError(t, flags.Parse([]string{"--highlight", "Deploying", "--highlight", `^Step \d+`}))
+	assert.Equal(t, []string{"Deploying", `^Step \d+`}, highlight)
+
+	// an invalid expression is reported as the flags are parsed
+	err := flags.Parse([]string{"--highlight", "("})
+	assert.ErrorContains(t, err, `invalid argument "(" for "--highlight" flag: error parsing regexp: missing closing ): `+"`(`")
+}
@@ -0,0 +1,90 @@
+package wait
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/client"
+)
+
+// retryAfterRoundTripper notes when the server last asked for requests to be retried later through a Retry-After
+// header. The go client doesn't pass response headers on with the errors it returns, so this is the only place the
+// hint can be picked up; the callbacks then attach it to the error of the call which failed.
+type retryAfterRoundTripper struct {
+	next http.RoundTripper
+	// now is always the real time rather than the Clock of a wait, as a Retry-After date is given by the server's clock
+	// and the hints are shared by every wait using the client
+	now func() time.Time
+
+	mutex sync.Mutex
+	// notBefore is the earliest time the server wants to hear from us again
+	notBefore time.Time
+}
+
+func (r *retryAfterRoundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := r.next.RoundTrip(request)
+	if err != nil || (response.StatusCode != http.StatusTooManyRequests && response.StatusCode != http.StatusServiceUnavailable) {
+		return response, err
+	}
+
+	if delay, ok := parseRetryAfter(response.Header.Get("Retry-After"), r.now()); ok {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		if notBefore := r.now().Add(delay); notBefore.After(r.notBefore) {
+			r.notBefore = notBefore
+		}
+	}
+	return response, nil
+}
+
+// wrap attaches the server's last retry-after hint to err, if it is still in the future. It is safe to call on a
+// nil round tripper, for callbacks which aren't using the real client.
+func (r *retryAfterRoundTripper) wrap(err error) error {
+	if err == nil || r == nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if delay := r.notBefore.Sub(r.now()); delay > 0 {
+		return &RetryAfterError{Err: err, RetryAfter: delay}
+	}
+	return err
+}
+
+// retryAfterHints returns the round tripper picking up retry-after hints from the responses to octopus, installing it
+// the first time it's needed. Every callback built from the same client shares it.
+func retryAfterHints(octopus *client.Client) *retryAfterRoundTripper {
+	if octopus == nil || octopus.HttpSession() == nil || octopus.HttpSession().HttpClient == nil {
+		return nil
+	}
+	httpClient := octopus.HttpSession().HttpClient
+	if hints, ok := httpClient.Transport.(*retryAfterRoundTripper); ok {
+		return hints
+	}
+
+	next := httpClient.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	hints := &retryAfterRoundTripper{next: next, now: time.Now}
+	httpClient.Transport = hints
+	return hints
+}
+
+// parseRetryAfter reads a Retry-After header, which is either a number of seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second, seconds > 0
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now), true
+	}
+	return 0, false
+}
@@ -0,0 +1,62 @@
+package wait
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 31, 18, 0, 0, 0, time.UTC)
+
+	delay, ok := parseRetryAfter("120", now)
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Minute, delay)
+
+	delay, ok = parseRetryAfter("Wed, 31 Jan 2024 18:00:30 GMT", now)
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Second, delay)
+
+	for _, value := range []string{"", "0", "-5", "soon", "Wed, 31 Jan 2024 17:59:00 GMT"} {
+		_, ok = parseRetryAfter(value, now)
+		assert.False(t, ok, value)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestRetryAfterRoundTripper(t *testing.T) {
+	now := time.Date(2024, 1, 31, 18, 0, 0, 0, time.UTC)
+	statusCode := http.StatusTooManyRequests
+	hints := &retryAfterRoundTripper{
+		next: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: statusCode, Header: http.Header{"Retry-After": []string{"10"}}}, nil
+		}),
+		now: func() time.Time { return now },
+	}
+	err := errors.New("too many requests")
+
+	_, _ = hints.RoundTrip(&http.Request{})
+	assert.Equal(t, 10*time.Second, retryAfter(hints.wrap(err)))
+	assert.ErrorIs(t, hints.wrap(err), err)
+	assert.True(t, isTransientError(hints.wrap(err)))
+
+	// the hint only applies until the time the server asked for has passed
+	now = now.Add(4 * time.Second)
+	assert.Equal(t, 6*time.Second, retryAfter(hints.wrap(err)))
+	now = now.Add(6 * time.Second)
+	assert.Equal(t, err, hints.wrap(err))
+
+	// a Retry-After header on a successful response isn't a request to back off
+	statusCode = http.StatusOK
+	_, _ = hints.RoundTrip(&http.Request{})
+	assert.Equal(t, err, hints.wrap(err))
+
+	var none *retryAfterRoundTripper
+	assert.Equal(t, err, none.wrap(err))
+}
@@ -0,0 +1,79 @@
+package wait
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/client"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+)
+
+// latestTaskCandidates is how many of a project's most recently queued tasks --select-latest picks from. The server
+// lists the newest tasks first, but can't sort them by when they started, so the latest to start is picked from these.
+const latestTaskCandidates = 30
+
+type LatestTasksCallback func(projectID string) ([]*tasks.Task, error)
+
+func GetLatestTasksCallback(octopus *client.Client) LatestTasksCallback {
+	return func(projectID string) ([]*tasks.Task, error) {
+		return QueryTasks(octopus, tasks.TasksQuery{Project: projectID, Take: latestTaskCandidates}, latestTaskCandidates)
+	}
+}
+
+// selectLatestTask finds the task of a project which started most recently, for --select-latest. project is the
+// project as it was given, to say which project had no tasks.
+func selectLatestTask(getLatestTasks LatestTasksCallback, projectID string, project string) (*tasks.Task, error) {
+	candidates, err := getLatestTasks(projectID)
+	if err != nil {
+		return nil, err
+	}
+	var latest *tasks.Task
+	for _, candidate := range candidates {
+		if latest == nil || isLaterTask(candidate, latest) {
+			latest = candidate
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("no tasks found for project %s, so there is no latest task to wait for", project)
+	}
+	return latest, nil
+}
+
+// isLaterTask reports whether a started after b. A task which hasn't started yet counts from when it was queued, so
+// that a task queued moments ago, such as by a trigger, is picked over the one which ran before it. Tasks which
+// started at the same time are told apart by their IDs, the higher being later, so the same task is always picked.
+func isLaterTask(a *tasks.Task, b *tasks.Task) bool {
+	aStarted, bStarted := taskStartedOrQueued(a), taskStartedOrQueued(b)
+	if !aStarted.Equal(bStarted) {
+		return aStarted.After(bStarted)
+	}
+	aNumber, bNumber := taskNumber(a.ID), taskNumber(b.ID)
+	if aNumber != bNumber {
+		return aNumber > bNumber
+	}
+	return a.ID > b.ID
+}
+
+// taskStartedOrQueued is when a task started, or when it was queued if it hasn't started yet
+func taskStartedOrQueued(t *tasks.Task) time.Time {
+	switch {
+	case t.StartTime != nil:
+		return *t.StartTime
+	case t.QueueTime != nil:
+		return *t.QueueTime
+	default:
+		return time.Time{}
+	}
+}
+
+// taskNumber is the number of a task ID such as ServerTasks-12345, so that IDs compare as numbers rather than as
+// text, which would put ServerTasks-9 after ServerTasks-10. It is 0 for IDs without a number.
+func taskNumber(taskID string) int {
+	number, err := strconv.Atoi(strings.TrimPrefix(taskID, "ServerTasks-"))
+	if err != nil {
+		return 0
+	}
+	return number
+}
@@ -0,0 +1,72 @@
+package wait
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/OctopusDeploy/cli/test/testutil"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectLatestTask(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	newTask := func(id string, started time.Time, queued time.Time) *tasks.Task {
+		task := testutil.NewFakeTask(id, "Deploy "+id, "Executing")
+		if !started.IsZero() {
+			task.StartTime = &started
+		}
+		task.QueueTime = &queued
+		return task
+	}
+
+	tests := []struct {
+		name       string
+		candidates []*tasks.Task
+		want       string
+	}{
+		{"latest to start", []*tasks.Task{
+			newTask("ServerTasks-2", now.Add(-time.Minute), now.Add(-2*time.Minute)),
+			newTask("ServerTasks-3", now.Add(-3*time.Minute), now.Add(-time.Minute)),
+			newTask("ServerTasks-1", now, now.Add(-3*time.Minute)),
+		}, "ServerTasks-1"},
+		{"started at the same time picks the highest ID", []*tasks.Task{
+			newTask("ServerTasks-9", now, now),
+			newTask("ServerTasks-10", now, now),
+			newTask("ServerTasks-8", now, now),
+		}, "ServerTasks-10"},
+		{"queued task counts from when it was queued", []*tasks.Task{
+			newTask("ServerTasks-1", now.Add(-time.Minute), now.Add(-2*time.Minute)),
+			newTask("ServerTasks-2", time.Time{}, now),
+		}, "ServerTasks-2"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// the pick doesn't depend on the order the server lists the tasks in
+			reversed := slices.Clone(test.candidates)
+			slices.Reverse(reversed)
+			for _, candidates := range [][]*tasks.Task{test.candidates, reversed} {
+				latest, err := selectLatestTask(func(projectID string) ([]*tasks.Task, error) {
+					assert.Equal(t, "Projects-1", projectID)
+					return candidates, nil
+				}, "Projects-1", "MyProject")
+				assert.NoError(t, err)
+				assert.Equal(t, test.want, latest.ID)
+			}
+		})
+	}
+}
+
+func TestSelectLatestTask_NoTasks(t *testing.T) {
+	_, err := selectLatestTask(func(projectID string) ([]*tasks.Task, error) {
+		return []*tasks.Task{}, nil
+	}, "Projects-1", "MyProject")
+	assert.EqualError(t, err, "no tasks found for project MyProject, so there is no latest task to wait for")
+
+	_, err = selectLatestTask(func(projectID string) ([]*tasks.Task, error) {
+		return nil, errors.New("connection reset by peer")
+	}, "Projects-1", "MyProject")
+	assert.EqualError(t, err, "connection reset by peer")
+}
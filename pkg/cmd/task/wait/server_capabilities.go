@@ -0,0 +1,91 @@
+package wait
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/client"
+)
+
+// ServerVersionCallback finds the version of Octopus Server, such as 2023.2.13090, from its root document
+type ServerVersionCallback func() (string, error)
+
+func GetServerVersionCallback(octopus *client.Client) ServerVersionCallback {
+	return func() (string, error) {
+		root, err := octopus.Root.Get()
+		if err != nil {
+			return "", err
+		}
+		return root.Version, nil
+	}
+}
+
+// serverCapability is something a wait can show which older versions of Octopus Server don't have. Rather than failing
+// the wait, a feature the server is too old for is left out.
+type serverCapability struct {
+	// description says what is left out, such as "the position of queued tasks"
+	description string
+	// minVersion is the first version of Octopus Server to have it
+	minVersion string
+}
+
+var (
+	// the queue position and output variables are fetched from routes within a space, which came with spaces in 2019.1
+	capabilityQueuePosition   = serverCapability{description: "the position of queued tasks", minVersion: "2019.1"}
+	capabilityOutputVariables = serverCapability{description: "the output variables of tasks", minVersion: "2019.1"}
+)
+
+// parseServerVersion splits a version such as 2023.2.13090 into its numbers, ignoring any pre-release suffix. It
+// reports false for anything else, and for the 0.0.0 of local builds, which aren't released versions at all.
+func parseServerVersion(version string) ([]int, bool) {
+	version, _, _ = strings.Cut(strings.TrimSpace(version), "-")
+	if version == "" {
+		return nil, false
+	}
+	parts := strings.Split(version, ".")
+	numbers := make([]int, len(parts))
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 {
+			return nil, false
+		}
+		numbers[i] = number
+	}
+	if numbers[0] == 0 {
+		return nil, false
+	}
+	return numbers, true
+}
+
+// supportsCapability reports whether a server of the given version has capability. A version which can't be made
+// sense of is taken to have everything, so that a feature is only left out when the server is known to lack it.
+func supportsCapability(version string, capability serverCapability) bool {
+	have, ok := parseServerVersion(version)
+	if !ok {
+		return true
+	}
+	need, _ := parseServerVersion(capability.minVersion)
+	for i := 0; i < len(need); i++ {
+		number := 0
+		if i < len(have) {
+			number = have[i]
+		}
+		if number != need[i] {
+			return number > need[i]
+		}
+	}
+	return true
+}
+
+// applyServerCapabilities leaves out the features the wait was asked for which a server of the given version doesn't
+// have, by taking away the callbacks they use. onUnsupported is told about each of them, once.
+func applyServerCapabilities(opts *WaitOptions, version string, onUnsupported func(capability serverCapability)) {
+	if opts.QueuedBehindCallback != nil && !supportsCapability(version, capabilityQueuePosition) {
+		opts.QueuedBehindCallback = nil
+		onUnsupported(capabilityQueuePosition)
+	}
+	if opts.PrintOutputs && opts.TaskOutputsCallback != nil && !supportsCapability(version, capabilityOutputVariables) {
+		opts.TaskOutputsCallback = nil
+		onUnsupported(capabilityOutputVariables)
+	}
+}
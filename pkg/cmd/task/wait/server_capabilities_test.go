@@ -0,0 +1,68 @@
+package wait
+
+import (
+	"testing"
+
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseServerVersion(t *testing.T) {
+	version, ok := parseServerVersion("2023.2.13090")
+	assert.True(t, ok)
+	assert.Equal(t, []int{2023, 2, 13090}, version)
+
+	version, ok = parseServerVersion("2024.1.0-ci0123")
+	assert.True(t, ok)
+	assert.Equal(t, []int{2024, 1, 0}, version)
+
+	for _, invalid := range []string{"", "0.0.0-local", "latest", "2023.x"} {
+		_, ok = parseServerVersion(invalid)
+		assert.False(t, ok, invalid)
+	}
+}
+
+func TestSupportsCapability(t *testing.T) {
+	capability := serverCapability{description: "something new", minVersion: "2019.11"}
+	assert.True(t, supportsCapability("2019.11", capability))
+	assert.True(t, supportsCapability("2019.11.0", capability))
+	assert.True(t, supportsCapability("2019.12.1", capability))
+	assert.True(t, supportsCapability("2023.2.13090", capability))
+	assert.False(t, supportsCapability("2019.10.7", capability))
+	assert.False(t, supportsCapability("2018.12.1", capability))
+	// a version which can't be made sense of is taken to have everything
+	assert.True(t, supportsCapability("0.0.0-local", capability))
+	assert.True(t, supportsCapability("", capability))
+}
+
+func TestApplyServerCapabilities(t *testing.T) {
+	newOpts := func() *WaitOptions {
+		return &WaitOptions{
+			QueuedBehindCallback: func(string) ([]*tasks.Task, error) { return nil, nil },
+			TaskOutputsCallback:  func(string) (map[string]string, error) { return nil, nil },
+			PrintOutputs:         true,
+		}
+	}
+
+	unsupported := make([]string, 0)
+	onUnsupported := func(capability serverCapability) { unsupported = append(unsupported, capability.description) }
+
+	opts := newOpts()
+	applyServerCapabilities(opts, "2023.2.13090", onUnsupported)
+	assert.NotNil(t, opts.QueuedBehindCallback)
+	assert.NotNil(t, opts.TaskOutputsCallback)
+	assert.Empty(t, unsupported)
+
+	opts = newOpts()
+	applyServerCapabilities(opts, "2018.10.0", onUnsupported)
+	assert.Nil(t, opts.QueuedBehindCallback)
+	assert.Nil(t, opts.TaskOutputsCallback)
+	assert.Equal(t, []string{"the position of queued tasks", "the output variables of tasks"}, unsupported)
+
+	// features which weren't asked for aren't reported
+	unsupported = make([]string, 0)
+	opts = newOpts()
+	opts.PrintOutputs = false
+	applyServerCapabilities(opts, "2018.10.0", onUnsupported)
+	assert.Equal(t, []string{"the position of queued tasks"}, unsupported)
+}
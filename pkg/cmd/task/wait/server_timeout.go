@@ -0,0 +1,55 @@
+package wait
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultServerTimeout is how many seconds a single request for the state or details of tasks can take unless
+// --server-timeout says otherwise
+const DefaultServerTimeout = 60
+
+// ErrServerTimeout matches (via errors.Is) a request to the server which took longer than --server-timeout. The poll
+// which made it is retried, as with any other transient error.
+var ErrServerTimeout = errors.New("the server didn't respond in time")
+
+// addServerTimeout bounds each call for the state or details of tasks by timeout
+func addServerTimeout(config *WaitConfig, timeout time.Duration) {
+	if config.GetServerTasksCallback != nil {
+		config.GetServerTasksCallback = withServerTimeout(config.GetServerTasksCallback, timeout)
+	}
+	if config.GetTaskDetailsCallback != nil {
+		config.GetTaskDetailsCallback = withServerTimeout(config.GetTaskDetailsCallback, timeout)
+	}
+}
+
+// withServerTimeout bounds each call to call by timeout, so that a connection which hangs fails the poll making it,
+// rather than stalling the wait until the whole of --timeout has gone. The client doesn't take a context, so a call
+// which times out can't be cancelled; it is left to finish in the background, and whatever it returns is ignored.
+func withServerTimeout[T any, R any](call func(T) (R, error), timeout time.Duration) func(T) (R, error) {
+	type outcome struct {
+		result R
+		err    error
+	}
+	return func(arg T) (R, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		// buffered, so that a call which finishes after it timed out doesn't block forever
+		done := make(chan outcome, 1)
+		go func() {
+			result, err := call(arg)
+			done <- outcome{result, err}
+		}()
+
+		select {
+		case o := <-done:
+			return o.result, o.err
+		case <-ctx.Done():
+			var zero R
+			return zero, fmt.Errorf("%w after %s", ErrServerTimeout, timeout)
+		}
+	}
+}
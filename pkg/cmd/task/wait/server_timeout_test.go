@@ -0,0 +1,77 @@
+package wait
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/OctopusDeploy/cli/test/testutil"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithServerTimeout(t *testing.T) {
+	getState := withServerTimeout(func(taskID string) (string, error) {
+		if taskID == "ServerTasks-2" {
+			time.Sleep(time.Second)
+		}
+		return "Success", nil
+	}, 50*time.Millisecond)
+
+	state, err := getState("ServerTasks-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Success", state)
+
+	// the slow call is given up on long before it would have returned
+	started := time.Now()
+	state, err = getState("ServerTasks-2")
+	assert.Less(t, time.Since(started), 500*time.Millisecond)
+	assert.ErrorIs(t, err, ErrServerTimeout)
+	assert.EqualError(t, err, "the server didn't respond in time after 50ms")
+	assert.Empty(t, state)
+	assert.True(t, isTransientError(err))
+
+	// errors from calls which return in time are passed on as they are
+	_, err = withServerTimeout(func(taskID string) (string, error) {
+		return "", errors.New("unauthorized")
+	}, 50*time.Millisecond)("ServerTasks-1")
+	assert.EqualError(t, err, "unauthorized")
+}
+
+func TestWaitForTasks_ServerTimeout(t *testing.T) {
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing", "Executing", "Success")
+
+	// the first poll hangs for far longer than the server timeout, as if its connection had stalled. It carries on in
+	// the background once it's given up on, so the calls are counted atomically.
+	var calls atomic.Int32
+	retries := make([]error, 0)
+	started := time.Now()
+	config := WaitConfig{
+		Timeout:         10 * time.Second,
+		PollInterval:    time.Millisecond,
+		MaxPollInterval: 10 * time.Millisecond,
+		MaxRetries:      1,
+		GetServerTasksCallback: func(taskIDs []string) ([]*tasks.Task, error) {
+			if calls.Add(1) == 2 {
+				time.Sleep(2 * time.Second)
+			}
+			return server.GetServerTasks(taskIDs)
+		},
+		OnRetry: func(attempt int, err error) {
+			retries = append(retries, err)
+		},
+	}
+	addServerTimeout(&config, 100*time.Millisecond)
+	result, err := WaitForTasks(context.Background(), nil, []string{"ServerTasks-1"}, config)
+
+	// the poll is retried rather than waiting for the stalled call to return
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(started), 2*time.Second)
+	assert.Len(t, result.SucceededTasks, 1)
+	if assert.Len(t, retries, 1) {
+		assert.ErrorIs(t, retries[0], ErrServerTimeout)
+	}
+}
@@ -0,0 +1,134 @@
+package wait
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+)
+
+// WaitState is what --state-file keeps of a wait: the tasks which were still pending when it was last written, in the
+// order they were first seen. --resume-from-file reads it back to carry the wait on once the CLI has been restarted.
+type WaitState struct {
+	Tasks     []*WaitStateTask `json:"Tasks"`
+	UpdatedAt time.Time        `json:"UpdatedAt"`
+}
+
+// WaitStateTask is a pending task along with the last state it was seen in
+type WaitStateTask struct {
+	ID    string `json:"Id"`
+	State string `json:"State"`
+}
+
+// ReadWaitState reads a file written by --state-file
+func ReadWaitState(path string) (*WaitState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	state := &WaitState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid --%s %s: %w", FlagResumeFromFile, path, err)
+	}
+	for _, t := range state.Tasks {
+		if t == nil || t.ID == "" {
+			return nil, fmt.Errorf("invalid --%s %s: every task must have an Id", FlagResumeFromFile, path)
+		}
+	}
+	return state, nil
+}
+
+// TaskIDs are the IDs of the tasks in the state, in the order they were first seen
+func (s *WaitState) TaskIDs() []string {
+	taskIDs := make([]string, 0, len(s.Tasks))
+	for _, t := range s.Tasks {
+		taskIDs = append(taskIDs, t.ID)
+	}
+	return taskIDs
+}
+
+// waitStateFile keeps the file given by --state-file up to date with the tasks still pending as the wait goes on
+type waitStateFile struct {
+	path      string
+	taskOrder []string
+	tasks     map[string]*tasks.Task
+	// clock tells the time the file was last updated at
+	clock Clock
+}
+
+func newWaitStateFile(path string, clock Clock) *waitStateFile {
+	return &waitStateFile{path: path, tasks: make(map[string]*tasks.Task), clock: clock}
+}
+
+// Record keeps the latest state of a task, to be written with it the next time the file is written
+func (f *waitStateFile) Record(t *tasks.Task) {
+	if _, ok := f.tasks[t.ID]; !ok {
+		f.taskOrder = append(f.taskOrder, t.ID)
+	}
+	f.tasks[t.ID] = t
+}
+
+// Write writes the tasks which haven't completed as of their latest state, leaving out those which have. Nothing is
+// written until a task has been recorded, so that a wait which fails before it finds its tasks, such as when the
+// server can't be reached, doesn't throw away the tasks a resumed wait was carrying on with.
+func (f *waitStateFile) Write() error {
+	if len(f.taskOrder) == 0 {
+		return nil
+	}
+	state := &WaitState{Tasks: make([]*WaitStateTask, 0, len(f.taskOrder)), UpdatedAt: f.clock.Now().UTC()}
+	for _, taskID := range f.taskOrder {
+		t := f.tasks[taskID]
+		if t.IsCompleted != nil && *t.IsCompleted {
+			continue
+		}
+		state.Tasks = append(state.Tasks, &WaitStateTask{ID: t.ID, State: t.State})
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(f.path, append(data, '\n'))
+}
+
+// addStateFile records the state of each task as it is found and polled, writing the file before each poll. The
+// polls happen one after another, so the file is never written by two of them at once.
+func addStateFile(config *WaitConfig, stateFile *waitStateFile, onError func(error)) {
+	onTaskAdded := config.OnTaskAdded
+	config.OnTaskAdded = func(t *tasks.Task) {
+		stateFile.Record(t)
+		if onTaskAdded != nil {
+			onTaskAdded(t)
+		}
+	}
+
+	onTaskPolled := config.OnTaskPolled
+	config.OnTaskPolled = func(t *tasks.Task, details *tasks.TaskDetailsResource, detailsErr error) {
+		stateFile.Record(t)
+		if onTaskPolled != nil {
+			onTaskPolled(t, details, detailsErr)
+		}
+	}
+
+	// a rerun takes the place of the task it reruns, which is left out of the file now that it has failed
+	onTaskRetried := config.OnTaskRetried
+	config.OnTaskRetried = func(failed *tasks.Task, rerun *tasks.Task, attempt int, err error) {
+		if err == nil && rerun != nil {
+			stateFile.Record(rerun)
+		}
+		if onTaskRetried != nil {
+			onTaskRetried(failed, rerun, attempt, err)
+		}
+	}
+
+	onPoll := config.OnPoll
+	config.OnPoll = func(pendingTaskIDs []string) {
+		if err := stateFile.Write(); err != nil {
+			onError(err)
+		}
+		if onPoll != nil {
+			onPoll(pendingTaskIDs)
+		}
+	}
+}
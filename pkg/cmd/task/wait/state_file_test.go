@@ -0,0 +1,54 @@
+package wait
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/OctopusDeploy/cli/test/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitStateFile_Write(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	stateFile := newWaitStateFile(path, realClock{})
+
+	// nothing has been found yet, so there's nothing to say about the wait
+	assert.NoError(t, stateFile.Write())
+	assert.NoFileExists(t, path)
+
+	stateFile.Record(testutil.NewFakeTask("ServerTasks-1", "Deploy Foo", "Queued"))
+	stateFile.Record(testutil.NewFakeTask("ServerTasks-2", "Deploy Bar", "Executing"))
+	assert.NoError(t, stateFile.Write())
+	state, err := ReadWaitState(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []*WaitStateTask{{ID: "ServerTasks-1", State: "Queued"}, {ID: "ServerTasks-2", State: "Executing"}}, state.Tasks)
+	assert.False(t, state.UpdatedAt.IsZero())
+
+	// tasks which finish are pruned, and the others keep the order they were first seen in
+	stateFile.Record(testutil.NewFakeTask("ServerTasks-2", "Deploy Bar", "Success"))
+	stateFile.Record(testutil.NewFakeTask("ServerTasks-1", "Deploy Foo", "Executing"))
+	assert.NoError(t, stateFile.Write())
+	state, err = ReadWaitState(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ServerTasks-1"}, state.TaskIDs())
+	assert.Equal(t, "Executing", state.Tasks[0].State)
+
+	// the temporary file each write goes through is renamed over the state file, so none are left behind
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestReadWaitState_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	assert.NoError(t, os.WriteFile(path, []byte("ServerTasks-1"), 0644))
+	_, err := ReadWaitState(path)
+	assert.ErrorContains(t, err, "invalid --resume-from-file "+path+": ")
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"Tasks": [{"State": "Executing"}]}`), 0644))
+	_, err = ReadWaitState(path)
+	assert.EqualError(t, err, "invalid --resume-from-file "+path+": every task must have an Id")
+}
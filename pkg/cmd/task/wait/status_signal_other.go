@@ -0,0 +1,10 @@
+//go:build !unix
+
+package wait
+
+import "os"
+
+// notifyStatusRequests does nothing on platforms without SIGUSR1, returning a channel which never receives
+func notifyStatusRequests() (<-chan os.Signal, func()) {
+	return nil, func() {}
+}
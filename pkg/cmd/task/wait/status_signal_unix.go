@@ -0,0 +1,18 @@
+//go:build unix
+
+package wait
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyStatusRequests relays SIGUSR1 to the returned channel, so that sending it to a running wait prints what the
+// wait is still waiting for. The returned function stops relaying it, after which SIGUSR1 is handled as it was before.
+func notifyStatusRequests() (<-chan os.Signal, func()) {
+	// buffered, so that a signal sent while a poll is in flight is still answered once it finishes
+	requests := make(chan os.Signal, 1)
+	signal.Notify(requests, syscall.SIGUSR1)
+	return requests, func() { signal.Stop(requests) }
+}
@@ -0,0 +1,55 @@
+package wait
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SuccessThreshold is how many of the tasks waited for have to succeed for the wait to succeed, either as a number
+// of tasks or as a percentage of them. The zero value means every task has to succeed.
+type SuccessThreshold struct {
+	Count   int
+	Percent int
+}
+
+// ParseSuccessThreshold reads a threshold given as a number of tasks, such as 3, or a percentage, such as 60%
+func ParseSuccessThreshold(value string) (SuccessThreshold, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return SuccessThreshold{}, nil
+	}
+
+	if percent, ok := strings.CutSuffix(value, "%"); ok {
+		n, err := strconv.Atoi(strings.TrimSpace(percent))
+		if err != nil || n < 1 || n > 100 {
+			return SuccessThreshold{}, fmt.Errorf("invalid --%s value %s; a percentage must be between 1%% and 100%%", FlagMinSuccess, value)
+		}
+		return SuccessThreshold{Percent: n}, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return SuccessThreshold{}, fmt.Errorf("invalid --%s value %s; expected a number of tasks such as 3, or a percentage such as 60%%", FlagMinSuccess, value)
+	}
+	return SuccessThreshold{Count: n}, nil
+}
+
+func (t SuccessThreshold) IsZero() bool {
+	return t.Count == 0 && t.Percent == 0
+}
+
+// Required is how many of total tasks have to succeed, rounding a percentage up so that 50% of 3 tasks is 2
+func (t SuccessThreshold) Required(total int) int {
+	if t.Percent != 0 {
+		return (total*t.Percent + 99) / 100
+	}
+	return t.Count
+}
+
+func (t SuccessThreshold) String() string {
+	if t.Percent != 0 {
+		return fmt.Sprintf("%d%%", t.Percent)
+	}
+	return strconv.Itoa(t.Count)
+}
@@ -0,0 +1,229 @@
+package wait
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/client"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/newclient"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+)
+
+// MaxTaskContexts is how many tasks --show-context looks up the context of. Tasks beyond it are shown without their
+// context, so that waiting for a great many tasks doesn't turn into a great many more requests.
+const MaxTaskContexts = 100
+
+const runbookRunTemplate = "/api/{spaceId}/runbookRuns/{id}"
+
+// TaskContext is what a task is deploying or running, for --show-context. Release is only set for deployments, and
+// Runbook and RunbookSnapshot only for runbook runs.
+type TaskContext struct {
+	Project         string
+	Environment     string
+	Release         string
+	Runbook         string
+	RunbookSnapshot string
+}
+
+// String describes the context of a task, such as "MyProject, Production, release 1.0.0"
+func (c *TaskContext) String() string {
+	parts := make([]string, 0, 3)
+	if c.Project != "" {
+		parts = append(parts, c.Project)
+	}
+	if c.Environment != "" {
+		parts = append(parts, c.Environment)
+	}
+	if c.Release != "" {
+		parts = append(parts, "release "+c.Release)
+	}
+	if c.Runbook != "" {
+		runbook := "runbook " + c.Runbook
+		if c.RunbookSnapshot != "" {
+			runbook += fmt.Sprintf(" (%s)", c.RunbookSnapshot)
+		}
+		parts = append(parts, runbook)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ResolveTaskContextCallback looks up what a task is deploying or running. It returns nil for tasks which aren't
+// deploying or running anything in a project, such as system tasks.
+type ResolveTaskContextCallback func(t *tasks.Task) (*TaskContext, error)
+
+// runbookRun is the part of a runbook run needed for its context, which the client doesn't have a type for
+type runbookRun struct {
+	ProjectID         string `json:"ProjectId"`
+	EnvironmentID     string `json:"EnvironmentId"`
+	RunbookID         string `json:"RunbookId"`
+	RunbookSnapshotID string `json:"RunbookSnapshotId"`
+}
+
+// GetResolveTaskContextCallback looks up the context of deployments and runbook runs. The names of projects,
+// environments and the like are cached, as a batch of tasks tends to share most of them.
+func GetResolveTaskContextCallback(octopus *client.Client, spaceID string) ResolveTaskContextCallback {
+	names := &nameCache{names: make(map[string]string)}
+	projectName := func(id string) (string, error) {
+		return names.lookup(id, func() (string, error) {
+			project, err := octopus.Projects.GetByID(id)
+			if err != nil {
+				return "", err
+			}
+			return project.Name, nil
+		})
+	}
+	environmentName := func(id string) (string, error) {
+		return names.lookup(id, func() (string, error) {
+			environment, err := octopus.Environments.GetByID(id)
+			if err != nil {
+				return "", err
+			}
+			return environment.Name, nil
+		})
+	}
+
+	return func(t *tasks.Task) (*TaskContext, error) {
+		c := &TaskContext{}
+		var projectID, environmentID string
+		if deploymentID, ok := t.Arguments["DeploymentId"].(string); ok && deploymentID != "" {
+			deployment, err := octopus.Deployments.GetByID(deploymentID)
+			if err != nil {
+				return nil, err
+			}
+			projectID, environmentID = deployment.ProjectID, deployment.EnvironmentID
+			c.Release, err = names.lookup(deployment.ReleaseID, func() (string, error) {
+				release, err := octopus.Releases.GetByID(deployment.ReleaseID)
+				if err != nil {
+					return "", err
+				}
+				return release.Version, nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		} else if runbookRunID, ok := t.Arguments["RunbookRunId"].(string); ok && runbookRunID != "" {
+			path, err := octopus.URITemplateCache().Expand(runbookRunTemplate, map[string]any{
+				"spaceId": spaceID,
+				"id":      runbookRunID,
+			})
+			if err != nil {
+				return nil, err
+			}
+			run, err := newclient.Get[runbookRun](octopus.HttpSession(), path)
+			if err != nil {
+				return nil, err
+			}
+			projectID, environmentID = run.ProjectID, run.EnvironmentID
+			c.Runbook, err = names.lookup(run.RunbookID, func() (string, error) {
+				runbook, err := octopus.Runbooks.GetByID(run.RunbookID)
+				if err != nil {
+					return "", err
+				}
+				return runbook.Name, nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			c.RunbookSnapshot, err = names.lookup(run.RunbookSnapshotID, func() (string, error) {
+				snapshot, err := octopus.RunbookSnapshots.GetByID(run.RunbookSnapshotID)
+				if err != nil {
+					return "", err
+				}
+				return snapshot.Name, nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			return nil, nil
+		}
+
+		var err error
+		if c.Project, err = projectName(projectID); err != nil {
+			return nil, err
+		}
+		if c.Environment, err = environmentName(environmentID); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+}
+
+// nameCache remembers the names of the resources looked up for the context of tasks, by their IDs
+type nameCache struct {
+	mutex sync.Mutex
+	names map[string]string
+}
+
+// lookup is the name of the resource with id, calling lookup for it the first time. A resource without an ID, such
+// as the snapshot of a runbook run which wasn't from one, has no name.
+func (n *nameCache) lookup(id string, lookup func() (string, error)) (string, error) {
+	if id == "" {
+		return "", nil
+	}
+	n.mutex.Lock()
+	name, ok := n.names[id]
+	n.mutex.Unlock()
+	if ok {
+		return name, nil
+	}
+	name, err := lookup()
+	if err != nil {
+		return "", err
+	}
+	n.mutex.Lock()
+	n.names[id] = name
+	n.mutex.Unlock()
+	return name, nil
+}
+
+// taskContexts looks up the context of each task once, for --show-context. A task whose context can't be looked up
+// is shown without it rather than failing the wait, as the context is only there to help tell tasks apart.
+type taskContexts struct {
+	mutex    sync.Mutex
+	resolve  ResolveTaskContextCallback
+	contexts map[string]*TaskContext
+	// onError is told about each task whose context couldn't be looked up, and onLimit about the first task left
+	// without its context because MaxTaskContexts tasks have already been looked up
+	onError func(taskID string, err error)
+	onLimit func(taskID string)
+}
+
+func newTaskContexts(resolve ResolveTaskContextCallback) *taskContexts {
+	return &taskContexts{resolve: resolve, contexts: make(map[string]*TaskContext)}
+}
+
+// context is the context of a task, or nil if it has none or it couldn't be looked up. A nil taskContexts gives
+// every task no context, so that callers don't have to check whether they were asked for.
+func (c *taskContexts) context(t *tasks.Task) *TaskContext {
+	if c == nil || t == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if taskContext, ok := c.contexts[t.ID]; ok {
+		return taskContext
+	}
+	if len(c.contexts) >= MaxTaskContexts {
+		if len(c.contexts) == MaxTaskContexts && c.onLimit != nil {
+			c.onLimit(t.ID)
+		}
+		// recorded as having no context, so that the limit is only reported once
+		c.contexts[t.ID] = nil
+		return nil
+	}
+
+	taskContext, err := c.resolve(t)
+	if err != nil {
+		if c.onError != nil {
+			c.onError(t.ID, err)
+		}
+		taskContext = nil
+	} else if taskContext != nil && taskContext.String() == "" {
+		// a context with nothing in it isn't worth showing
+		taskContext = nil
+	}
+	c.contexts[t.ID] = taskContext
+	return taskContext
+}
@@ -0,0 +1,91 @@
+package wait
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/OctopusDeploy/cli/test/testutil"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskContext_String(t *testing.T) {
+	assert.Equal(t, "MyProject, Production, release 1.0.0", (&TaskContext{Project: "MyProject", Environment: "Production", Release: "1.0.0"}).String())
+	assert.Equal(t, "MyProject, Production, runbook Restart (Snapshot 3)", (&TaskContext{Project: "MyProject", Environment: "Production", Runbook: "Restart", RunbookSnapshot: "Snapshot 3"}).String())
+	assert.Equal(t, "MyProject, runbook Restart", (&TaskContext{Project: "MyProject", Runbook: "Restart"}).String())
+	assert.Equal(t, "", (&TaskContext{}).String())
+}
+
+func TestTaskContexts_LooksUpEachTaskOnce(t *testing.T) {
+	lookups := map[string]int{}
+	contexts := newTaskContexts(func(task *tasks.Task) (*TaskContext, error) {
+		lookups[task.ID]++
+		switch task.ID {
+		case "ServerTasks-1":
+			return &TaskContext{Project: "MyProject"}, nil
+		case "ServerTasks-2":
+			return nil, errors.New("not found")
+		case "ServerTasks-3":
+			return &TaskContext{}, nil
+		}
+		return nil, nil
+	})
+	failed := make([]string, 0)
+	contexts.onError = func(taskID string, err error) { failed = append(failed, taskID) }
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, &TaskContext{Project: "MyProject"}, contexts.context(testutil.NewFakeTask("ServerTasks-1", "", "Executing")))
+		assert.Nil(t, contexts.context(testutil.NewFakeTask("ServerTasks-2", "", "Executing")))
+		assert.Nil(t, contexts.context(testutil.NewFakeTask("ServerTasks-3", "", "Executing")))
+		assert.Nil(t, contexts.context(testutil.NewFakeTask("ServerTasks-4", "", "Executing")))
+	}
+	assert.Equal(t, map[string]int{"ServerTasks-1": 1, "ServerTasks-2": 1, "ServerTasks-3": 1, "ServerTasks-4": 1}, lookups)
+	assert.Equal(t, []string{"ServerTasks-2"}, failed)
+
+	var none *taskContexts
+	assert.Nil(t, none.context(testutil.NewFakeTask("ServerTasks-1", "", "Executing")))
+}
+
+func TestTaskContexts_StopsLookingUpAfterTheLimit(t *testing.T) {
+	lookups := 0
+	contexts := newTaskContexts(func(task *tasks.Task) (*TaskContext, error) {
+		lookups++
+		return &TaskContext{Project: "MyProject"}, nil
+	})
+	limited := make([]string, 0)
+	contexts.onLimit = func(taskID string) { limited = append(limited, taskID) }
+
+	for i := 1; i <= MaxTaskContexts+2; i++ {
+		taskContext := contexts.context(testutil.NewFakeTask(fmt.Sprintf("ServerTasks-%d", i), "", "Executing"))
+		if i <= MaxTaskContexts {
+			assert.NotNil(t, taskContext)
+		} else {
+			assert.Nil(t, taskContext)
+		}
+	}
+	assert.Equal(t, MaxTaskContexts, lookups)
+	assert.Equal(t, []string{fmt.Sprintf("ServerTasks-%d", MaxTaskContexts+1)}, limited)
+}
+
+func TestNameCache_LooksUpEachNameOnce(t *testing.T) {
+	names := &nameCache{names: make(map[string]string)}
+	lookups := 0
+	lookup := func() (string, error) {
+		lookups++
+		return "MyProject", nil
+	}
+
+	for i := 0; i < 2; i++ {
+		name, err := names.lookup("Projects-1", lookup)
+		assert.NoError(t, err)
+		assert.Equal(t, "MyProject", name)
+	}
+	name, err := names.lookup("", lookup)
+	assert.NoError(t, err)
+	assert.Equal(t, "", name)
+	assert.Equal(t, 1, lookups)
+
+	_, err = names.lookup("Projects-2", func() (string, error) { return "", errors.New("not found") })
+	assert.EqualError(t, err, "not found")
+}
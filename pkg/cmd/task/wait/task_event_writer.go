@@ -0,0 +1,264 @@
+package wait
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+)
+
+// the types of event written by --output-format jsonl. Every event is a JSON object on a line of its own, with the
+// Type of event it is and the Time it was written, in UTC. The other fields of each type are:
+//
+//   - state: TaskId, Name, State, PreviousState (left out the first time a task is written), IsCompleted,
+//     PercentComplete and Step
+//   - progress: TaskId, PercentComplete and Step
+//   - log: TaskId, ActivityId, Activity, Category (each left out when empty), Message, OccurredAt, PercentComplete
+//     and Step
+//   - summary: Succeeded, Tasks, Error, Failures and Verification, the last three left out when empty
+//
+// PercentComplete (a whole number from 0 to 100) and Step (the name of the step the task is running) are null when
+// they aren't known, such as before the details of a task have been fetched, rather than left out.
+const (
+	TaskEventState    = "state"
+	TaskEventProgress = "progress"
+	TaskEventLog      = "log"
+	TaskEventSummary  = "summary"
+)
+
+// TaskProgress is how far through a task is, as of the last time its details were fetched. Its fields are written as
+// null when they aren't known, so that every event of a type has the same fields.
+type TaskProgress struct {
+	PercentComplete *int    `json:"PercentComplete"`
+	Step            *string `json:"Step"`
+}
+
+// TaskStateEvent is written when a task is first seen and each time its state changes
+type TaskStateEvent struct {
+	Type          string    `json:"Type"`
+	Time          time.Time `json:"Time"`
+	TaskID        string    `json:"TaskId"`
+	Name          string    `json:"Name"`
+	State         string    `json:"State"`
+	PreviousState string    `json:"PreviousState,omitempty"`
+	IsCompleted   bool      `json:"IsCompleted"`
+	TaskProgress
+}
+
+// TaskProgressEvent is written each time the progress of a task or the step it is running changes, without its state
+// changing too
+type TaskProgressEvent struct {
+	Type   string    `json:"Type"`
+	Time   time.Time `json:"Time"`
+	TaskID string    `json:"TaskId"`
+	TaskProgress
+}
+
+// TaskLogEvent is written for each new element in the activity log of a task
+type TaskLogEvent struct {
+	Type       string    `json:"Type"`
+	Time       time.Time `json:"Time"`
+	TaskID     string    `json:"TaskId"`
+	ActivityID string    `json:"ActivityId,omitempty"`
+	Activity   string    `json:"Activity,omitempty"`
+	Category   string    `json:"Category,omitempty"`
+	Message    string    `json:"Message"`
+	OccurredAt time.Time `json:"OccurredAt"`
+	TaskProgress
+}
+
+// TaskSummaryEvent is always the last event written, once the wait is over whatever its outcome
+type TaskSummaryEvent struct {
+	Type      string        `json:"Type"`
+	Time      time.Time     `json:"Time"`
+	Succeeded bool          `json:"Succeeded"`
+	Tasks     []*TaskResult `json:"Tasks"`
+	Error     string        `json:"Error,omitempty"`
+	// Failures are why each failed task failed, when the wait failed because of them
+	Failures []*TaskFailure `json:"Failures,omitempty"`
+	// Verification is the outcome of --verify-url, when the tasks succeeded and it was given
+	Verification *VerifyResult `json:"Verification,omitempty"`
+}
+
+// TaskEventWriter writes what happens while waiting as JSON lines, one event per line, so that other tools can follow
+// the wait as it happens rather than only once it's over
+type TaskEventWriter struct {
+	out io.Writer
+	// writtenLogs is how many log elements have been written for each activity, keyed by task ID then activity ID.
+	// The server only ever appends to an activity's log, so anything past that count is new.
+	writtenLogs map[string]map[string]int
+	// progress is the latest progress of each task, which the events of a task carry until it changes
+	progress map[string]TaskProgress
+	// clock tells the time of each event, which is the real time unless SetClock says otherwise
+	clock Clock
+}
+
+func NewTaskEventWriter(out io.Writer) *TaskEventWriter {
+	return &TaskEventWriter{
+		out:         out,
+		writtenLogs: make(map[string]map[string]int),
+		progress:    make(map[string]TaskProgress),
+		clock:       realClock{},
+	}
+}
+
+// SetClock makes the writer tell the time of each event from clock, such as the Clock of the wait
+func (w *TaskEventWriter) SetClock(clock Clock) {
+	w.clock = clock
+}
+
+// WriteState writes the state of a task, along with the state it was last written in, if any. Once a task has
+// completed its progress won't change any more, so it is forgotten.
+func (w *TaskEventWriter) WriteState(t *tasks.Task, previousState string) error {
+	event := &TaskStateEvent{
+		Type:          TaskEventState,
+		Time:          w.clock.Now().UTC(),
+		TaskID:        t.ID,
+		Name:          t.Description,
+		State:         t.State,
+		PreviousState: previousState,
+		IsCompleted:   t.IsCompleted != nil && *t.IsCompleted,
+		TaskProgress:  w.progress[t.ID],
+	}
+	if event.IsCompleted {
+		delete(w.progress, t.ID)
+	}
+	return w.write(event)
+}
+
+// WriteProgress records the progress of a task from its details, writing it if it has changed since it was last
+// written. Without details, the task keeps the progress it was last written with.
+func (w *TaskEventWriter) WriteProgress(t *tasks.Task, details *tasks.TaskDetailsResource) error {
+	if details == nil {
+		return nil
+	}
+	progress := newTaskProgress(details)
+	if sameTaskProgress(progress, w.progress[t.ID]) {
+		return nil
+	}
+	w.progress[t.ID] = progress
+	return w.write(&TaskProgressEvent{
+		Type:         TaskEventProgress,
+		Time:         w.clock.Now().UTC(),
+		TaskID:       t.ID,
+		TaskProgress: progress,
+	})
+}
+
+// WriteLogs writes the log elements of a task which haven't been written yet. Once a task has completed its log
+// won't grow any more, so it is forgotten.
+func (w *TaskEventWriter) WriteLogs(t *tasks.Task, details *tasks.TaskDetailsResource) error {
+	if details == nil {
+		return nil
+	}
+	taskID := t.ID
+	written := w.writtenLogs[taskID]
+	if written == nil {
+		written = make(map[string]int)
+		w.writtenLogs[taskID] = written
+	}
+
+	var walk func(activities []*tasks.ActivityElement) error
+	walk = func(activities []*tasks.ActivityElement) error {
+		for _, activity := range activities {
+			if activity == nil {
+				continue
+			}
+			for i := written[activity.ID]; i < len(activity.LogElements); i++ {
+				logElement := activity.LogElements[i]
+				if logElement == nil {
+					continue
+				}
+				err := w.write(&TaskLogEvent{
+					Type:         TaskEventLog,
+					Time:         w.clock.Now().UTC(),
+					TaskID:       taskID,
+					ActivityID:   activity.ID,
+					Activity:     activity.Name,
+					Category:     logElement.Category,
+					Message:      logElement.MessageText,
+					OccurredAt:   logElement.OccurredAt,
+					TaskProgress: w.progress[taskID],
+				})
+				if err != nil {
+					return err
+				}
+			}
+			written[activity.ID] = max(written[activity.ID], len(activity.LogElements))
+			if err := walk(activity.Children); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(details.ActivityLogs); err != nil {
+		return err
+	}
+
+	if t.IsCompleted != nil && *t.IsCompleted {
+		delete(w.writtenLogs, taskID)
+	}
+	return nil
+}
+
+// WriteSummary writes the outcome of the wait, which is the last event of the stream. verification is nil unless the
+// tasks were verified with --verify-url.
+func (w *TaskEventWriter) WriteSummary(results []*TaskResult, verification *VerifyResult, waitErr error) error {
+	if results == nil {
+		results = []*TaskResult{}
+	}
+	event := &TaskSummaryEvent{
+		Type:      TaskEventSummary,
+		Time:      w.clock.Now().UTC(),
+		Succeeded: waitErr == nil,
+		Tasks:     results,
+	}
+	event.Verification = verification
+	if waitErr != nil {
+		event.Error = waitErr.Error()
+	}
+	var taskFailedErr *TaskFailedError
+	if errors.As(waitErr, &taskFailedErr) {
+		event.Failures = taskFailedErr.Failures
+	}
+	return w.write(event)
+}
+
+// newTaskProgress reads how far through a task is from its details, leaving out whatever they don't say
+func newTaskProgress(details *tasks.TaskDetailsResource) TaskProgress {
+	progress := TaskProgress{}
+	if percentage, ok := progressPercentage(details); ok {
+		progress.PercentComplete = &percentage
+	}
+	if step := runningStep(details); step != "" {
+		progress.Step = &step
+	}
+	return progress
+}
+
+// sameTaskProgress reports whether a and b say the same, rather than whether they point to the same values
+func sameTaskProgress(a TaskProgress, b TaskProgress) bool {
+	return samePointee(a.PercentComplete, b.PercentComplete) && samePointee(a.Step, b.Step)
+}
+
+func samePointee[T comparable](a *T, b *T) bool {
+	return (a == nil) == (b == nil) && (a == nil || *a == *b)
+}
+
+// write writes an event as a single line in one go, flushing it if out is buffered, so that whoever is reading the
+// stream sees each event as soon as it happens
+func (w *TaskEventWriter) write(event any) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err := w.out.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if flusher, ok := w.out.(interface{ Flush() error }); ok {
+		return flusher.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package wait
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+)
+
+// ParseSince accepts either a duration before now, or an absolute date with an optional time
+func ParseSince(value string, now time.Time) (time.Time, error) {
+	if duration, err := time.ParseDuration(value); err == nil {
+		return now.Add(-duration), nil
+	}
+	if since, err := time.Parse(time.RFC3339, value); err == nil {
+		return since, nil
+	}
+	if since, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return since, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --%s value %s; expected a duration such as 24h or a date such as 2024-01-31", FlagSince, value)
+}
+
+// compileNamePattern turns a --name-pattern such as "Deploy *" into a regular expression matching the whole of a
+// task's name, where * matches any run of characters and ? any single one, ignoring case
+func compileNamePattern(pattern string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("(?i)^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
+
+// matchesTaskFilter reports whether a task found by config.All, config.States or config.Since has a name matching
+// config.NamePattern, and started (or was queued, if it hasn't started yet) no earlier than config.Since
+func matchesTaskFilter(config WaitConfig, t *tasks.Task) bool {
+	if config.NamePattern != nil && !config.NamePattern.MatchString(t.Description) {
+		return false
+	}
+	if !config.Since.IsZero() {
+		started := taskStartedOrQueued(t)
+		if started.IsZero() || started.Before(config.Since) {
+			return false
+		}
+	}
+	return true
+}
+
+// describeTaskFilter says which tasks a wait looked for, such as "in state Queued matching 'Deploy *' which started
+// since 2024-01-31T09:00:00Z", to report what it found
+func describeTaskFilter(states []string, namePattern string, since time.Time) string {
+	parts := make([]string, 0, 3)
+	if len(states) != 0 {
+		parts = append(parts, "in state "+strings.Join(states, ", "))
+	}
+	if namePattern != "" {
+		parts = append(parts, fmt.Sprintf("matching '%s'", namePattern))
+	}
+	if !since.IsZero() {
+		parts = append(parts, "which started since "+since.Format(time.RFC3339))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,46 @@
+package wait
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompileNamePattern(t *testing.T) {
+	pattern := compileNamePattern("Deploy *")
+	assert.True(t, pattern.MatchString("Deploy MyProject release 1.0.0 to Production"))
+	assert.True(t, pattern.MatchString("deploy MyProject release 1.0.0 to Production"))
+	assert.False(t, pattern.MatchString("Redeploy MyProject release 1.0.0 to Production"))
+
+	pattern = compileNamePattern("Run runbook ? (1.0)")
+	assert.True(t, pattern.MatchString("Run runbook A (1.0)"))
+	assert.False(t, pattern.MatchString("Run runbook AB (1.0)"))
+	assert.False(t, pattern.MatchString("Run runbook A (100)"))
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 1, 31, 10, 0, 0, 0, time.UTC)
+
+	since, err := ParseSince("10m", now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(-10*time.Minute), since)
+
+	since, err = ParseSince("2024-01-30T09:00:00Z", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 30, 9, 0, 0, 0, time.UTC), since)
+
+	since, err = ParseSince("2024-01-30", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 30, 0, 0, 0, 0, time.Local), since)
+
+	_, err = ParseSince("yesterday", now)
+	assert.EqualError(t, err, "invalid --since value yesterday; expected a duration such as 24h or a date such as 2024-01-31")
+}
+
+func TestDescribeTaskFilter(t *testing.T) {
+	since := time.Date(2024, 1, 31, 9, 50, 0, 0, time.UTC)
+	assert.Equal(t, "in state Queued, Executing", describeTaskFilter([]string{"Queued", "Executing"}, "", time.Time{}))
+	assert.Equal(t, "in state Queued matching 'Deploy *' which started since 2024-01-31T09:50:00Z", describeTaskFilter([]string{"Queued"}, "Deploy *", since))
+	assert.Equal(t, "which started since 2024-01-31T09:50:00Z", describeTaskFilter(nil, "", since))
+}
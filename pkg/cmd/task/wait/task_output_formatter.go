@@ -3,11 +3,18 @@ package wait
 import (
 	"fmt"
 	"io"
+	"os"
+	"regexp"
+	"sort"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/OctopusDeploy/cli/pkg/output"
+	"github.com/OctopusDeploy/cli/pkg/util"
 	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+	"github.com/mgutz/ansi"
+	"golang.org/x/term"
 )
 
 const (
@@ -20,117 +27,841 @@ const (
 	logLineIndent    = "                  "
 )
 
+// spinnerFrames are shown in turn, one per poll, so a terminal shows the wait is still alive
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// LogLevel controls how much the formatter prints, each level including everything printed by the levels before it
+type LogLevel int
+
+const (
+	// LogLevelError only prints why tasks failed
+	LogLevelError LogLevel = iota
+	// LogLevelWarn also prints warnings, such as retries
+	LogLevelWarn
+	// LogLevelInfo also prints task state transitions, progress and the summary
+	LogLevelInfo
+	// LogLevelDebug also prints each poll and how long each API call took
+	LogLevelDebug
+)
+
+// LogLevels are the names of the log levels, indexed by level
+var LogLevels = []string{"error", "warn", "info", "debug"}
+
+// ParseLogLevel parses a log level name case-insensitively
+func ParseLogLevel(name string) (LogLevel, error) {
+	for level, levelName := range LogLevels {
+		if strings.EqualFold(levelName, strings.TrimSpace(name)) {
+			return LogLevel(level), nil
+		}
+	}
+	return LogLevelInfo, fmt.Errorf("unknown log level %s; valid levels are %s", name, strings.Join(LogLevels, ", "))
+}
+
 type TaskOutputFormatter struct {
-	out io.Writer
+	out              io.Writer
+	logLevel         LogLevel
+	isTerminal       bool
+	colorEnabled     bool
+	started          time.Time
+	statusLineActive bool
+	spinnerFrame     int
+	// highlights are the patterns which make an activity log line stand out; with onlyMatching, log lines which
+	// don't match any of them aren't printed at all
+	highlights   []*regexp.Regexp
+	onlyMatching bool
+	// links are included with each task's state and failure when set, such as for --print-links
+	links *taskLinks
+	// contexts are included with each task's description and in the summary table when set, such as for --show-context
+	contexts *taskContexts
+	// expandAll prints the logs of every finished step, rather than collapsing the ones which succeeded
+	expandAll bool
+	// tail, when set, limits the log lines printed at once to the most recent ones, such as for --tail
+	tail int
+	// resultsTemplate replaces the summary table once the wait finishes when set, such as for --format-template
+	resultsTemplate *template.Template
+	// lastOutput is when a line was last printed, so that a heartbeat is only printed when nothing else has been
+	lastOutput time.Time
+	// dashboardLines is how many lines the dashboard took up when it was last drawn, so it can be drawn over
+	dashboardLines int
+	// clock tells the time for the elapsed time and heartbeats, which is the real time unless SetClock says otherwise
+	clock Clock
 }
 
-func NewTaskOutputFormatter(out io.Writer) *TaskOutputFormatter {
+// NewTaskOutputFormatter creates a formatter writing to out. Output is only colored when out is a terminal
+// and NO_COLOR isn't set, so piped output is plain text. Anything more detailed than logLevel isn't printed.
+func NewTaskOutputFormatter(out io.Writer, logLevel LogLevel) *TaskOutputFormatter {
+	isTerminal := isTerminal(out)
+	clock := realClock{}
+	now := clock.Now()
 	return &TaskOutputFormatter{
-		out: out,
+		out:          out,
+		logLevel:     logLevel,
+		isTerminal:   isTerminal,
+		colorEnabled: isTerminal && os.Getenv("NO_COLOR") == "",
+		started:      now,
+		lastOutput:   now,
+		clock:        clock,
 	}
 }
 
+// SetClock makes the formatter tell the time from clock, such as the Clock of the wait, starting the elapsed time
+// over from now on clock
+func (f *TaskOutputFormatter) SetClock(clock Clock) {
+	f.clock = clock
+	f.started = clock.Now()
+	f.lastOutput = f.started
+}
+
+// DisableColor makes the formatter print plain text even on a terminal, such as for --no-color
+func (f *TaskOutputFormatter) DisableColor() {
+	f.colorEnabled = false
+}
+
+// SetHighlights makes activity log lines matching any of highlights stand out, such as for --highlight, and with
+// onlyMatching leaves out the ones which don't match
+func (f *TaskOutputFormatter) SetHighlights(highlights []*regexp.Regexp, onlyMatching bool) {
+	f.highlights = highlights
+	f.onlyMatching = onlyMatching
+}
+
+// SetTaskLinks makes the formatter include a link to each task in the web portal with its state and failure
+func (f *TaskOutputFormatter) SetTaskLinks(links *taskLinks) {
+	f.links = links
+}
+
+// SetTaskContexts makes the formatter include what each task is deploying or running with its description
+func (f *TaskOutputFormatter) SetTaskContexts(contexts *taskContexts) {
+	f.contexts = contexts
+}
+
+// ExpandAllActivities makes the formatter print the logs of every finished step, such as for --expand-all, rather
+// than collapsing the ones which succeeded or were skipped to a single line
+func (f *TaskOutputFormatter) ExpandAllActivities() {
+	f.expandAll = true
+}
+
+// TailActivityLogs makes the formatter print only the most recent lines of the logs of the steps it prints at once,
+// such as for --tail, rather than all of them. Steps which succeeded or were skipped are printed with their most
+// recent lines rather than being collapsed. All of a step which failed is still printed, as are lines matching a
+// highlight.
+func (f *TaskOutputFormatter) TailActivityLogs(lines int) {
+	f.tail = lines
+}
+
+// SetResultsTemplate makes the formatter print each task rendered through tmpl instead of the summary table
+func (f *TaskOutputFormatter) SetResultsTemplate(tmpl *template.Template) {
+	f.resultsTemplate = tmpl
+}
+
+func isTerminal(out io.Writer) bool {
+	file, ok := out.(interface{ Fd() uintptr })
+	return ok && term.IsTerminal(int(file.Fd()))
+}
+
 func (f *TaskOutputFormatter) PrintTaskInfo(t *tasks.Task) {
-	status := f.formatTaskStatus(t.State)
+	f.printTaskInfo(t, "")
+}
+
+// PrintTaskStep prints a task along with the step it is running, such as
+// "ServerTasks-1: Deploy MyProject release 1.0.0 to Production: Executing: Deploy to Production (step 3/7)"
+func (f *TaskOutputFormatter) PrintTaskStep(t *tasks.Task, step string) {
+	f.printTaskInfo(t, ": "+step)
+}
+
+// PrintQueuedTaskInfo prints a queued task along with where it is in the queue given the tasks it is queued behind,
+// such as "ServerTasks-2: Deploy MyProject release 1.0.0 to Production: Queued, position 3, blocked by ServerTasks-1"
+func (f *TaskOutputFormatter) PrintQueuedTaskInfo(t *tasks.Task, queuedBehind []*tasks.Task) {
+	f.printTaskInfo(t, formatQueuePosition(queuedBehind))
+}
+
+// formatQueuePosition describes where a task is in the queue given the tasks it is queued behind. The ones which are
+// executing are what's holding it up, such as by holding a lock on the environment it deploys to.
+func formatQueuePosition(queuedBehind []*tasks.Task) string {
+	if len(queuedBehind) == 0 {
+		return ""
+	}
+	position := fmt.Sprintf(", position %d", len(queuedBehind)+1)
+	blocking := make([]string, 0)
+	for _, t := range queuedBehind {
+		if t != nil && t.State == "Executing" {
+			blocking = append(blocking, t.ID)
+		}
+	}
+	if len(blocking) != 0 {
+		position += ", blocked by " + strings.Join(blocking, ", ")
+	}
+	return position
+}
+
+func (f *TaskOutputFormatter) printTaskInfo(t *tasks.Task, queuePosition string) {
+	if f.logLevel < LogLevelInfo {
+		return
+	}
+	status := f.formatTaskStatus(t.State) + queuePosition
+	link := f.links.link(t.ID, t.SpaceID)
+	description := t.Description
+	if taskContext := f.contexts.context(t); taskContext != nil {
+		description += fmt.Sprintf(" [%s]", taskContext)
+	}
 	if t.StartTime != nil && t.CompletedTime != nil {
 		duration := t.CompletedTime.Sub(*t.StartTime).Round(time.Second)
-		timeInfo := f.formatTaskHeader(t.ID, t.Description, status, t.StartTime, t.CompletedTime, duration)
-		fmt.Fprintln(f.out, timeInfo)
+		timeInfo := f.formatTaskHeader(t.ID, description, status, t.StartTime, t.CompletedTime, duration, link)
+		f.writeLine(timeInfo)
 	} else {
-		fmt.Fprintln(f.out, f.formatTaskHeader(t.ID, t.Description, status, nil, nil, time.Duration(0)))
+		f.writeLine(f.formatTaskHeader(t.ID, description, status, nil, nil, time.Duration(0), link))
 	}
 }
 
-func (f *TaskOutputFormatter) PrintActivityElement(activity *tasks.ActivityElement, indent int, completedChildIds map[string]bool) {
-	for _, child := range activity.Children {
-		if child.Status != "Pending" && child.Status != "Running" && !completedChildIds[child.ID] {
-			line := fmt.Sprintf("         %s: %s", child.Status, child.Name)
-
-			var timeInfo string
-			if child.Started != nil && child.Ended != nil {
-				startTime := child.Started.Format(timeFormat)
-				endTime := child.Ended.Format(timeFormat)
-				duration := child.Ended.Sub(*child.Started).Round(time.Second)
-				indentStr := f.getIndentation(logIndentLevel)
-				sep := f.formatSeparatorLine(indentStr)
-				timeInfo = fmt.Sprintf("\n%s\n%sStarted:   %s\n%sEnded:     %s\n%sDuration:  %s\n%s",
-					sep,
-					indentStr, startTime,
-					indentStr, endTime,
-					indentStr, duration,
-					sep)
-			}
+// PrintSummaryTable prints one row per task with its final state, sized to fit the longest task name. The tasks
+// in timedOutTaskIDs are reported as having timed out, and other unfinished tasks as still running, rather than failed.
+// Tasks which succeeded but logged any of warnings, keyed by task ID, are reported with how many they logged.
+func (f *TaskOutputFormatter) PrintSummaryTable(summaryTasks []*tasks.Task, timedOutTaskIDs []string, warnings map[string][]string) error {
+	if len(summaryTasks) == 0 || f.logLevel < LogLevelInfo {
+		return nil
+	}
 
-			switch child.Status {
-			case "Success":
-				line = output.Green(line)
-			case "Failed":
-				line = output.Red(line)
-			case "Skipped":
-				line = output.Yellow(line)
-			case "SuccessWithWarning":
-				line = output.Yellow(line)
-			case "Canceled":
-				line = output.Yellow(line)
+	f.writeLine("")
+	t := output.NewTable(f.out)
+	header := []string{f.bold("ID"), f.bold("NAME"), f.bold("STATE"), f.bold("DURATION"), f.bold("RESULT")}
+	if f.contexts != nil {
+		header = append(header, f.bold("CONTEXT"))
+	}
+	t.AddRow(header...)
+	for _, task := range summaryTasks {
+		duration := "-"
+		if d, ok := taskDuration(task); ok {
+			duration = formatDuration(d)
+		}
+		result := f.green("Succeeded")
+		if util.SliceContains(timedOutTaskIDs, task.ID) {
+			result = f.yellow("Timed out")
+		} else if util.SliceContains(runningTaskStates, task.State) {
+			// such as at the end of --watch, or when --fail-fast stopped waiting for the task
+			result = f.yellow("Running")
+		} else if task.FinishedSuccessfully == nil || !*task.FinishedSuccessfully {
+			result = f.red("Failed")
+		} else if len(warnings[task.ID]) != 0 {
+			result = f.yellow(fmt.Sprintf("Succeeded with %d warning(s)", len(warnings[task.ID])))
+		}
+		row := []string{task.ID, task.Description, f.formatTaskStatus(task.State), duration, result}
+		if f.contexts != nil {
+			taskContext := "-"
+			if c := f.contexts.context(task); c != nil {
+				taskContext = c.String()
 			}
+			row = append(row, taskContext)
+		}
+		t.AddRow(row...)
+	}
+	return t.Print()
+}
+
+// PrintQueueWaits prints one row per task with how long it spent queued and executing, for --print-queue-wait. Times
+// observed while waiting rather than given by the server are marked, as they only start from when the wait began.
+func (f *TaskOutputFormatter) PrintQueueWaits(waitedTasks []*tasks.Task, queueWaits map[string]QueueWait) error {
+	if f.logLevel < LogLevelInfo {
+		return nil
+	}
 
-			if timeInfo != "" {
-				line = line + timeInfo
+	f.writeLine("")
+	t := output.NewTable(f.out)
+	t.AddRow(f.bold("ID"), f.bold("QUEUED"), f.bold("EXECUTING"))
+	observed := false
+	for _, task := range waitedTasks {
+		wait, ok := queueWaits[task.ID]
+		if !ok {
+			continue
+		}
+		marker := ""
+		if wait.Observed {
+			marker = "*"
+			observed = true
+		}
+		t.AddRow(task.ID, formatDuration(wait.Queued)+marker, formatDuration(wait.Executing)+marker)
+	}
+	if err := t.Print(); err != nil {
+		return err
+	}
+	if observed {
+		f.writeLine("* observed while waiting, so only counted from when the wait began")
+	}
+	return nil
+}
+
+// PrintTaskOutputs prints one row per output variable set by each task which succeeded, for --print-outputs, in the
+// order the tasks were waited for and then by name
+func (f *TaskOutputFormatter) PrintTaskOutputs(waitedTasks []*tasks.Task, outputs map[string]map[string]string) error {
+	if f.logLevel < LogLevelInfo {
+		return nil
+	}
+
+	f.writeLine("")
+	rows := 0
+	t := output.NewTable(f.out)
+	t.AddRow(f.bold("ID"), f.bold("OUTPUT"), f.bold("VALUE"))
+	for _, task := range waitedTasks {
+		taskOutputs := outputs[task.ID]
+		names := make([]string, 0, len(taskOutputs))
+		for name := range taskOutputs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			t.AddRow(task.ID, name, taskOutputs[name])
+			rows++
+		}
+	}
+	if rows == 0 {
+		f.writeLine("No output variables were set by the task(s) which succeeded")
+		return nil
+	}
+	return t.Print()
+}
+
+// PrintAPIProfile prints how long the API calls made while waiting took, by kind of call and by poll. It is printed
+// whatever the log level, as it is only recorded when asked for.
+func (f *TaskOutputFormatter) PrintAPIProfile(profile *apiProfile) error {
+	f.writeLine("")
+	t := output.NewTable(f.out)
+	t.AddRow(f.bold("API CALL"), f.bold("CALLS"), f.bold("TOTAL"), f.bold("MIN"), f.bold("AVG"), f.bold("MAX"))
+	calls := profile.callStats()
+	for _, call := range apiCalls {
+		if stats, ok := calls[call]; ok {
+			t.AddRow(call, fmt.Sprint(stats.count), formatAPITime(stats.total), formatAPITime(stats.min), formatAPITime(stats.average()), formatAPITime(stats.max))
+		}
+	}
+	// each poll is counted as a single call, to show how long it took to check on the tasks each time
+	polls := profile.pollStats()
+	t.AddRow("Per poll", fmt.Sprint(polls.count), formatAPITime(polls.total), formatAPITime(polls.min), formatAPITime(polls.average()), formatAPITime(polls.max))
+	return t.Print()
+}
+
+// PrintTaskFailure prints why a task failed, indenting any further lines of the message under the task ID
+func (f *TaskOutputFormatter) PrintTaskFailure(taskID string, message string) {
+	f.writeLine(f.red(fmt.Sprintf("%s failed: %s", taskID, strings.ReplaceAll(message, "\n", "\n    "))))
+	if link := f.links.link(taskID, ""); link != "" {
+		f.writeLine("    See " + link)
+	}
+}
+
+// PrintTaskWarnings prints the warnings logged by a task which succeeded, indenting them under the task ID
+func (f *TaskOutputFormatter) PrintTaskWarnings(taskID string, warnings []string) {
+	if f.logLevel < LogLevelWarn {
+		return
+	}
+	f.writeLine(f.yellow(fmt.Sprintf("%s succeeded with %d warning(s):\n    %s", taskID, len(warnings), strings.ReplaceAll(strings.Join(warnings, "\n"), "\n", "\n    "))))
+}
+
+// PrintWarning prints a message about a problem which doesn't stop the wait
+func (f *TaskOutputFormatter) PrintWarning(message string) {
+	if f.logLevel < LogLevelWarn {
+		return
+	}
+	f.writeLine(f.yellow("Warning: " + message))
+}
+
+// PrintInfo prints a message about the wait as a whole
+func (f *TaskOutputFormatter) PrintInfo(message string) {
+	if f.logLevel < LogLevelInfo {
+		return
+	}
+	f.writeLine(message)
+}
+
+// PrintDebug prints a message which helps to diagnose what the wait is doing, such as why it is slow
+func (f *TaskOutputFormatter) PrintDebug(message string) {
+	if f.logLevel < LogLevelDebug {
+		return
+	}
+	f.writeLine("Debug: " + message)
+}
+
+// PrintStatusLine prints how long we've been waiting, followed by status. On a terminal each status line
+// overwrites the previous one, otherwise they are appended like any other output.
+func (f *TaskOutputFormatter) PrintStatusLine(status string) {
+	if f.logLevel < LogLevelInfo {
+		return
+	}
+	line := fmt.Sprintf("[elapsed %s]", formatClock(f.elapsed()))
+	if status != "" {
+		line = line + " " + status
+	}
+
+	if !f.isTerminal {
+		f.writeLine(line)
+		return
+	}
+	fmt.Fprintf(f.out, "\r\033[K%s", line)
+	f.statusLineActive = true
+}
+
+// PrintSpinner shows a heartbeat such as "⠋ Waiting for 2 task(s)… (elapsed 01:05)", replacing the previous one.
+// It is only shown on a terminal, as on anything else it would just add a line per poll.
+func (f *TaskOutputFormatter) PrintSpinner(pendingCount int) {
+	if f.logLevel < LogLevelInfo || !f.isTerminal {
+		return
+	}
+	frame := spinnerFrames[f.spinnerFrame%len(spinnerFrames)]
+	f.spinnerFrame++
+
+	elapsed := f.elapsed().Round(time.Second)
+	fmt.Fprintf(f.out, "\r\033[K%s Waiting for %d task(s)… (elapsed %02d:%02d)", frame, pendingCount, int(elapsed.Minutes()), int(elapsed.Seconds())%60)
+	f.statusLineActive = true
+}
+
+// PrintHeartbeat prints a line such as "Still waiting for 2 task(s) (elapsed 01:05:00)" if nothing has been printed
+// for at least interval, so that CI systems which stop jobs without output for too long don't stop a healthy wait.
+// It isn't printed on a terminal, where the spinner and status line already show the wait is alive.
+func (f *TaskOutputFormatter) PrintHeartbeat(pendingCount int, interval time.Duration) {
+	if f.logLevel < LogLevelInfo || f.isTerminal || f.clock.Now().Sub(f.lastOutput) < interval {
+		return
+	}
+	f.writeLine(fmt.Sprintf("Still waiting for %d task(s) (elapsed %s)", pendingCount, formatClock(f.elapsed())))
+}
+
+// elapsed is how long the formatter has been printing the wait
+func (f *TaskOutputFormatter) elapsed() time.Duration {
+	return f.clock.Now().Sub(f.started)
+}
+
+// PrintStatus prints the tasks still pending with their states and how long each has been running, such as when
+// SIGUSR1 asks what a long wait is still waiting for. It is printed whatever the log level, as it was asked for.
+func (f *TaskOutputFormatter) PrintStatus(pendingTasks []*tasks.Task) error {
+	f.writeLine(fmt.Sprintf("Waiting for %d task(s) (elapsed %s)", len(pendingTasks), formatClock(f.elapsed())))
+	if len(pendingTasks) == 0 {
+		return nil
+	}
+	now := f.clock.Now()
+	t := output.NewTable(f.out)
+	t.AddRow(f.bold("ID"), f.bold("NAME"), f.bold("STATE"), f.bold("ELAPSED"))
+	for _, task := range pendingTasks {
+		t.AddRow(task.ID, task.Description, f.formatTaskStatus(task.State), formatClock(dashboardElapsed(task, now)))
+	}
+	return t.Print()
+}
+
+// PrintDashboard draws lines as a block replacing the one drawn before it, such as for --dashboard, leaving the
+// cursor below it. It is only drawn on a terminal, where the cursor can be moved back up over the block.
+func (f *TaskOutputFormatter) PrintDashboard(lines []string) {
+	if f.logLevel < LogLevelInfo || !f.isTerminal {
+		return
+	}
+	f.ClearStatusLine()
+	for _, line := range lines {
+		fmt.Fprintln(f.out, line)
+	}
+	f.dashboardLines = len(lines)
+}
+
+// TerminalWidth is how many columns wide the terminal being written to is, or 0 if it isn't a terminal or its size
+// can't be found
+func (f *TaskOutputFormatter) TerminalWidth() int {
+	file, ok := f.out.(interface{ Fd() uintptr })
+	if !ok || !f.isTerminal {
+		return 0
+	}
+	width, _, err := term.GetSize(int(file.Fd()))
+	if err != nil {
+		return 0
+	}
+	return width
+}
+
+// ClearStatusLine removes the status line and the dashboard from a terminal, so that they don't get mixed up with
+// the next line printed
+func (f *TaskOutputFormatter) ClearStatusLine() {
+	if f.statusLineActive {
+		fmt.Fprint(f.out, "\r\033[K")
+		f.statusLineActive = false
+	}
+	if f.dashboardLines > 0 {
+		// back up to the first line of the dashboard, then clear everything from there down
+		fmt.Fprintf(f.out, "\033[%dF\033[J", f.dashboardLines)
+		f.dashboardLines = 0
+	}
+}
+
+// FormatTaskProgress describes how far through a task is, e.g. "63% complete, ETA 00:02:28". If the server doesn't
+// provide an estimate of the remaining time, one is extrapolated from how long the task has been running. On a
+// terminal it is drawn as a bar, followed by the step the task is running, as the status line is redrawn in place
+// rather than adding a line each time. Returns an empty string if the details have no progress information.
+func (f *TaskOutputFormatter) FormatTaskProgress(details *tasks.TaskDetailsResource) string {
+	percentage, ok := progressPercentage(details)
+	if !ok {
+		return ""
+	}
+
+	eta := details.Progress.EstimatedTimeRemaining
+	if eta == "" && percentage > 0 && percentage < 100 && details.Task != nil && details.Task.StartTime != nil {
+		running := f.clock.Now().Sub(*details.Task.StartTime)
+		eta = formatClock(time.Duration(float64(running) * float64(100-percentage) / float64(percentage)))
+	}
+
+	progress := fmt.Sprintf("%d%% complete", percentage)
+	if eta != "" {
+		progress = progress + ", ETA " + eta
+	}
+	if f.isTerminal {
+		progress = formatProgressBar(percentage, progressBarWidth) + " " + progress
+		if step := runningStep(details); step != "" {
+			progress = progress + " - " + step
+		}
+	}
+	return progress
+}
+
+// progressBarWidth is how many characters wide the progress bar of a task is, not counting its ends
+const progressBarWidth = 20
+
+// formatProgressBar draws how far through something is, such as "[█████░░░░░░░░░░░░░░░]" for 25% of 20 characters
+func formatProgressBar(percentage int, width int) string {
+	filled := width * max(0, min(percentage, 100)) / 100
+	return "[" + strings.Repeat("█", filled) + strings.Repeat("░", width-filled) + "]"
+}
+
+// progressPercentage is how far through a task is from 0 to 100, or false if its details don't say
+func progressPercentage(details *tasks.TaskDetailsResource) (int, bool) {
+	if details == nil || details.Progress == nil {
+		return 0, false
+	}
+	return max(0, min(details.Progress.ProgressPercentage, 100)), true
+}
+
+// FormatActiveStep describes the step a task is running and where it is among the task's steps, such as
+// "Deploy to Production (step 3/7)", or returns an empty string if it isn't running one
+func (f *TaskOutputFormatter) FormatActiveStep(details *tasks.TaskDetailsResource) string {
+	step := findActiveStep(details)
+	if step == nil {
+		return ""
+	}
+	// the step's own number is already given by where it is among the steps
+	name := stepNumberPrefixPattern.ReplaceAllString(step.Name, "")
+	return fmt.Sprintf("%s (step %d/%d)", name, step.Number, step.Count)
+}
+
+// stepNumberPrefixPattern matches the number the server gives the name of each step, such as "Step 3: "
+var stepNumberPrefixPattern = regexp.MustCompile(`^Step \d+: `)
+
+// activeStep is the step a task is running, numbered from 1 among the Count steps of the task
+type activeStep struct {
+	Name   string
+	Number int
+	Count  int
+}
+
+// findActiveStep finds the step a task is running, or returns nil if it isn't running one, such as while it is
+// waiting for a manual intervention
+func findActiveStep(details *tasks.TaskDetailsResource) *activeStep {
+	if details == nil {
+		return nil
+	}
+	for _, activity := range details.ActivityLogs {
+		if activity == nil {
+			continue
+		}
+		for i, step := range activity.Children {
+			if step != nil && step.Status == "Running" {
+				return &activeStep{Name: step.Name, Number: i + 1, Count: len(activity.Children)}
 			}
-			fmt.Fprintln(f.out, line)
+		}
+	}
+	return nil
+}
+
+// runningStep is the name of the step a task is running, or an empty string if it isn't running one, such as while
+// it is waiting for a manual intervention
+func runningStep(details *tasks.TaskDetailsResource) string {
+	if step := findActiveStep(details); step != nil {
+		return step.Name
+	}
+	return ""
+}
+
+// PrintResults writes the final results of the waited tasks as a single JSON or YAML document
+func (f *TaskOutputFormatter) PrintResults(results []*TaskResult, outputFormat string) error {
+	data, err := MarshalTaskResults(results, outputFormat)
+	if err != nil {
+		return err
+	}
+
+	f.ClearStatusLine()
+	_, err = f.out.Write(data)
+	return err
+}
+
+// PrintResultsTemplate prints each result rendered through the results template
+func (f *TaskOutputFormatter) PrintResultsTemplate(results []*TaskResult) error {
+	rendered, err := renderFormatTemplate(f.resultsTemplate, results)
+	if err != nil {
+		return err
+	}
 
+	f.ClearStatusLine()
+	_, err = io.WriteString(f.out, rendered)
+	return err
+}
+
+// PrintedActivities records the activities PrintActivityElement has printed, keyed by ID, along with how each of them
+// ended, so that an activity which runs again (such as a retried step) is printed again once it ends again
+type PrintedActivities map[string]string
+
+// activityOutcome identifies one run of a finished activity, so a later run of the same activity can be told apart
+func activityOutcome(activity *tasks.ActivityElement) string {
+	if activity.Ended == nil {
+		return activity.Status
+	}
+	return activity.Status + " " + activity.Ended.Format(time.RFC3339Nano)
+}
+
+// PrintActivityElement prints the completed children of activity which haven't already been printed. When prefix is
+// not empty (e.g. because several tasks are being followed at once) every line is prefixed with it. The server may
+// leave parts of the activity tree out, so missing activities and log elements are skipped rather than printed.
+// Unless the formatter expands all activities or tails their logs, steps which succeeded or were skipped are collapsed
+// to a single line, leaving out their logs other than the lines matching a highlight; any other step is expanded all
+// the way down, so that why it failed is visible.
+func (f *TaskOutputFormatter) PrintActivityElement(prefix string, activity *tasks.ActivityElement, indent int, printed PrintedActivities) {
+	if activity == nil || f.logLevel < LogLevelInfo {
+		return
+	}
+	// the steps are gathered before any is printed, so that a tail can be taken across all of them
+	finished := make([]*tasks.ActivityElement, 0, len(activity.Children))
+	for _, child := range activity.Children {
+		if child == nil {
+			continue
+		}
+		if child.Status == "Pending" || child.Status == "Running" {
+			// it has started again, so whatever was printed before is no longer its outcome
+			delete(printed, child.ID)
+			continue
+		}
+		if printed[child.ID] != activityOutcome(child) {
+			finished = append(finished, child)
+		}
+	}
+	shown := f.tailActivityLogs(finished)
+
+	for _, child := range finished {
+		collapsed := !f.expandAll && f.tail == 0 && isCollapsibleActivity(child)
+		line := fmt.Sprintf("         %s: %s", child.Status, child.Name)
+		if collapsed && child.Started != nil && child.Ended != nil {
+			line += fmt.Sprintf(" (%s)", child.Ended.Sub(*child.Started).Round(time.Second))
+		}
+
+		var timeInfo string
+		if !collapsed && child.Started != nil && child.Ended != nil {
+			startTime := child.Started.Format(timeFormat)
+			endTime := child.Ended.Format(timeFormat)
+			duration := child.Ended.Sub(*child.Started).Round(time.Second)
+			indentStr := f.getIndentation(logIndentLevel)
+			sep := f.formatSeparatorLine(indentStr)
+			timeInfo = fmt.Sprintf("\n%s\n%sStarted:   %s\n%sEnded:     %s\n%sDuration:  %s\n%s",
+				sep,
+				indentStr, startTime,
+				indentStr, endTime,
+				indentStr, duration,
+				sep)
+		}
+
+		switch child.Status {
+		case "Success":
+			line = f.green(line)
+		case "Failed":
+			line = f.red(line)
+		case "Skipped":
+			line = f.yellow(line)
+		case "SuccessWithWarning":
+			line = f.yellow(line)
+		case "Canceled":
+			line = f.yellow(line)
+		}
+
+		if timeInfo != "" {
+			line = line + timeInfo
+		}
+		f.println(prefix, line)
+
+		// a collapsed step still shows the lines which were asked to stand out
+		if !collapsed || len(f.highlights) != 0 {
 			for _, stepChild := range child.Children {
-				if stepChild.Status != "Pending" && stepChild.Status != "Running" {
-					var lastWasRetry bool
-					for _, logElement := range stepChild.LogElements {
-						message := logElement.MessageText
-						timeStr := logElement.OccurredAt.Format(timeFormat)
-						category := logElement.Category
-
-						if strings.Contains(message, "Retry (attempt") {
-							fmt.Fprintln(f.out, f.formatRetryMessage(message))
-							lastWasRetry = true
-						} else if lastWasRetry && strings.Contains(message, "Starting") {
-							lastWasRetry = false
-						}
-
-						logLine := f.formatLogLine(timeStr, category, message)
-						switch strings.ToLower(category) {
-						case "warning":
-							logLine = output.Yellow(logLine)
-						case "error", "fatal":
-							logLine = output.Red(logLine)
-						}
-
-						fmt.Fprintln(f.out, logLine)
-					}
-				}
+				f.printActivityLogs(prefix, stepChild, collapsed, shown)
+			}
+		}
+
+		printed[child.ID] = activityOutcome(child)
+	}
+}
+
+// tailActivityLogs picks the log lines of steps to print with a tail: the most recent lines, by when they occurred,
+// along with all the lines of a step which failed and every line matching a highlight. It returns nil without a
+// tail, leaving every line to be printed.
+func (f *TaskOutputFormatter) tailActivityLogs(steps []*tasks.ActivityElement) map[*tasks.ActivityLogElement]bool {
+	if f.tail <= 0 {
+		return nil
+	}
+	shown := make(map[*tasks.ActivityLogElement]bool)
+	recent := make([]*tasks.ActivityLogElement, 0)
+	var collect func(activity *tasks.ActivityElement, failed bool)
+	collect = func(activity *tasks.ActivityElement, failed bool) {
+		if activity == nil || activity.Status == "Pending" || activity.Status == "Running" {
+			return
+		}
+		for _, logElement := range activity.LogElements {
+			switch {
+			case logElement == nil:
+			case failed || f.isHighlighted(logElement.MessageText):
+				shown[logElement] = true
+			case !f.onlyMatching:
+				recent = append(recent, logElement)
 			}
+		}
+		for _, child := range activity.Children {
+			collect(child, failed)
+		}
+	}
+	for _, step := range steps {
+		for _, child := range step.Children {
+			collect(child, step.Status == "Failed")
+		}
+	}
+
+	sort.SliceStable(recent, func(i, j int) bool { return recent[i].OccurredAt.Before(recent[j].OccurredAt) })
+	for _, logElement := range recent[max(0, len(recent)-f.tail):] {
+		shown[logElement] = true
+	}
+	return shown
+}
+
+// isCollapsibleActivity reports whether an activity went well enough for its logs to be left out by default
+func isCollapsibleActivity(activity *tasks.ActivityElement) bool {
+	return activity.Status == "Success" || activity.Status == "Skipped"
+}
+
+// printActivityLogs prints the log lines of a finished activity, followed by those of each of its children in turn.
+// With onlyHighlighted, only the lines matching a highlight are printed, and when shown is set only the lines in it.
+func (f *TaskOutputFormatter) printActivityLogs(prefix string, activity *tasks.ActivityElement, onlyHighlighted bool, shown map[*tasks.ActivityLogElement]bool) {
+	if activity == nil || activity.Status == "Pending" || activity.Status == "Running" {
+		return
+	}
+
+	var lastWasRetry bool
+	for _, logElement := range activity.LogElements {
+		if logElement == nil {
+			continue
+		}
+		message := logElement.MessageText
+		highlighted := f.isHighlighted(message)
+		if (f.onlyMatching || onlyHighlighted) && !highlighted {
+			continue
+		}
+		if shown != nil && !shown[logElement] {
+			continue
+		}
+		timeStr := logElement.OccurredAt.Format(timeFormat)
+		category := logElement.Category
+
+		if strings.Contains(message, "Retry (attempt") {
+			f.println(prefix, f.formatRetryMessage(message))
+			lastWasRetry = true
+		} else if lastWasRetry && strings.Contains(message, "Starting") {
+			lastWasRetry = false
+		}
+
+		logLine := f.formatLogLine(timeStr, category, message)
+		switch {
+		case highlighted:
+			logLine = f.highlight(logLine)
+		case strings.EqualFold(category, "warning"):
+			logLine = f.yellow(logLine)
+		case strings.EqualFold(category, "error"), strings.EqualFold(category, "fatal"):
+			logLine = f.red(logLine)
+		}
+		f.println(prefix, logLine)
+	}
+
+	for _, child := range activity.Children {
+		f.printActivityLogs(prefix, child, onlyHighlighted, shown)
+	}
+}
+
+// println writes text, prefixing each of its lines with prefix if one is given
+func (f *TaskOutputFormatter) println(prefix string, text string) {
+	if prefix == "" {
+		f.writeLine(text)
+		return
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		f.writeLine(fmt.Sprintf("[%s] %s", prefix, line))
+	}
+}
 
-			completedChildIds[child.ID] = true
+func (f *TaskOutputFormatter) writeLine(line string) {
+	f.ClearStatusLine()
+	fmt.Fprintln(f.out, line)
+	f.lastOutput = f.clock.Now()
+}
+
+func (f *TaskOutputFormatter) red(s string) string {
+	return f.colorize(s, "red")
+}
+
+func (f *TaskOutputFormatter) green(s string) string {
+	return f.colorize(s, "green")
+}
+
+func (f *TaskOutputFormatter) yellow(s string) string {
+	return f.colorize(s, "yellow")
+}
+
+func (f *TaskOutputFormatter) bold(s string) string {
+	return f.colorize(s, "default+b")
+}
+
+func (f *TaskOutputFormatter) highlight(s string) string {
+	return f.colorize(s, "black+b:yellow")
+}
+
+// isHighlighted reports whether an activity log message matches any of the highlights
+func (f *TaskOutputFormatter) isHighlighted(message string) bool {
+	for _, highlight := range f.highlights {
+		if highlight.MatchString(message) {
+			return true
 		}
 	}
+	return false
+}
+
+// colorize applies style to s when color is enabled. It doesn't use the output package's colors, which are
+// enabled by whether stdout is a terminal rather than whatever this formatter writes to.
+func (f *TaskOutputFormatter) colorize(s string, style string) string {
+	if !f.colorEnabled {
+		return s
+	}
+	return ansi.Color(s, style)
 }
 
 func (f *TaskOutputFormatter) formatTaskStatus(state string) string {
 	switch state {
 	case "Failed", "TimedOut":
-		return output.Red(state)
+		return f.red(state)
 	case "Success":
-		return output.Green(state)
+		return f.green(state)
 	case "Queued", "Executing", "Cancelling", "Canceled":
-		return output.Yellow(state)
+		return f.yellow(state)
 	default:
 		return state
 	}
 }
 
-func (f *TaskOutputFormatter) formatTaskHeader(taskID string, description string, status string, startTime *time.Time, endTime *time.Time, duration time.Duration) string {
+func (f *TaskOutputFormatter) formatTaskHeader(taskID string, description string, status string, startTime *time.Time, endTime *time.Time, duration time.Duration, link string) string {
 	if startTime == nil || endTime == nil {
+		if link != "" {
+			return fmt.Sprintf("%s: %s: %s (%s)", taskID, description, status, link)
+		}
 		return fmt.Sprintf("%s: %s: %s", taskID, description, status)
 	}
 
-	return fmt.Sprintf("\n%s %s %s\n   Name: %s\n   Status: %s\n   Started: %s\n   Ended: %s\n   Duration: %s\n",
+	header := fmt.Sprintf("\n%s %s %s\n   Name: %s\n   Status: %s\n   Started: %s\n   Ended: %s\n   Duration: %s\n",
 		taskHeaderIndent,
 		taskID,
 		taskHeaderIndent,
@@ -139,6 +870,10 @@ func (f *TaskOutputFormatter) formatTaskHeader(taskID string, description string
 		startTime.Format(timeFormat),
 		endTime.Format(timeFormat),
 		duration)
+	if link != "" {
+		header += fmt.Sprintf("   Link: %s\n", link)
+	}
+	return header
 }
 
 func (f *TaskOutputFormatter) formatLogLine(timeStr, category, message string) string {
@@ -146,7 +881,7 @@ func (f *TaskOutputFormatter) formatLogLine(timeStr, category, message string) s
 }
 
 func (f *TaskOutputFormatter) formatRetryMessage(message string) string {
-	return fmt.Sprintf("%s%s", logLineIndent, output.Yellow(fmt.Sprintf("------ %s ------", message)))
+	return fmt.Sprintf("%s%s", logLineIndent, f.yellow(fmt.Sprintf("------ %s ------", message)))
 }
 
 func (f *TaskOutputFormatter) getIndentation(level int) string {
@@ -156,3 +891,14 @@ func (f *TaskOutputFormatter) getIndentation(level int) string {
 func (f *TaskOutputFormatter) formatSeparatorLine(indent string) string {
 	return indent + strings.Repeat(separator, sepLength)
 }
+
+// formatAPITime formats the duration of API calls to the millisecond, which is as precise as is useful
+func formatAPITime(d time.Duration) string {
+	return d.Round(time.Millisecond).String()
+}
+
+// formatClock formats a duration as hh:mm:ss
+func formatClock(d time.Duration) string {
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
@@ -0,0 +1,484 @@
+package wait
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OctopusDeploy/cli/pkg/util"
+	"github.com/OctopusDeploy/cli/test/testutil"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskOutputFormatter_FormatTaskProgress(t *testing.T) {
+	formatter := NewTaskOutputFormatter(&bytes.Buffer{}, LogLevelInfo)
+
+	assert.Equal(t, "", formatter.FormatTaskProgress(&tasks.TaskDetailsResource{}))
+
+	assert.Equal(t, "63% complete, ETA 2 minutes", formatter.FormatTaskProgress(&tasks.TaskDetailsResource{
+		Progress: &tasks.TaskProgress{ProgressPercentage: 63, EstimatedTimeRemaining: "2 minutes"},
+	}))
+
+	// without an estimate from the server, a task which is a quarter done after a minute has three minutes to go
+	startTime := time.Now().Add(-1 * time.Minute)
+	task := tasks.NewTask()
+	task.StartTime = &startTime
+	assert.Equal(t, "25% complete, ETA 00:03:00", formatter.FormatTaskProgress(&tasks.TaskDetailsResource{
+		Task:     task,
+		Progress: &tasks.TaskProgress{ProgressPercentage: 25},
+	}))
+}
+
+func TestTaskOutputFormatter_FormatTaskProgressOnTerminal(t *testing.T) {
+	formatter := NewTaskOutputFormatter(&bytes.Buffer{}, LogLevelInfo)
+	formatter.isTerminal = true
+
+	// still nothing to show without progress information, so the activity log is all there is
+	assert.Equal(t, "", formatter.FormatTaskProgress(&tasks.TaskDetailsResource{}))
+
+	assert.Equal(t, "[████████████░░░░░░░░] 63% complete, ETA 2 minutes - Deploy a Package", formatter.FormatTaskProgress(&tasks.TaskDetailsResource{
+		Progress: &tasks.TaskProgress{ProgressPercentage: 63, EstimatedTimeRemaining: "2 minutes"},
+		ActivityLogs: []*tasks.ActivityElement{{
+			Children: []*tasks.ActivityElement{
+				{Name: "Run a Script", Status: "Success"},
+				{Name: "Deploy a Package", Status: "Running"},
+				{Name: "Send an Email", Status: "Pending"},
+			},
+		}},
+	}))
+
+	// without a running step, such as while waiting for an intervention, there's only the bar
+	assert.Equal(t, "[░░░░░░░░░░░░░░░░░░░░] 0% complete, ETA 2 minutes", formatter.FormatTaskProgress(&tasks.TaskDetailsResource{
+		Progress: &tasks.TaskProgress{ProgressPercentage: 0, EstimatedTimeRemaining: "2 minutes"},
+	}))
+}
+
+func TestTaskOutputFormatter_FormatActiveStep(t *testing.T) {
+	formatter := NewTaskOutputFormatter(&bytes.Buffer{}, LogLevelInfo)
+	steps := func(statuses ...string) *tasks.TaskDetailsResource {
+		children := make([]*tasks.ActivityElement, 0, len(statuses))
+		for i, status := range statuses {
+			children = append(children, &tasks.ActivityElement{Name: fmt.Sprintf("Step %d: Deploy to Environment %d", i+1, i+1), Status: status})
+		}
+		return &tasks.TaskDetailsResource{ActivityLogs: []*tasks.ActivityElement{{Name: "Deploy", Children: children}}}
+	}
+
+	assert.Equal(t, "Deploy to Environment 3 (step 3/4)", formatter.FormatActiveStep(steps("Success", "Success", "Running", "Pending")))
+	assert.Equal(t, "Deploy to Environment 1 (step 1/1)", formatter.FormatActiveStep(steps("Running")))
+	// names without a step number are shown as they are
+	details := steps("Running", "Pending")
+	details.ActivityLogs[0].Children[0].Name = "Acquire packages"
+	assert.Equal(t, "Acquire packages (step 1/2)", formatter.FormatActiveStep(details))
+
+	// such as while waiting for a manual intervention, or once the task has finished
+	assert.Equal(t, "", formatter.FormatActiveStep(steps("Success", "Pending")))
+	assert.Equal(t, "", formatter.FormatActiveStep(&tasks.TaskDetailsResource{}))
+	assert.Equal(t, "", formatter.FormatActiveStep(nil))
+}
+
+func TestFormatProgressBar(t *testing.T) {
+	assert.Equal(t, "[░░░░░░░░░░]", formatProgressBar(0, 10))
+	assert.Equal(t, "[██░░░░░░░░]", formatProgressBar(25, 10))
+	assert.Equal(t, "[██████████]", formatProgressBar(100, 10))
+	// the server's percentage is trusted to be in range, but the bar stays the same width if it isn't
+	assert.Equal(t, "[██████████]", formatProgressBar(120, 10))
+	assert.Equal(t, "[░░░░░░░░░░]", formatProgressBar(-5, 10))
+}
+
+func TestTaskOutputFormatter_PrintStatusLineWhenPiped(t *testing.T) {
+	out := bytes.Buffer{}
+	formatter := NewTaskOutputFormatter(&out, LogLevelInfo)
+	formatter.started = time.Now().Add(-(4*time.Minute + 12*time.Second))
+
+	formatter.PrintStatusLine("63% complete")
+	formatter.PrintWarning("something happened")
+
+	assert.Equal(t, "[elapsed 00:04:12] 63% complete\nWarning: something happened\n", out.String())
+}
+
+func TestTaskOutputFormatter_PrintSpinner(t *testing.T) {
+	out := bytes.Buffer{}
+	formatter := NewTaskOutputFormatter(&out, LogLevelInfo)
+	formatter.started = time.Now().Add(-(4*time.Minute + 12*time.Second))
+
+	// piped output doesn't get a spinner
+	formatter.PrintSpinner(2)
+	assert.Equal(t, "", out.String())
+
+	formatter.isTerminal = true
+	formatter.PrintSpinner(2)
+	formatter.PrintSpinner(1)
+	formatter.PrintWarning("something happened")
+
+	assert.Equal(t, "\r\033[K⠋ Waiting for 2 task(s)… (elapsed 04:12)"+
+		"\r\033[K⠙ Waiting for 1 task(s)… (elapsed 04:12)"+
+		"\r\033[KWarning: something happened\n", out.String())
+}
+
+func TestTaskOutputFormatter_PrintHeartbeat(t *testing.T) {
+	out := bytes.Buffer{}
+	clock := testutil.NewFakeClock(time.Date(2024, 1, 31, 18, 0, 0, 0, time.UTC))
+	formatter := NewTaskOutputFormatter(&out, LogLevelInfo)
+	formatter.SetClock(clock)
+
+	// nothing is printed while other output is still flowing
+	clock.Advance(4*time.Minute + 11*time.Second)
+	formatter.PrintInfo("still deploying")
+	clock.Advance(time.Second)
+	formatter.PrintHeartbeat(2, time.Minute)
+	assert.Equal(t, "still deploying\n", out.String())
+
+	out.Reset()
+	clock.Advance(time.Minute)
+	formatter.PrintHeartbeat(2, time.Minute)
+	assert.Equal(t, "Still waiting for 2 task(s) (elapsed 00:05:12)\n", out.String())
+
+	// the heartbeat counts as output itself
+	formatter.PrintHeartbeat(2, time.Minute)
+	assert.Equal(t, "Still waiting for 2 task(s) (elapsed 00:05:12)\n", out.String())
+
+	// a terminal has the spinner instead
+	out.Reset()
+	formatter.isTerminal = true
+	clock.Advance(time.Minute)
+	formatter.PrintHeartbeat(2, time.Minute)
+	assert.Equal(t, "", out.String())
+}
+
+func TestTaskOutputFormatter_PrintActivityElementRetried(t *testing.T) {
+	out := bytes.Buffer{}
+	formatter := NewTaskOutputFormatter(&out, LogLevelInfo)
+	printed := make(PrintedActivities)
+
+	firstEnded := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	secondEnded := firstEnded.Add(time.Minute)
+	step := func(status string, ended *time.Time) *tasks.ActivityElement {
+		return &tasks.ActivityElement{
+			Children: []*tasks.ActivityElement{{ID: "ServerTasks-1_step1", Name: "Step 1", Status: status, Ended: ended}},
+		}
+	}
+
+	formatter.PrintActivityElement("", step("Failed", &firstEnded), 0, printed)
+	assert.Equal(t, "         Failed: Step 1\n", out.String())
+
+	// an activity which has already been printed isn't printed again
+	out.Reset()
+	formatter.PrintActivityElement("", step("Failed", &firstEnded), 0, printed)
+	assert.Equal(t, "", out.String())
+
+	// but once it is retried, it is printed again when it ends
+	formatter.PrintActivityElement("", step("Running", nil), 0, printed)
+	assert.Equal(t, "", out.String())
+	formatter.PrintActivityElement("", step("Success", &secondEnded), 0, printed)
+	assert.Equal(t, "         Success: Step 1\n", out.String())
+
+	// even if the retry started and ended between polls
+	out.Reset()
+	thirdEnded := secondEnded.Add(time.Minute)
+	formatter.PrintActivityElement("", step("Success", &thirdEnded), 0, printed)
+	assert.Equal(t, "         Success: Step 1\n", out.String())
+}
+
+func TestTaskOutputFormatter_PrintActivityElementPartialDetails(t *testing.T) {
+	out := bytes.Buffer{}
+	formatter := NewTaskOutputFormatter(&out, LogLevelInfo)
+
+	// the server can leave out any part of the details, down to the activities themselves
+	details := &tasks.TaskDetailsResource{
+		ActivityLogs: []*tasks.ActivityElement{
+			nil,
+			{},
+			{Children: []*tasks.ActivityElement{
+				nil,
+				{ID: "ServerTasks-1_step1", Name: "Step 1", Status: "Success"},
+				{ID: "ServerTasks-1_step2", Name: "Step 2", Status: "Failed", Children: []*tasks.ActivityElement{
+					nil,
+					{Status: "Failed", LogElements: []*tasks.ActivityLogElement{nil, {Category: "Error", MessageText: "Script returned exit code 1"}}},
+				}},
+			}},
+		},
+	}
+
+	assert.NotPanics(t, func() {
+		for _, activity := range details.ActivityLogs {
+			formatter.PrintActivityElement("", activity, 0, make(PrintedActivities))
+		}
+	})
+	assert.Contains(t, out.String(), "         Success: Step 1\n")
+	assert.Contains(t, out.String(), "         Failed: Step 2\n")
+	assert.Contains(t, out.String(), "Error    Script returned exit code 1\n")
+
+	assert.Equal(t, "Script returned exit code 1", taskFailureMessage(details))
+	assert.Empty(t, findChildTaskIDs(details))
+	assert.Equal(t, "", taskFailureMessage(nil))
+	assert.Empty(t, findChildTaskIDs(&tasks.TaskDetailsResource{}))
+}
+
+func TestTaskOutputFormatter_Highlights(t *testing.T) {
+	activity := &tasks.ActivityElement{
+		Children: []*tasks.ActivityElement{{
+			ID:     "ServerTasks-1_step1",
+			Name:   "Step 1",
+			Status: "Success",
+			Children: []*tasks.ActivityElement{{
+				Status: "Success",
+				LogElements: []*tasks.ActivityLogElement{
+					{Category: "Info", MessageText: "Deploying package Acme.Web"},
+					{Category: "Warning", MessageText: "Disk space is low"},
+					{Category: "Info", MessageText: "Package deployed"},
+				},
+			}},
+		}},
+	}
+	highlights := []*regexp.Regexp{regexp.MustCompile(`Acme\.Web`), regexp.MustCompile(`(?i)disk`)}
+
+	// without color, highlighted lines are printed like any other
+	out := bytes.Buffer{}
+	formatter := NewTaskOutputFormatter(&out, LogLevelInfo)
+	formatter.ExpandAllActivities()
+	formatter.SetHighlights(highlights, false)
+	formatter.PrintActivityElement("", activity, 0, make(PrintedActivities))
+	assert.NotContains(t, out.String(), "\033[")
+	assert.Contains(t, out.String(), "Deploying package Acme.Web\n")
+	assert.Contains(t, out.String(), "Package deployed\n")
+
+	out.Reset()
+	formatter.colorEnabled = true
+	formatter.PrintActivityElement("", activity, 0, make(PrintedActivities))
+	assert.Equal(t, 2, strings.Count(out.String(), "\033[0;1;30;43m"))
+	assert.Contains(t, out.String(), "Package deployed\n")
+
+	// only the matching log lines are printed, along with the step they belong to
+	out.Reset()
+	formatter.DisableColor()
+	formatter.SetHighlights(highlights, true)
+	formatter.PrintActivityElement("", activity, 0, make(PrintedActivities))
+	assert.Contains(t, out.String(), "Success: Step 1\n")
+	assert.Contains(t, out.String(), "Deploying package Acme.Web\n")
+	assert.Contains(t, out.String(), "Disk space is low\n")
+	assert.NotContains(t, out.String(), "Package deployed")
+}
+
+// nestedActivityFixture is a task with a step which succeeded, a step which was skipped and a step which failed, each
+// with logs nested below their actions as they are for steps run on several deployment targets
+func nestedActivityFixture() *tasks.ActivityElement {
+	started := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	ended := started.Add(90 * time.Second)
+	logs := func(messages ...string) []*tasks.ActivityLogElement {
+		elements := make([]*tasks.ActivityLogElement, 0, len(messages))
+		for _, message := range messages {
+			category := "Info"
+			if strings.HasPrefix(message, "Error:") {
+				category = "Error"
+			}
+			elements = append(elements, &tasks.ActivityLogElement{Category: category, MessageText: message, OccurredAt: started})
+		}
+		return elements
+	}
+	return &tasks.ActivityElement{
+		Children: []*tasks.ActivityElement{
+			{ID: "ServerTasks-1_step1", Name: "Step 1", Status: "Success", Started: &started, Ended: &ended, Children: []*tasks.ActivityElement{
+				{Name: "Deploy package", Status: "Success", LogElements: logs("Deploying package Acme.Web"), Children: []*tasks.ActivityElement{
+					{Name: "Web01", Status: "Success", LogElements: logs("Extracted package on Web01")},
+				}},
+			}},
+			{ID: "ServerTasks-1_step2", Name: "Step 2", Status: "Skipped", Children: []*tasks.ActivityElement{
+				{Name: "Run smoke tests", Status: "Skipped", LogElements: logs("Skipped as the environment doesn't match")},
+			}},
+			{ID: "ServerTasks-1_step3", Name: "Step 3", Status: "Failed", Started: &started, Ended: &ended, Children: []*tasks.ActivityElement{
+				{Name: "Run migrations", Status: "Failed", LogElements: logs("Running migrations"), Children: []*tasks.ActivityElement{
+					{Name: "Db01", Status: "Success", LogElements: logs("Connected to Db01")},
+					{Name: "Db02", Status: "Failed", LogElements: logs("Error: migration 42 failed")},
+				}},
+			}},
+			{ID: "ServerTasks-1_step4", Name: "Step 4", Status: "Running"},
+		},
+	}
+}
+
+func TestTaskOutputFormatter_PrintActivityElementCollapsed(t *testing.T) {
+	out := bytes.Buffer{}
+	formatter := NewTaskOutputFormatter(&out, LogLevelInfo)
+
+	formatter.PrintActivityElement("", nestedActivityFixture(), 0, make(PrintedActivities))
+	assert.Equal(t, strings.Join([]string{
+		"         Success: Step 1 (1m30s)",
+		"         Skipped: Step 2",
+		"         Failed: Step 3",
+		"                        ─────────────────────────────",
+		"                        Started:   01-01-2024 10:00:00",
+		"                        Ended:     01-01-2024 10:01:30",
+		"                        Duration:  1m30s",
+		"                        ─────────────────────────────",
+		"                  01-01-2024 10:00:00      Info     Running migrations",
+		"                  01-01-2024 10:00:00      Info     Connected to Db01",
+		"                  01-01-2024 10:00:00      Error    Error: migration 42 failed",
+		"",
+	}, "\n"), out.String())
+
+	// highlighted lines still show through a collapsed step
+	out.Reset()
+	formatter.SetHighlights([]*regexp.Regexp{regexp.MustCompile(`Web01`)}, false)
+	formatter.PrintActivityElement("", nestedActivityFixture(), 0, make(PrintedActivities))
+	assert.Contains(t, out.String(), "         Success: Step 1 (1m30s)\n                  01-01-2024 10:00:00      Info     Extracted package on Web01\n")
+	assert.NotContains(t, out.String(), "Deploying package Acme.Web")
+}
+
+func TestTaskOutputFormatter_PrintActivityElementExpandAll(t *testing.T) {
+	out := bytes.Buffer{}
+	formatter := NewTaskOutputFormatter(&out, LogLevelInfo)
+	formatter.ExpandAllActivities()
+
+	formatter.PrintActivityElement("", nestedActivityFixture(), 0, make(PrintedActivities))
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	assert.Equal(t, "         Success: Step 1", lines[0])
+	assert.Contains(t, out.String(), "Info     Deploying package Acme.Web\n")
+	assert.Contains(t, out.String(), "Info     Extracted package on Web01\n")
+	assert.Contains(t, out.String(), "         Skipped: Step 2\n")
+	assert.Contains(t, out.String(), "Info     Skipped as the environment doesn't match\n")
+	assert.Contains(t, out.String(), "Error    Error: migration 42 failed\n")
+	assert.NotContains(t, out.String(), "Step 4")
+}
+
+func TestTaskOutputFormatter_PrintActivityElementTail(t *testing.T) {
+	started := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	ended := started.Add(time.Minute)
+	log := func(seconds int, message string) *tasks.ActivityLogElement {
+		return &tasks.ActivityLogElement{Category: "Info", MessageText: message, OccurredAt: started.Add(time.Duration(seconds) * time.Second)}
+	}
+	// the steps ran in parallel, so their lines are interleaved in time
+	activity := &tasks.ActivityElement{
+		Children: []*tasks.ActivityElement{
+			{ID: "ServerTasks-1_step1", Name: "Step 1", Status: "Success", Started: &started, Ended: &ended, Children: []*tasks.ActivityElement{
+				{Name: "Deploy package", Status: "Success", LogElements: []*tasks.ActivityLogElement{
+					log(1, "Downloading package"), log(3, "Extracting package"), log(6, "Package deployed"),
+				}},
+			}},
+			{ID: "ServerTasks-1_step2", Name: "Step 2", Status: "Success", Started: &started, Ended: &ended, Children: []*tasks.ActivityElement{
+				{Name: "Warm up", Status: "Success", LogElements: []*tasks.ActivityLogElement{
+					log(2, "Warming up the cache"), log(5, "Cache warmed up"),
+				}},
+			}},
+			{ID: "ServerTasks-1_step3", Name: "Step 3", Status: "Failed", Started: &started, Ended: &ended, Children: []*tasks.ActivityElement{
+				{Name: "Run migrations", Status: "Failed", LogElements: []*tasks.ActivityLogElement{
+					log(0, "Running migrations"), log(4, "Migration 42 failed"),
+				}},
+			}},
+		},
+	}
+
+	out := bytes.Buffer{}
+	formatter := NewTaskOutputFormatter(&out, LogLevelInfo)
+	formatter.TailActivityLogs(2)
+	formatter.PrintActivityElement("", activity, 0, make(PrintedActivities))
+	logLines := util.SliceFilter(strings.Split(out.String(), "\n"), func(line string) bool { return strings.Contains(line, "Info") })
+	assert.Equal(t, []string{
+		"                  01-01-2024 10:00:06      Info     Package deployed",
+		"                  01-01-2024 10:00:05      Info     Cache warmed up",
+		// all of the step which failed is printed, however old its lines
+		"                  01-01-2024 10:00:00      Info     Running migrations",
+		"                  01-01-2024 10:00:04      Info     Migration 42 failed",
+	}, logLines)
+	// steps which succeeded are printed in full rather than collapsed, other than their logs
+	assert.Contains(t, out.String(), "         Success: Step 1\n")
+
+	// highlighted lines are printed even when they aren't among the most recent
+	out.Reset()
+	formatter.SetHighlights([]*regexp.Regexp{regexp.MustCompile(`Downloading`)}, false)
+	formatter.PrintActivityElement("", activity, 0, make(PrintedActivities))
+	assert.Contains(t, out.String(), "Downloading package")
+	assert.Contains(t, out.String(), "Package deployed")
+	assert.Contains(t, out.String(), "Cache warmed up")
+	assert.NotContains(t, out.String(), "Extracting package")
+	assert.NotContains(t, out.String(), "Warming up the cache")
+}
+
+func TestTaskOutputFormatter_PrintSummaryTable(t *testing.T) {
+	out := bytes.Buffer{}
+	formatter := NewTaskOutputFormatter(&out, LogLevelInfo)
+
+	startTime := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	completedTime := startTime.Add(90 * time.Second)
+	succeeded := true
+	failed := false
+
+	first := tasks.NewTask()
+	first.ID = "ServerTasks-1"
+	first.Description = "Deploy"
+	first.State = "Success"
+	first.StartTime = &startTime
+	first.CompletedTime = &completedTime
+	first.FinishedSuccessfully = &succeeded
+
+	second := tasks.NewTask()
+	second.ID = "ServerTasks-22"
+	second.Description = "Deploy a project with a much longer name"
+	second.State = "Failed"
+	second.FinishedSuccessfully = &failed
+
+	assert.NoError(t, formatter.PrintSummaryTable([]*tasks.Task{first, second}, nil, nil))
+	assert.Equal(t, "\n"+
+		"ID              NAME                                      STATE    DURATION  RESULT\n"+
+		"ServerTasks-1   Deploy                                    Success  1m30s     Succeeded\n"+
+		"ServerTasks-22  Deploy a project with a much longer name  Failed   -         Failed\n", out.String())
+}
+
+func TestTaskOutputFormatter_PrintResultsTsv(t *testing.T) {
+	out := bytes.Buffer{}
+	formatter := NewTaskOutputFormatter(&out, LogLevelInfo)
+
+	results := []*TaskResult{
+		{ID: "ServerTasks-1", Name: "Deploy", State: "Success", FinishedSuccessfully: true, Duration: "1m30s"},
+		{ID: "ServerTasks-22", Name: "Deploy\tto\\Production\r\nagain", State: "Failed", Errors: "The step failed"},
+	}
+	assert.NoError(t, formatter.PrintResults(results, "TSV"))
+	assert.Equal(t, ""+
+		"Id\tName\tState\tFinishedSuccessfully\tDuration\n"+
+		"ServerTasks-1\tDeploy\tSuccess\ttrue\t1m30s\n"+
+		"ServerTasks-22\tDeploy\\tto\\\\Production\\r\\nagain\tFailed\tfalse\t\n", out.String())
+}
+
+func TestTaskOutputFormatter_Color(t *testing.T) {
+	failed := tasks.NewTask()
+	failed.ID = "ServerTasks-1"
+	failed.Description = "Deploy"
+	failed.State = "Failed"
+	activity := &tasks.ActivityElement{
+		Children: []*tasks.ActivityElement{{
+			ID:     "ServerTasks-1_step1",
+			Name:   "Step 1",
+			Status: "Failed",
+			Children: []*tasks.ActivityElement{{
+				Status:      "Failed",
+				LogElements: []*tasks.ActivityLogElement{{Category: "Error", MessageText: "Script returned exit code 1"}},
+			}},
+		}},
+	}
+	print := func(formatter *TaskOutputFormatter) {
+		formatter.PrintTaskInfo(failed)
+		formatter.PrintActivityElement("", activity, 0, make(PrintedActivities))
+	}
+
+	// output which isn't a terminal, such as when piped, is plain text
+	out := bytes.Buffer{}
+	print(NewTaskOutputFormatter(&out, LogLevelInfo))
+	assert.NotContains(t, out.String(), "\033[")
+	assert.Contains(t, out.String(), "ServerTasks-1: Deploy: Failed\n")
+	assert.Contains(t, out.String(), "Failed: Step 1")
+
+	out.Reset()
+	formatter := NewTaskOutputFormatter(&out, LogLevelInfo)
+	formatter.colorEnabled = true
+	print(formatter)
+	assert.Contains(t, out.String(), "ServerTasks-1: Deploy: \033[0;31mFailed\033[0m\n")
+	assert.Equal(t, 3, strings.Count(out.String(), "\033[0;31m"))
+
+	out.Reset()
+	formatter.DisableColor()
+	print(formatter)
+	assert.NotContains(t, out.String(), "\033[")
+}
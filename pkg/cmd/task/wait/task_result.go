@@ -0,0 +1,195 @@
+package wait
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OctopusDeploy/cli/pkg/constants"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+	"gopkg.in/yaml.v3"
+)
+
+// TaskResult is the structured representation of a waited task, used for JSON and YAML output
+type TaskResult struct {
+	ID                   string `json:"Id" yaml:"id"`
+	Name                 string `json:"Name" yaml:"name"`
+	State                string `json:"State" yaml:"state"`
+	FinishedSuccessfully bool   `json:"FinishedSuccessfully" yaml:"finishedSuccessfully"`
+	Duration             string `json:"Duration,omitempty" yaml:"duration,omitempty"`
+	Errors               string `json:"Errors,omitempty" yaml:"errors,omitempty"`
+	Warnings             int    `json:"Warnings,omitempty" yaml:"warnings,omitempty"`
+	Link                 string `json:"Link,omitempty" yaml:"link,omitempty"`
+	// QueuedFor and ExecutingFor are only set with --print-queue-wait. QueueWaitObserved says they're from the state
+	// changes seen while waiting, which start from when the wait began, as the server didn't say when the task was
+	// queued.
+	QueuedFor         string `json:"QueuedFor,omitempty" yaml:"queuedFor,omitempty"`
+	ExecutingFor      string `json:"ExecutingFor,omitempty" yaml:"executingFor,omitempty"`
+	QueueWaitObserved bool   `json:"QueueWaitObserved,omitempty" yaml:"queueWaitObserved,omitempty"`
+	// Attempts and RetriedTaskIDs are only set for a task which is the rerun of one which failed, with
+	// --retry-on-failure; the earlier attempts come oldest first
+	Attempts       int      `json:"Attempts,omitempty" yaml:"attempts,omitempty"`
+	RetriedTaskIDs []string `json:"RetriedTaskIds,omitempty" yaml:"retriedTaskIds,omitempty"`
+	// Project, Environment, Release, Runbook and RunbookSnapshot are only set with --show-context, and only for tasks
+	// which deploy a release or run a runbook
+	Project         string `json:"Project,omitempty" yaml:"project,omitempty"`
+	Environment     string `json:"Environment,omitempty" yaml:"environment,omitempty"`
+	Release         string `json:"Release,omitempty" yaml:"release,omitempty"`
+	Runbook         string `json:"Runbook,omitempty" yaml:"runbook,omitempty"`
+	RunbookSnapshot string `json:"RunbookSnapshot,omitempty" yaml:"runbookSnapshot,omitempty"`
+	// Outputs are only set with --print-outputs, and only for tasks which succeeded, keyed by the full name of each
+	// output variable
+	Outputs map[string]string `json:"Outputs,omitempty" yaml:"outputs,omitempty"`
+}
+
+func NewTaskResult(t *tasks.Task) *TaskResult {
+	result := &TaskResult{
+		ID:                   t.ID,
+		Name:                 t.Description,
+		State:                t.State,
+		FinishedSuccessfully: t.FinishedSuccessfully != nil && *t.FinishedSuccessfully,
+		Errors:               t.ErrorMessage,
+	}
+	if duration, ok := taskDuration(t); ok {
+		result.Duration = formatDuration(duration)
+	}
+	return result
+}
+
+// taskLinks builds the addresses of tasks in the Octopus web portal, for --print-links
+type taskLinks struct {
+	// host is the server's address, which may include a subpath for servers hosted under one
+	host string
+	// spaceID is the space of tasks which don't say which space they're in
+	spaceID string
+}
+
+func newTaskLinks(opts *WaitOptions) *taskLinks {
+	return &taskLinks{host: opts.Host, spaceID: SpaceID(opts.Dependencies)}
+}
+
+// link is the address of a task's page in the web portal, such as
+// https://octopus.example.com/app#/Spaces-1/tasks/ServerTasks-123. A nil taskLinks makes no links, so that callers
+// don't have to check whether they were asked for.
+func (l *taskLinks) link(taskID string, spaceID string) string {
+	if l == nil {
+		return ""
+	}
+	if spaceID == "" {
+		spaceID = l.spaceID
+	}
+	host := strings.TrimRight(l.host, "/")
+	if spaceID == "" {
+		return fmt.Sprintf("%s/app#/tasks/%s", host, taskID)
+	}
+	return fmt.Sprintf("%s/app#/%s/tasks/%s", host, spaceID, taskID)
+}
+
+// taskDuration is how long a finished task ran for on the server, from when it started to when it completed
+func taskDuration(t *tasks.Task) (time.Duration, bool) {
+	if t.StartTime == nil || t.CompletedTime == nil {
+		return 0, false
+	}
+	return t.CompletedTime.Sub(*t.StartTime), true
+}
+
+// formatDuration formats a duration to the second, such as 40m12s, or to the hundredth of a second if it is shorter
+// than that, so that something which failed straight away doesn't read as having taken no time at all
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(10 * time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+// MarshalTaskResults serializes the results in the given format: an indented JSON array, a YAML list, jsonl with
+// one JSON object per result on each line, or tsv with a header row and a row of tab separated values per result
+func MarshalTaskResults(results []*TaskResult, format string) ([]byte, error) {
+	switch strings.ToLower(format) {
+	case constants.OutputFormatJson:
+		data, err := json.MarshalIndent(results, "", "  ")
+		return append(data, '\n'), err
+	case OutputFormatYaml:
+		return yaml.Marshal(results)
+	case OutputFormatJsonl:
+		var data []byte
+		for _, result := range results {
+			line, err := json.Marshal(result)
+			if err != nil {
+				return nil, err
+			}
+			data = append(append(data, line...), '\n')
+		}
+		return data, nil
+	case OutputFormatTsv:
+		return marshalTaskResultsTsv(results), nil
+	default:
+		return nil, fmt.Errorf("unsupported output format %s", format)
+	}
+}
+
+// tsvColumns are the columns of tsv output, named after the fields of the JSON output they hold
+var tsvColumns = []string{"Id", "Name", "State", "FinishedSuccessfully", "Duration"}
+
+// tsvEscaper escapes the characters which would otherwise split a value into more than one column or row, as tab
+// separated values can't be quoted
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+// marshalTaskResultsTsv writes a header row followed by a row for each result, keeping to the most useful fields so
+// that every row has the same columns. Backslashes, tabs and line breaks in values are escaped as \\, \t, \n and \r.
+func marshalTaskResultsTsv(results []*TaskResult) []byte {
+	var sb strings.Builder
+	sb.WriteString(strings.Join(tsvColumns, "\t") + "\n")
+	for _, result := range results {
+		row := []string{result.ID, result.Name, result.State, strconv.FormatBool(result.FinishedSuccessfully), result.Duration}
+		for i, value := range row {
+			row[i] = tsvEscaper.Replace(value)
+		}
+		sb.WriteString(strings.Join(row, "\t") + "\n")
+	}
+	return []byte(sb.String())
+}
+
+// WriteTaskResultsFile writes the results to path in the given format, as MarshalTaskResults does. They're written
+// to a temporary file alongside it which is then renamed over path, so readers never see a partially written file.
+func WriteTaskResultsFile(path string, results []*TaskResult, format string) error {
+	data, err := MarshalTaskResults(results, format)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(path, data)
+}
+
+// writeFileAtomically writes data to a temporary file alongside path which is then renamed over it, so that readers
+// never see a partially written file, and a wait stopped part way through a write leaves the old file in place
+func writeFileAtomically(path string, data []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tempPath := file.Name()
+	// a no-op once the rename has happened
+	defer os.Remove(tempPath)
+
+	// temporary files are only readable by their owner, but the files are meant for other tools to pick up
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, path)
+}
@@ -0,0 +1,37 @@
+package wait
+
+import (
+	"slices"
+	"time"
+)
+
+// DefaultTimeoutWarnings are the percentages of the timeout at which task wait warns that it is running out of time
+var DefaultTimeoutWarnings = []int{80}
+
+// timeoutWarnings tracks which percentages of a timeout have been passed, so that each is only warned about once
+type timeoutWarnings struct {
+	percents []int
+	next     int
+}
+
+// newTimeoutWarnings tracks the given percentages, in whatever order they're given; zeros are left out
+func newTimeoutWarnings(percents []int) *timeoutWarnings {
+	sorted := slices.DeleteFunc(slices.Clone(percents), func(p int) bool { return p <= 0 })
+	slices.Sort(sorted)
+	return &timeoutWarnings{percents: slices.Compact(sorted)}
+}
+
+// passed returns the highest percentage of timeout which elapsed has passed since it was last called, if any.
+// When a slow poll passes several at once only the highest is returned, as warning about the others would be
+// out of date already.
+func (w *timeoutWarnings) passed(elapsed time.Duration, timeout time.Duration) (int, bool) {
+	if timeout <= 0 {
+		return 0, false
+	}
+	percent, ok := 0, false
+	for w.next < len(w.percents) && elapsed*100 >= timeout*time.Duration(w.percents[w.next]) {
+		percent, ok = w.percents[w.next], true
+		w.next++
+	}
+	return percent, ok
+}
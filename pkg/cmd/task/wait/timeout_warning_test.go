@@ -0,0 +1,65 @@
+package wait
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/OctopusDeploy/cli/test/testutil"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeoutWarnings_Passed(t *testing.T) {
+	w := newTimeoutWarnings([]int{95, 0, 50, 80, 50})
+
+	_, ok := w.passed(40*time.Second, 100*time.Second)
+	assert.False(t, ok)
+
+	percent, ok := w.passed(50*time.Second, 100*time.Second)
+	assert.True(t, ok)
+	assert.Equal(t, 50, percent)
+
+	// each percentage is only passed once
+	_, ok = w.passed(60*time.Second, 100*time.Second)
+	assert.False(t, ok)
+
+	// a slow poll passing several at once only gets the highest of them
+	percent, ok = w.passed(99*time.Second, 100*time.Second)
+	assert.True(t, ok)
+	assert.Equal(t, 95, percent)
+
+	_, ok = w.passed(200*time.Second, 100*time.Second)
+	assert.False(t, ok)
+}
+
+func TestTimeoutWarnings_NoTimeout(t *testing.T) {
+	w := newTimeoutWarnings(DefaultTimeoutWarnings)
+
+	_, ok := w.passed(time.Hour, 0)
+	assert.False(t, ok)
+}
+
+func TestWaitForTasks_TimeoutWarnings(t *testing.T) {
+	executing := testutil.NewFakeTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing")
+
+	warnings := make([]int, 0)
+	config := WaitConfig{
+		Timeout:         500 * time.Millisecond,
+		PollInterval:    5 * time.Millisecond,
+		MaxPollInterval: 5 * time.Millisecond,
+		TimeoutWarnings: []int{50, 80, 95},
+		GetServerTasksCallback: func(taskIDs []string) ([]*tasks.Task, error) {
+			return []*tasks.Task{executing}, nil
+		},
+		OnTimeoutWarning: func(percent int, pendingTaskIDs []string) {
+			assert.Equal(t, []string{"ServerTasks-1"}, pendingTaskIDs)
+			warnings = append(warnings, percent)
+		},
+	}
+	_, err := WaitForTasks(context.Background(), nil, []string{"ServerTasks-1"}, config)
+
+	var timeoutErr *WaitTimeoutError
+	assert.ErrorAs(t, err, &timeoutErr)
+	assert.Equal(t, []int{50, 80, 95}, warnings)
+}
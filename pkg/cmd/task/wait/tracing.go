@@ -0,0 +1,24 @@
+package wait
+
+import (
+	"context"
+	"time"
+)
+
+// TracingShutdownTimeout is how long to wait for the spans of a wait to be exported before exiting
+const TracingShutdownTimeout = 5 * time.Second
+
+// TracerProvider receives the spans of a wait. With the otel build tag, it is an OpenTelemetry
+// trace.TracerProvider; builds without the tag are never traced, and don't depend on OpenTelemetry at all.
+type TracerProvider interface{}
+
+// waitTracer traces a wait with a span covering the whole of it, and a child span for each API call made while
+// waiting. Only builds with the otel build tag have one.
+type waitTracer interface {
+	// start starts the span of the wait, returning the context the spans of its API calls are children of
+	start(ctx context.Context, taskIDs []string) context.Context
+	// addTracing records a span for each call of the API callbacks of config
+	addTracing(ctx context.Context, config *WaitConfig)
+	// end records how the wait ended on its span
+	end(result WaitResult, waitErr error)
+}
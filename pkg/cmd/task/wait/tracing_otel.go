@@ -0,0 +1,153 @@
+//go:build otel
+
+package wait
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans created by task wait
+const tracerName = "github.com/OctopusDeploy/cli/pkg/cmd/task/wait"
+
+const (
+	spanWait        = "octopus task wait"
+	spanPollTasks   = "poll tasks"
+	spanQueryTasks  = "query tasks"
+	spanTaskDetails = "fetch task details"
+)
+
+const (
+	attributeTaskIDs       = "octopus.task.ids"
+	attributeTaskID        = "octopus.task.id"
+	attributeTaskCount     = "octopus.task.count"
+	attributeTaskStates    = "octopus.task.states"
+	attributeWaitStatus    = "octopus.wait.status"
+	attributeWaitExitCode  = "octopus.wait.exit_code"
+	attributeFailedTaskIDs = "octopus.wait.failed_task_ids"
+)
+
+// otelWaitTracer traces a wait with OpenTelemetry
+type otelWaitTracer struct {
+	tracer trace.Tracer
+	// span covers the whole wait, once it has started
+	span trace.Span
+}
+
+// newWaitTracer returns the tracer the wait should be traced with, if any, and a function exporting any spans it
+// still holds once the wait is over. Tracing is for the benefit of whoever is watching the CLI, so an exporter which
+// can't be set up, or can't export, only gets a warning.
+func newWaitTracer(opts *WaitOptions, formatter *TaskOutputFormatter) (waitTracer, func()) {
+	if opts.TracerProvider != nil {
+		tracerProvider, ok := opts.TracerProvider.(trace.TracerProvider)
+		if !ok {
+			formatter.PrintWarning(fmt.Sprintf("the tracer provider is a %T rather than an OpenTelemetry one, so the wait won't be traced", opts.TracerProvider))
+			return nil, nil
+		}
+		return &otelWaitTracer{tracer: tracerProvider.Tracer(tracerName)}, nil
+	}
+	tracerProvider, shutdown, err := newTracerProvider(opts.Context)
+	if err != nil {
+		formatter.PrintWarning(fmt.Sprintf("failed to set up tracing, so the wait won't be traced: %v", err))
+		return nil, nil
+	}
+	if tracerProvider == nil {
+		return nil, nil
+	}
+	tracer := &otelWaitTracer{tracer: tracerProvider.Tracer(tracerName)}
+	return tracer, func() {
+		// the wait may have ended because its context was cancelled, which mustn't stop the spans being exported
+		ctx, cancel := context.WithTimeout(context.Background(), TracingShutdownTimeout)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			formatter.PrintWarning(fmt.Sprintf("failed to export the traces of the wait: %v", err))
+		}
+	}
+}
+
+// start starts the span covering the whole wait, which the spans of the API calls made while waiting are children of
+func (w *otelWaitTracer) start(ctx context.Context, taskIDs []string) context.Context {
+	ctx, w.span = w.tracer.Start(ctx, spanWait, trace.WithAttributes(attribute.StringSlice(attributeTaskIDs, taskIDs)))
+	return ctx
+}
+
+// end records how the wait ended on its span, with the same status --notify commands are given
+func (w *otelWaitTracer) end(result WaitResult, waitErr error) {
+	span := w.span
+	taskIDs := make([]string, 0, len(result.Tasks))
+	for _, t := range result.Tasks {
+		taskIDs = append(taskIDs, t.ID)
+	}
+	failedTaskIDs := make([]string, 0, len(result.FailedTasks))
+	for _, t := range result.FailedTasks {
+		failedTaskIDs = append(failedTaskIDs, t.ID)
+	}
+	// tasks selected by state are only known once the wait has found them
+	if len(taskIDs) != 0 {
+		span.SetAttributes(attribute.StringSlice(attributeTaskIDs, taskIDs))
+	}
+	span.SetAttributes(
+		attribute.String(attributeWaitStatus, notifyStatus(waitErr)),
+		attribute.Int(attributeWaitExitCode, exitCode(waitErr)),
+		attribute.StringSlice(attributeFailedTaskIDs, failedTaskIDs),
+	)
+	if waitErr != nil {
+		span.SetStatus(codes.Error, waitErr.Error())
+	}
+	span.End()
+}
+
+// addTracing records a child span of ctx for each API call made while waiting
+func (w *otelWaitTracer) addTracing(ctx context.Context, config *WaitConfig) {
+	tracer := w.tracer
+	if getServerTasks := config.GetServerTasksCallback; getServerTasks != nil {
+		config.GetServerTasksCallback = func(taskIDs []string) ([]*tasks.Task, error) {
+			_, span := tracer.Start(ctx, spanPollTasks, trace.WithAttributes(attribute.StringSlice(attributeTaskIDs, taskIDs)))
+			serverTasks, err := getServerTasks(taskIDs)
+			endSpan(span, err)
+			return serverTasks, err
+		}
+	}
+
+	if queryTasks := config.QueryTasksCallback; queryTasks != nil {
+		config.QueryTasksCallback = func(query tasks.TasksQuery) ([]*tasks.Task, error) {
+			_, span := tracer.Start(ctx, spanQueryTasks, trace.WithAttributes(attribute.StringSlice(attributeTaskStates, query.States)))
+			serverTasks, err := queryTasks(query)
+			span.SetAttributes(attribute.Int(attributeTaskCount, len(serverTasks)))
+			endSpan(span, err)
+			return serverTasks, err
+		}
+	}
+
+	if queryRecentTasks := config.QueryRecentTasksCallback; queryRecentTasks != nil {
+		config.QueryRecentTasksCallback = func(query RecentTasksQuery) ([]*tasks.Task, error) {
+			_, span := tracer.Start(ctx, spanQueryTasks, trace.WithAttributes(attribute.StringSlice(attributeTaskStates, query.States)))
+			serverTasks, err := queryRecentTasks(query)
+			span.SetAttributes(attribute.Int(attributeTaskCount, len(serverTasks)))
+			endSpan(span, err)
+			return serverTasks, err
+		}
+	}
+
+	if getTaskDetails := config.GetTaskDetailsCallback; getTaskDetails != nil {
+		config.GetTaskDetailsCallback = func(taskID string) (*tasks.TaskDetailsResource, error) {
+			_, span := tracer.Start(ctx, spanTaskDetails, trace.WithAttributes(attribute.String(attributeTaskID, taskID)))
+			details, err := getTaskDetails(taskID)
+			endSpan(span, err)
+			return details, err
+		}
+	}
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,70 @@
+//go:build otel
+
+package wait_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/OctopusDeploy/cli/pkg/cmd"
+	taskWaitCreate "github.com/OctopusDeploy/cli/pkg/cmd/task/wait"
+	"github.com/OctopusDeploy/cli/pkg/util"
+	"github.com/OctopusDeploy/cli/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestWait_Tracing(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing", "Failed")
+	recorder := tracetest.NewSpanRecorder()
+	opts := &taskWaitCreate.WaitOptions{
+		Dependencies:           &cmd.Dependencies{Out: &out},
+		TaskIDs:                []string{"ServerTasks-1"},
+		GetServerTasksCallback: server.GetServerTasks,
+		GetTaskDetailsCallback: server.GetTaskDetails,
+		Timeout:                taskWaitCreate.DefaultTimeout,
+		PollInterval:           1,
+		MaxPollInterval:        1,
+		ShowProgress:           true,
+		DetailWorkers:          1,
+		TracerProvider:         sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)),
+	}
+
+	err := runOnFakeClock(opts)
+	assert.ErrorIs(t, err, taskWaitCreate.ErrTaskFailed)
+
+	spans := recorder.Ended()
+	names := util.SliceTransform(spans, func(span sdktrace.ReadOnlySpan) string { return span.Name() })
+	// the task is fetched when the wait starts and by the poll which finds it has failed, then its details are
+	// fetched for its progress and again for the reason it failed
+	assert.Equal(t, []string{"poll tasks", "poll tasks", "fetch task details", "fetch task details", "octopus task wait"}, names)
+
+	waitSpan := spans[len(spans)-1]
+	for _, span := range spans[:len(spans)-1] {
+		assert.Equal(t, waitSpan.SpanContext().SpanID(), span.Parent().SpanID())
+		assert.Equal(t, codes.Unset, span.Status().Code)
+	}
+	assert.Contains(t, spans[2].Attributes(), attribute.String("octopus.task.id", "ServerTasks-1"))
+	assert.Equal(t, codes.Error, waitSpan.Status().Code)
+	assert.Subset(t, waitSpan.Attributes(), []attribute.KeyValue{
+		attribute.StringSlice("octopus.task.ids", []string{"ServerTasks-1"}),
+		attribute.String("octopus.wait.status", "failed"),
+		attribute.Int("octopus.wait.exit_code", taskWaitCreate.ExitCodeTaskFailed),
+		attribute.StringSlice("octopus.wait.failed_task_ids", []string{"ServerTasks-1"}),
+	})
+
+	// without a provider, nor an OTLP endpoint, nothing is traced
+	out.Reset()
+	recorder = tracetest.NewSpanRecorder()
+	opts.TracerProvider = nil
+	opts.GetServerTasksCallback = testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Success").GetServerTasks
+	err = runOnFakeClock(opts)
+	assert.NoError(t, err)
+	assert.Empty(t, recorder.Ended())
+}
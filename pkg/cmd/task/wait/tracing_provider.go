@@ -0,0 +1,9 @@
+//go:build !otel
+
+package wait
+
+// newWaitTracer returns nil, as tracing is only built in with the otel build tag. Without it, task wait doesn't pay
+// for exporting spans, or for creating them.
+func newWaitTracer(opts *WaitOptions, formatter *TaskOutputFormatter) (waitTracer, func()) {
+	return nil, nil
+}
@@ -0,0 +1,44 @@
+//go:build otel
+
+package wait
+
+import (
+	"context"
+	"os"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// serviceName is the service spans are reported as, unless OTEL_SERVICE_NAME says otherwise
+const serviceName = "octopus-cli"
+
+// newTracerProvider returns a provider exporting spans over OTLP, configured by the standard OTEL_EXPORTER_OTLP_*
+// environment variables, or nil when none of them name an endpoint to export to. The returned function flushes
+// any spans which haven't been exported yet.
+func newTracerProvider(ctx context.Context) (trace.TracerProvider, func(context.Context) error, error) {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return nil, nil, nil
+	}
+	if os.Getenv("OTEL_SDK_DISABLED") == "true" || os.Getenv("OTEL_TRACES_EXPORTER") == "none" {
+		return nil, nil, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the environment, such as OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES, takes precedence over our defaults
+	res, err := resource.Merge(
+		resource.NewSchemaless(semconv.ServiceName(serviceName)),
+		resource.Environment(),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	return provider, provider.Shutdown, nil
+}
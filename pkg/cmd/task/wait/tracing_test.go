@@ -0,0 +1,31 @@
+//go:build !otel
+
+package wait_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/OctopusDeploy/cli/pkg/cmd"
+	taskWaitCreate "github.com/OctopusDeploy/cli/pkg/cmd/task/wait"
+	"github.com/OctopusDeploy/cli/test/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWait_TracingNotBuiltIn(t *testing.T) {
+	out := bytes.Buffer{}
+	opts := &taskWaitCreate.WaitOptions{
+		Dependencies:           &cmd.Dependencies{Out: &out},
+		TaskIDs:                []string{"ServerTasks-1"},
+		GetServerTasksCallback: testutil.NewFakeTaskServer().AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Success").GetServerTasks,
+		Timeout:                taskWaitCreate.DefaultTimeout,
+		PollInterval:           1,
+		MaxPollInterval:        1,
+		// without the otel build tag, a provider is ignored rather than warned about
+		TracerProvider: struct{}{},
+	}
+
+	err := runOnFakeClock(opts)
+	assert.NoError(t, err)
+	assert.NotContains(t, out.String(), "Warning")
+}
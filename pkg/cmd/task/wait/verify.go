@@ -0,0 +1,119 @@
+package wait
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	DefaultVerifyTimeout  = 60
+	DefaultVerifyInterval = 5
+
+	// VerifyRequestTimeout is the longest a single --verify-url request can take, so that one request which hangs
+	// doesn't use up the whole of --verify-timeout
+	VerifyRequestTimeout = 10 * time.Second
+)
+
+// ErrVerifyFailed matches (via errors.Is) any *VerifyFailedError returned by WaitRun
+var ErrVerifyFailed = errors.New("verification failed")
+
+// VerifyResult is the outcome of --verify-url, which is reported separately from the tasks it follows
+type VerifyResult struct {
+	URL       string `json:"Url" yaml:"url"`
+	Succeeded bool   `json:"Succeeded" yaml:"succeeded"`
+	// StatusCode is the status of the last response, if there was one
+	StatusCode int    `json:"StatusCode,omitempty" yaml:"statusCode,omitempty"`
+	Attempts   int    `json:"Attempts" yaml:"attempts"`
+	Duration   string `json:"Duration" yaml:"duration"`
+	// Error is why the last request failed, if it didn't get a response
+	Error string `json:"Error,omitempty" yaml:"error,omitempty"`
+}
+
+// VerifyFailedError is returned when the tasks succeeded, but --verify-url didn't respond with a 2xx status before
+// --verify-timeout elapsed
+type VerifyFailedError struct {
+	Result *VerifyResult
+}
+
+func (e *VerifyFailedError) Error() string {
+	outcome := fmt.Sprintf("last responded %d %s", e.Result.StatusCode, http.StatusText(e.Result.StatusCode))
+	if e.Result.StatusCode == 0 {
+		outcome = "last failed: " + e.Result.Error
+	}
+	return fmt.Sprintf("the task(s) succeeded, but verifying %s failed after %d attempt(s) over %s; it %s", e.Result.URL, e.Result.Attempts, e.Result.Duration, outcome)
+}
+
+func (e *VerifyFailedError) Is(target error) bool { return target == ErrVerifyFailed }
+
+func (e *VerifyFailedError) ExitCode() int { return ExitCodeVerifyFailed }
+
+// parseVerifyURL checks that --verify-url is an absolute http or https URL
+func parseVerifyURL(value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("invalid --%s value %s: %w", FlagVerifyURL, value, err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid --%s value %s: must be an http or https URL", FlagVerifyURL, value)
+	}
+	return nil
+}
+
+// verify requests verifyURL until it responds with a 2xx status, trying again every interval until timeout elapses on
+// clock or ctx is cancelled
+func verify(ctx context.Context, clock Clock, client *http.Client, verifyURL string, timeout time.Duration, interval time.Duration) *VerifyResult {
+	started := clock.Now()
+	ctx, cancel := startWaitBudget(ctx, clock, timeout, true)
+	defer cancel(nil)
+
+	result := &VerifyResult{URL: verifyURL}
+	for {
+		statusCode, err := verifyRequest(ctx, client, verifyURL)
+		// an attempt cut short by the timeout says nothing about the URL, so the one before it is reported instead
+		if err != nil && ctx.Err() != nil && result.Attempts != 0 {
+			break
+		}
+		result.Attempts++
+		result.StatusCode, result.Error = statusCode, ""
+		if err != nil {
+			result.Error = err.Error()
+		}
+		result.Succeeded = err == nil && statusCode >= 200 && statusCode < 300
+		if result.Succeeded {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-clock.After(interval):
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	result.Duration = formatDuration(clock.Now().Sub(started))
+	return result
+}
+
+// verifyRequest makes a single request to verifyURL, returning the status it responded with
+func verifyRequest(ctx context.Context, client *http.Client, verifyURL string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, VerifyRequestTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, verifyURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	// reading the body lets the connection be reused by the next attempt
+	_, _ = io.Copy(io.Discard, response.Body)
+	return response.StatusCode, nil
+}
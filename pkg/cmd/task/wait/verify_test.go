@@ -0,0 +1,89 @@
+package wait
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first two requests are made while whatever was deployed is still starting up
+		if requests.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	result := verify(context.Background(), realClock{}, server.Client(), server.URL, time.Second, time.Millisecond)
+	assert.True(t, result.Succeeded)
+	assert.Equal(t, http.StatusNoContent, result.StatusCode)
+	assert.Equal(t, 3, result.Attempts)
+	assert.Empty(t, result.Error)
+}
+
+func TestVerify_Timeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	result := verify(context.Background(), realClock{}, server.Client(), server.URL, 50*time.Millisecond, 10*time.Millisecond)
+	assert.False(t, result.Succeeded)
+	assert.Equal(t, http.StatusInternalServerError, result.StatusCode)
+	assert.Greater(t, result.Attempts, 1)
+
+	err := &VerifyFailedError{Result: result}
+	assert.ErrorIs(t, err, ErrVerifyFailed)
+	assert.Equal(t, ExitCodeVerifyFailed, err.ExitCode())
+	assert.Contains(t, err.Error(), "it last responded 500 Internal Server Error")
+}
+
+func TestVerify_TimeoutCutsAnAttemptShort(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		// every later attempt hangs until the timeout cuts it short
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	result := verify(context.Background(), realClock{}, server.Client(), server.URL, 100*time.Millisecond, time.Millisecond)
+	assert.False(t, result.Succeeded)
+	// the attempt which was cut short isn't counted, and the one before it is reported
+	assert.Equal(t, 1, result.Attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, result.StatusCode)
+	assert.Empty(t, result.Error)
+	assert.Contains(t, (&VerifyFailedError{Result: result}).Error(), "after 1 attempt(s)")
+	assert.Contains(t, (&VerifyFailedError{Result: result}).Error(), "it last responded 503 Service Unavailable")
+}
+
+func TestVerify_Unreachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serverURL := server.URL
+	server.Close()
+
+	result := verify(context.Background(), realClock{}, http.DefaultClient, serverURL, 20*time.Millisecond, 10*time.Millisecond)
+	assert.False(t, result.Succeeded)
+	assert.Equal(t, 0, result.StatusCode)
+	assert.NotEmpty(t, result.Error)
+	assert.Contains(t, (&VerifyFailedError{Result: result}).Error(), "it last failed: ")
+}
+
+func TestParseVerifyURL(t *testing.T) {
+	assert.NoError(t, parseVerifyURL("https://myapp.example.com/health"))
+	assert.NoError(t, parseVerifyURL("http://localhost:8080"))
+	assert.EqualError(t, parseVerifyURL("myapp.example.com/health"), "invalid --verify-url value myapp.example.com/health: must be an http or https URL")
+	assert.EqualError(t, parseVerifyURL("ftp://myapp.example.com"), "invalid --verify-url value ftp://myapp.example.com: must be an http or https URL")
+}
@@ -1,205 +1,2152 @@
 package wait
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
 	"strings"
+	"sync"
+	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/MakeNowJust/heredoc/v2"
 	"github.com/OctopusDeploy/cli/pkg/cmd"
 	"github.com/OctopusDeploy/cli/pkg/constants"
+	cliErrors "github.com/OctopusDeploy/cli/pkg/errors"
 	"github.com/OctopusDeploy/cli/pkg/factory"
+	"github.com/OctopusDeploy/cli/pkg/question"
+	"github.com/OctopusDeploy/cli/pkg/question/selectors"
 	"github.com/OctopusDeploy/cli/pkg/util"
 	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/client"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/deployments"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/newclient"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/resources"
 	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 const (
-	FlagTimeout    = "timeout"
-	FlagProgress   = "progress"
-	DefaultTimeout = 600
+	FlagTimeout            = "timeout"
+	FlagProgress           = "progress"
+	FlagPollInterval       = "poll-interval"
+	FlagMaxPollInterval    = "max-poll-interval"
+	FlagHeartbeatInterval  = "heartbeat-interval"
+	FlagTimeoutWarning     = "timeout-warning"
+	FlagIDFile             = "id-file"
+	FlagDetailWorkers      = "detail-workers"
+	FlagQuiet              = "quiet"
+	FlagMaxRetries         = "max-retries"
+	FlagAll                = "all"
+	FlagIncludeNew         = "include-new"
+	FlagState              = "state"
+	FlagFollowChildren     = "follow-children"
+	FlagFailFast           = "fail-fast"
+	FlagSuccessStates      = "success-states"
+	FlagOutputFile         = "output-file"
+	FlagOutputFileFormat   = "output-file-format"
+	FlagOnTimeout          = "on-timeout"
+	FlagDeadline           = "deadline"
+	FlagNoColor            = "no-color"
+	FlagLogLevel           = "log-level"
+	FlagPerTaskTimeout     = "per-task-timeout"
+	FlagInputFormat        = "input-format"
+	FlagWatch              = "watch"
+	FlagWatchDuration      = "watch-duration"
+	FlagProject            = "project"
+	FlagProfile            = "profile"
+	FlagNoPrintInitial     = "no-print-initial"
+	FlagFailOnIntervention = "fail-on-intervention"
+	FlagMinSuccess         = "min-success"
+	FlagCancelRemaining    = "cancel-remaining"
+	FlagHighlight          = "highlight"
+	FlagOnlyMatching       = "only-matching"
+	FlagNotify             = "notify"
+	FlagOnSuccess          = "on-success"
+	FlagOnFailure          = "on-failure"
+	FlagHookStrict         = "hook-strict"
+	FlagRequireRunning     = "require-running"
+	FlagMinAge             = "min-age"
+	FlagMaxAge             = "max-age"
+	FlagMaxTasks           = "max-tasks"
+	FlagIgnoreMissing      = "ignore-missing"
+	FlagDeployment         = "deployment"
+	FlagPrintLinks         = "print-links"
+	FlagPrintQueueWait     = "print-queue-wait"
+	FlagShowContext        = "show-context"
+	FlagPrintOutputs       = "print-outputs"
+	FlagOutputsPrefix      = "outputs-prefix"
+	FlagFormatTemplate     = "format-template"
+	FlagExpandAll          = "expand-all"
+	FlagTail               = "tail"
+	FlagRetryOnFailure     = "retry-on-failure"
+	FlagRetryIf            = "retry-if"
+	FlagDashboard          = "dashboard"
+	FlagFailOnWarning      = "fail-on-warning"
+	FlagStrictHealth       = "strict-health"
+	FlagVerifyURL          = "verify-url"
+	FlagVerifyTimeout      = "verify-timeout"
+	FlagVerifyInterval     = "verify-interval"
+	FlagExitCodeOnly       = "exit-code-only"
+	FlagIDBatchSize        = "id-batch-size"
+	FlagSelectLatest       = "select-latest"
+	FlagServerTimeout      = "server-timeout"
+	FlagAPIRateLimit       = "api-rate-limit"
+	FlagShowStep           = "show-step"
+	FlagStateFile          = "state-file"
+	FlagResumeFromFile     = "resume-from-file"
+	FlagDryRun             = "dry-run"
+	FlagSchema             = "schema"
+	FlagSince              = "since"
+	FlagNamePattern        = "name-pattern"
+	DefaultTimeout         = 600
+	DefaultPollInterval    = 2
+	DefaultMaxPollInterval = 30
+	DefaultDetailWorkers   = 4
+	DefaultMaxTasks        = 100
+	MaxDetailWorkers       = 16
+	DefaultMaxRetries      = 3
+
+	// maxChildTaskDepth stops --follow-children from chasing an unbounded chain of tasks queuing other tasks
+	maxChildTaskDepth = 10
+
+	// OutputFormatYaml, OutputFormatJsonl and OutputFormatTsv are only supported by task wait, in addition to the global
+	// output formats. Rather than writing the results at the end, jsonl streams each event as it happens, ending with a
+	// summary. tsv writes a row of tab separated values for each task, under a header row, for spreadsheets and the
+	// likes of cut and awk.
+	OutputFormatYaml  = "yaml"
+	OutputFormatJsonl = "jsonl"
+	OutputFormatTsv   = "tsv"
+
+	// OnTimeoutFail leaves the tasks running when the wait times out; OnTimeoutCancel cancels them
+	OnTimeoutFail   = "fail"
+	OnTimeoutCancel = "cancel"
+
+	// InputFormatAuto reads task IDs piped into stdin as JSON if they look like JSON, and as text otherwise
+	InputFormatAuto = "auto"
+	InputFormatText = "text"
+
+	cancelTemplate       = "/api/{spaceId}/tasks/{id}/cancel"
+	rerunTemplate        = "/api/{spaceId}/tasks/rerun/{id}"
+	queuedBehindTemplate = "/api/{spaceId}/tasks/{id}/queued-behind"
 )
 
+// ErrWaitCancelled is returned by WaitForTasks when the wait is interrupted (e.g. by Ctrl-C) before the tasks finish
+var ErrWaitCancelled = errors.New("cancelled while waiting for pending tasks")
+
 type WaitOptions struct {
 	*cmd.Dependencies
+	Context                context.Context
 	TaskIDs                []string
 	GetServerTasksCallback ServerTasksCallback
 	GetTaskDetailsCallback TaskDetailsCallback
-	Timeout               int
-	ShowProgress         bool
+	QueryTasksCallback     TasksQueryCallback
+	CancelTaskCallback     CancelTaskCallback
+	ResolveProjectCallback ResolveProjectCallback
+	Timeout                int
+	Deadline               string
+	PerTaskTimeout         int
+	PollInterval           int
+	MaxPollInterval        int
+	HeartbeatInterval      int
+	TimeoutWarnings        []int
+	ShowProgress           bool
+	Highlight              []string
+	OnlyMatching           bool
+	DetailWorkers          int
+	IDBatchSize            int
+	ServerTimeout          int
+	APIRateLimit           float64
+	ShowStep               bool
+	StateFile              string
+	ResumeFromFile         string
+	Quiet                  bool
+	ExitCodeOnly           bool
+	MaxRetries             int
+	All                    bool
+	IncludeNew             bool
+	States                 []string
+	Watch                  bool
+	WatchDuration          int
+	Project                string
+	FollowChildren         bool
+	FailFast               bool
+	FailOnIntervention     bool
+	FailOnWarning          bool
+	StrictHealth           bool
+	MinSuccess             string
+	CancelRemaining        bool
+	SuccessStates          []string
+	OutputFile             string
+	OutputFileFormat       string
+	OnTimeout              string
+	NoColor                bool
+	LogLevel               string
+	Profile                bool
+	NoPrintInitial         bool
+	DryRun                 bool
+	Notify                 string
+	OnSuccess              string
+	OnFailure              string
+	HookStrict             bool
+	VerifyURL              string
+	VerifyTimeout          int
+	VerifyInterval         int
+	RequireRunning         bool
+	MinAge                 int
+	MaxAge                 int
+	MaxTasks               int
+	IgnoreMissing          bool
+	PrintLinks             bool
+	PrintQueueWait         bool
+	ShowContext            bool
+	PrintOutputs           bool
+	OutputsPrefixes        []string
+	FormatTemplate         string
+	ExpandAll              bool
+	Dashboard              bool
+	Tail                   int
+	RetryOnFailure         int
+	RetryIf                string
+	OutputFormat           string
+
+	// Deployments are waited for by the server tasks running them, along with any TaskIDs
+	Deployments                []string
+	ResolveDeploymentsCallback ResolveDeploymentsCallback
+	// QueuedBehindCallback finds the tasks a queued task is waiting behind, to say where it is in the queue
+	QueuedBehindCallback QueuedBehindCallback
+	// LatestTasksCallback finds the most recently queued tasks of a project, for --select-latest to pick from
+	LatestTasksCallback LatestTasksCallback
+	SelectLatest        bool
+	// Since and NamePattern find the tasks to wait for by when they started and what they're called, as given
+	Since       string
+	NamePattern string
+	// QueryRecentTasksCallback finds the tasks for --since, without going through the whole of the task history
+	QueryRecentTasksCallback RecentTasksCallback
+	// RerunTaskCallback reruns the tasks which fail with --retry-on-failure
+	RerunTaskCallback RerunTaskCallback
+	// ResolveTaskContextCallback looks up what each task is deploying or running, for --show-context
+	ResolveTaskContextCallback ResolveTaskContextCallback
+	// TaskOutputsCallback finds the output variables set by each task which succeeded, for --print-outputs
+	TaskOutputsCallback TaskOutputsCallback
+	// ServerVersionCallback finds the version of the server, to leave out the features it is too old for. When nil,
+	// the server is taken to have them all.
+	ServerVersionCallback ServerVersionCallback
+	// Clock tells the time and waits between polls, so that tests can drive the timing of a wait. When nil, the wait
+	// uses the real clock.
+	Clock Clock
+	// TracerProvider receives the spans of the wait, in builds with the otel tag. When nil, the wait is only traced
+	// if it was built with the tag and an OTLP endpoint is configured.
+	TracerProvider TracerProvider
+	// StatusRequests receives a signal each time the status of the wait is asked for, such as by sending the process
+	// SIGUSR1, printing the tasks it is still waiting for
+	StatusRequests <-chan os.Signal
+
+	// onPageRetry is told about pages of tasks which failed to load and are being fetched again
+	onPageRetry PageRetryCallback
 }
 
 type ServerTasksCallback func([]string) ([]*tasks.Task, error)
 type TaskDetailsCallback func(string) (*tasks.TaskDetailsResource, error)
+type TasksQueryCallback func(tasks.TasksQuery) ([]*tasks.Task, error)
+
+// RecentTasksQuery is a query for the tasks queued no earlier than Since, for --since
+type RecentTasksQuery struct {
+	tasks.TasksQuery
+	Since time.Time
+}
+
+// RecentTasksCallback fetches the tasks matching a query, only going as far back through the task history as its
+// Since, as QueryTasksSince does
+type RecentTasksCallback func(RecentTasksQuery) ([]*tasks.Task, error)
+type CancelTaskCallback func(string) (*tasks.Task, error)
+type RerunTaskCallback func(string) (*tasks.Task, error)
+type ResolveProjectCallback func(string) (string, error)
+type ResolveDeploymentsCallback func([]string) ([]*deployments.Deployment, error)
+type QueuedBehindCallback func(string) ([]*tasks.Task, error)
+
+// TaskStates are all the states a server task can be in
+var TaskStates = []string{"Queued", "Executing", "Cancelling", "Success", "Failed", "Canceled", "TimedOut"}
+
+// DefaultSuccessStates are the final states which count as success unless --success-states says otherwise
+var DefaultSuccessStates = []string{"Success"}
+
+// outputFileFormats are the formats --output-file can be written in
+var outputFileFormats = []string{constants.OutputFormatJson, OutputFormatYaml, OutputFormatJsonl, OutputFormatTsv}
+
+// runningTaskStates are the states of tasks which haven't finished yet, used when waiting for --all tasks
+var runningTaskStates = []string{"Queued", "Executing", "Cancelling"}
+
+// SpaceID is the ID of the space tasks are looked up in: the space given by --space once it has been resolved, or else
+// the space of the client
+func SpaceID(dependencies *cmd.Dependencies) string {
+	if dependencies.Space != nil {
+		return dependencies.Space.GetID()
+	}
+	if dependencies.Client != nil {
+		return dependencies.Client.GetSpaceID()
+	}
+	return ""
+}
 
 func NewWaitOps(dependencies *cmd.Dependencies, taskIDs []string) *WaitOptions {
-	return &WaitOptions{
-		Dependencies:           dependencies,
-		TaskIDs:               taskIDs,
-		GetServerTasksCallback: GetServerTasksCallback(dependencies.Client),
-		GetTaskDetailsCallback: GetTaskDetailsCallback(dependencies.Client),
-		Timeout:               DefaultTimeout,
-		ShowProgress:         false,
+	spaceID := SpaceID(dependencies)
+	opts := &WaitOptions{
+		Dependencies:               dependencies,
+		TaskIDs:                    taskIDs,
+		GetTaskDetailsCallback:     GetTaskDetailsCallback(dependencies.Client, spaceID),
+		CancelTaskCallback:         GetCancelTaskCallback(dependencies.Client, spaceID),
+		ResolveProjectCallback:     GetResolveProjectCallback(dependencies.Client),
+		ResolveDeploymentsCallback: GetResolveDeploymentsCallback(dependencies.Client),
+		QueuedBehindCallback:       GetQueuedBehindCallback(dependencies.Client, spaceID),
+		LatestTasksCallback:        GetLatestTasksCallback(dependencies.Client),
+		RerunTaskCallback:          GetRerunTaskCallback(dependencies.Client, spaceID),
+		ResolveTaskContextCallback: GetResolveTaskContextCallback(dependencies.Client, spaceID),
+		TaskOutputsCallback:        GetTaskOutputsCallback(dependencies.Client, spaceID),
+		ServerVersionCallback:      GetServerVersionCallback(dependencies.Client),
+		Timeout:                    DefaultTimeout,
+		PollInterval:               DefaultPollInterval,
+		MaxPollInterval:            DefaultMaxPollInterval,
+		ShowProgress:               false,
+		DetailWorkers:              DefaultDetailWorkers,
+		IDBatchSize:                DefaultIDBatchSize,
+		ServerTimeout:              DefaultServerTimeout,
+		APIRateLimit:               DefaultAPIRateLimit,
+		MaxRetries:                 DefaultMaxRetries,
+		MaxTasks:                   DefaultMaxTasks,
+		SuccessStates:              DefaultSuccessStates,
+		TimeoutWarnings:            DefaultTimeoutWarnings,
+		OnTimeout:                  OnTimeoutFail,
+		LogLevel:                   LogLevels[LogLevelInfo],
+		OutputFormat:               constants.OutputFormatTable,
+		VerifyTimeout:              DefaultVerifyTimeout,
+		VerifyInterval:             DefaultVerifyInterval,
+	}
+	// the callbacks are made before the flags are read, so they report page retries to whatever the wait sets up later
+	opts.GetServerTasksCallback = getServerTasksCallback(dependencies.Client, opts.pageRetried, opts.sleep)
+	opts.QueryTasksCallback = getTasksQueryCallback(dependencies.Client, opts.pageRetried, opts.sleep)
+	opts.QueryRecentTasksCallback = getRecentTasksCallback(dependencies.Client, opts.pageRetried, opts.sleep)
+	return opts
+}
+
+// clock is the Clock of the wait, or the real clock if it hasn't been given one
+func (o *WaitOptions) clock() Clock {
+	if o.Clock == nil {
+		return realClock{}
+	}
+	return o.Clock
+}
+
+// sleep waits for d to pass on the clock of the wait, such as before a page which failed to load is fetched again
+func (o *WaitOptions) sleep(d time.Duration) {
+	o.clock().Sleep(d)
+}
+
+// pageRetried passes a page retry on to onPageRetry, if the wait has set it
+func (o *WaitOptions) pageRetried(page int, attempt int, err error) {
+	if o.onPageRetry != nil {
+		o.onPageRetry(page, attempt, err)
 	}
 }
 
 func NewCmdWait(f factory.Factory) *cobra.Command {
 	var timeout int
+	var pollInterval int
+	var maxPollInterval int
+	var heartbeatInterval int
+	var timeoutWarnings []int
 	var showProgress bool
+	var highlight []string
+	var onlyMatching bool
+	var idFile string
+	var detailWorkers int
+	var idBatchSize int
+	var selectLatest bool
+	var since string
+	var namePattern string
+	var serverTimeout int
+	var apiRateLimit float64
+	var showStep bool
+	var stateFile string
+	var resumeFromFile string
+	var quiet bool
+	var exitCodeOnly bool
+	var maxRetries int
+	var all bool
+	var includeNew bool
+	var states []string
+	var watch bool
+	var watchDuration int
+	var project string
+	var followChildren bool
+	var failFast bool
+	var failOnIntervention bool
+	var failOnWarning bool
+	var strictHealth bool
+	var minSuccess string
+	var cancelRemaining bool
+	var successStates []string
+	var outputFile string
+	var outputFileFormat string
+	var onTimeout string
+	var deadline string
+	var noColor bool
+	var logLevel string
+	var perTaskTimeout int
+	var inputFormat string
+	var profile bool
+	var noPrintInitial bool
+	var dryRun bool
+	var printSchema bool
+	var notify string
+	var onSuccess string
+	var onFailure string
+	var hookStrict bool
+	var verifyURL string
+	var verifyTimeout int
+	var verifyInterval int
+	var requireRunning bool
+	var minAge int
+	var maxAge int
+	var maxTasks int
+	var ignoreMissing bool
+	var deploymentIDs []string
+	var printLinks bool
+	var printQueueWait bool
+	var showContext bool
+	var printOutputs bool
+	var outputsPrefixes []string
+	var formatTemplate string
+	var expandAll bool
+	var dashboard bool
+	var tail int
+	var retryOnFailure int
+	var retryIf string
 	cmd := &cobra.Command{
-		Use:     "wait [TaskIDs]",
-		Short:   "Wait for task(s) to finish",
-		Long:    "Wait for a provided list of task(s) to finish",
-		Example: heredoc.Docf("$ %s task wait", constants.ExecutableName),
+		Use:   "wait [TaskIDs]",
+		Short: "Wait for task(s) to finish",
+		Long: fmt.Sprintf("Wait for a provided list of task(s) to finish. Task IDs can also be piped in, either as text or as the JSON output of commands such as release deploy. When run interactively without any task IDs, prompts for the running tasks to wait for.\n\n"+
+			"Exits with %d when a task failed, %d when the wait timed out, %d when a task is waiting for an intervention with --%s and %d when --%s failed. "+
+			"Exit code 3 is left out, as the CLI already exits with it when it can't load its configuration, which a script would otherwise mistake for a timeout",
+			ExitCodeTaskFailed, ExitCodeWaitTimeout, ExitCodeTaskInterrupted, FlagFailOnIntervention, ExitCodeVerifyFailed, FlagVerifyURL),
+		// task IDs complete to the running tasks, then the most recent finished ones
+		ValidArgsFunction: newTaskIDCompletion(f),
+		Example: heredoc.Docf(`
+			$ %[1]s task wait ServerTasks-12345
+			$ %[1]s task wait ServerTasks-12345 ServerTasks-12346 --output-format json
+			$ %[1]s task wait 12345 12346
+			$ %[1]s task wait --id-file task-ids.txt
+			$ %[1]s task wait --id-file task-ids.txt --ignore-missing
+			$ %[1]s task wait --id-file task-ids.txt --id-batch-size 50
+			$ %[1]s task wait --id-file task-ids.txt --timeout 0 --state-file wait-state.json
+			$ %[1]s task wait --resume-from-file wait-state.json --timeout 0
+			$ %[1]s task wait --deployment Deployments-123,Deployments-124
+			$ %[1]s release deploy --project MyProject --version 1.0.0 --environment Production --output-format json | %[1]s task wait
+			$ %[1]s task wait --all --include-new
+			$ %[1]s task wait --state Queued --max-tasks 500
+			$ %[1]s task wait --state Executing,Queued
+			$ %[1]s task wait --state Queued --project MyProject --dry-run
+			$ %[1]s task wait --schema > task-wait-output.schema.json
+			$ %[1]s task wait --project MyProject --select-latest
+			$ %[1]s task wait --name-pattern 'Deploy *' --since 10m
+			$ %[1]s task wait --watch --project MyProject --watch-duration 3600
+			$ %[1]s task wait ServerTasks-12345 --follow-children
+			$ %[1]s task wait ServerTasks-12345 ServerTasks-12346 --require-running --max-age 3600
+			$ %[1]s task wait ServerTasks-12345 --progress --highlight "Deploying package" --highlight "(?i)warn"
+			$ %[1]s task wait ServerTasks-12345 --progress --highlight "^Step 3" --only-matching
+			$ %[1]s task wait ServerTasks-12345 --progress --expand-all
+			$ %[1]s task wait ServerTasks-12345 --progress --tail 20
+			$ %[1]s task wait ServerTasks-12345 ServerTasks-12346 --show-step
+			$ %[1]s task wait ServerTasks-12345 ServerTasks-12346 ServerTasks-12347 --progress --dashboard
+			$ %[1]s task wait ServerTasks-12345 ServerTasks-12346 --fail-fast --print-links
+			$ %[1]s task wait --all --print-queue-wait
+			$ %[1]s task wait --all --show-context
+			$ %[1]s task wait ServerTasks-12345 --print-outputs --outputs-prefix Url --output-format json
+			$ %[1]s task wait ServerTasks-12345 --fail-on-intervention
+			$ %[1]s task wait ServerTasks-12345 ServerTasks-12346 --fail-on-warning
+			$ %[1]s task wait ServerTasks-12345 --strict-health
+			$ %[1]s task wait ServerTasks-12345 --verify-url https://myapp.example.com/health --verify-timeout 120
+			$ %[1]s task wait ServerTasks-12345 --retry-on-failure 2 --retry-if "(?i)connection reset|timed out"
+			$ %[1]s task wait ServerTasks-1 ServerTasks-2 ServerTasks-3 ServerTasks-4 ServerTasks-5 --min-success 3 --cancel-remaining
+			$ %[1]s task wait --state Executing,Queued --min-success 60%%
+			$ %[1]s task wait ServerTasks-12345 --success-states Success,Canceled
+			$ %[1]s task wait ServerTasks-12345 --output-file task-results.json
+			$ %[1]s task wait ServerTasks-12345 --progress --output-file task-results.yaml --output-file-format yaml
+			$ %[1]s task wait ServerTasks-12345 --output-format jsonl
+			$ %[1]s task wait --all --output-format tsv | cut -f 1,3
+			$ %[1]s task wait ServerTasks-12345 ServerTasks-12346 --quiet --format-template '{{.ID}} {{.State}} {{.Duration}}'
+			$ %[1]s task wait ServerTasks-12345 --timeout 1800 --on-timeout cancel
+			$ %[1]s task wait ServerTasks-12345 --timeout 0
+			$ %[1]s task wait ServerTasks-12345 --timeout 3600 --server-timeout 20
+			$ %[1]s task wait --all --progress --follow-children --api-rate-limit 5
+			$ %[1]s task wait ServerTasks-12345 --exit-code-only --output-file task-results.json
+			$ OCTOPUS_TASK_WAIT_TIMEOUT=1800 %[1]s task wait ServerTasks-12345
+			$ %[1]s task wait ServerTasks-12345 --timeout 0 --heartbeat-interval 300
+			$ %[1]s task wait ServerTasks-12345 --timeout 3600 --timeout-warning 50,80,95
+			$ %[1]s task wait ServerTasks-12345 --timeout 0 --notify 'notify-send "Octopus task wait" "$OCTOPUS_WAIT_STATUS after $OCTOPUS_WAIT_DURATION"'
+			$ %[1]s task wait ServerTasks-12345 --on-success ./promote.sh --on-failure './rollback.sh "$OCTOPUS_WAIT_FAILED_TASK_IDS"' --hook-strict
+			$ %[1]s task wait ServerTasks-12345 --deadline 2024-01-31T18:00:00Z
+			$ %[1]s task wait ServerTasks-12345 ServerTasks-12346 --per-task-timeout 300 --on-timeout cancel
+			$ %[1]s task wait ServerTasks-12345 --log-level debug
+			$ %[1]s task wait --all --profile
+			$ %[1]s task wait --all --no-print-initial
+			$ %[1]s task wait ServerTasks-12345 --space "Other Space"
+		`, constants.ExecutableName),
 		RunE: func(c *cobra.Command, args []string) error {
+			// the schema doesn't depend on anything else, so it doesn't need a server, or any tasks to wait for
+			if printSchema {
+				_, err := c.OutOrStdout().Write(OutputSchema)
+				return err
+			}
+			if err := applyConfigDefaults(c.Flags(), viper.GetViper()); err != nil {
+				return err
+			}
+
 			taskIDs := make([]string, len(args))
 			copy(taskIDs, args)
 
-			taskIDs = append(taskIDs, util.ReadValuesFromPipe()...)
+			if idFile != "" {
+				fileTaskIDs, err := readTaskIDsFromFile(idFile)
+				if err != nil {
+					return err
+				}
+				taskIDs = append(taskIDs, fileTaskIDs...)
+			}
+
+			// stdin can only be read once; if the ID file is stdin it has already been consumed
+			if idFile != "-" {
+				pipedTaskIDs, err := readTaskIDsFromPipe(inputFormat)
+				if err != nil {
+					return err
+				}
+				taskIDs = append(taskIDs, pipedTaskIDs...)
+			}
+			taskIDs = util.SliceDistinct(taskIDs)
+
+			ctx := c.Context()
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			statusRequests, stopStatusRequests := notifyStatusRequests()
+			defer stopStatusRequests()
 
 			dependencies := cmd.NewDependencies(f, c)
+			// scripts should fail fast when they don't give any task IDs, rather than wait for an answer,
+			// whether they asked for it with --no-prompt or just aren't attached to a terminal
+			if !f.IsPromptEnabled() || !isTerminal(os.Stdin) || !isTerminal(dependencies.Out) {
+				dependencies.NoPrompt = true
+			}
 			opts := NewWaitOps(dependencies, taskIDs)
+			opts.Context = ctx
+			opts.StatusRequests = statusRequests
 			opts.Timeout = timeout
+			opts.PollInterval = pollInterval
+			opts.MaxPollInterval = maxPollInterval
+			opts.HeartbeatInterval = heartbeatInterval
+			opts.TimeoutWarnings = timeoutWarnings
 			opts.ShowProgress = showProgress
+			opts.Highlight = highlight
+			opts.OnlyMatching = onlyMatching
+			opts.DetailWorkers = detailWorkers
+			opts.IDBatchSize = idBatchSize
+			opts.SelectLatest = selectLatest
+			opts.Since = since
+			opts.NamePattern = namePattern
+			opts.ServerTimeout = serverTimeout
+			opts.APIRateLimit = apiRateLimit
+			opts.ShowStep = showStep
+			opts.StateFile = stateFile
+			opts.ResumeFromFile = resumeFromFile
+			opts.Quiet = quiet
+			opts.ExitCodeOnly = exitCodeOnly
+			opts.MaxRetries = maxRetries
+			opts.All = all
+			opts.IncludeNew = includeNew
+			opts.States = states
+			opts.Watch = watch
+			opts.WatchDuration = watchDuration
+			opts.Project = project
+			opts.FollowChildren = followChildren
+			opts.FailFast = failFast
+			opts.FailOnIntervention = failOnIntervention
+			opts.FailOnWarning = failOnWarning
+			opts.StrictHealth = strictHealth
+			opts.MinSuccess = minSuccess
+			opts.CancelRemaining = cancelRemaining
+			opts.SuccessStates = successStates
+			opts.OutputFile = outputFile
+			opts.OutputFileFormat = outputFileFormat
+			opts.OnTimeout = onTimeout
+			opts.Deadline = deadline
+			opts.NoColor = noColor
+			opts.LogLevel = logLevel
+			opts.PerTaskTimeout = perTaskTimeout
+			opts.Profile = profile
+			opts.NoPrintInitial = noPrintInitial
+			opts.DryRun = dryRun
+			opts.Notify = notify
+			opts.OnSuccess = onSuccess
+			opts.OnFailure = onFailure
+			opts.HookStrict = hookStrict
+			opts.VerifyURL = verifyURL
+			opts.VerifyTimeout = verifyTimeout
+			opts.VerifyInterval = verifyInterval
+			opts.RequireRunning = requireRunning
+			opts.MinAge = minAge
+			opts.MaxAge = maxAge
+			opts.MaxTasks = maxTasks
+			opts.IgnoreMissing = ignoreMissing
+			opts.Deployments = deploymentIDs
+			opts.PrintLinks = printLinks
+			opts.PrintQueueWait = printQueueWait
+			opts.ShowContext = showContext
+			opts.PrintOutputs = printOutputs
+			opts.OutputsPrefixes = outputsPrefixes
+			opts.FormatTemplate = formatTemplate
+			opts.ExpandAll = expandAll
+			opts.Dashboard = dashboard
+			opts.Tail = tail
+			opts.RetryOnFailure = retryOnFailure
+			opts.RetryIf = retryIf
+			opts.Timeout = commandTimeout(c.Flags(), opts.Timeout, deadline, watch)
+			opts.PollInterval, opts.MaxPollInterval = commandPollIntervals(c.Flags(), opts.PollInterval, opts.MaxPollInterval)
+			if outputFormat, err := c.Flags().GetString(constants.FlagOutputFormat); err == nil {
+				opts.OutputFormat = outputFormat
+			}
 
-			return WaitRun(opts)
+			// the exit code still tells a failed task from a timeout, which is all --exit-code-only wants to know
+			err := WaitRun(opts)
+			if err != nil && exitCodeOnly {
+				return cliErrors.NewSilentError(err)
+			}
+			return err
 		},
 	}
 
 	flags := cmd.Flags()
-	flags.IntVar(&timeout, FlagTimeout, DefaultTimeout, "Duration to wait (in seconds) before stopping execution")
-	flags.BoolVar(&showProgress, FlagProgress, false, "Show detailed progress of the tasks")
+	flags.IntVar(&timeout, FlagTimeout, DefaultTimeout, fmt.Sprintf("Duration to wait (in seconds) before stopping execution, or 0 to wait until the tasks finish. Defaults to $%s, or else the %s setting, if either is set", constants.EnvTaskWaitTimeout, constants.ConfigWaitTimeout))
+	flags.IntVar(&pollInterval, FlagPollInterval, DefaultPollInterval, fmt.Sprintf("Initial duration to wait (in seconds) between checks of the task(s) status. Defaults to $%s, or else the %s setting, if either is set", constants.EnvTaskWaitPollInterval, constants.ConfigWaitPollInterval))
+	flags.IntVar(&maxPollInterval, FlagMaxPollInterval, DefaultMaxPollInterval, "Maximum duration to wait (in seconds) between checks of the task(s) status as polling backs off. Defaults to the poll interval when that is longer")
+	flags.IntSliceVar(&timeoutWarnings, FlagTimeoutWarning, DefaultTimeoutWarnings, "Print a warning once the wait has used up each of these percentages of its --timeout (or of the time until its --deadline), saying how many task(s) are still pending, or 0 to never do so. Not printed with --quiet, with structured output or with --watch")
+	flags.IntVar(&heartbeatInterval, FlagHeartbeatInterval, 0, "Print a line saying the wait is still going after this many seconds without any other output, however long apart the checks of the task(s) status are, or 0 to never do so. Keeps CI systems which stop jobs without output for too long from stopping a healthy wait. Not printed on a terminal, with --quiet or with structured output")
+	flags.BoolVar(&showProgress, FlagProgress, false, "Show detailed progress of the tasks, with a progress bar on a terminal for tasks which report how far through they are")
+	flags.BoolVar(&showStep, FlagShowStep, false, fmt.Sprintf("Show the step each task is running alongside its state, such as 'Executing: Deploy to Production (step 3/7)', printed again as each step starts. A lighter alternative to --%s, which prints the logs of each step too", FlagProgress))
+	flags.BoolVar(&expandAll, FlagExpandAll, false, fmt.Sprintf("With --%s, print the logs of every finished step. By default steps which succeeded or were skipped are collapsed to a single line, and only the others are printed in full", FlagProgress))
+	flags.BoolVar(&dashboard, FlagDashboard, false, fmt.Sprintf("With --%s, show each task on a line of its own with its state, current step and elapsed time, redrawn in place as the tasks progress, "+
+		"rather than printing their activity logs. Falls back to the usual output when not writing to a terminal", FlagProgress))
+	flags.Var(newRegexpArrayValue(&highlight), FlagHighlight, fmt.Sprintf("With --%s, make the activity log lines matching this regular expression stand out. Can be given more than once", FlagProgress))
+	flags.BoolVar(&onlyMatching, FlagOnlyMatching, false, fmt.Sprintf("With --%s, only print the activity log lines matching one of the expressions", FlagHighlight))
+	flags.IntVar(&tail, FlagTail, 0, fmt.Sprintf("With --%s, print only the most recent N log lines of the steps which finish between two checks, including steps which succeeded. "+
+		"All of a step which failed is still printed, as is every line matching --%s; with --%s, the most recent N of the other matching lines are printed", FlagProgress, FlagHighlight, FlagOnlyMatching))
+	flags.IntVar(&detailWorkers, FlagDetailWorkers, DefaultDetailWorkers, fmt.Sprintf("Maximum number of task details to fetch concurrently when showing progress, between 1 and %d", MaxDetailWorkers))
+	flags.IntVar(&serverTimeout, FlagServerTimeout, DefaultServerTimeout, "Seconds a single request for the status or details of the task(s) can take before the check is given up on and retried, so that a connection which hangs doesn't stall the wait, or 0 for no limit. Unlike --timeout, this bounds each request rather than the whole wait")
+	flags.Float64Var(&apiRateLimit, FlagAPIRateLimit, DefaultAPIRateLimit, "Most requests a second to make to the server while waiting, shared by the checks of the task(s) status, their details and anything else the wait asks for, or 0 for no limit. Up to a second's worth can be made at once. Lower it to go easy on a busy shared server when waiting for many tasks with --progress or --follow-children, or raise it if the wait can't keep up with them")
+	flags.IntVar(&idBatchSize, FlagIDBatchSize, DefaultIDBatchSize, "Maximum number of task IDs to check the status of in a single request. More tasks than this are checked in batches, as the server or a proxy in front of it may turn away requests with too many IDs")
+	flags.BoolVar(&quiet, FlagQuiet, false, "Don't print task information while waiting; only the exit code (and any error) reports the outcome")
+	flags.BoolVar(&exitCodeOnly, FlagExitCodeOnly, false, fmt.Sprintf("Print nothing at all, not even why the wait failed, and report the outcome only through the exit code. --%s still writes the results in full", FlagOutputFile))
+	flags.IntVar(&maxRetries, FlagMaxRetries, DefaultMaxRetries, "Number of consecutive times to retry checking the task(s) status after a transient server or network error")
+	flags.BoolVar(&all, FlagAll, false, "Wait for all queued and executing tasks in the space instead of a list of task IDs")
+	flags.BoolVar(&includeNew, FlagIncludeNew, false, "With --all, also wait for tasks which are queued while waiting")
+	flags.StringSliceVar(&states, FlagState, nil, fmt.Sprintf("Wait for all tasks currently in the given state(s) instead of a list of task IDs. One or more of %s", strings.Join(TaskStates, ", ")))
+	flags.BoolVar(&watch, FlagWatch, false, "Keep waiting for newly queued tasks once the current ones have finished, reporting each as it starts and finishes, until interrupted or --watch-duration elapses")
+	flags.IntVar(&watchDuration, FlagWatchDuration, 0, "With --watch, duration to watch for (in seconds), or 0 to watch until interrupted")
+	flags.StringVarP(&project, FlagProject, "p", "", "With --all, --state or --watch, only wait for tasks for the project with the given name or ID. With --select-latest, the project to wait for the latest task of")
+	flags.BoolVar(&selectLatest, FlagSelectLatest, false, "Wait for the task of --project which started most recently, or was queued most recently if it hasn't started yet, such as after a trigger whose task ID wasn't kept")
+	flags.StringVar(&since, FlagSince, "", "Wait for the tasks which started (or were queued, if they haven't started yet) since the given duration ago (e.g. 10m) or date (e.g. 2024-01-31 or 2024-01-31T09:00:00Z), whatever state they're in. With --all or --state, only wait for the tasks they find which started since then")
+	flags.StringVar(&namePattern, FlagNamePattern, "", fmt.Sprintf("With --all, --state or --%s, only wait for tasks whose name matches the given pattern, ignoring case, where * matches any run of characters and ? any single one, such as 'Deploy *'", FlagSince))
+	flags.BoolVar(&followChildren, FlagFollowChildren, false, "Also wait for the child tasks queued by the task(s), such as deployments started by a \"Deploy a release\" step")
+	flags.BoolVar(&failFast, FlagFailFast, false, "Stop waiting as soon as any task fails, rather than waiting for all tasks to finish")
+	flags.IntVar(&retryOnFailure, FlagRetryOnFailure, 0, "Rerun a task which fails while waiting for it, up to this many times, and wait for the rerun in its place, or 0 to never do so. "+
+		"Only for failures known to be worth retrying, such as a flaky network; the summary says which attempt each task is")
+	flags.StringVar(&retryIf, FlagRetryIf, "", fmt.Sprintf("With --%s, only rerun tasks whose failure message matches this regular expression", FlagRetryOnFailure))
+	flags.BoolVar(&failOnIntervention, FlagFailOnIntervention, false, "Stop waiting as soon as any task is paused for a manual intervention or guided failure, rather than warning and waiting for it to be resolved")
+	flags.BoolVar(&failOnWarning, FlagFailOnWarning, false, "Fail the wait if any task succeeds but logs warnings, as though it had failed, rather than only reporting its warnings")
+	flags.BoolVar(&strictHealth, FlagStrictHealth, false, "Fail any deployment target health check which succeeds even though some of the targets it checked were unhealthy, naming those targets, rather than letting a partly healthy check pass")
+	flags.StringVar(&minSuccess, FlagMinSuccess, "", "Succeed as soon as this many of the tasks have succeeded, as a number of tasks such as 3 or a percentage such as 60%, without waiting for the rest. Tasks which fail after that are ignored")
+	flags.BoolVar(&cancelRemaining, FlagCancelRemaining, false, fmt.Sprintf("With --%s, cancel the tasks still running once enough tasks have succeeded", FlagMinSuccess))
+	flags.StringSliceVar(&successStates, FlagSuccessStates, DefaultSuccessStates, "Final task state(s) which count as success; tasks finishing in any other state fail the wait")
+	flags.StringVar(&outputFile, FlagOutputFile, "", fmt.Sprintf("Write the outcome of the task(s) to a file once the wait completes, as --%s whatever the console output format", FlagOutputFileFormat))
+	flags.StringVar(&outputFileFormat, FlagOutputFileFormat, "", fmt.Sprintf("Format of --%s, independent of the console output format. One of %s. Defaults to %s", FlagOutputFile, strings.Join(outputFileFormats, ", "), constants.OutputFormatJson))
+	flags.IntVar(&perTaskTimeout, FlagPerTaskTimeout, 0, "Duration to wait (in seconds) for each task before giving up on it while waiting for the others, or 0 for no limit")
+	flags.StringVar(&onTimeout, FlagOnTimeout, OnTimeoutFail, fmt.Sprintf("What to do with the tasks still running when --%s or --%s elapses: '%s' leaves them running, '%s' cancels them", FlagTimeout, FlagPerTaskTimeout, OnTimeoutFail, OnTimeoutCancel))
+	flags.StringVar(&deadline, FlagDeadline, "", fmt.Sprintf("Time to stop waiting at, as an RFC3339 timestamp such as 2024-01-31T18:00:00Z. Overrides the default --%s; if both are given, whichever comes first wins", FlagTimeout))
+	flags.BoolVar(&noColor, FlagNoColor, false, "Don't color the output, even on a terminal. Color is also disabled when output is piped or NO_COLOR is set")
+	flags.StringVar(&logLevel, FlagLogLevel, LogLevels[LogLevelInfo], fmt.Sprintf("How much to print while waiting. One of %s: error only prints failures, warn adds retries and other warnings, info adds task states and progress, and debug adds each poll and API call timing", strings.Join(LogLevels, ", ")))
+	flags.BoolVar(&profile, FlagProfile, false, "Once the wait finishes, print how long the API calls made while waiting took, to help tell a slow server from a slow client. Implied by --log-level debug")
+	flags.BoolVar(&noPrintInitial, FlagNoPrintInitial, false, "Don't print the state of each task when the wait starts, only as tasks change state and finish")
+	flags.BoolVar(&dryRun, FlagDryRun, false, "Print the tasks which would be waited for and their current states, without waiting for them")
+	flags.BoolVar(&printSchema, FlagSchema, false, fmt.Sprintf("Print the JSON Schema of the output of --%s json and jsonl and exit, without waiting for anything. Its $id ends with the version of the output, v%d, which goes up whenever a field is changed or removed", constants.FlagOutputFormat, OutputSchemaVersion))
+	flags.BoolVar(&requireRunning, FlagRequireRunning, false, "Fail straight away if any of the given tasks has already finished, rather than reporting how it finished, so that stale task IDs are caught")
+	flags.IntVar(&minAge, FlagMinAge, 0, "Only wait for tasks which started (or were queued, if they haven't started yet) at least this many seconds ago. Given task IDs which started more recently fail the wait; tasks found by --all or --state are left out")
+	flags.IntVar(&maxAge, FlagMaxAge, 0, "Only wait for tasks which started (or were queued, if they haven't started yet) at most this many seconds ago, or 0 for no limit. Given task IDs which started earlier fail the wait; tasks found by --all or --state are left out")
+	flags.IntVar(&maxTasks, FlagMaxTasks, DefaultMaxTasks, "Fail straight away if more than this many tasks are found to wait for, such as by a mistyped --all or --state, or 0 for no limit. Tasks queued while waiting don't count towards it")
+	flags.BoolVar(&ignoreMissing, FlagIgnoreMissing, false, "Warn about given task IDs which aren't found, such as tasks already removed by retention, and wait for the others rather than failing")
+	flags.StringVar(&notify, FlagNotify, "", fmt.Sprintf("Shell command to run once the wait finishes, whatever the outcome, such as to send a notification. "+
+		"It is given %s (one of %s), %s, %s, %s, %s, %s, %s and %s as environment variables, and is killed if it runs for longer than %s. "+
+		"It failing doesn't change the exit code",
+		NotifyEnvStatus, strings.Join([]string{NotifyStatusSuccess, NotifyStatusFailed, NotifyStatusTimeout, NotifyStatusInterrupted, NotifyStatusCancelled, NotifyStatusUnverified, NotifyStatusError}, ", "),
+		NotifyEnvExitCode, NotifyEnvTaskIDs, NotifyEnvFailedTaskIDs, NotifyEnvPendingTaskIDs, NotifyEnvDuration, NotifyEnvDurationSeconds, NotifyEnvError, NotifyTimeout))
+	flags.StringVar(&onSuccess, FlagOnSuccess, "", fmt.Sprintf("Shell command to run only if the wait succeeds, such as to promote a release. It is given the same environment variables as --%s, and is killed if it runs for longer than %s", FlagNotify, HookTimeout))
+	flags.StringVar(&onFailure, FlagOnFailure, "", fmt.Sprintf("Shell command to run only if the wait fails, such as to roll back a release, with the IDs of the tasks which failed in %s along with the other environment variables of --%s. It is killed if it runs for longer than %s, and isn't run if the wait is cancelled", NotifyEnvFailedTaskIDs, FlagNotify, HookTimeout))
+	flags.BoolVar(&hookStrict, FlagHookStrict, false, fmt.Sprintf("Fail a wait which succeeded if its --%s command fails, rather than only warning about it. A failing --%s command never changes the exit code, as the wait has already failed", FlagOnSuccess, FlagOnFailure))
+	flags.StringVar(&verifyURL, FlagVerifyURL, "", fmt.Sprintf("Once the task(s) succeed, request this URL, such as a health check, until it responds with a 2xx status, and fail the wait if it doesn't within --%s", FlagVerifyTimeout))
+	flags.IntVar(&verifyTimeout, FlagVerifyTimeout, DefaultVerifyTimeout, fmt.Sprintf("With --%s, duration (in seconds) to keep trying the URL for before failing", FlagVerifyURL))
+	flags.IntVar(&verifyInterval, FlagVerifyInterval, DefaultVerifyInterval, fmt.Sprintf("With --%s, duration (in seconds) to wait between tries of the URL", FlagVerifyURL))
+	flags.StringSliceVar(&deploymentIDs, FlagDeployment, nil, "Wait for the server tasks running the given deployment(s), such as Deployments-123, along with any task IDs given")
+	flags.BoolVar(&printLinks, FlagPrintLinks, false, "Include a link to each task in the Octopus web portal with its state and failure, and as a Link field in structured output")
+	flags.BoolVar(&printQueueWait, FlagPrintQueueWait, false, "Once the wait finishes, print how long each task spent queued before it started executing and how long it spent executing, also given as QueuedFor and ExecutingFor fields in structured output, to help tell whether tasks are held up waiting for others. "+
+		"Where the server doesn't say when a task was queued, the times are from the state changes seen while waiting, which start from when the wait began")
+	flags.BoolVar(&showContext, FlagShowContext, false, fmt.Sprintf("Include the project, environment and release or runbook of each task with its state and in the summary table, also given as Project, Environment, Release, Runbook and RunbookSnapshot fields in structured output. "+
+		"Looking them up takes extra requests, so names are cached and only the first %d task(s) are looked up. Tasks which don't deploy or run anything in a project, such as system tasks, are shown without them", MaxTaskContexts))
+	flags.BoolVar(&printOutputs, FlagPrintOutputs, false, "Once the wait finishes, print the output variables set by the steps of each task which succeeded, such as Octopus.Action[Deploy web app].Output.Url, also given as an Outputs field in structured output. Sensitive values are masked")
+	flags.StringSliceVar(&outputsPrefixes, FlagOutputsPrefix, nil, fmt.Sprintf("With --%s, only print the output variables whose full name, or own name after Output., starts with any of the given prefixes", FlagPrintOutputs))
+	flags.Var(newFormatTemplateValue(&formatTemplate), FlagFormatTemplate, "Go template to print each task with once the wait finishes, instead of the summary table, such as '{{.ID}} {{.State}}'. "+
+		"The fields are ID, Name, State, FinishedSuccessfully, Duration, Errors, Warnings and Link, and upper, lower, trim, replace and json can be used alongside the built in functions. "+
+		"Printed even with --quiet")
+	flags.StringVar(&stateFile, FlagStateFile, "", "Keep a JSON file up to date with the tasks still pending and the last state each was seen in, written before each check of their status and pruned as they finish, so that a wait which is stopped, such as by a CI agent being replaced, can be carried on with --resume-from-file")
+	flags.StringVar(&resumeFromFile, FlagResumeFromFile, "", fmt.Sprintf("Carry on a wait which was stopped, waiting for the tasks still pending in a file written by --%s. Tasks which the server no longer has, such as ones removed by retention, are left out with a warning. The file keeps being updated unless --%s names another", FlagStateFile, FlagStateFile))
+	flags.StringVar(&idFile, FlagIDFile, "", "Read newline separated task IDs from a file, or from stdin if '-'")
+	flags.StringVar(&inputFormat, FlagInputFormat, InputFormatAuto, fmt.Sprintf("Format of task IDs piped into stdin. '%s' separates IDs by new lines, spaces or commas; '%s' reads an array of IDs, or an object or array of objects with a %s field; '%s' detects JSON by a leading { or [", InputFormatText, constants.OutputFormatJson, strings.Join(taskIDFields, ", "), InputFormatAuto))
 
 	return cmd
 }
 
+// waitSettings are the flags of a wait once validateWaitOptions has parsed them
+type waitSettings struct {
+	logLevel        LogLevel
+	minSuccess      SuccessThreshold
+	since           time.Time
+	deadline        time.Time
+	namePattern     *regexp.Regexp
+	resultsTemplate *template.Template
+	highlights      []*regexp.Regexp
+	retryIf         *regexp.Regexp
+	// projectID is the ID of --project once it has been looked up
+	projectID string
+}
+
+// waitOutput is how the progress and results of a wait are written, as picked by newWaitOutput
+type waitOutput struct {
+	formatter *TaskOutputFormatter
+	// events streams what happens as JSON lines with --output-format jsonl
+	events *TaskEventWriter
+	// dashboard is redrawn in place of the usual lines with --dashboard on a terminal
+	dashboard *taskDashboard
+	// printProgress is set unless --quiet or structured output leave the progress out
+	printProgress bool
+	// showDetails prints the progress and activity logs of the tasks with --progress
+	showDetails bool
+	// showSteps prints the step each task is running with --show-step
+	showSteps bool
+	// streamEvents writes the states, progress and logs of the tasks as events, rather than just the summary
+	streamEvents bool
+}
+
 func WaitRun(opts *WaitOptions) error {
-	if len(opts.TaskIDs) == 0 {
-		return fmt.Errorf("no server task IDs provided, at least one is required")
+	clock := opts.clock()
+	if opts.ResumeFromFile != "" {
+		if resumed, err := resumeWait(opts); err != nil || !resumed {
+			return err
+		}
+	}
+	settings, err := validateWaitOptions(opts, clock)
+	if err != nil {
+		return err
+	}
+
+	if opts.Project != "" {
+		settings.projectID, err = opts.ResolveProjectCallback(opts.Project)
+		if err != nil {
+			return err
+		}
+	}
+	if opts.SelectLatest {
+		latest, err := selectLatestTask(opts.LatestTasksCallback, settings.projectID, opts.Project)
+		if err != nil {
+			return err
+		}
+		opts.TaskIDs = []string{latest.ID}
+	}
+
+	output := newWaitOutput(opts, settings, clock)
+	formatter, events, printProgress := output.formatter, output.events, output.printProgress
+	defer formatter.ClearStatusLine()
+	config := newWaitConfig(opts, settings, output, clock)
+	checkServerVersion(opts, output)
+	if profile := addAPICallWrappers(opts, &config, settings, output, clock); profile != nil {
+		defer formatter.PrintAPIProfile(profile)
+	}
+	// the contexts are set up once the lookups have been rate limited, as they hold on to the callback
+	addTaskContexts(opts, output)
+
+	if opts.DryRun {
+		return dryRunWait(opts, formatter, config, events)
+	}
+
+	ctx := opts.Context
+	tracer, shutdownTracing := newWaitTracer(opts, formatter)
+	if shutdownTracing != nil {
+		defer shutdownTracing()
+	}
+	if tracer != nil {
+		ctx = tracer.start(ctx, opts.TaskIDs)
+		tracer.addTracing(ctx, &config)
 	}
 
-	if opts.ShowProgress && len(opts.TaskIDs) > 1 {
-		return fmt.Errorf("--progress flag is only supported when waiting for a single task")
+	var waitStateFile *waitStateFile
+	if opts.StateFile != "" {
+		waitStateFile = newWaitStateFile(opts.StateFile, clock)
+		addStateFile(&config, waitStateFile, func(err error) {
+			if !printProgress {
+				return
+			}
+			formatter.PrintWarning(fmt.Sprintf("failed to update --%s %s: %v", FlagStateFile, opts.StateFile, err))
+		})
+	}
+
+	var transitions *transitionLog
+	if opts.PrintQueueWait {
+		transitions = newTransitionLog(clock)
+		addQueueWaitTracking(&config, transitions)
+	}
+
+	started := clock.Now()
+	result, err := WaitForTasks(ctx, opts.Client, opts.TaskIDs, config)
+	var queueWaits map[string]QueueWait
+	if transitions != nil {
+		queueWaits = transitions.queueWaits(result.Tasks)
+	}
+	var outputs map[string]map[string]string
+	if opts.PrintOutputs && opts.TaskOutputsCallback != nil {
+		outputs = fetchTaskOutputs(opts, formatter, result.SucceededTasks, printProgress)
+	}
+	// written once more now that the polls have stopped, pruning the tasks which finished on the last of them
+	if waitStateFile != nil {
+		if writeErr := waitStateFile.Write(); writeErr != nil && printProgress {
+			formatter.PrintWarning(fmt.Sprintf("failed to update --%s %s: %v", FlagStateFile, opts.StateFile, writeErr))
+		}
+	}
+	var timeoutErr *WaitTimeoutError
+	if errors.As(err, &timeoutErr) && opts.OnTimeout == OnTimeoutCancel {
+		cancelPendingTasks(opts, timeoutErr)
+	}
+	if err == nil {
+		if opts.CancelRemaining {
+			cancelRemainingTasks(opts, formatter, result, printProgress)
+		}
+
+		if len(result.Tasks) == 0 && (opts.All || len(opts.States) != 0 || opts.Watch || opts.Since != "") && printProgress {
+			states := opts.States
+			if opts.All || opts.Watch {
+				states = runningTaskStates
+			}
+			formatter.PrintInfo(fmt.Sprintf("No tasks %s to wait for", describeTaskFilter(states, opts.NamePattern, settings.since)))
+			err = writeOutputFile(opts, nil)
+		} else {
+			err = completeWait(opts, formatter, result, queueWaits, outputs)
+		}
+	}
+	// the tasks succeeding is only half of the gate, as whatever they deployed has to be verified too
+	var verification *VerifyResult
+	if err == nil && opts.VerifyURL != "" {
+		verification, err = verifyWait(opts, formatter, printProgress)
 	}
 
-	tasks, err := opts.GetServerTasksCallback(opts.TaskIDs)
+	// the summary ends the stream however the wait ended, so that readers always know the outcome
+	if events != nil {
+		if summaryErr := events.WriteSummary(newTaskResults(result, formatter.links, formatter.contexts, queueWaits, outputs), verification, err); summaryErr != nil && err == nil {
+			err = summaryErr
+		}
+	}
+	// the hooks come before --notify, so that it is told if --hook-strict failed the wait
+	if opts.OnSuccess != "" || opts.OnFailure != "" {
+		err = runOutcomeHook(opts, formatter, result, clock.Now().Sub(started), err)
+	}
+	if opts.Notify != "" {
+		notify(opts, formatter, result, clock.Now().Sub(started), err)
+	}
+	if tracer != nil {
+		tracer.end(result, err)
+	}
+	return err
+}
+
+// resumeWait carries on with the tasks still pending in --resume-from-file, returning false if none of them are, so
+// there is nothing to wait for
+func resumeWait(opts *WaitOptions) (bool, error) {
+	if len(opts.TaskIDs) != 0 || len(opts.Deployments) != 0 || opts.All || len(opts.States) != 0 || opts.Watch || opts.SelectLatest || opts.Since != "" {
+		return false, fmt.Errorf("--%s cannot be used with task IDs, --%s, --%s, --%s, --%s, --%s or --%s", FlagResumeFromFile, FlagDeployment, FlagAll, FlagState, FlagWatch, FlagSelectLatest, FlagSince)
+	}
+	state, err := ReadWaitState(opts.ResumeFromFile)
 	if err != nil {
-		return err
+		return false, err
+	}
+	if len(state.Tasks) == 0 {
+		if !opts.Quiet && !isStructuredOutputFormat(opts.OutputFormat) {
+			fmt.Fprintf(opts.Out, "No tasks were still pending in %s, so there is nothing to wait for\n", opts.ResumeFromFile)
+		}
+		return false, nil
+	}
+	opts.TaskIDs = state.TaskIDs()
+	// tasks can be removed while the wait is stopped, which shouldn't stop it carrying on with the others
+	opts.IgnoreMissing = true
+	if opts.StateFile == "" {
+		opts.StateFile = opts.ResumeFromFile
+	}
+	return true, nil
+}
+
+// validateWaitOptions checks that the flags of a wait make sense together, normalizing and parsing them as it goes.
+// Deployments are resolved to their tasks and any missing task IDs are prompted for, so that what's left to wait for
+// can be checked too.
+func validateWaitOptions(opts *WaitOptions, clock Clock) (*waitSettings, error) {
+	if len(opts.Deployments) != 0 {
+		if opts.All || len(opts.States) != 0 || opts.Watch {
+			return nil, fmt.Errorf("--%s cannot be used with --%s, --%s or --%s", FlagDeployment, FlagAll, FlagState, FlagWatch)
+		}
+		deploymentIDs, err := NormalizeDeploymentIDs(opts.Deployments)
+		if err != nil {
+			return nil, err
+		}
+		deploymentTaskIDs, err := resolveDeploymentTasks(deploymentIDs, opts.ResolveDeploymentsCallback)
+		if err != nil {
+			return nil, err
+		}
+		// a deployment's task may have been given as well, which NormalizeTaskIDs only keeps once
+		opts.TaskIDs = append(opts.TaskIDs, deploymentTaskIDs...)
 	}
 
-	if len(tasks) == 0 {
-		return fmt.Errorf("no server tasks found")
+	taskIDs, err := NormalizeTaskIDs(opts.TaskIDs)
+	if err != nil {
+		return nil, err
 	}
+	opts.TaskIDs = taskIDs
 
-	pendingTaskIDs := make([]string, 0)
-	failedTaskIDs := make([]string, 0)
-	formatter := NewTaskOutputFormatter(opts.Out)
+	if opts.All && len(opts.TaskIDs) != 0 {
+		return nil, fmt.Errorf("task IDs cannot be provided when using --%s", FlagAll)
+	}
 
-	for _, t := range tasks {
-		if t.IsCompleted == nil || !*t.IsCompleted {
-			pendingTaskIDs = append(pendingTaskIDs, t.ID)
+	if len(opts.States) != 0 {
+		if opts.All || len(opts.TaskIDs) != 0 {
+			return nil, fmt.Errorf("--%s cannot be used with task IDs or --%s", FlagState, FlagAll)
 		}
-		if (t.IsCompleted != nil && *t.IsCompleted) && (t.FinishedSuccessfully != nil && !*t.FinishedSuccessfully) {
-			failedTaskIDs = append(failedTaskIDs, t.ID)
+		states, err := NormalizeTaskStates(opts.States)
+		if err != nil {
+			return nil, err
 		}
+		opts.States = states
+	}
 
-		formatter.PrintTaskInfo(t)
+	if len(opts.SuccessStates) != 0 {
+		successStates, err := NormalizeTaskStates(opts.SuccessStates)
+		if err != nil {
+			return nil, err
+		}
+		if running := util.SliceFilter(successStates, func(s string) bool { return util.SliceContains(runningTaskStates, s) }); len(running) != 0 {
+			return nil, fmt.Errorf("--%s can only contain finished states, not %s", FlagSuccessStates, strings.Join(running, ", "))
+		}
+		opts.SuccessStates = successStates
+	}
+
+	if opts.IncludeNew && !opts.All {
+		return nil, fmt.Errorf("--%s can only be used with --%s", FlagIncludeNew, FlagAll)
 	}
 
-	if len(pendingTaskIDs) == 0 {
-		if len(failedTaskIDs) != 0 {
-			return fmt.Errorf("One or more deployment tasks failed: %s", strings.Join(failedTaskIDs, ", "))
+	if opts.Watch {
+		if opts.All || len(opts.States) != 0 || len(opts.TaskIDs) != 0 {
+			return nil, fmt.Errorf("--%s cannot be used with task IDs, --%s or --%s", FlagWatch, FlagAll, FlagState)
+		}
+		if opts.Timeout > 0 {
+			return nil, fmt.Errorf("--%s cannot be used with --%s; use --%s instead", FlagTimeout, FlagWatch, FlagWatchDuration)
+		}
+		if opts.WatchDuration < 0 {
+			return nil, fmt.Errorf("--%s must not be negative", FlagWatchDuration)
+		}
+	} else if opts.WatchDuration != 0 {
+		return nil, fmt.Errorf("--%s can only be used with --%s", FlagWatchDuration, FlagWatch)
+	}
+
+	settings := &waitSettings{logLevel: LogLevelInfo}
+	settings.minSuccess, err = ParseSuccessThreshold(opts.MinSuccess)
+	if err != nil {
+		return nil, err
+	}
+	if !settings.minSuccess.IsZero() {
+		if opts.Watch {
+			return nil, fmt.Errorf("--%s cannot be used with --%s", FlagMinSuccess, FlagWatch)
+		}
+		if opts.FailFast {
+			return nil, fmt.Errorf("--%s and --%s cannot be used together", FlagMinSuccess, FlagFailFast)
+		}
+		// child tasks are only found while waiting, so until then we can't tell whether there will be enough tasks
+		if len(opts.TaskIDs) != 0 && !opts.FollowChildren && settings.minSuccess.Count > len(opts.TaskIDs) {
+			return nil, fmt.Errorf("--%s (%d) must not be more than the number of tasks (%d)", FlagMinSuccess, settings.minSuccess.Count, len(opts.TaskIDs))
+		}
+	} else if opts.CancelRemaining {
+		return nil, fmt.Errorf("--%s can only be used with --%s", FlagCancelRemaining, FlagMinSuccess)
+	}
+
+	if opts.SelectLatest {
+		if len(opts.TaskIDs) != 0 || opts.All || len(opts.States) != 0 || opts.Watch {
+			return nil, fmt.Errorf("--%s cannot be used with task IDs, --%s, --%s or --%s", FlagSelectLatest, FlagAll, FlagState, FlagWatch)
+		}
+		if opts.Project == "" {
+			return nil, fmt.Errorf("--%s can only be used with --%s", FlagSelectLatest, FlagProject)
+		}
+	}
+
+	if opts.Since != "" {
+		if len(opts.TaskIDs) != 0 || opts.Watch || opts.SelectLatest {
+			return nil, fmt.Errorf("--%s cannot be used with task IDs, --%s or --%s", FlagSince, FlagWatch, FlagSelectLatest)
+		}
+		now := clock.Now()
+		if settings.since, err = ParseSince(opts.Since, now); err != nil {
+			return nil, err
+		}
+		if settings.since.After(now) {
+			return nil, fmt.Errorf("--%s must not be in the future", FlagSince)
+		}
+	}
+	if opts.NamePattern != "" {
+		if !opts.All && len(opts.States) == 0 && opts.Since == "" {
+			return nil, fmt.Errorf("--%s can only be used with --%s, --%s or --%s", FlagNamePattern, FlagAll, FlagState, FlagSince)
+		}
+		// tasks queued while waiting are taken as they come, without being matched against the pattern
+		if opts.IncludeNew {
+			return nil, fmt.Errorf("--%s cannot be used with --%s", FlagNamePattern, FlagIncludeNew)
+		}
+		settings.namePattern = compileNamePattern(opts.NamePattern)
+	}
+
+	if opts.Project != "" && !opts.All && len(opts.States) == 0 && !opts.Watch && !opts.SelectLatest && opts.Since == "" {
+		return nil, fmt.Errorf("--%s can only be used with --%s, --%s, --%s, --%s or --%s", FlagProject, FlagAll, FlagState, FlagWatch, FlagSelectLatest, FlagSince)
+	}
+
+	if opts.RequireRunning && (opts.All || len(opts.States) != 0 || opts.Watch) {
+		return nil, fmt.Errorf("--%s cannot be used with --%s, --%s or --%s", FlagRequireRunning, FlagAll, FlagState, FlagWatch)
+	}
+	if opts.MinAge < 0 {
+		return nil, fmt.Errorf("--%s must not be negative", FlagMinAge)
+	}
+	if opts.MaxAge < 0 {
+		return nil, fmt.Errorf("--%s must not be negative", FlagMaxAge)
+	}
+	if opts.MaxAge != 0 && opts.MinAge > opts.MaxAge {
+		return nil, fmt.Errorf("--%s (%ds) must be less than or equal to --%s (%ds)", FlagMinAge, opts.MinAge, FlagMaxAge, opts.MaxAge)
+	}
+	if opts.MaxTasks < 0 {
+		return nil, fmt.Errorf("--%s must not be negative", FlagMaxTasks)
+	}
+	if (opts.MinAge != 0 || opts.MaxAge != 0) && opts.Watch {
+		return nil, fmt.Errorf("--%s and --%s cannot be used with --%s", FlagMinAge, FlagMaxAge, FlagWatch)
+	}
+
+	if len(opts.TaskIDs) == 0 && !opts.All && len(opts.States) == 0 && !opts.Watch && !opts.SelectLatest && opts.Since == "" && !opts.NoPrompt {
+		if err := PromptMissing(opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(opts.TaskIDs) == 0 && !opts.All && len(opts.States) == 0 && !opts.Watch && !opts.SelectLatest && opts.Since == "" {
+		if opts.NoPrompt {
+			return nil, fmt.Errorf("no server task IDs provided, at least one is required when prompting is disabled with --%s or when not running interactively", constants.FlagNoPrompt)
+		}
+		return nil, fmt.Errorf("no server task IDs provided, at least one is required")
+	}
+
+	if opts.PollInterval <= 0 {
+		return nil, fmt.Errorf("--%s must be greater than zero", FlagPollInterval)
+	}
+
+	if opts.Deadline != "" {
+		settings.deadline, err = time.Parse(time.RFC3339, opts.Deadline)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --%s value %s; expected an RFC3339 timestamp such as 2024-01-31T18:00:00Z", FlagDeadline, opts.Deadline)
+		}
+		if !settings.deadline.After(clock.Now()) {
+			return nil, fmt.Errorf("--%s (%s) must be in the future", FlagDeadline, opts.Deadline)
+		}
+	}
+
+	// with only a deadline, or no timeout at all, there's no relative timeout for the poll interval to fit into
+	if opts.Timeout > 0 && opts.PollInterval > opts.Timeout {
+		return nil, fmt.Errorf("--%s (%ds) must be less than or equal to --%s (%ds)", FlagPollInterval, opts.PollInterval, FlagTimeout, opts.Timeout)
+	}
+
+	if opts.MaxPollInterval < opts.PollInterval {
+		return nil, fmt.Errorf("--%s (%ds) must be greater than or equal to --%s (%ds)", FlagMaxPollInterval, opts.MaxPollInterval, FlagPollInterval, opts.PollInterval)
+	}
+
+	if opts.PerTaskTimeout < 0 {
+		return nil, fmt.Errorf("--%s must not be negative", FlagPerTaskTimeout)
+	}
+
+	if opts.HeartbeatInterval < 0 {
+		return nil, fmt.Errorf("--%s must not be negative", FlagHeartbeatInterval)
+	}
+
+	for _, percent := range opts.TimeoutWarnings {
+		if percent < 0 || percent >= 100 {
+			return nil, fmt.Errorf("invalid --%s value %d; a percentage must be between 1 and 99, or 0 to never warn", FlagTimeoutWarning, percent)
+		}
+	}
+
+	if opts.MaxRetries < 0 {
+		return nil, fmt.Errorf("--%s must not be negative", FlagMaxRetries)
+	}
+
+	switch strings.ToLower(opts.OnTimeout) {
+	case "", OnTimeoutFail:
+		opts.OnTimeout = OnTimeoutFail
+	case OnTimeoutCancel:
+		opts.OnTimeout = OnTimeoutCancel
+	default:
+		return nil, fmt.Errorf("unsupported --%s value %s. Valid values are '%s', '%s'. Defaults to %s", FlagOnTimeout, opts.OnTimeout, OnTimeoutFail, OnTimeoutCancel, OnTimeoutFail)
+	}
+
+	if opts.LogLevel != "" {
+		settings.logLevel, err = ParseLogLevel(opts.LogLevel)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Profile && isStructuredOutputFormat(opts.OutputFormat) {
+		return nil, fmt.Errorf("--%s cannot be used with --%s %s", FlagProfile, constants.FlagOutputFormat, opts.OutputFormat)
+	}
+	if opts.OutputFileFormat != "" {
+		if opts.OutputFile == "" {
+			return nil, fmt.Errorf("--%s can only be used with --%s", FlagOutputFileFormat, FlagOutputFile)
+		}
+		if !util.SliceContains(outputFileFormats, strings.ToLower(opts.OutputFileFormat)) {
+			return nil, fmt.Errorf("unsupported --%s value %s. Valid values are %s. Defaults to %s", FlagOutputFileFormat, opts.OutputFileFormat, strings.Join(outputFileFormats, ", "), constants.OutputFormatJson)
+		}
+	}
+	if opts.FormatTemplate != "" && isStructuredOutputFormat(opts.OutputFormat) {
+		return nil, fmt.Errorf("--%s cannot be used with --%s %s", FlagFormatTemplate, constants.FlagOutputFormat, opts.OutputFormat)
+	}
+	if opts.FormatTemplate != "" {
+		if settings.resultsTemplate, err = parseFormatTemplate(opts.FormatTemplate); err != nil {
+			return nil, fmt.Errorf("invalid --%s value %s: %w", FlagFormatTemplate, opts.FormatTemplate, err)
 		}
-		return nil
 	}
 
-	gotError := make(chan error, 1)
-	done := make(chan bool, 1)
-	completedChildIds := make(map[string]bool)
+	settings.highlights, err = compileRegexps(FlagHighlight, opts.Highlight)
+	if err != nil {
+		return nil, err
+	}
+	if len(settings.highlights) != 0 && !opts.ShowProgress {
+		return nil, fmt.Errorf("--%s can only be used with --%s", FlagHighlight, FlagProgress)
+	}
+	if opts.ExpandAll && !opts.ShowProgress {
+		return nil, fmt.Errorf("--%s can only be used with --%s", FlagExpandAll, FlagProgress)
+	}
+	if opts.Dashboard && !opts.ShowProgress {
+		return nil, fmt.Errorf("--%s can only be used with --%s", FlagDashboard, FlagProgress)
+	}
+	if opts.Tail < 0 {
+		return nil, fmt.Errorf("--%s must not be negative", FlagTail)
+	}
+	if opts.Tail != 0 && !opts.ShowProgress {
+		return nil, fmt.Errorf("--%s can only be used with --%s", FlagTail, FlagProgress)
+	}
+	if opts.OnlyMatching && len(settings.highlights) == 0 {
+		return nil, fmt.Errorf("--%s can only be used with --%s", FlagOnlyMatching, FlagHighlight)
+	}
+
+	if opts.RetryOnFailure < 0 {
+		return nil, fmt.Errorf("--%s must not be negative", FlagRetryOnFailure)
+	}
+	if opts.RetryIf != "" && opts.RetryOnFailure == 0 {
+		return nil, fmt.Errorf("--%s can only be used with --%s", FlagRetryIf, FlagRetryOnFailure)
+	}
+	if opts.RetryIf != "" {
+		if settings.retryIf, err = regexp.Compile(opts.RetryIf); err != nil {
+			return nil, fmt.Errorf("invalid --%s value %s: %w", FlagRetryIf, opts.RetryIf, err)
+		}
+	}
+
+	// child tasks are only found by polling their parents, which a dry run doesn't do
+	if opts.DryRun && opts.FollowChildren {
+		return nil, fmt.Errorf("--%s cannot be used with --%s", FlagDryRun, FlagFollowChildren)
+	}
+	if opts.DryRun && opts.StateFile != "" {
+		return nil, fmt.Errorf("--%s cannot be used with --%s", FlagDryRun, FlagStateFile)
+	}
+
+	if opts.HookStrict && opts.OnSuccess == "" && opts.OnFailure == "" {
+		return nil, fmt.Errorf("--%s can only be used with --%s or --%s", FlagHookStrict, FlagOnSuccess, FlagOnFailure)
+	}
+	if len(opts.OutputsPrefixes) != 0 && !opts.PrintOutputs {
+		return nil, fmt.Errorf("--%s can only be used with --%s", FlagOutputsPrefix, FlagPrintOutputs)
+	}
+
+	if opts.VerifyURL != "" {
+		if err := parseVerifyURL(opts.VerifyURL); err != nil {
+			return nil, err
+		}
+		if opts.DryRun {
+			return nil, fmt.Errorf("--%s cannot be used with --%s", FlagDryRun, FlagVerifyURL)
+		}
+		if opts.VerifyTimeout <= 0 {
+			return nil, fmt.Errorf("--%s must be greater than zero", FlagVerifyTimeout)
+		}
+		if opts.VerifyInterval <= 0 {
+			return nil, fmt.Errorf("--%s must be greater than zero", FlagVerifyInterval)
+		}
+	}
+
+	if opts.ShowStep {
+		if opts.ShowProgress {
+			return nil, fmt.Errorf("--%s cannot be used with --%s", FlagShowStep, FlagProgress)
+		}
+		if opts.Quiet {
+			return nil, fmt.Errorf("--%s cannot be used with --%s", FlagShowStep, FlagQuiet)
+		}
+	}
+
+	// --exit-code-only goes further than --quiet, leaving out the errors too, so there's nothing for it to print alongside
+	if opts.ExitCodeOnly {
+		switch {
+		case opts.ShowProgress:
+			return nil, fmt.Errorf("--%s cannot be used with --%s", FlagExitCodeOnly, FlagProgress)
+		case opts.FormatTemplate != "":
+			return nil, fmt.Errorf("--%s cannot be used with --%s", FlagExitCodeOnly, FlagFormatTemplate)
+		case isStructuredOutputFormat(opts.OutputFormat):
+			return nil, fmt.Errorf("--%s cannot be used with --%s %s; use --%s to keep the results", FlagExitCodeOnly, constants.FlagOutputFormat, opts.OutputFormat, FlagOutputFile)
+		}
+		opts.Quiet = true
+	}
+	if opts.Quiet && opts.ShowProgress {
+		return nil, fmt.Errorf("--%s and --%s cannot be used together", FlagQuiet, FlagProgress)
+	}
+
+	if opts.IDBatchSize < 0 {
+		return nil, fmt.Errorf("--%s must not be negative", FlagIDBatchSize)
+	}
+	if opts.ServerTimeout < 0 {
+		return nil, fmt.Errorf("--%s must not be negative", FlagServerTimeout)
+	}
+	if opts.APIRateLimit < 0 {
+		return nil, fmt.Errorf("--%s must not be negative", FlagAPIRateLimit)
+	}
+
+	if (opts.ShowProgress || opts.ShowStep || opts.FollowChildren) && (opts.DetailWorkers < 1 || opts.DetailWorkers > MaxDetailWorkers) {
+		return nil, fmt.Errorf("--%s must be between 1 and %d", FlagDetailWorkers, MaxDetailWorkers)
+	}
+
+	return settings, nil
+}
+
+// newWaitOutput picks how the progress and results of a wait are written given its flags: printed by a formatter,
+// streamed as events or drawn on a dashboard, and in how much detail
+func newWaitOutput(opts *WaitOptions, settings *waitSettings, clock Clock) *waitOutput {
+	formatter := NewTaskOutputFormatter(opts.Out, settings.logLevel)
+	formatter.SetClock(clock)
+	if opts.NoColor {
+		formatter.DisableColor()
+	}
+	formatter.SetHighlights(settings.highlights, opts.OnlyMatching)
+	if opts.ExpandAll {
+		formatter.ExpandAllActivities()
+	}
+	if opts.Tail != 0 {
+		formatter.TailActivityLogs(opts.Tail)
+	}
+	if opts.PrintLinks {
+		formatter.SetTaskLinks(newTaskLinks(opts))
+	}
+	formatter.SetResultsTemplate(settings.resultsTemplate)
+	// structured output is written once all tasks have settled, so there's no progress chatter to mix into it
+	printProgress := !opts.Quiet && !isStructuredOutputFormat(opts.OutputFormat)
+	showDetails := opts.ShowProgress && printProgress
+	// with --show-step, the details are only fetched to find the step each task is running
+	showSteps := opts.ShowStep && printProgress
+	// with jsonl, task states, progress and activity logs are streamed as events rather than printed, unless --quiet
+	// leaves just the summary event
+	var events *TaskEventWriter
+	if strings.EqualFold(opts.OutputFormat, OutputFormatJsonl) {
+		events = NewTaskEventWriter(opts.Out)
+		events.SetClock(clock)
+	}
+	streamEvents := events != nil && !opts.Quiet
+	// the dashboard stands in for the state changes and activity logs of the tasks, but only on a terminal, where it
+	// can be redrawn in place; anywhere else the usual lines are printed
+	var dashboard *taskDashboard
+	if opts.Dashboard && showDetails && formatter.isTerminal {
+		dashboard = newTaskDashboard()
+	}
+	return &waitOutput{
+		formatter:     formatter,
+		events:        events,
+		dashboard:     dashboard,
+		printProgress: printProgress,
+		showDetails:   showDetails,
+		showSteps:     showSteps,
+		streamEvents:  streamEvents,
+	}
+}
+
+// drawDashboard redraws the dashboard in place with the latest state of the tasks
+func (o *waitOutput) drawDashboard(clock Clock) {
+	o.formatter.PrintDashboard(o.dashboard.Lines(o.formatter, clock.Now(), o.formatter.TerminalWidth()))
+}
+
+// newWaitConfig turns the flags of a wait into the config WaitForTasks runs it with, printing what happens to the
+// tasks as it goes through output
+func newWaitConfig(opts *WaitOptions, settings *waitSettings, output *waitOutput, clock Clock) WaitConfig {
+	formatter, events, dashboard := output.formatter, output.events, output.dashboard
+	printProgress, showDetails, showSteps, streamEvents := output.printProgress, output.showDetails, output.showSteps, output.streamEvents
+
+	// taskCount is how many tasks have been seen so far; with more than one, progress is prefixed by task ID
+	taskCount := 0
+	// keyed by task ID, then activity ID, so activities from different tasks don't collide
+	printedActivities := make(map[string]PrintedActivities)
+	// detailWarnings records the tasks we've already warned about failing to fetch the details of
+	detailWarnings := make(map[string]bool)
+	// printedStates is the last state printed for each task, so a task is only printed again when its state changes
+	printedStates := make(map[string]string)
+	// steps are the steps each task is running with --show-step, and printedSteps the steps last printed, so that a
+	// task is printed again as each step starts
+	steps := make(map[string]string)
+	printedSteps := make(map[string]string)
+	printTaskInfo := func(t *tasks.Task) {
+		if (!printProgress && !streamEvents) || dashboard != nil || (printedStates[t.ID] == t.State && printedSteps[t.ID] == steps[t.ID]) {
+			return
+		}
+		previousState := printedStates[t.ID]
+		printedStates[t.ID] = t.State
+		printedSteps[t.ID] = steps[t.ID]
+		if streamEvents {
+			events.WriteState(t, previousState)
+			return
+		}
+		if step := steps[t.ID]; step != "" {
+			formatter.PrintTaskStep(t, step)
+			return
+		}
+		if t.State == "Queued" && opts.QueuedBehindCallback != nil {
+			// where a task is in the queue is only a hint, so failing to find out doesn't get in the way of the wait
+			if queuedBehind, err := opts.QueuedBehindCallback(t.ID); err == nil {
+				formatter.PrintQueuedTaskInfo(t, queuedBehind)
+				return
+			}
+		}
+		formatter.PrintTaskInfo(t)
+	}
+	// polling is set once the tasks found when the wait started have been added, and polling for them begins
+	polling := false
 
-	go func() {
-		for len(pendingTaskIDs) != 0 {
-			time.Sleep(5 * time.Second)
-			tasks, err = opts.GetServerTasksCallback(pendingTaskIDs)
+	timeout := opts.Timeout
+	if opts.Watch {
+		timeout = opts.WatchDuration
+	}
+	config := WaitConfig{
+		Timeout:                time.Duration(timeout) * time.Second,
+		Deadline:               settings.deadline,
+		PerTaskTimeout:         time.Duration(opts.PerTaskTimeout) * time.Second,
+		PollInterval:           time.Duration(opts.PollInterval) * time.Second,
+		MaxPollInterval:        time.Duration(opts.MaxPollInterval) * time.Second,
+		MaxRetries:             opts.MaxRetries,
+		DetailWorkers:          opts.DetailWorkers,
+		IDBatchSize:            opts.IDBatchSize,
+		SuccessStates:          opts.SuccessStates,
+		FailFast:               opts.FailFast,
+		FailOnIntervention:     opts.FailOnIntervention,
+		StrictHealth:           opts.StrictHealth,
+		MinSuccess:             settings.minSuccess,
+		RequireRunning:         opts.RequireRunning,
+		MinAge:                 time.Duration(opts.MinAge) * time.Second,
+		MaxAge:                 time.Duration(opts.MaxAge) * time.Second,
+		MaxTasks:               opts.MaxTasks,
+		IgnoreMissing:          opts.IgnoreMissing,
+		RetryOnFailure:         opts.RetryOnFailure,
+		RetryIf:                settings.retryIf,
+		RerunTaskCallback:      opts.RerunTaskCallback,
+		FollowChildren:         opts.FollowChildren,
+		All:                    opts.All,
+		IncludeNew:             opts.IncludeNew,
+		States:                 opts.States,
+		Since:                  settings.since,
+		NamePattern:            settings.namePattern,
+		Watch:                  opts.Watch,
+		ProjectID:              settings.projectID,
+		FetchDetails:           showDetails || showSteps || streamEvents,
+		GetServerTasksCallback: opts.GetServerTasksCallback,
+		GetTaskDetailsCallback: opts.GetTaskDetailsCallback,
+		QueryTasksCallback:     opts.QueryTasksCallback,
+		Clock:                  clock,
+		OnPoll: func(pendingTaskIDs []string) {
+			polling = true
+		},
+		OnTaskAdded: func(t *tasks.Task) {
+			taskCount++
+			if dashboard != nil {
+				dashboard.Update(t, nil)
+				output.drawDashboard(clock)
+				return
+			}
+			if opts.NoPrintInitial && !polling {
+				// treated as already printed, so the task is printed again as soon as its state changes
+				printedStates[t.ID] = t.State
+				return
+			}
+			printTaskInfo(t)
+		},
+		OnTaskPolled: func(t *tasks.Task, details *tasks.TaskDetailsResource, detailsErr error) {
+			// the activities come first, so a task's final state is printed after everything it did
+			defer printTaskInfo(t)
+			// without details the task keeps the step it was last seen running, rather than flickering between them
+			if showSteps && details != nil {
+				steps[t.ID] = formatter.FormatActiveStep(details)
+			}
+			if streamEvents {
+				// the logs carry the progress the task had made by the time they were fetched
+				events.WriteProgress(t, details)
+				events.WriteLogs(t, details)
+			}
+			if !showDetails {
+				return
+			}
+			// without details we can't show progress, but we can still tell when the task finishes
+			if detailsErr != nil && !detailWarnings[t.ID] {
+				detailWarnings[t.ID] = true
+				formatter.PrintWarning(fmt.Sprintf("failed to fetch the details of %s, so its progress won't be shown: %v", t.ID, detailsErr))
+			}
+			if dashboard != nil {
+				dashboard.Update(t, details)
+				return
+			}
+			if details != nil {
+				if printedActivities[t.ID] == nil {
+					printedActivities[t.ID] = make(PrintedActivities)
+				}
+				prefix := ""
+				if taskCount > 1 {
+					prefix = t.ID
+				}
+				for _, activity := range details.ActivityLogs {
+					formatter.PrintActivityElement(prefix, activity, 0, printedActivities[t.ID])
+				}
+			}
+			// a finished task isn't polled again, so there's no need to remember what was printed for it
+			if t.IsCompleted != nil && *t.IsCompleted {
+				delete(printedActivities, t.ID)
+			}
+		},
+		OnTaskCompleted: printTaskInfo,
+		OnTaskRetried: func(failed *tasks.Task, rerun *tasks.Task, attempt int, err error) {
+			if !printProgress {
+				return
+			}
+			if err != nil {
+				formatter.PrintWarning(fmt.Sprintf("failed to rerun %s, so its failure stands: %v", failed.ID, err))
+				return
+			}
+			formatter.PrintInfo(fmt.Sprintf("%s failed, rerunning it as %s (attempt %d of %d)", failed.ID, rerun.ID, attempt, opts.RetryOnFailure+1))
+		},
+		OnTaskTimedOut: func(t *tasks.Task) {
+			if printProgress {
+				formatter.PrintWarning(fmt.Sprintf("%s is still %s after --%s of %ds, so it is no longer being waited for", t.ID, t.State, FlagPerTaskTimeout, opts.PerTaskTimeout))
+			}
+			if opts.OnTimeout != OnTimeoutCancel {
+				return
+			}
+			_, err := opts.CancelTaskCallback(t.ID)
+			if !printProgress {
+				return
+			}
 			if err != nil {
-				gotError <- err
+				formatter.PrintWarning(fmt.Sprintf("failed to cancel %s: %v", t.ID, err))
+				return
+			}
+			formatter.PrintInfo(fmt.Sprintf("Requested cancellation of %s", t.ID))
+		},
+		OnTaskInterrupted: func(t *tasks.Task) {
+			// with --fail-on-intervention the error says the same thing
+			if printProgress && !opts.FailOnIntervention {
+				formatter.PrintWarning(fmt.Sprintf("%s is waiting for a manual intervention or guided failure to be resolved in Octopus, and won't finish until someone does so", t.ID))
+			}
+		},
+		OnPending: func(pendingTaskIDs []string, polledTasks []*tasks.Task, polledDetails []*tasks.TaskDetailsResource) {
+			if dashboard != nil {
+				output.drawDashboard(clock)
+			} else if showDetails {
+				formatter.PrintStatusLine(formatPendingProgress(formatter, polledTasks, polledDetails, taskCount > 1))
+			} else if printProgress {
+				// without --progress there's nothing else to show between state changes
+				formatter.PrintSpinner(len(pendingTaskIDs))
+			}
+		},
+		OnRetry: func(attempt int, err error) {
+			if !printProgress {
+				return
+			}
+			if delay := retryAfter(err); delay > 0 {
+				formatter.PrintWarning(fmt.Sprintf("failed to check task status, retrying in %s as asked by the server (attempt %d of %d): %v", delay.Round(time.Second), attempt, opts.MaxRetries, err))
 				return
 			}
-			for _, t := range tasks {
-				if opts.ShowProgress {
-					details, err := opts.GetTaskDetailsCallback(t.ID)
-					if err != nil {
-						continue // Skip progress display if we can't get details
-					}
-
-					if len(details.ActivityLogs) > 0 {
-						// Process all activities
-						for _, activity := range details.ActivityLogs {
-							formatter.PrintActivityElement(activity, 0, completedChildIds)
-						}
-					}
+			formatter.PrintWarning(fmt.Sprintf("failed to check task status, retrying (attempt %d of %d): %v", attempt, opts.MaxRetries, err))
+		},
+	}
+	if opts.Space != nil {
+		config.SpaceName = opts.Space.Name
+	}
+	if opts.Since != "" {
+		config.QueryRecentTasksCallback = opts.QueryRecentTasksCallback
+	}
+	if printProgress {
+		config.OnTasksMissing = func(taskIDs []string) {
+			formatter.PrintWarning(fmt.Sprintf("%v, so they won't be waited for", newTasksNotFoundError(config, taskIDs)))
+		}
+		// tasks found by when they started or what they're called are listed up front, as they weren't named
+		if opts.Since != "" || opts.NamePattern != "" {
+			config.OnTasksFound = func(serverTasks []*tasks.Task) {
+				if len(serverTasks) == 0 {
+					return
 				}
-
-				if t.IsCompleted != nil && *t.IsCompleted {
-					if t.FinishedSuccessfully != nil && !*t.FinishedSuccessfully {
-						failedTaskIDs = append(failedTaskIDs, t.ID)
-					}
-					formatter.PrintTaskInfo(t)
-					pendingTaskIDs = removeTaskID(pendingTaskIDs, t.ID)
+				states := opts.States
+				if opts.All {
+					states = runningTaskStates
 				}
+				taskIDs := util.SliceTransform(serverTasks, func(t *tasks.Task) string { return t.ID })
+				formatter.PrintInfo(fmt.Sprintf("Found %d task(s) %s: %s", len(serverTasks), describeTaskFilter(states, opts.NamePattern, settings.since), strings.Join(taskIDs, ", ")))
 			}
 		}
-		if len(failedTaskIDs) != 0 {
-			gotError <- fmt.Errorf("One or more deployment tasks failed: %s", strings.Join(failedTaskIDs, ", "))
-			return
+	}
+	if printProgress && opts.HeartbeatInterval > 0 {
+		heartbeatInterval := time.Duration(opts.HeartbeatInterval) * time.Second
+		config.HeartbeatInterval = heartbeatInterval
+		config.OnHeartbeat = func(pendingTaskIDs []string) {
+			formatter.PrintHeartbeat(len(pendingTaskIDs), heartbeatInterval)
+		}
+	}
+	// the end of a watch is expected rather than a failure, so there's nothing to warn about
+	if printProgress && !opts.Watch && len(opts.TimeoutWarnings) > 0 {
+		config.TimeoutWarnings = opts.TimeoutWarnings
+		config.OnTimeoutWarning = func(percent int, pendingTaskIDs []string) {
+			formatter.PrintWarning(fmt.Sprintf("%d%% of the timeout has elapsed, %d task(s) still pending", percent, len(pendingTaskIDs)))
+		}
+	}
+	if opts.StatusRequests != nil {
+		// the status is printed even with --quiet or structured output, as it was asked for, but on stderr so that
+		// stdout is left to the results
+		statusFormatter := formatter
+		if !printProgress {
+			statusFormatter = NewTaskOutputFormatter(os.Stderr, settings.logLevel)
+			statusFormatter.SetClock(clock)
+			if opts.NoColor {
+				statusFormatter.DisableColor()
+			}
+		}
+		config.StatusRequests = opts.StatusRequests
+		config.OnStatusRequest = func(pendingTasks []*tasks.Task) {
+			if err := statusFormatter.PrintStatus(pendingTasks); err != nil {
+				formatter.PrintWarning(fmt.Sprintf("failed to print the status of the wait: %v", err))
+			}
+		}
+	}
+	return config
+}
+
+// checkServerVersion leaves out the features of a wait which the server is too old for. The version is only looked up
+// for the features which depend on it, so that other waits don't make the request.
+func checkServerVersion(opts *WaitOptions, output *waitOutput) {
+	if opts.ServerVersionCallback == nil || !((output.printProgress && opts.QueuedBehindCallback != nil) || opts.PrintOutputs) {
+		return
+	}
+	version, err := opts.ServerVersionCallback()
+	if err != nil {
+		if output.printProgress {
+			output.formatter.PrintDebug(fmt.Sprintf("failed to find the version of the server, so it is taken to support everything: %v", err))
+		}
+		return
+	}
+	applyServerCapabilities(opts, version, func(capability serverCapability) {
+		if output.printProgress {
+			output.formatter.PrintDebug(fmt.Sprintf("Octopus Server %s doesn't support %s, which needs %s or later, so it is left out", version, capability.description, capability.minVersion))
+		}
+	})
+}
+
+// addAPICallWrappers wraps the API calls of a wait with its --server-timeout, --profile, debug timings and
+// --api-rate-limit, returning the profile to print once the wait is over, if there is one
+func addAPICallWrappers(opts *WaitOptions, config *WaitConfig, settings *waitSettings, output *waitOutput, clock Clock) *apiProfile {
+	formatter, printProgress, logLevel := output.formatter, output.printProgress, settings.logLevel
+	// the timeout is added before anything else wraps the API calls, so that a call which is given up on doesn't carry
+	// on recording or printing anything in the background. Each batch of task IDs gets the whole of it to itself.
+	if opts.ServerTimeout > 0 {
+		addServerTimeout(config, time.Duration(opts.ServerTimeout)*time.Second)
+	}
+	// the profile wraps the API calls first, so that it doesn't include the time taken to print their debug timings
+	var profile *apiProfile
+	if opts.Profile || (printProgress && logLevel >= LogLevelDebug) {
+		profile = newAPIProfile()
+		addAPIProfile(config, profile)
+	}
+	if printProgress && logLevel >= LogLevelDebug {
+		addDebugTiming(config, formatter)
+		opts.onPageRetry = func(page int, attempt int, err error) {
+			formatter.PrintDebug(fmt.Sprintf("failed to fetch page %d of tasks, fetching it again (attempt %d of %d): %v", page, attempt, PageRetries, err))
+		}
+	}
+	// the rate limit comes last, so that the time spent waiting for it isn't counted as time taken by the server
+	if opts.APIRateLimit > 0 {
+		limiter := newRateLimiter(opts.APIRateLimit, clock)
+		addRateLimit(config, limiter)
+		if opts.QueuedBehindCallback != nil {
+			opts.QueuedBehindCallback = withRateLimit(opts.QueuedBehindCallback, limiter)
+		}
+		if opts.CancelTaskCallback != nil {
+			opts.CancelTaskCallback = withRateLimit(opts.CancelTaskCallback, limiter)
+		}
+		if opts.ResolveTaskContextCallback != nil {
+			opts.ResolveTaskContextCallback = withRateLimit(opts.ResolveTaskContextCallback, limiter)
+		}
+		if opts.TaskOutputsCallback != nil {
+			opts.TaskOutputsCallback = withRateLimit(opts.TaskOutputsCallback, limiter)
+		}
+	}
+	return profile
+}
+
+// addTaskContexts looks up the project, environment and release or runbook of each task for --show-context
+func addTaskContexts(opts *WaitOptions, output *waitOutput) {
+	if !opts.ShowContext || opts.ResolveTaskContextCallback == nil {
+		return
+	}
+	contexts := newTaskContexts(opts.ResolveTaskContextCallback)
+	contexts.onError = func(taskID string, err error) {
+		if output.printProgress {
+			output.formatter.PrintDebug(fmt.Sprintf("failed to look up the context of %s, so it is shown without it: %v", taskID, err))
+		}
+	}
+	contexts.onLimit = func(taskID string) {
+		if output.printProgress {
+			output.formatter.PrintInfo(fmt.Sprintf("Only the context of the first %d task(s) is shown, so %s and any later tasks are shown without it", MaxTaskContexts, taskID))
+		}
+	}
+	output.formatter.SetTaskContexts(contexts)
+}
+
+// verifyWait requests --verify-url once the tasks have succeeded, failing the wait if it doesn't respond with a 2xx
+// status within --verify-timeout. The outcome is reported on its own, after the tasks.
+func verifyWait(opts *WaitOptions, formatter *TaskOutputFormatter, printProgress bool) (*VerifyResult, error) {
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if printProgress {
+		formatter.PrintInfo(fmt.Sprintf("Verifying %s", opts.VerifyURL))
+	}
+	verification := verify(ctx, opts.clock(), &http.Client{}, opts.VerifyURL, time.Duration(opts.VerifyTimeout)*time.Second, time.Duration(opts.VerifyInterval)*time.Second)
+	if !verification.Succeeded {
+		return verification, &VerifyFailedError{Result: verification}
+	}
+	if printProgress {
+		formatter.PrintInfo(fmt.Sprintf("Verified %s: %d %s after %d attempt(s)", opts.VerifyURL, verification.StatusCode, http.StatusText(verification.StatusCode), verification.Attempts))
+	}
+	return verification, nil
+}
+
+// dryRunWait reports the tasks a wait would start with and their current states, without waiting for them
+func dryRunWait(opts *WaitOptions, formatter *TaskOutputFormatter, config WaitConfig, events *TaskEventWriter) error {
+	serverTasks, _, err := resolveTasks(withWaitConfigDefaults(opts.Client, config), opts.TaskIDs)
+	if err != nil {
+		return err
+	}
+
+	results := newTaskResults(WaitResult{Tasks: serverTasks}, formatter.links, formatter.contexts, nil, nil)
+	switch {
+	case events != nil:
+		return events.WriteSummary(results, nil, nil)
+	case isStructuredOutputFormat(opts.OutputFormat):
+		return formatter.PrintResults(results, opts.OutputFormat)
+	case formatter.resultsTemplate != nil:
+		return formatter.PrintResultsTemplate(results)
+	case opts.Quiet:
+		return nil
+	}
+
+	if err := formatter.PrintSummaryTable(serverTasks, nil, nil); err != nil {
+		return err
+	}
+	finished := util.SliceFilter(serverTasks, func(t *tasks.Task) bool { return t.IsCompleted != nil && *t.IsCompleted })
+	formatter.PrintInfo(fmt.Sprintf("Dry run: would wait for %d task(s), %d of which have already finished", len(serverTasks), len(finished)))
+	return nil
+}
+
+// PromptMissing asks which of the running tasks to wait for
+func PromptMissing(opts *WaitOptions) error {
+	if opts.NoPrompt {
+		return fmt.Errorf("cannot prompt for the tasks to wait for when prompting is disabled with --%s or when not running interactively", constants.FlagNoPrompt)
+	}
+	runningTasks, err := opts.QueryTasksCallback(tasks.TasksQuery{States: runningTaskStates})
+	if err != nil {
+		return err
+	}
+	if len(runningTasks) == 0 {
+		return fmt.Errorf("no server task IDs provided, and there are no running tasks to choose from")
+	}
+
+	selectedTasks, err := question.MultiSelectMap(opts.Ask, "Select the tasks to wait for", runningTasks, formatTaskOption, true)
+	if err != nil {
+		return err
+	}
+	opts.TaskIDs = util.SliceTransform(selectedTasks, func(t *tasks.Task) string { return t.ID })
+	return nil
+}
+
+// formatTaskOption describes a task to choose from, such as
+// "ServerTasks-1: Deploy MyProject release 1.0.0 to Production (Executing, started 31-01-2024 18:00:00)"
+func formatTaskOption(t *tasks.Task) string {
+	if t.StartTime == nil {
+		return fmt.Sprintf("%s: %s (%s)", t.ID, t.Description, t.State)
+	}
+	return fmt.Sprintf("%s: %s (%s, started %s)", t.ID, t.Description, t.State, t.StartTime.Format(timeFormat))
+}
+
+// completeWait writes any structured output for the settled tasks and returns an error if any of them failed
+func completeWait(opts *WaitOptions, formatter *TaskOutputFormatter, result WaitResult, queueWaits map[string]QueueWait, outputs map[string]map[string]string) error {
+	results := newTaskResults(result, formatter.links, formatter.contexts, queueWaits, outputs)
+	if err := writeOutputFile(opts, results); err != nil {
+		return err
+	}
+
+	failedTaskIDs := make([]string, 0, len(result.FailedTasks))
+	for _, t := range result.FailedTasks {
+		failedTaskIDs = append(failedTaskIDs, t.ID)
+	}
+	timedOutTaskIDs := make([]string, 0, len(result.TimedOutTasks))
+	for _, t := range result.TimedOutTasks {
+		timedOutTaskIDs = append(timedOutTaskIDs, t.ID)
+	}
+	warnedTaskIDs := make([]string, 0, len(result.Warnings))
+	for _, t := range result.Tasks {
+		if _, ok := result.Warnings[t.ID]; ok {
+			warnedTaskIDs = append(warnedTaskIDs, t.ID)
 		}
-		done <- true
-	}()
+	}
+	// with --fail-on-warning, the warnings of a task which succeeded fail the wait as though the task had failed
+	if opts.FailOnWarning && len(warnedTaskIDs) != 0 {
+		// the messages are copied, as the warnings are only failures as far as the outcome of the wait goes
+		result.FailureMessages = maps.Clone(result.FailureMessages)
+		for _, taskID := range warnedTaskIDs {
+			failedTaskIDs = append(failedTaskIDs, taskID)
+			result.FailureMessages[taskID] = fmt.Sprintf("%d warning(s) with --%s:\n%s", len(result.Warnings[taskID]), FlagFailOnWarning, strings.Join(result.Warnings[taskID], "\n"))
+		}
+	}
 
-	select {
-	case <-done:
+	if isStructuredOutputFormat(opts.OutputFormat) {
+		// with jsonl the results are part of the summary event, which WaitRun writes once it knows the outcome
+		if !strings.EqualFold(opts.OutputFormat, OutputFormatJsonl) {
+			if err := formatter.PrintResults(results, opts.OutputFormat); err != nil {
+				return err
+			}
+		}
+	} else if formatter.resultsTemplate != nil && opts.Quiet {
+		// the template is all --quiet leaves, for scripts which only want what it renders
+		if err := formatter.PrintResultsTemplate(results); err != nil {
+			return err
+		}
+	} else if !opts.Quiet {
+		for _, taskID := range failedTaskIDs {
+			if message, ok := result.FailureMessages[taskID]; ok {
+				formatter.PrintTaskFailure(taskID, message)
+			}
+		}
+		if !opts.FailOnWarning {
+			for _, taskID := range warnedTaskIDs {
+				formatter.PrintTaskWarnings(taskID, result.Warnings[taskID])
+			}
+		}
+		if formatter.resultsTemplate != nil {
+			if err := formatter.PrintResultsTemplate(results); err != nil {
+				return err
+			}
+		} else if err := formatter.PrintSummaryTable(result.Tasks, timedOutTaskIDs, result.Warnings); err != nil {
+			return err
+		}
+		if len(queueWaits) != 0 {
+			if err := formatter.PrintQueueWaits(result.Tasks, queueWaits); err != nil {
+				return err
+			}
+		}
+		// without the callback, the server is too old to have output variables, rather than the tasks not setting any
+		if opts.PrintOutputs && opts.TaskOutputsCallback != nil {
+			if err := formatter.PrintTaskOutputs(result.Tasks, outputs); err != nil {
+				return err
+			}
+		}
+		if result.MinSuccess != 0 {
+			formatter.PrintInfo(formatMinSuccess(opts, result))
+		}
+		if len(result.MissingTaskIDs) != 0 {
+			formatter.PrintInfo(fmt.Sprintf("Not found, so not waited for: %s", strings.Join(result.MissingTaskIDs, ", ")))
+		}
+		for _, t := range result.Tasks {
+			if retried, ok := result.RetriedTaskIDs[t.ID]; ok {
+				formatter.PrintInfo(fmt.Sprintf("%s is attempt %d, rerunning %s", t.ID, len(retried)+1, strings.Join(retried, ", ")))
+			}
+		}
+		if opts.Watch {
+			formatter.PrintInfo(fmt.Sprintf("Watched %d task(s)", len(result.Tasks)))
+		} else if opts.All || len(opts.States) != 0 {
+			formatter.PrintInfo(fmt.Sprintf("Waited for %d task(s)", len(result.Tasks)))
+		}
+	}
+
+	// once enough tasks have succeeded, the others failing doesn't fail the wait
+	if result.MinSuccess != 0 && len(result.SucceededTasks) >= result.MinSuccess {
 		return nil
-	case err := <-gotError:
+	}
+	if len(failedTaskIDs) != 0 || len(timedOutTaskIDs) != 0 {
+		err := newTaskFailedError(result, failedTaskIDs)
+		err.TimedOutTaskIDs = timedOutTaskIDs
 		return err
-	case <-time.After(time.Duration(opts.Timeout) * time.Second):
-		return fmt.Errorf("timeout while waiting for pending tasks")
+	}
+	return nil
+}
+
+// newTaskResults turns the tasks waited for into their structured representation, with why any failed ones did,
+// links to them when links is set, what they deploy or run when contexts is set, and the output variables of the
+// ones which succeeded when outputs is set
+func newTaskResults(result WaitResult, links *taskLinks, contexts *taskContexts, queueWaits map[string]QueueWait, outputs map[string]map[string]string) []*TaskResult {
+	results := make([]*TaskResult, 0, len(result.Tasks))
+	for _, t := range result.Tasks {
+		taskResult := NewTaskResult(t)
+		if message, ok := result.FailureMessages[t.ID]; ok {
+			taskResult.Errors = message
+		}
+		taskResult.Warnings = len(result.Warnings[t.ID])
+		taskResult.Link = links.link(t.ID, t.SpaceID)
+		if retried, ok := result.RetriedTaskIDs[t.ID]; ok {
+			taskResult.Attempts = len(retried) + 1
+			taskResult.RetriedTaskIDs = retried
+		}
+		if wait, ok := queueWaits[t.ID]; ok {
+			taskResult.QueuedFor = formatDuration(wait.Queued)
+			taskResult.ExecutingFor = formatDuration(wait.Executing)
+			taskResult.QueueWaitObserved = wait.Observed
+		}
+		if taskContext := contexts.context(t); taskContext != nil {
+			taskResult.Project = taskContext.Project
+			taskResult.Environment = taskContext.Environment
+			taskResult.Release = taskContext.Release
+			taskResult.Runbook = taskContext.Runbook
+			taskResult.RunbookSnapshot = taskContext.RunbookSnapshot
+		}
+		if taskOutputs, ok := outputs[t.ID]; ok {
+			taskResult.Outputs = taskOutputs
+		}
+		results = append(results, taskResult)
+	}
+	return results
+}
+
+// formatMinSuccess says whether enough tasks succeeded to meet --min-success, such as
+// "3 of 5 task(s) succeeded, meeting --min-success 60% (3 required)"
+func formatMinSuccess(opts *WaitOptions, result WaitResult) string {
+	outcome := "meeting"
+	if len(result.SucceededTasks) < result.MinSuccess {
+		outcome = "short of"
+	}
+	return fmt.Sprintf("%d of %d task(s) succeeded, %s --%s %s (%d required)", len(result.SucceededTasks), len(result.Tasks), outcome, FlagMinSuccess, strings.TrimSpace(opts.MinSuccess), result.MinSuccess)
+}
+
+// cancelRemainingTasks cancels the tasks which were still running when enough tasks had succeeded for --min-success
+func cancelRemainingTasks(opts *WaitOptions, formatter *TaskOutputFormatter, result WaitResult, printProgress bool) {
+	for _, t := range result.Tasks {
+		if t.IsCompleted != nil && *t.IsCompleted {
+			continue
+		}
+		_, err := opts.CancelTaskCallback(t.ID)
+		if !printProgress {
+			continue
+		}
+		if err != nil {
+			formatter.PrintWarning(fmt.Sprintf("failed to cancel %s: %v", t.ID, err))
+			continue
+		}
+		formatter.PrintInfo(fmt.Sprintf("Requested cancellation of %s", t.ID))
+	}
+}
+
+// addDebugTiming prints each poll, and how long each of the API calls made while waiting takes by the Clock of config
+func addDebugTiming(config *WaitConfig, formatter *TaskOutputFormatter) {
+	clock := config.Clock
+	onPoll := config.OnPoll
+	config.OnPoll = func(pendingTaskIDs []string) {
+		formatter.PrintDebug(fmt.Sprintf("polling %d pending task(s): %s", len(pendingTaskIDs), strings.Join(pendingTaskIDs, ", ")))
+		if onPoll != nil {
+			onPoll(pendingTaskIDs)
+		}
+	}
+
+	if getServerTasks := config.GetServerTasksCallback; getServerTasks != nil {
+		config.GetServerTasksCallback = func(taskIDs []string) ([]*tasks.Task, error) {
+			started := clock.Now()
+			serverTasks, err := getServerTasks(taskIDs)
+			formatter.PrintDebug(fmt.Sprintf("fetched %d task(s) by ID in %s", len(taskIDs), clock.Now().Sub(started).Round(time.Millisecond)))
+			return serverTasks, err
+		}
+	}
+
+	if queryTasks := config.QueryTasksCallback; queryTasks != nil {
+		config.QueryTasksCallback = func(query tasks.TasksQuery) ([]*tasks.Task, error) {
+			started := clock.Now()
+			serverTasks, err := queryTasks(query)
+			formatter.PrintDebug(fmt.Sprintf("queried tasks in state %s in %s", strings.Join(query.States, ", "), clock.Now().Sub(started).Round(time.Millisecond)))
+			return serverTasks, err
+		}
+	}
+
+	if queryRecentTasks := config.QueryRecentTasksCallback; queryRecentTasks != nil {
+		config.QueryRecentTasksCallback = func(query RecentTasksQuery) ([]*tasks.Task, error) {
+			started := clock.Now()
+			serverTasks, err := queryRecentTasks(query)
+			formatter.PrintDebug(fmt.Sprintf("queried tasks queued since %s in %s", query.Since.Format(time.RFC3339), clock.Now().Sub(started).Round(time.Millisecond)))
+			return serverTasks, err
+		}
+	}
+
+	// details are fetched by several workers at once, so their timings mustn't be printed over each other
+	var detailsMutex sync.Mutex
+	if getTaskDetails := config.GetTaskDetailsCallback; getTaskDetails != nil {
+		config.GetTaskDetailsCallback = func(taskID string) (*tasks.TaskDetailsResource, error) {
+			started := clock.Now()
+			details, err := getTaskDetails(taskID)
+			detailsMutex.Lock()
+			defer detailsMutex.Unlock()
+			formatter.PrintDebug(fmt.Sprintf("fetched the details of %s in %s", taskID, clock.Now().Sub(started).Round(time.Millisecond)))
+			return details, err
+		}
+	}
+}
+
+// cancelPendingTasks requests cancellation of the tasks which were still running when the wait timed out,
+// recording the outcome in the timeout error. A task which can't be cancelled doesn't stop the others.
+func cancelPendingTasks(opts *WaitOptions, timeoutErr *WaitTimeoutError) {
+	timeoutErr.CancelledTaskIDs = make([]string, 0, len(timeoutErr.PendingTaskIDs))
+	timeoutErr.CancelFailures = make(map[string]error)
+	for _, taskID := range timeoutErr.PendingTaskIDs {
+		if _, err := opts.CancelTaskCallback(taskID); err != nil {
+			timeoutErr.CancelFailures[taskID] = err
+			continue
+		}
+		timeoutErr.CancelledTaskIDs = append(timeoutErr.CancelledTaskIDs, taskID)
+	}
+}
+
+func writeOutputFile(opts *WaitOptions, results []*TaskResult) error {
+	if opts.OutputFile == "" {
+		return nil
+	}
+	if results == nil {
+		results = make([]*TaskResult, 0)
+	}
+	format := opts.OutputFileFormat
+	if format == "" {
+		format = constants.OutputFormatJson
+	}
+	return WriteTaskResultsFile(opts.OutputFile, results, format)
+}
+
+// NormalizeTaskStates matches the given states case-insensitively against the known task states,
+// returning an error naming any unknown states
+func NormalizeTaskStates(states []string) ([]string, error) {
+	normalized := make([]string, 0, len(states))
+	unknown := make([]string, 0)
+	for _, state := range states {
+		state = strings.TrimSpace(state)
+		if state == "" {
+			continue
+		}
+		known := util.SliceFilter(TaskStates, func(s string) bool { return strings.EqualFold(s, state) })
+		if len(known) == 0 {
+			unknown = append(unknown, state)
+			continue
+		}
+		normalized = append(normalized, known[0])
+	}
+
+	if len(unknown) != 0 {
+		return nil, fmt.Errorf("unknown task state(s): %s; valid states are %s", strings.Join(unknown, ", "), strings.Join(TaskStates, ", "))
+	}
+	return util.SliceDistinct(normalized), nil
+}
+
+func isStructuredOutputFormat(outputFormat string) bool {
+	switch strings.ToLower(outputFormat) {
+	case constants.OutputFormatJson, OutputFormatYaml, OutputFormatJsonl, OutputFormatTsv:
+		return true
+	default:
+		return false
 	}
 }
 
 func GetServerTasksCallback(octopus *client.Client) ServerTasksCallback {
+	return getServerTasksCallback(octopus, nil, realClock{}.Sleep)
+}
+
+func getServerTasksCallback(octopus *client.Client, onPageRetry PageRetryCallback, sleep func(time.Duration)) ServerTasksCallback {
+	hints := retryAfterHints(octopus)
 	return func(taskIDs []string) ([]*tasks.Task, error) {
-		query := tasks.TasksQuery{
+		serverTasks, err := queryTasks(octopus, tasks.TasksQuery{
 			IDs: taskIDs,
+		}, 0, time.Time{}, onPageRetry, sleep)
+		return serverTasks, hints.wrap(err)
+	}
+}
+
+func GetTasksQueryCallback(octopus *client.Client) TasksQueryCallback {
+	return getTasksQueryCallback(octopus, nil, realClock{}.Sleep)
+}
+
+func getTasksQueryCallback(octopus *client.Client, onPageRetry PageRetryCallback, sleep func(time.Duration)) TasksQueryCallback {
+	hints := retryAfterHints(octopus)
+	return func(query tasks.TasksQuery) ([]*tasks.Task, error) {
+		serverTasks, err := queryTasks(octopus, query, 0, time.Time{}, onPageRetry, sleep)
+		return serverTasks, hints.wrap(err)
+	}
+}
+
+func GetRecentTasksCallback(octopus *client.Client) RecentTasksCallback {
+	return getRecentTasksCallback(octopus, nil, realClock{}.Sleep)
+}
+
+func getRecentTasksCallback(octopus *client.Client, onPageRetry PageRetryCallback, sleep func(time.Duration)) RecentTasksCallback {
+	hints := retryAfterHints(octopus)
+	return func(query RecentTasksQuery) ([]*tasks.Task, error) {
+		serverTasks, err := queryTasks(octopus, query.TasksQuery, 0, query.Since, onPageRetry, sleep)
+		return serverTasks, hints.wrap(err)
+	}
+}
+
+// QueryTasks fetches the tasks matching query, following the server's paging until all of them have been
+// fetched, or just the first limit of them if limit is greater than zero
+func QueryTasks(octopus *client.Client, query tasks.TasksQuery, limit int) ([]*tasks.Task, error) {
+	return queryTasks(octopus, query, limit, time.Time{}, nil, realClock{}.Sleep)
+}
+
+// QueryTasksSince fetches the tasks matching query as QueryTasks does, but only as far back as since. The server lists
+// the newest tasks first but can't filter them by when they were queued, so paging stops at the first page whose tasks
+// were all queued before since, rather than going through the whole of the task history. The tasks on the pages it
+// does fetch which were queued before since are left for the caller to filter out; as they come after the others,
+// the first limit of the tasks which are left are still the newest.
+func QueryTasksSince(octopus *client.Client, query tasks.TasksQuery, since time.Time, limit int) ([]*tasks.Task, error) {
+	return queryTasks(octopus, query, limit, since, nil, realClock{}.Sleep)
+}
+
+func queryTasks(octopus *client.Client, query tasks.TasksQuery, limit int, since time.Time, onPageRetry PageRetryCallback, sleep func(time.Duration)) ([]*tasks.Task, error) {
+	if limit > 0 && (query.Take == 0 || query.Take > limit) {
+		query.Take = limit
+	}
+	var stop func(*resources.Resources[*tasks.Task]) bool
+	if !since.IsZero() {
+		stop = queuedBefore(since)
+	}
+
+	page, err := octopus.Tasks.Get(query)
+	if err != nil {
+		return nil, err
+	}
+	return collectPages(page, func(page *resources.Resources[*tasks.Task]) (*resources.Resources[*tasks.Task], error) {
+		return page.GetNextPage(octopus.Sling())
+	}, limit, pageRetryDelay, sleep, onPageRetry, stop)
+}
+
+func GetTaskDetailsCallback(octopus *client.Client, spaceID string) TaskDetailsCallback {
+	hints := retryAfterHints(octopus)
+	return func(taskID string) (*tasks.TaskDetailsResource, error) {
+		details, err := tasks.GetDetails(octopus, spaceID, taskID)
+		return details, hints.wrap(err)
+	}
+}
+
+func GetCancelTaskCallback(octopus *client.Client, spaceID string) CancelTaskCallback {
+	return func(taskID string) (*tasks.Task, error) {
+		path, err := octopus.URITemplateCache().Expand(cancelTemplate, map[string]any{
+			"spaceId": spaceID,
+			"id":      taskID,
+		})
+		if err != nil {
+			return nil, err
 		}
+		return newclient.Post[tasks.Task](octopus.HttpSession(), path, nil)
+	}
+}
 
-		resourceTasks, err := octopus.Tasks.Get(query)
+func GetRerunTaskCallback(octopus *client.Client, spaceID string) RerunTaskCallback {
+	return func(taskID string) (*tasks.Task, error) {
+		path, err := octopus.URITemplateCache().Expand(rerunTemplate, map[string]any{
+			"spaceId": spaceID,
+			"id":      taskID,
+		})
 		if err != nil {
 			return nil, err
 		}
+		return newclient.Post[tasks.Task](octopus.HttpSession(), path, nil)
+	}
+}
 
-		tasks, err := resourceTasks.GetAllPages(octopus.Sling())
+func GetQueuedBehindCallback(octopus *client.Client, spaceID string) QueuedBehindCallback {
+	return func(taskID string) ([]*tasks.Task, error) {
+		path, err := octopus.URITemplateCache().Expand(queuedBehindTemplate, map[string]any{
+			"spaceId": spaceID,
+			"id":      taskID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		page, err := newclient.Get[resources.Resources[*tasks.Task]](octopus.HttpSession(), path)
 		if err != nil {
 			return nil, err
 		}
+		return page.Items, nil
+	}
+}
 
-		return tasks, nil
+func GetResolveDeploymentsCallback(octopus *client.Client) ResolveDeploymentsCallback {
+	return func(deploymentIDs []string) ([]*deployments.Deployment, error) {
+		return octopus.Deployments.GetByIDs(deploymentIDs)
 	}
 }
 
-func GetTaskDetailsCallback(octopus *client.Client) TaskDetailsCallback {
-	return func(taskID string) (*tasks.TaskDetailsResource, error) {
-		return tasks.GetDetails(octopus, octopus.GetSpaceID(), taskID)
+func GetResolveProjectCallback(octopus *client.Client) ResolveProjectCallback {
+	return func(projectIdentifier string) (string, error) {
+		project, err := selectors.FindProject(octopus, projectIdentifier)
+		if err != nil {
+			return "", err
+		}
+		return project.GetID(), nil
 	}
 }
 
-func removeTaskID(taskIDs []string, taskID string) []string {
-	for i, p := range taskIDs {
-		if p == taskID {
-			taskIDs[i] = taskIDs[len(taskIDs)-1]
-			taskIDs = taskIDs[:len(taskIDs)-1]
-			break
+// formatPendingProgress describes the progress of each polled task which is still running, prefixed by the
+// task ID when waiting for more than one task
+func formatPendingProgress(formatter *TaskOutputFormatter, polledTasks []*tasks.Task, polledDetails []*tasks.TaskDetailsResource, withTaskIDs bool) string {
+	parts := make([]string, 0, len(polledTasks))
+	for i, t := range polledTasks {
+		if t.IsCompleted != nil && *t.IsCompleted {
+			continue
+		}
+		progress := formatter.FormatTaskProgress(polledDetails[i])
+		if progress == "" {
+			continue
+		}
+		if withTaskIDs {
+			progress = t.ID + ": " + progress
 		}
+		parts = append(parts, progress)
 	}
-	return taskIDs
+	return strings.Join(parts, "; ")
 }
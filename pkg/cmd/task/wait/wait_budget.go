@@ -0,0 +1,77 @@
+package wait
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// errWaitTimedOut is why the budget of a wait ended when it ran out of time, rather than being cancelled
+var errWaitTimedOut = errors.New("the wait ran out of time")
+
+// startWaitBudget returns a context which ends along with ctx, or with errWaitTimedOut as its cause once timeout has
+// passed, so that everything a wait does from the moment it starts counts against its timeout. With bounded unset,
+// it only ends along with ctx.
+func startWaitBudget(ctx context.Context, clock Clock, timeout time.Duration, bounded bool) (context.Context, context.CancelCauseFunc) {
+	budget, cancel := context.WithCancelCause(ctx)
+	if !bounded {
+		return budget, cancel
+	}
+	// the timer is set before the goroutine starts, so that a fake clock knows about it as soon as this returns
+	timeoutElapsed := clock.After(timeout)
+	go func() {
+		select {
+		case <-timeoutElapsed:
+			cancel(errWaitTimedOut)
+		case <-budget.Done():
+		}
+	}()
+	return budget, cancel
+}
+
+// addWaitBudget bounds each call for the state or details of tasks by budget, including the first, which finds the
+// tasks to wait for, and the last, which find out why any of them failed
+func addWaitBudget(config *WaitConfig, budget context.Context) {
+	if config.GetServerTasksCallback != nil {
+		config.GetServerTasksCallback = withWaitBudget(config.GetServerTasksCallback, budget)
+	}
+	if config.QueryTasksCallback != nil {
+		config.QueryTasksCallback = withWaitBudget(config.QueryTasksCallback, budget)
+	}
+	if config.QueryRecentTasksCallback != nil {
+		config.QueryRecentTasksCallback = withWaitBudget(config.QueryRecentTasksCallback, budget)
+	}
+	if config.GetTaskDetailsCallback != nil {
+		config.GetTaskDetailsCallback = withWaitBudget(config.GetTaskDetailsCallback, budget)
+	}
+}
+
+// withWaitBudget gives up on a call to call once budget ends, returning why it did. As with withServerTimeout, a call
+// which is given up on can't be cancelled; it is left to finish in the background, and whatever it returns is
+// ignored.
+func withWaitBudget[T any, R any](call func(T) (R, error), budget context.Context) func(T) (R, error) {
+	type outcome struct {
+		result R
+		err    error
+	}
+	return func(arg T) (R, error) {
+		var zero R
+		if budget.Err() != nil {
+			return zero, context.Cause(budget)
+		}
+
+		// buffered, so that a call which finishes after it was given up on doesn't block forever
+		done := make(chan outcome, 1)
+		go func() {
+			result, err := call(arg)
+			done <- outcome{result, err}
+		}()
+
+		select {
+		case o := <-done:
+			return o.result, o.err
+		case <-budget.Done():
+			return zero, context.Cause(budget)
+		}
+	}
+}
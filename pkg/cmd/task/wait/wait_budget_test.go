@@ -0,0 +1,54 @@
+package wait
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/OctopusDeploy/cli/test/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithWaitBudget(t *testing.T) {
+	clock := testutil.NewFakeClock(time.Date(2024, 1, 31, 18, 0, 0, 0, time.UTC))
+	budget, cancel := startWaitBudget(context.Background(), clock, 5*time.Second, true)
+	defer cancel(nil)
+
+	hung := make(chan struct{})
+	defer close(hung)
+	getState := withWaitBudget(func(taskID string) (string, error) {
+		if taskID == "ServerTasks-2" {
+			<-hung
+		}
+		return "Success", nil
+	}, budget)
+
+	state, err := getState("ServerTasks-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Success", state)
+
+	// the call which hangs is given up on once the time is up
+	go clock.Advance(5 * time.Second)
+	state, err = getState("ServerTasks-2")
+	assert.ErrorIs(t, err, errWaitTimedOut)
+	assert.Empty(t, state)
+
+	// and once it's up, no more calls are made
+	_, err = getState("ServerTasks-1")
+	assert.ErrorIs(t, err, errWaitTimedOut)
+}
+
+func TestStartWaitBudget(t *testing.T) {
+	clock := testutil.NewFakeClock(time.Date(2024, 1, 31, 18, 0, 0, 0, time.UTC))
+
+	// without a timeout, the budget only ends along with the context it was started from
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	budget, cancel := startWaitBudget(ctx, clock, 0, false)
+	defer cancel(nil)
+	clock.Advance(time.Hour)
+	assert.NoError(t, budget.Err())
+	cancelCtx()
+	<-budget.Done()
+	assert.True(t, errors.Is(context.Cause(budget), context.Canceled))
+}
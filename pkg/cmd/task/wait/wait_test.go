@@ -1,15 +1,41 @@
 package wait_test
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/MakeNowJust/heredoc/v2"
 	"github.com/OctopusDeploy/cli/pkg/cmd"
 	taskWaitCreate "github.com/OctopusDeploy/cli/pkg/cmd/task/wait"
+	"github.com/OctopusDeploy/cli/pkg/constants"
+	cliErrors "github.com/OctopusDeploy/cli/pkg/errors"
+	"github.com/OctopusDeploy/cli/pkg/util"
 	"github.com/OctopusDeploy/cli/test/testutil"
+	octopusApiClient "github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/client"
+	octopusApiConstants "github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/constants"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/core"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/deployments"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/resources"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/spaces"
 	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
 	"github.com/stretchr/testify/assert"
 )
@@ -18,174 +44,3127 @@ var serverUrl, _ = url.Parse("https://serverurl")
 var spinner = &testutil.FakeSpinner{}
 var rootResource = testutil.NewRootResource()
 
+// waitedPattern matches how long a failed wait took, which depends on how quickly the test ran
+var waitedPattern = regexp.MustCompile(` after waiting [0-9.hmsµ]+`)
+
+// assertTaskFailedError asserts err says how long the wait took, and is otherwise the expected failure
+func assertTaskFailedError(t *testing.T, err error, expected string) {
+	if assert.Error(t, err) {
+		assert.Regexp(t, waitedPattern, err.Error())
+		assert.Equal(t, expected, waitedPattern.ReplaceAllString(err.Error(), ""))
+	}
+}
+
+// fakeClockStart is the time at which runOnFakeClock starts the wait
+var fakeClockStart = time.Date(2024, 1, 31, 18, 0, 0, 0, time.UTC)
+
+// runOnFakeClock runs the wait on a fake clock which moves on to whatever the wait is waiting for whenever it is
+// idle, so that a test of a wait which polls a few times doesn't sit through the poll interval each time. The wait is
+// idle while its next poll is due, along with its timeout, or the end of the watch, if it has one.
+func runOnFakeClock(opts *taskWaitCreate.WaitOptions) error {
+	clock := testutil.NewFakeClock(fakeClockStart)
+	opts.Clock = clock
+	timeout := opts.Timeout
+	if opts.Watch {
+		timeout = opts.WatchDuration
+	}
+	idleTimers := 1
+	if timeout > 0 || opts.Deadline != "" {
+		idleTimers++
+	}
+	stop := clock.AdvanceWhenWaiting(idleTimers)
+	defer stop()
+	return taskWaitCreate.WaitRun(opts)
+}
+
+// newServerWaitOptions makes the options of a wait for taskIDs on server which polls every second, writing to out
+func newServerWaitOptions(out io.Writer, server *testutil.FakeTaskServer, taskIDs ...string) *taskWaitCreate.WaitOptions {
+	return &taskWaitCreate.WaitOptions{
+		Dependencies:           &cmd.Dependencies{Out: out},
+		TaskIDs:                taskIDs,
+		GetServerTasksCallback: server.GetServerTasks,
+		QueryTasksCallback:     server.QueryTasks,
+		Timeout:                taskWaitCreate.DefaultTimeout,
+		PollInterval:           1,
+		MaxPollInterval:        1,
+	}
+}
+
 func TestWait(t *testing.T) {
+	tests := []struct {
+		name   string
+		server *testutil.FakeTaskServer
+		// polls is how many times the server is asked for the tasks
+		polls  int
+		err    string
+		output string
+	}{
+		{
+			name: "succeeded",
+			server: testutil.NewFakeTaskServer().
+				AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing", "Success").
+				AddTask("ServerTasks-2", "Deploy Bar 2 release 0.0.2 to Foo", "Success"),
+			polls: 2,
+			output: heredoc.Doc(`
+				ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Executing
+				ServerTasks-2: Deploy Bar 2 release 0.0.2 to Foo: Success
+				ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Success
+
+				ID             NAME                               STATE    DURATION  RESULT
+				ServerTasks-1  Deploy Bar 1 release 0.0.2 to Foo  Success  -         Succeeded
+				ServerTasks-2  Deploy Bar 2 release 0.0.2 to Foo  Success  -         Succeeded
+			`),
+		},
+		{
+			name: "failed before the wait",
+			server: testutil.NewFakeTaskServer().
+				AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Failed"),
+			polls: 1,
+			err:   "One or more deployment tasks failed: ServerTasks-1\n  ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo",
+			output: heredoc.Doc(`
+				ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Failed
+
+				ID             NAME                               STATE   DURATION  RESULT
+				ServerTasks-1  Deploy Bar 1 release 0.0.2 to Foo  Failed  -         Failed
+			`),
+		},
+		{
+			name: "failed while waiting",
+			server: testutil.NewFakeTaskServer().
+				AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing", "Failed"),
+			polls: 2,
+			err:   "One or more deployment tasks failed: ServerTasks-1\n  ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo",
+			output: heredoc.Doc(`
+				ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Executing
+				ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Failed
+
+				ID             NAME                               STATE   DURATION  RESULT
+				ServerTasks-1  Deploy Bar 1 release 0.0.2 to Foo  Failed  -         Failed
+			`),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := bytes.Buffer{}
+			opts := newServerWaitOptions(&out, test.server, "ServerTasks-1", "ServerTasks-2")
+			if test.err != "" {
+				opts.TaskIDs = []string{"ServerTasks-1"}
+			}
+
+			err := runOnFakeClock(opts)
+			assert.Equal(t, test.polls, test.server.Calls())
+			assert.Equal(t, test.output, out.String())
+			if test.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			// how long the wait took depends on the jitter of the polls, and a task which had already failed isn't waited for
+			if assert.Error(t, err) {
+				assert.Equal(t, test.err, waitedPattern.ReplaceAllString(err.Error(), ""))
+			}
+			assert.ErrorIs(t, err, taskWaitCreate.ErrTaskFailed)
+			var taskFailedError *taskWaitCreate.TaskFailedError
+			assert.ErrorAs(t, err, &taskFailedError)
+			assert.Equal(t, []string{"ServerTasks-1"}, taskFailedError.TaskIDs)
+			assert.Equal(t, taskWaitCreate.ExitCodeTaskFailed, taskFailedError.ExitCode())
+		})
+	}
+}
+
+func TestWait_InvalidOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     func(opts *taskWaitCreate.WaitOptions)
+		expected string
+	}{
+		{"poll interval of zero", func(opts *taskWaitCreate.WaitOptions) { opts.PollInterval = 0 }, "--poll-interval must be greater than zero"},
+		{"poll interval longer than the timeout", func(opts *taskWaitCreate.WaitOptions) {
+			opts.Timeout = 10
+			opts.PollInterval = 11
+			opts.MaxPollInterval = 11
+		}, "--poll-interval (11s) must be less than or equal to --timeout (10s)"},
+		{"max poll interval shorter than the poll interval", func(opts *taskWaitCreate.WaitOptions) { opts.PollInterval = 6; opts.MaxPollInterval = 5 }, "--max-poll-interval (5s) must be greater than or equal to --poll-interval (6s)"},
+		{"too many detail workers", func(opts *taskWaitCreate.WaitOptions) {
+			opts.ShowProgress = true
+			opts.DetailWorkers = taskWaitCreate.MaxDetailWorkers + 1
+		}, "--detail-workers must be between 1 and 16"},
+		{"unknown log level", func(opts *taskWaitCreate.WaitOptions) { opts.LogLevel = "verbose" }, "unknown log level verbose; valid levels are error, warn, info, debug"},
+		{"unknown on timeout", func(opts *taskWaitCreate.WaitOptions) { opts.OnTimeout = "ignore" }, "unsupported --on-timeout value ignore. Valid values are 'fail', 'cancel'. Defaults to fail"},
+		{"deadline not a timestamp", func(opts *taskWaitCreate.WaitOptions) { opts.Deadline = "tomorrow" }, "invalid --deadline value tomorrow; expected an RFC3339 timestamp such as 2024-01-31T18:00:00Z"},
+		{"deadline in the past", func(opts *taskWaitCreate.WaitOptions) { opts.Deadline = "2024-01-31T18:00:00Z" }, "--deadline (2024-01-31T18:00:00Z) must be in the future"},
+		{"watch with task IDs", func(opts *taskWaitCreate.WaitOptions) { opts.Watch = true }, "--watch cannot be used with task IDs, --all or --state"},
+		{"watch with a timeout", func(opts *taskWaitCreate.WaitOptions) { opts.TaskIDs = nil; opts.Watch = true }, "--timeout cannot be used with --watch; use --watch-duration instead"},
+		{"negative watch duration", func(opts *taskWaitCreate.WaitOptions) {
+			opts.TaskIDs = nil
+			opts.Watch = true
+			opts.Timeout = 0
+			opts.WatchDuration = -1
+		}, "--watch-duration must not be negative"},
+		{"watch duration without watch", func(opts *taskWaitCreate.WaitOptions) { opts.WatchDuration = 60 }, "--watch-duration can only be used with --watch"},
+		{"project with task IDs", func(opts *taskWaitCreate.WaitOptions) { opts.Project = "MyProject" }, "--project can only be used with --all, --state, --watch, --select-latest or --since"},
+		{"negative min age", func(opts *taskWaitCreate.WaitOptions) { opts.MinAge = -1 }, "--min-age must not be negative"},
+		{"negative max age", func(opts *taskWaitCreate.WaitOptions) { opts.MaxAge = -1 }, "--max-age must not be negative"},
+		{"min age over max age", func(opts *taskWaitCreate.WaitOptions) { opts.MinAge = 600; opts.MaxAge = 60 }, "--min-age (600s) must be less than or equal to --max-age (60s)"},
+		{"ages with watch", func(opts *taskWaitCreate.WaitOptions) {
+			opts.TaskIDs = nil
+			opts.Watch = true
+			opts.Timeout = 0
+			opts.MinAge = 60
+		}, "--min-age and --max-age cannot be used with --watch"},
+		{"since with task IDs", func(opts *taskWaitCreate.WaitOptions) { opts.Since = "10m" }, "--since cannot be used with task IDs, --watch or --select-latest"},
+		{"since not a duration or date", func(opts *taskWaitCreate.WaitOptions) { opts.TaskIDs = nil; opts.Since = "yesterday" }, "invalid --since value yesterday; expected a duration such as 24h or a date such as 2024-01-31"},
+		{"since in the future", func(opts *taskWaitCreate.WaitOptions) { opts.TaskIDs = nil; opts.Since = "-10m" }, "--since must not be in the future"},
+		{"name pattern with task IDs", func(opts *taskWaitCreate.WaitOptions) { opts.NamePattern = "Deploy *" }, "--name-pattern can only be used with --all, --state or --since"},
+		{"name pattern with include new", func(opts *taskWaitCreate.WaitOptions) {
+			opts.TaskIDs = nil
+			opts.NamePattern = "Deploy *"
+			opts.All = true
+			opts.IncludeNew = true
+		}, "--name-pattern cannot be used with --include-new"},
+		{"min success not a number", func(opts *taskWaitCreate.WaitOptions) { opts.MinSuccess = "most" }, "invalid --min-success value most; expected a number of tasks such as 3, or a percentage such as 60%"},
+		{"min success of zero", func(opts *taskWaitCreate.WaitOptions) { opts.MinSuccess = "0" }, "invalid --min-success value 0; expected a number of tasks such as 3, or a percentage such as 60%"},
+		{"min success percentage out of range", func(opts *taskWaitCreate.WaitOptions) { opts.MinSuccess = "120%" }, "invalid --min-success value 120%; a percentage must be between 1% and 100%"},
+		{"min success more than the tasks", func(opts *taskWaitCreate.WaitOptions) {
+			opts.TaskIDs = []string{"ServerTasks-1", "ServerTasks-2"}
+			opts.MinSuccess = "3"
+		}, "--min-success (3) must not be more than the number of tasks (2)"},
+		{"min success with fail fast", func(opts *taskWaitCreate.WaitOptions) { opts.MinSuccess = "1"; opts.FailFast = true }, "--min-success and --fail-fast cannot be used together"},
+		{"cancel remaining without min success", func(opts *taskWaitCreate.WaitOptions) { opts.CancelRemaining = true }, "--cancel-remaining can only be used with --min-success"},
+		{"invalid highlight", func(opts *taskWaitCreate.WaitOptions) { opts.ShowProgress = true; opts.Highlight = []string{"("} }, "invalid --highlight value (: error parsing regexp: missing closing ): `(`"},
+		{"highlight without progress", func(opts *taskWaitCreate.WaitOptions) { opts.Highlight = []string{"Deploying"} }, "--highlight can only be used with --progress"},
+		{"only matching without highlight", func(opts *taskWaitCreate.WaitOptions) { opts.ShowProgress = true; opts.OnlyMatching = true }, "--only-matching can only be used with --highlight"},
+		{"tail without progress", func(opts *taskWaitCreate.WaitOptions) { opts.Tail = 20 }, "--tail can only be used with --progress"},
+		{"negative tail", func(opts *taskWaitCreate.WaitOptions) { opts.ShowProgress = true; opts.Tail = -1 }, "--tail must not be negative"},
+		{"dashboard without progress", func(opts *taskWaitCreate.WaitOptions) { opts.Dashboard = true }, "--dashboard can only be used with --progress"},
+		{"quiet with progress", func(opts *taskWaitCreate.WaitOptions) { opts.Quiet = true; opts.ShowProgress = true }, "--quiet and --progress cannot be used together"},
+		{"profile with json", func(opts *taskWaitCreate.WaitOptions) {
+			opts.Profile = true
+			opts.OutputFormat = constants.OutputFormatJson
+		}, "--profile cannot be used with --output-format json"},
+		{"format template with json", func(opts *taskWaitCreate.WaitOptions) {
+			opts.FormatTemplate = "{{.ID}}"
+			opts.OutputFormat = constants.OutputFormatJson
+		}, "--format-template cannot be used with --output-format json"},
+		{"unknown output file format", func(opts *taskWaitCreate.WaitOptions) {
+			opts.OutputFile = "results.json"
+			opts.OutputFileFormat = "xml"
+		}, "unsupported --output-file-format value xml. Valid values are json, yaml, jsonl, tsv. Defaults to json"},
+		{"output file format without output file", func(opts *taskWaitCreate.WaitOptions) { opts.OutputFileFormat = "json" }, "--output-file-format can only be used with --output-file"},
+		{"dry run with follow children", func(opts *taskWaitCreate.WaitOptions) { opts.DryRun = true; opts.FollowChildren = true }, "--dry-run cannot be used with --follow-children"},
+		{"require running with all", func(opts *taskWaitCreate.WaitOptions) {
+			opts.TaskIDs = nil
+			opts.All = true
+			opts.RequireRunning = true
+		}, "--require-running cannot be used with --all, --state or --watch"},
+		{"task IDs with --all", func(opts *taskWaitCreate.WaitOptions) { opts.All = true }, "task IDs cannot be provided when using --all"},
+		{"unknown state", func(opts *taskWaitCreate.WaitOptions) {
+			opts.TaskIDs = nil
+			opts.States = []string{"Executing", "Running", "Done"}
+		}, "unknown task state(s): Running, Done; valid states are Queued, Executing, Cancelling, Success, Failed, Canceled, TimedOut"},
+		{"unknown success state", func(opts *taskWaitCreate.WaitOptions) { opts.SuccessStates = []string{"Success", "Done"} }, "unknown task state(s): Done; valid states are Queued, Executing, Cancelling, Success, Failed, Canceled, TimedOut"},
+		{"running success state", func(opts *taskWaitCreate.WaitOptions) { opts.SuccessStates = []string{"Success", "Executing"} }, "--success-states can only contain finished states, not Executing"},
+		{"hook strict without a hook", func(opts *taskWaitCreate.WaitOptions) { opts.HookStrict = true }, "--hook-strict can only be used with --on-success or --on-failure"},
+		{"invalid deployment ID", func(opts *taskWaitCreate.WaitOptions) { opts.Deployments = []string{"ServerTasks-1"} }, "invalid deployment ID(s): ServerTasks-1; expected IDs in the form Deployments-123 or 123"},
+		{"deployment with all", func(opts *taskWaitCreate.WaitOptions) {
+			opts.TaskIDs = nil
+			opts.Deployments = []string{"Deployments-11"}
+			opts.All = true
+		}, "--deployment cannot be used with --all, --state or --watch"},
+		{"negative max tasks", func(opts *taskWaitCreate.WaitOptions) { opts.MaxTasks = -1 }, "--max-tasks must not be negative"},
+		{"verify URL not http", func(opts *taskWaitCreate.WaitOptions) {
+			opts.VerifyURL = "health"
+			opts.VerifyTimeout = 1
+			opts.VerifyInterval = 1
+		}, "invalid --verify-url value health: must be an http or https URL"},
+		{"verify timeout of zero", func(opts *taskWaitCreate.WaitOptions) {
+			opts.VerifyURL = "https://example.com/health"
+			opts.VerifyInterval = 1
+		}, "--verify-timeout must be greater than zero"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := bytes.Buffer{}
+			opts := newServerWaitOptions(&out, testutil.NewFakeTaskServer(), "ServerTasks-1")
+			opts.DetailWorkers = taskWaitCreate.DefaultDetailWorkers
+			test.opts(opts)
+			assert.EqualError(t, runOnFakeClock(opts), test.expected)
+			// nothing is printed or asked of the server before the flags have been checked
+			assert.Empty(t, out.String())
+		})
+	}
+}
+
+func TestWait_Cancelled(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1")
+	opts.Context = ctx
+	opts.GetServerTasksCallback = func(taskIDs []string) ([]*tasks.Task, error) {
+		cancel()
+		return server.GetServerTasks(taskIDs)
+	}
+
+	err := taskWaitCreate.WaitRun(opts)
+	assert.ErrorIs(t, err, taskWaitCreate.ErrWaitCancelled)
+}
+
+func TestWait_JsonOutput(t *testing.T) {
+	out := bytes.Buffer{}
+	startTime := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	completedTime := startTime.Add(90 * time.Second)
+	failedTime := startTime.Add(40 * time.Minute)
+
+	succeeded := testutil.NewFakeTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Success")
+	succeeded.StartTime = &startTime
+	succeeded.CompletedTime = &completedTime
+	failed := testutil.NewFakeTask("ServerTasks-2", "Deploy Bar 2 release 0.0.2 to Foo", "Failed")
+	failed.ErrorMessage = "Something went wrong"
+	failed.StartTime = &startTime
+	failed.CompletedTime = &failedTime
+	server := testutil.NewFakeTaskServer().
+		AddTaskStates("ServerTasks-1", succeeded).
+		AddTaskStates("ServerTasks-2", failed)
+
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1", "ServerTasks-2")
+	opts.OutputFormat = constants.OutputFormatJson
+
+	err := taskWaitCreate.WaitRun(opts)
+	assertTaskFailedError(t, err, "One or more deployment tasks failed: ServerTasks-2\n  ServerTasks-2: Deploy Bar 2 release 0.0.2 to Foo (failed after 40m0s): Something went wrong")
+
+	var results []taskWaitCreate.TaskResult
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &results))
+	assert.Equal(t, []taskWaitCreate.TaskResult{
+		{ID: "ServerTasks-1", Name: "Deploy Bar 1 release 0.0.2 to Foo", State: "Success", FinishedSuccessfully: true, Duration: "1m30s"},
+		{ID: "ServerTasks-2", Name: "Deploy Bar 2 release 0.0.2 to Foo", State: "Failed", FinishedSuccessfully: false, Duration: "40m0s", Errors: "Something went wrong"},
+	}, results)
+}
+
+func TestWait_JsonLinesOutput(t *testing.T) {
 	out := bytes.Buffer{}
-	defaultTaskIDs := []string{
-		"TaskID1",
-		"TaskID2",
+	occurredAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	logElements := []*tasks.ActivityLogElement{
+		{Category: "Info", MessageText: "Deploying package", OccurredAt: occurredAt},
+		{Category: "Info", MessageText: "Package deployed", OccurredAt: occurredAt.Add(time.Second)},
+	}
+	stepLogs := func(count int) *tasks.TaskDetailsResource {
+		return &tasks.TaskDetailsResource{
+			ActivityLogs: []*tasks.ActivityElement{{ID: "ServerTasks-1_step1", Name: "Step 1", LogElements: logElements[:count]}},
+		}
+	}
+	newServer := func(states ...*tasks.Task) *testutil.FakeTaskServer {
+		return testutil.NewFakeTaskServer().
+			AddTaskStates("ServerTasks-1", states...).
+			AddDetails("ServerTasks-1", stepLogs(1), stepLogs(2))
 	}
+	executing := testutil.NewFakeTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing")
+
+	// the step logs a line on each of the first two polls, and the task finishes on the third
+	server := newServer(executing, executing, testutil.NewFakeTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Success"))
+	// buffered, so nothing reaches out unless each event is flushed
+	opts := newServerWaitOptions(bufio.NewWriter(&out), server, "ServerTasks-1")
+	opts.GetTaskDetailsCallback = server.GetTaskDetails
+	opts.OutputFormat = taskWaitCreate.OutputFormatJsonl
+
+	err := runOnFakeClock(opts)
+	assert.NoError(t, err)
 
-	taskList := []*tasks.Task{
-		tasks.NewTask(),
-		tasks.NewTask(),
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	assert.Len(t, lines, 5)
+	events := make([]map[string]any, 0, len(lines))
+	for _, line := range lines {
+		var event map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(line), &event))
+		assert.NotEmpty(t, event["Time"])
+		delete(event, "Time")
+		events = append(events, event)
 	}
+	assert.Equal(t, []map[string]any{
+		{"Type": "state", "TaskId": "ServerTasks-1", "Name": "Deploy Bar 1 release 0.0.2 to Foo", "State": "Executing", "IsCompleted": false, "PercentComplete": nil, "Step": nil},
+		{"Type": "log", "TaskId": "ServerTasks-1", "ActivityId": "ServerTasks-1_step1", "Activity": "Step 1", "Category": "Info", "Message": "Deploying package", "OccurredAt": "2024-01-01T10:00:00Z", "PercentComplete": nil, "Step": nil},
+		{"Type": "log", "TaskId": "ServerTasks-1", "ActivityId": "ServerTasks-1_step1", "Activity": "Step 1", "Category": "Info", "Message": "Package deployed", "OccurredAt": "2024-01-01T10:00:01Z", "PercentComplete": nil, "Step": nil},
+		{"Type": "state", "TaskId": "ServerTasks-1", "Name": "Deploy Bar 1 release 0.0.2 to Foo", "State": "Success", "PreviousState": "Executing", "IsCompleted": true, "PercentComplete": nil, "Step": nil},
+		{"Type": "summary", "Succeeded": true, "Tasks": []any{
+			map[string]any{"Id": "ServerTasks-1", "Name": "Deploy Bar 1 release 0.0.2 to Foo", "State": "Success", "FinishedSuccessfully": true},
+		}},
+	}, events)
+
+	// the summary ends the stream even when the wait fails
+	out.Reset()
+	server = newServer(executing)
+	opts.GetServerTasksCallback = server.GetServerTasks
+	opts.GetTaskDetailsCallback = server.GetTaskDetails
+	opts.Timeout = 1
+	err = runOnFakeClock(opts)
+	assert.Error(t, err)
+	lines = strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	var summary taskWaitCreate.TaskSummaryEvent
+	assert.NoError(t, json.Unmarshal([]byte(lines[len(lines)-1]), &summary))
+	assert.Equal(t, taskWaitCreate.TaskEventSummary, summary.Type)
+	assert.False(t, summary.Succeeded)
+	assert.Equal(t, err.Error(), summary.Error)
 
-	// bool vars as bool constants can't be used as pointers for IsCompleted
-	boolFalse := false
-	boolTrue := true
+	// a failed task is reported with why it failed
+	out.Reset()
+	failed := testutil.NewFakeTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Failed")
+	failed.ErrorMessage = "The deployment failed"
+	server = newServer(failed)
+	opts.GetServerTasksCallback = server.GetServerTasks
+	opts.GetTaskDetailsCallback = server.GetTaskDetails
+	opts.Timeout = taskWaitCreate.DefaultTimeout
+	err = runOnFakeClock(opts)
+	assert.ErrorIs(t, err, taskWaitCreate.ErrTaskFailed)
+	lines = strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	summary = taskWaitCreate.TaskSummaryEvent{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[len(lines)-1]), &summary))
+	assert.Equal(t, []*taskWaitCreate.TaskFailure{
+		{TaskID: "ServerTasks-1", Name: "Deploy Bar 1 release 0.0.2 to Foo", Message: "The deployment failed"},
+	}, summary.Failures)
+}
 
-	taskList[0].ID = defaultTaskIDs[0]
-	taskList[0].IsCompleted = &boolFalse
-	taskList[0].FinishedSuccessfully = &boolFalse
-	taskList[0].Description = "Deploy Bar 1 release 0.0.2 to Foo"
-	taskList[0].State = "Executing"
+func TestWait_JsonLinesProgress(t *testing.T) {
+	out := bytes.Buffer{}
+	running := func(percentage int, step string) *tasks.TaskDetailsResource {
+		return &tasks.TaskDetailsResource{
+			Progress: &tasks.TaskProgress{ProgressPercentage: percentage},
+			ActivityLogs: []*tasks.ActivityElement{{
+				Children: []*tasks.ActivityElement{{Name: "Step 1: Acquire packages", Status: "Success"}, {Name: step, Status: "Running"}},
+			}},
+		}
+	}
+	// the second poll hasn't made any progress, so it isn't written, and the task has finished by the third
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing", "Executing", "Executing", "Success").
+		AddDetails("ServerTasks-1",
+			running(25, "Step 2: Deploy package"),
+			running(25, "Step 2: Deploy package"),
+			&tasks.TaskDetailsResource{Progress: &tasks.TaskProgress{ProgressPercentage: 100}})
 
-	taskList[1].ID = defaultTaskIDs[1]
-	taskList[1].IsCompleted = &boolTrue
-	taskList[1].FinishedSuccessfully = &boolTrue
-	taskList[1].Description = "Deploy Bar 2 release 0.0.2 to Foo"
-	taskList[1].State = "Success"
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1")
+	opts.GetTaskDetailsCallback = server.GetTaskDetails
+	opts.DetailWorkers = 1
+	opts.OutputFormat = taskWaitCreate.OutputFormatJsonl
 
-	timesCalled := 0
+	err := runOnFakeClock(opts)
+	assert.NoError(t, err)
 
-	getServerTaskCallback := func(taskIDs []string) ([]*tasks.Task, error) {
-		timesCalled += 1
-		switch timesCalled {
-		case 1:
-			assert.Len(t, taskIDs, 2)
-			assert.Equal(t, defaultTaskIDs[0], taskIDs[0])
-			assert.Equal(t, defaultTaskIDs[1], taskIDs[1])
-			return taskList, nil
-		case 2:
-			assert.Len(t, taskIDs, 1)
-			assert.Equal(t, defaultTaskIDs[0], taskIDs[0])
-			taskList[0].IsCompleted = &boolTrue
-			taskList[0].FinishedSuccessfully = &boolTrue
-			taskList[0].State = "Success"
-			taskList = taskList[:len(taskList)-1]
-			return taskList, nil
-		}
-		return nil, fmt.Errorf("getServerTaskCallback was called more then the expected amount of times")
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	events := make([]map[string]any, 0, len(lines))
+	for _, line := range lines[:len(lines)-1] {
+		var event map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(line), &event))
+		delete(event, "Time")
+		events = append(events, event)
 	}
+	// progress isn't known until the details are first fetched, and is null rather than left out until then
+	assert.Equal(t, []map[string]any{
+		{"Type": "state", "TaskId": "ServerTasks-1", "Name": "Deploy Bar 1 release 0.0.2 to Foo", "State": "Executing", "IsCompleted": false, "PercentComplete": nil, "Step": nil},
+		{"Type": "progress", "TaskId": "ServerTasks-1", "PercentComplete": float64(25), "Step": "Step 2: Deploy package"},
+		{"Type": "progress", "TaskId": "ServerTasks-1", "PercentComplete": float64(100), "Step": nil},
+		{"Type": "state", "TaskId": "ServerTasks-1", "Name": "Deploy Bar 1 release 0.0.2 to Foo", "State": "Success", "PreviousState": "Executing", "IsCompleted": true, "PercentComplete": float64(100), "Step": nil},
+	}, events)
+}
 
-	opts := &taskWaitCreate.WaitOptions{
-		Dependencies: &cmd.Dependencies{
-			Out: &out,
-		},
-		TaskIDs:                defaultTaskIDs,
-		GetServerTasksCallback: getServerTaskCallback,
-		GetTaskDetailsCallback: nil,
-		Timeout:                taskWaitCreate.DefaultTimeout,
-		ShowProgress:           false,
+func TestWait_Timeout(t *testing.T) {
+	deadline := fakeClockStart.Add(2 * time.Second).Format(time.RFC3339)
+	tests := []struct {
+		name     string
+		opts     func(opts *taskWaitCreate.WaitOptions)
+		expected string
+	}{
+		{"timeout", func(opts *taskWaitCreate.WaitOptions) { opts.Timeout = 1 }, "timeout after 1s; still pending: ServerTasks-1 (Executing)"},
+		// the deadline comes first, so it's the one which stops the wait
+		{"deadline", func(opts *taskWaitCreate.WaitOptions) { opts.Deadline = deadline }, fmt.Sprintf("deadline %s reached; still pending: ServerTasks-1 (Executing)", deadline)},
 	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := testutil.NewFakeTaskServer().AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing")
+			opts := newServerWaitOptions(&bytes.Buffer{}, server, "ServerTasks-1")
+			opts.OutputFile = filepath.Join(t.TempDir(), "results.json")
+			test.opts(opts)
 
-	err := taskWaitCreate.WaitRun(opts)
+			err := runOnFakeClock(opts)
+			assert.EqualError(t, err, test.expected)
+			assert.ErrorIs(t, err, taskWaitCreate.ErrWaitTimeout)
+			assert.NotErrorIs(t, err, taskWaitCreate.ErrTaskFailed)
+			assert.NoFileExists(t, opts.OutputFile)
+		})
+	}
+}
+
+func TestWait_ZeroTimeoutWaitsUntilTasksFinish(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing", "Executing", "Success")
+
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1")
+	opts.Timeout = 0
+
+	err := runOnFakeClock(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, server.Fetches("ServerTasks-1"))
+	testutil.AssertOutputLines(t, out.String(),
+		"ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Executing",
+		"ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Success",
+		"",
+		"ID             NAME                               STATE    DURATION  RESULT",
+		"ServerTasks-1  Deploy Bar 1 release 0.0.2 to Foo  Success  -         Succeeded",
+	)
+}
+
+func TestWait_TimeoutCancelsPendingTasks(t *testing.T) {
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy ServerTasks-1", "Executing").
+		AddTask("ServerTasks-2", "Deploy ServerTasks-2", "Success").
+		AddTask("ServerTasks-3", "Deploy ServerTasks-3", "Queued")
+
+	cancelledTaskIDs := make([]string, 0)
+	opts := newServerWaitOptions(&bytes.Buffer{}, server, "ServerTasks-1", "ServerTasks-2", "ServerTasks-3")
+	opts.CancelTaskCallback = func(taskID string) (*tasks.Task, error) {
+		if taskID == "ServerTasks-3" {
+			return nil, errors.New("task not found")
+		}
+		cancelledTaskIDs = append(cancelledTaskIDs, taskID)
+		return testutil.NewFakeTask(taskID, "Deploy "+taskID, "Cancelling"), nil
+	}
+	opts.Timeout = 1
+	opts.OnTimeout = taskWaitCreate.OnTimeoutCancel
+
+	err := runOnFakeClock(opts)
+	assert.ErrorIs(t, err, taskWaitCreate.ErrWaitTimeout)
+	assert.EqualError(t, err, heredoc.Doc(`
+		timeout after 1s; still pending: ServerTasks-1 (Executing), ServerTasks-3 (Queued); cancelled: ServerTasks-1
+		  ServerTasks-3: failed to cancel: task not found`))
+	assert.Equal(t, []string{"ServerTasks-1"}, cancelledTaskIDs)
+}
+
+func TestWait_PrintsStateTransitionsOnce(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Queued", "Queued", "Executing", "Executing", "Executing", "Success")
+
+	err := runOnFakeClock(newServerWaitOptions(&out, server, "ServerTasks-1"))
+	assert.NoError(t, err)
+	assert.Equal(t, 6, server.Fetches("ServerTasks-1"))
+	assert.True(t, strings.HasPrefix(out.String(), heredoc.Doc(`
+		ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Queued
+		ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Executing
+		ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Success
+	`)), out.String())
+}
+
+func TestWait_LogLevel(t *testing.T) {
+	// the second poll fails, and the task has failed by the retry
+	newOptions := func(out *bytes.Buffer, logLevel string) *taskWaitCreate.WaitOptions {
+		failed := testutil.NewFakeTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Failed")
+		failed.ErrorMessage = "Something went wrong"
+		server := testutil.NewFakeTaskServer().
+			AddTaskStates("ServerTasks-1", testutil.NewFakeTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing"), failed).
+			FailCall(2, &core.APIError{StatusCode: http.StatusBadGateway, ErrorMessage: "Bad Gateway", FullException: "upstream unavailable"})
+
+		opts := newServerWaitOptions(out, server, "ServerTasks-1")
+		opts.MaxRetries = 1
+		opts.LogLevel = logLevel
+		return opts
+	}
+
+	out := bytes.Buffer{}
+	err := runOnFakeClock(newOptions(&out, "error"))
+	assert.ErrorIs(t, err, taskWaitCreate.ErrTaskFailed)
+	assert.Equal(t, "ServerTasks-1 failed: Something went wrong\n", out.String())
+
+	out.Reset()
+	err = runOnFakeClock(newOptions(&out, "WARN"))
+	assert.ErrorIs(t, err, taskWaitCreate.ErrTaskFailed)
+	assert.Equal(t, heredoc.Doc(`
+		Warning: failed to check task status, retrying (attempt 1 of 1): Octopus API error: Bad Gateway [] upstream unavailable
+		ServerTasks-1 failed: Something went wrong
+	`), out.String())
+
+	out.Reset()
+	err = runOnFakeClock(newOptions(&out, "debug"))
+	assert.ErrorIs(t, err, taskWaitCreate.ErrTaskFailed)
+	assert.Contains(t, out.String(), "ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Executing\n")
+	assert.Equal(t, 2, strings.Count(out.String(), "Debug: polling 1 pending task(s): ServerTasks-1\n"))
+	assert.Equal(t, 3, strings.Count(out.String(), "Debug: fetched 1 task(s) by ID in "))
+}
+
+func TestWait_HonorsRetryAfter(t *testing.T) {
+	out := bytes.Buffer{}
+	api := testutil.NewMockHttpServer()
+	defer api.Close()
+
+	root := testutil.NewRootResource()
+	root.Links[octopusApiConstants.LinkTasks] = "/api/Spaces-1/tasks{/id}{?skip,active,environment,tenant,runbook,project,name,node,running,states,spaces,ids,partialName,take}"
+	clientReceiver := testutil.GoBegin2(func() (*octopusApiClient.Client, error) {
+		return octopusApiClient.NewClient(testutil.NewMockHttpClientWithTransport(api), serverUrl, "API-XXXXXXXXXXXXXXXXXXXXXXXXXXXXX", "Spaces-1")
+	})
+	api.ExpectRequest(t, "GET", "/api/").RespondWith(root)
+	api.ExpectRequest(t, "GET", "/api/Spaces-1").RespondWith(root)
+	octopus, err := testutil.ReceivePair(clientReceiver)
+	assert.NoError(t, err)
+
+	task := testutil.NewFakeTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing")
+
+	start := time.Date(2024, 1, 31, 18, 0, 0, 0, time.UTC)
+	clock := testutil.NewFakeClock(start)
+	opts := taskWaitCreate.NewWaitOps(&cmd.Dependencies{Out: &out, Client: octopus}, []string{"ServerTasks-1"})
+	opts.PollInterval = 1
+	opts.MaxPollInterval = 1
+	opts.Clock = clock
+	stop := clock.AdvanceWhenWaiting(2)
+	defer stop()
+	errReceiver := testutil.GoBegin(func() error { return taskWaitCreate.WaitRun(opts) })
+
+	tasksPath := "/api/Spaces-1/tasks?ids=ServerTasks-1"
+	api.ExpectRequest(t, "GET", tasksPath).RespondWith(resources.Resources[*tasks.Task]{Items: []*tasks.Task{task}})
+
+	// the first poll is turned away, with the server asking for a few seconds' peace
+	api.ExpectRequest(t, "GET", tasksPath)
+	api.Respond(&http.Response{
+		StatusCode:    http.StatusTooManyRequests,
+		Status:        "429 Too Many Requests",
+		Header:        http.Header{"Retry-After": []string{"3"}},
+		Body:          io.NopCloser(strings.NewReader("{}")),
+		ContentLength: 2,
+	}, nil)
+
+	// which we give it, even though the poll interval is shorter: the first poll came a second in, give or take the
+	// jitter, and the retry 3s after that
+	retried := api.ExpectRequest(t, "GET", tasksPath)
+	assert.InDelta(t, float64(4*time.Second), float64(clock.Now().Sub(start)), float64(200*time.Millisecond))
+	retried.RespondWith(resources.Resources[*tasks.Task]{Items: []*tasks.Task{testutil.NewFakeTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Success")}})
+
+	assert.NoError(t, <-errReceiver)
+	assert.Contains(t, out.String(), "Warning: failed to check task status, retrying in 3s as asked by the server (attempt 1 of 3)")
+}
+
+func TestWait_PerTaskTimeout(t *testing.T) {
+	out := bytes.Buffer{}
+	// the first poll comes well within the per-task timeout, so the other task finishes in time
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy ServerTasks-1", "Executing").
+		AddTask("ServerTasks-2", "Deploy ServerTasks-2", "Executing", "Success")
+
+	cancelledTaskIDs := make([]string, 0)
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1", "ServerTasks-2")
+	opts.CancelTaskCallback = func(taskID string) (*tasks.Task, error) {
+		cancelledTaskIDs = append(cancelledTaskIDs, taskID)
+		return testutil.NewFakeTask(taskID, "Deploy "+taskID, "Executing"), nil
+	}
+	opts.PerTaskTimeout = 2
+	opts.OnTimeout = taskWaitCreate.OnTimeoutCancel
+
+	err := runOnFakeClock(opts)
+	assertTaskFailedError(t, err, "One or more deployment tasks timed out: ServerTasks-1")
+	assert.ErrorIs(t, err, taskWaitCreate.ErrWaitTimeout)
+	assert.NotErrorIs(t, err, taskWaitCreate.ErrTaskFailed)
+	var taskFailedError *taskWaitCreate.TaskFailedError
+	assert.ErrorAs(t, err, &taskFailedError)
+	assert.Equal(t, taskWaitCreate.ExitCodeWaitTimeout, taskFailedError.ExitCode())
+	assert.Equal(t, []string{"ServerTasks-1"}, cancelledTaskIDs)
+	assert.Equal(t, heredoc.Doc(`
+  ServerTasks-1: Deploy ServerTasks-1: Executing
+  ServerTasks-2: Deploy ServerTasks-2: Executing
+  ServerTasks-2: Deploy ServerTasks-2: Success
+  Warning: ServerTasks-1 is still Executing after --per-task-timeout of 2s, so it is no longer being waited for
+  Requested cancellation of ServerTasks-1
+
+  ID             NAME                  STATE      DURATION  RESULT
+  ServerTasks-1  Deploy ServerTasks-1  Executing  -         Timed out
+  ServerTasks-2  Deploy ServerTasks-2  Success    -         Succeeded
+  `), out.String())
+}
+
+func TestReadTaskIDs(t *testing.T) {
+	input := heredoc.Doc(`
+		# tasks from the deploy step
+		ServerTasks-1
+
+		  ServerTasks-2  
+		#ServerTasks-3
+		ServerTasks-1
+	`)
+
+	taskIDs, err := taskWaitCreate.ReadTaskIDs(strings.NewReader(input))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ServerTasks-1", "ServerTasks-2", "ServerTasks-1"}, taskIDs)
+}
+
+func TestParseTaskIDs(t *testing.T) {
+	// the output of release deploy --output-format json
+	taskIDs, err := taskWaitCreate.ParseTaskIDs([]byte(`[{"DeploymentId":"Deployments-1","ServerTaskId":"ServerTasks-1"},{"DeploymentId":"Deployments-2","ServerTaskId":"ServerTasks-2"}]`), taskWaitCreate.InputFormatAuto)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ServerTasks-1", "ServerTasks-2"}, taskIDs)
+
+	taskIDs, err = taskWaitCreate.ParseTaskIDs([]byte(`  {"Id": "Deployments-1", "taskId": "ServerTasks-3"}`), taskWaitCreate.InputFormatAuto)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ServerTasks-3"}, taskIDs)
+
+	// the output of task list --output-format json
+	taskIDs, err = taskWaitCreate.ParseTaskIDs([]byte(`[{"Id":"ServerTasks-4","Name":"Deploy","State":"Executing"}]`), constants.OutputFormatJson)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ServerTasks-4"}, taskIDs)
+
+	taskIDs, err = taskWaitCreate.ParseTaskIDs([]byte(`["ServerTasks-5", "ServerTasks-6"]`), taskWaitCreate.InputFormatAuto)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ServerTasks-5", "ServerTasks-6"}, taskIDs)
+
+	taskIDs, err = taskWaitCreate.ParseTaskIDs([]byte("ServerTasks-7,ServerTasks-8\nServerTasks-9"), taskWaitCreate.InputFormatAuto)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ServerTasks-7", "ServerTasks-8", "ServerTasks-9"}, taskIDs)
+
+	_, err = taskWaitCreate.ParseTaskIDs([]byte(`[{"Id":"Deployments-1"}]`), taskWaitCreate.InputFormatAuto)
+	assert.EqualError(t, err, "unrecognized JSON task IDs; expected an array of task IDs, or an object or array of objects with a ServerTaskId, TaskId, Id field")
+
+	_, err = taskWaitCreate.ParseTaskIDs([]byte("ServerTasks-1"), constants.OutputFormatJson)
+	assert.ErrorContains(t, err, "invalid JSON task IDs: ")
+
+	_, err = taskWaitCreate.ParseTaskIDs([]byte("ServerTasks-1"), "xml")
+	assert.EqualError(t, err, "unsupported --input-format value xml. Valid values are 'auto', 'text', 'json'. Defaults to auto")
+}
+
+func TestNormalizeTaskIDs(t *testing.T) {
+	taskIDs, err := taskWaitCreate.NormalizeTaskIDs([]string{" ServerTasks-1", "", "ServerTasks-2", "ServerTasks-1 ", "  "})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ServerTasks-1", "ServerTasks-2"}, taskIDs)
+
+	// bare numbers are short for server task IDs, including when the same task is also given in full
+	taskIDs, err = taskWaitCreate.NormalizeTaskIDs([]string{"12345", " 12346 "})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ServerTasks-12345", "ServerTasks-12346"}, taskIDs)
+
+	taskIDs, err = taskWaitCreate.NormalizeTaskIDs([]string{"ServerTasks-1", "2", "1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ServerTasks-1", "ServerTasks-2"}, taskIDs)
+
+	_, err = taskWaitCreate.NormalizeTaskIDs([]string{"ServerTasks-1", "ServerTask-2", "Deployments-3", "ServerTask-2", "12a"})
+	assert.EqualError(t, err, "invalid server task ID(s): ServerTask-2, Deployments-3, 12a; expected IDs in the form ServerTasks-123 or 123")
+}
+
+func TestWait_Profile(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing", "Success")
+
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1")
+	opts.Quiet = true
+	opts.Profile = true
+
+	// the profile is printed even when quiet, as it was asked for; the initial fetch counts as a poll
+	err := runOnFakeClock(opts)
+	assert.NoError(t, err)
+	assert.Regexp(t, `^\nAPI CALL +CALLS +TOTAL +MIN +AVG +MAX\nFetch tasks by ID +2 +\S+ +\S+ +\S+ +\S+\nPer poll +2 +\S+ +\S+ +\S+ +\S+\n$`, out.String())
+}
+
+func TestWait_TimedByClock(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing", "Success")
+	var clock *testutil.FakeClock
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1")
+	// each fetch takes a second and a half of the wait's time, and none of the real time
+	opts.GetServerTasksCallback = func(taskIDs []string) ([]*tasks.Task, error) {
+		clock.Advance(1500 * time.Millisecond)
+		return server.GetServerTasks(taskIDs)
+	}
+	opts.GetTaskDetailsCallback = server.GetTaskDetails
+	opts.LogLevel = "debug"
+	opts.Profile = true
+	run := func() error {
+		clock = testutil.NewFakeClock(fakeClockStart)
+		opts.Clock = clock
+		stop := clock.AdvanceWhenWaiting(2)
+		defer stop()
+		return taskWaitCreate.WaitRun(opts)
+	}
+
+	// the debug timings and the profile only add up if the calls are timed by the clock of the wait
+	err := run()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(out.String(), "Debug: fetched 1 task(s) by ID in 1.5s\n"))
+	assert.Regexp(t, `\nFetch tasks by ID +2 +3s +1.5s +1.5s +1.5s\n`, out.String())
+
+	// and so are the times of the events
+	out.Reset()
+	server.AddTask("ServerTasks-2", "Deploy Bar 2 release 0.0.2 to Foo", "Executing", "Success")
+	opts.TaskIDs = []string{"ServerTasks-2"}
+	opts.LogLevel = ""
+	opts.Profile = false
+	opts.OutputFormat = taskWaitCreate.OutputFormatJsonl
+	err = run()
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.NotEmpty(t, lines)
+	for _, line := range lines {
+		var event struct{ Time time.Time }
+		assert.NoError(t, json.Unmarshal([]byte(line), &event))
+		assert.False(t, event.Time.Before(fakeClockStart), line)
+		assert.True(t, event.Time.Before(fakeClockStart.Add(time.Minute)), line)
+	}
+}
+
+func TestWait_NoPrintInitial(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy ServerTasks-1", "Executing", "Success").
+		AddTask("ServerTasks-2", "Deploy ServerTasks-2", "Success")
+
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1", "ServerTasks-2")
+	opts.NoPrintInitial = true
+
+	// only the task which finished while waiting is printed before the summary
+	err := runOnFakeClock(opts)
 	assert.NoError(t, err)
-	assert.Equal(t, 2, timesCalled)
 	expectedOutput := heredoc.Doc(`
-  TaskID1: Deploy Bar 1 release 0.0.2 to Foo: Executing
-  TaskID2: Deploy Bar 2 release 0.0.2 to Foo: Success
-  TaskID1: Deploy Bar 1 release 0.0.2 to Foo: Success
+  ServerTasks-1: Deploy ServerTasks-1: Success
+
+  ID             NAME                  STATE    DURATION  RESULT
+  ServerTasks-1  Deploy ServerTasks-1  Success  -         Succeeded
+  ServerTasks-2  Deploy ServerTasks-2  Success  -         Succeeded
   `)
 	assert.Equal(t, expectedOutput, out.String())
 }
 
-func TestWait_FailedTask(t *testing.T) {
+func TestWait_PromptsForTasks(t *testing.T) {
 	out := bytes.Buffer{}
-	defaultTaskIDs := []string{
-		"TaskID1",
+	startTime := time.Date(2024, 1, 31, 18, 0, 0, 0, time.UTC)
+	executing := testutil.NewFakeTask("ServerTasks-1", "Deploy ServerTasks-1", "Executing")
+	executing.StartTime = &startTime
+	server := testutil.NewFakeTaskServer().
+		AddTaskStates("ServerTasks-1", executing).
+		AddTask("ServerTasks-2", "Deploy ServerTasks-2", "Queued", "Success")
+
+	asker, checkRemainingPrompts := testutil.NewMockAsker(t, []*testutil.PA{
+		testutil.NewMultiSelectPrompt("Select the tasks to wait for", "", []string{
+			"ServerTasks-1: Deploy ServerTasks-1 (Executing, started 31-01-2024 18:00:00)",
+			"ServerTasks-2: Deploy ServerTasks-2 (Queued)",
+		}, []string{"ServerTasks-2: Deploy ServerTasks-2 (Queued)"}),
+	})
+
+	opts := newServerWaitOptions(&out, server)
+	opts.Ask = asker
+	opts.QueryTasksCallback = func(query tasks.TasksQuery) ([]*tasks.Task, error) {
+		assert.Equal(t, []string{"Queued", "Executing", "Cancelling"}, query.States)
+		return server.QueryTasks(query)
 	}
 
-	taskList := []*tasks.Task{
-		tasks.NewTask(),
+	err := runOnFakeClock(opts)
+	checkRemainingPrompts()
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "ServerTasks-2: Deploy ServerTasks-2: Success\n")
+	// the task which wasn't picked is only fetched by the prompt's query
+	assert.Equal(t, 1, server.Fetches("ServerTasks-1"))
+
+	// scripts which can't answer prompts still fail fast
+	opts.NoPrompt = true
+	opts.TaskIDs = nil
+	err = runOnFakeClock(opts)
+	assert.EqualError(t, err, "no server task IDs provided, at least one is required when prompting is disabled with --no-prompt or when not running interactively")
+}
+
+func TestWait_NoPromptSkipsPrompting(t *testing.T) {
+	out := bytes.Buffer{}
+	// any prompt would fail the test, as there are no answers to give
+	asker, checkRemainingPrompts := testutil.NewMockAsker(t, []*testutil.PA{})
+
+	server := testutil.NewFakeTaskServer()
+	opts := newServerWaitOptions(&out, server)
+	opts.Ask = asker
+	opts.NoPrompt = true
+
+	err := taskWaitCreate.WaitRun(opts)
+	checkRemainingPrompts()
+	assert.EqualError(t, err, "no server task IDs provided, at least one is required when prompting is disabled with --no-prompt or when not running interactively")
+	assert.Empty(t, out.String())
+	// neither running tasks are queried, nor any tasks fetched
+	assert.Equal(t, 0, server.Calls())
+
+	err = taskWaitCreate.PromptMissing(opts)
+	checkRemainingPrompts()
+	assert.EqualError(t, err, "cannot prompt for the tasks to wait for when prompting is disabled with --no-prompt or when not running interactively")
+}
+
+func TestWait_Intervention(t *testing.T) {
+	out := bytes.Buffer{}
+	// the task is paused on a manual intervention when the wait starts, and finishes once it's been resolved
+	newServer := func() *testutil.FakeTaskServer {
+		interrupted := testutil.NewFakeTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing")
+		interrupted.HasPendingInterruptions = true
+		return testutil.NewFakeTaskServer().AddTaskStates("ServerTasks-1",
+			interrupted, testutil.NewFakeTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Success"))
 	}
 
-	// bool vars as bool constants can't be used as pointers for IsCompleted
-	boolFalse := false
-	boolTrue := true
+	err := runOnFakeClock(newServerWaitOptions(&out, newServer(), "ServerTasks-1"))
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), heredoc.Doc(`
+  ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Executing
+  Warning: ServerTasks-1 is waiting for a manual intervention or guided failure to be resolved in Octopus, and won't finish until someone does so
+  ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Success
+  `))
+
+	// with --fail-on-intervention, the wait stops straight away
+	out.Reset()
+	server := newServer()
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1")
+	opts.FailOnIntervention = true
+	err = runOnFakeClock(opts)
+	assert.EqualError(t, err, "One or more tasks are waiting for a manual intervention or guided failure to be resolved: ServerTasks-1")
+	assert.ErrorIs(t, err, taskWaitCreate.ErrTaskInterrupted)
+	var exitCodeError interface{ ExitCode() int }
+	assert.ErrorAs(t, err, &exitCodeError)
+	assert.Equal(t, taskWaitCreate.ExitCodeTaskInterrupted, exitCodeError.ExitCode())
+	assert.Equal(t, 1, server.Calls())
+	assert.NotContains(t, out.String(), "Warning:")
+}
 
-	taskList[0].ID = defaultTaskIDs[0]
-	taskList[0].IsCompleted = &boolTrue
-	taskList[0].FinishedSuccessfully = &boolFalse
-	taskList[0].Description = "Deploy Bar 1 release 0.0.2 to Foo"
-	taskList[0].State = "Failed"
+func TestWait_ShortTaskIDs(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().AddTask("ServerTasks-12345", "Deploy Bar 1 release 0.0.2 to Foo", "Success")
 
-	getServerTaskCallback := func(taskIDs []string) ([]*tasks.Task, error) {
-		return taskList, nil
+	// piped IDs end up with those given as arguments, so both are normalized the same way
+	pipedTaskIDs, err := taskWaitCreate.ParseTaskIDs([]byte("12345\n"), taskWaitCreate.InputFormatAuto)
+	assert.NoError(t, err)
+
+	opts := newServerWaitOptions(&out, server, append([]string{"ServerTasks-12345"}, pipedTaskIDs...)...)
+	opts.GetServerTasksCallback = func(taskIDs []string) ([]*tasks.Task, error) {
+		assert.Equal(t, []string{"ServerTasks-12345"}, taskIDs)
+		return server.GetServerTasks(taskIDs)
 	}
 
-	opts := &taskWaitCreate.WaitOptions{
-		Dependencies: &cmd.Dependencies{
-			Out: &out,
-		},
-		TaskIDs:                defaultTaskIDs,
-		GetServerTasksCallback: getServerTaskCallback,
-		GetTaskDetailsCallback: nil,
-		Timeout:                taskWaitCreate.DefaultTimeout,
-		ShowProgress:           false,
+	err = runOnFakeClock(opts)
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "ServerTasks-12345: Deploy Bar 1 release 0.0.2 to Foo: Success\n")
+}
+
+func TestWait_ProgressForMultipleTasks(t *testing.T) {
+	out := bytes.Buffer{}
+	// both tasks use the same activity ID, which must not suppress the second task's output
+	details := &tasks.TaskDetailsResource{
+		ActivityLogs: []*tasks.ActivityElement{{
+			ID:       "ServerTasks-root",
+			Children: []*tasks.ActivityElement{{ID: "Activity-1", Name: "Step 1", Status: "Success"}},
+		}},
 	}
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy ServerTasks-1", "Executing", "Success").
+		AddTask("ServerTasks-2", "Deploy ServerTasks-2", "Executing", "Success").
+		AddDetails("ServerTasks-1", details).
+		AddDetails("ServerTasks-2", details)
 
-	err := taskWaitCreate.WaitRun(opts)
-	assert.EqualError(t, err, "One or more deployment tasks failed: TaskID1")
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1", "ServerTasks-2")
+	opts.GetTaskDetailsCallback = server.GetTaskDetails
+	opts.ShowProgress = true
+	opts.DetailWorkers = 2
+
+	err := runOnFakeClock(opts)
+	assert.NoError(t, err)
 	expectedOutput := heredoc.Doc(`
-  TaskID1: Deploy Bar 1 release 0.0.2 to Foo: Failed
+  ServerTasks-1: Deploy ServerTasks-1: Executing
+  ServerTasks-2: Deploy ServerTasks-2: Executing
+  [ServerTasks-1]          Success: Step 1
+  ServerTasks-1: Deploy ServerTasks-1: Success
+  [ServerTasks-2]          Success: Step 1
+  ServerTasks-2: Deploy ServerTasks-2: Success
+
+  ID             NAME                  STATE    DURATION  RESULT
+  ServerTasks-1  Deploy ServerTasks-1  Success  -         Succeeded
+  ServerTasks-2  Deploy ServerTasks-2  Success  -         Succeeded
   `)
 	assert.Equal(t, expectedOutput, out.String())
 }
 
-func TestWait_FailedPendingTask(t *testing.T) {
+func TestWait_ProgressForTaskFinishedBeforeWaiting(t *testing.T) {
 	out := bytes.Buffer{}
-	defaultTaskIDs := []string{
-		"TaskID1",
+	stepDetails := func(taskID string, status string) *tasks.TaskDetailsResource {
+		return &tasks.TaskDetailsResource{
+			ActivityLogs: []*tasks.ActivityElement{{
+				ID:       taskID + "-root",
+				Children: []*tasks.ActivityElement{{ID: taskID + "-step1", Name: "Step 1", Status: status}},
+			}},
+		}
 	}
+	finished := testutil.NewFakeTask("ServerTasks-1", "Deploy ServerTasks-1", "Failed")
+	finished.ErrorMessage = "Step 1 failed"
+	server := testutil.NewFakeTaskServer().
+		AddTaskStates("ServerTasks-1", finished).
+		AddTask("ServerTasks-2", "Deploy ServerTasks-2", "Executing", "Success").
+		AddDetails("ServerTasks-1", stepDetails("ServerTasks-1", "Failed")).
+		AddDetails("ServerTasks-2", stepDetails("ServerTasks-2", "Success"))
+
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1", "ServerTasks-2")
+	opts.GetTaskDetailsCallback = server.GetTaskDetails
+	opts.ShowProgress = true
+	opts.DetailWorkers = 2
+
+	err := runOnFakeClock(opts)
+	assert.ErrorIs(t, err, taskWaitCreate.ErrTaskFailed)
+	// the finished task's activity is shown once up front, even though it's never polled
+	assert.Equal(t, 1, server.Fetches("ServerTasks-1"))
+	expectedOutput := heredoc.Doc(`
+  ServerTasks-1: Deploy ServerTasks-1: Failed
+  ServerTasks-2: Deploy ServerTasks-2: Executing
+  [ServerTasks-1]          Failed: Step 1
+  [ServerTasks-2]          Success: Step 1
+  ServerTasks-2: Deploy ServerTasks-2: Success
+  ServerTasks-1 failed: Step 1 failed
+  `)
+	assert.True(t, strings.HasPrefix(out.String(), expectedOutput), out.String())
+	assert.Equal(t, 1, strings.Count(out.String(), "Failed: Step 1"))
+}
+
+func TestWait_Quiet(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Failed")
+
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1")
+	opts.Quiet = true
+
+	err := runOnFakeClock(opts)
+	assert.ErrorIs(t, err, taskWaitCreate.ErrTaskFailed)
+	assert.Empty(t, out.String())
+
+	opts.OutputFormat = constants.OutputFormatJson
+	err = runOnFakeClock(opts)
+	assert.ErrorIs(t, err, taskWaitCreate.ErrTaskFailed)
+	assert.Contains(t, out.String(), `"Id": "ServerTasks-1"`)
+}
+
+func TestWait_RetriesTransientErrors(t *testing.T) {
+	out := bytes.Buffer{}
+	// the second poll fails, and the task has finished by the retry
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing", "Success").
+		FailCall(2, &core.APIError{StatusCode: http.StatusBadGateway, ErrorMessage: "Bad Gateway", FullException: "upstream unavailable"})
+
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1")
+	opts.MaxRetries = 1
+
+	err := runOnFakeClock(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, server.Calls())
+	expectedOutput := heredoc.Doc(`
+  ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Executing
+  Warning: failed to check task status, retrying (attempt 1 of 1): Octopus API error: Bad Gateway [] upstream unavailable
+  ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Success
+
+  ID             NAME                               STATE    DURATION  RESULT
+  ServerTasks-1  Deploy Bar 1 release 0.0.2 to Foo  Success  -         Succeeded
+  `)
+	assert.Equal(t, expectedOutput, out.String())
+}
+
+func TestWait_DoesNotRetryDefinitiveErrors(t *testing.T) {
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing").
+		FailCall(2, errors.New("unauthorized"))
+
+	opts := newServerWaitOptions(&bytes.Buffer{}, server, "ServerTasks-1")
+	opts.MaxRetries = 3
 
-	taskList := []*tasks.Task{
-		tasks.NewTask(),
+	err := runOnFakeClock(opts)
+	assert.EqualError(t, err, "unauthorized")
+	assert.Equal(t, 2, server.Calls())
+}
+
+func TestWait_AllIncludingNewTasks(t *testing.T) {
+	out := bytes.Buffer{}
+	// task 2 is only queued once task 1 has finished, so the server only has it from the second query on
+	server := testutil.NewFakeTaskServer().AddTask("ServerTasks-1", "Deploy ServerTasks-1", "Executing", "Success")
+	queries := 0
+
+	opts := newServerWaitOptions(&out, server)
+	opts.QueryTasksCallback = func(query tasks.TasksQuery) ([]*tasks.Task, error) {
+		assert.Equal(t, []string{"Queued", "Executing", "Cancelling"}, query.States)
+		queries++
+		if queries == 2 {
+			server.AddTask("ServerTasks-2", "Deploy ServerTasks-2", "Executing", "Success")
+		}
+		return server.QueryTasks(query)
 	}
+	opts.All = true
+	opts.IncludeNew = true
+
+	err := runOnFakeClock(opts)
+	assert.NoError(t, err)
+	expectedOutput := heredoc.Doc(`
+  ServerTasks-1: Deploy ServerTasks-1: Executing
+  ServerTasks-1: Deploy ServerTasks-1: Success
+  ServerTasks-2: Deploy ServerTasks-2: Executing
+  ServerTasks-2: Deploy ServerTasks-2: Success
 
-	// bool vars as bool constants can't be used as pointers for IsCompleted
-	boolFalse := false
-	boolTrue := true
+  ID             NAME                  STATE    DURATION  RESULT
+  ServerTasks-1  Deploy ServerTasks-1  Success  -         Succeeded
+  ServerTasks-2  Deploy ServerTasks-2  Success  -         Succeeded
+  Waited for 2 task(s)
+  `)
+	assert.Equal(t, expectedOutput, out.String())
+}
 
-	taskList[0].ID = defaultTaskIDs[0]
-	taskList[0].IsCompleted = &boolFalse
-	taskList[0].FinishedSuccessfully = &boolFalse
-	taskList[0].Description = "Deploy Bar 1 release 0.0.2 to Foo"
-	taskList[0].State = "Executing"
+func TestWait_AllWithNothingRunning(t *testing.T) {
+	out := bytes.Buffer{}
+	opts := newServerWaitOptions(&out, testutil.NewFakeTaskServer())
+	opts.All = true
 
-	timesCalled := 0
+	err := runOnFakeClock(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, "No tasks in state Queued, Executing, Cancelling to wait for\n", out.String())
+}
 
-	getServerTaskCallback := func(taskIDs []string) ([]*tasks.Task, error) {
-		timesCalled += 1
-		switch timesCalled {
-		case 1:
-			return taskList, nil
-		case 2:
-			taskList[0].IsCompleted = &boolTrue
-			taskList[0].FinishedSuccessfully = &boolFalse
-			taskList[0].State = "Failed"
-			return taskList, nil
+func TestWait_Watch(t *testing.T) {
+	out := bytes.Buffer{}
+	// nothing is running when the watch starts; the task is queued by the time of the first poll
+	server := testutil.NewFakeTaskServer()
+	queries := 0
+
+	opts := newServerWaitOptions(&out, server)
+	opts.QueryTasksCallback = func(query tasks.TasksQuery) ([]*tasks.Task, error) {
+		assert.Equal(t, "Projects-1", query.Project)
+		queries++
+		if queries == 2 {
+			server.AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Queued", "Success")
 		}
-		return nil, fmt.Errorf("getServerTaskCallback was called more then the expected amount of times")
+		return server.QueryTasks(query)
+	}
+	opts.ResolveProjectCallback = func(project string) (string, error) {
+		assert.Equal(t, "MyProject", project)
+		return "Projects-1", nil
 	}
+	opts.Timeout = 0
+	opts.Watch = true
+	opts.WatchDuration = 3
+	opts.Project = "MyProject"
 
-	opts := &taskWaitCreate.WaitOptions{
-		Dependencies: &cmd.Dependencies{
-			Out: &out,
-		},
-		TaskIDs:                defaultTaskIDs,
-		GetServerTasksCallback: getServerTaskCallback,
-		GetTaskDetailsCallback: nil,
-		Timeout:                taskWaitCreate.DefaultTimeout,
-		ShowProgress:           false,
+	// the watch carries on after the task finishes, and the end of the window isn't an error
+	err := runOnFakeClock(opts)
+	assert.NoError(t, err)
+	expectedOutput := heredoc.Doc(`
+  ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Queued
+  ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Success
+
+  ID             NAME                               STATE    DURATION  RESULT
+  ServerTasks-1  Deploy Bar 1 release 0.0.2 to Foo  Success  -         Succeeded
+  Watched 1 task(s)
+  `)
+	assert.Equal(t, expectedOutput, out.String())
+	assert.GreaterOrEqual(t, queries, 3)
+}
+
+func TestWait_State(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Queued", "Success")
+
+	opts := newServerWaitOptions(&out, server)
+	opts.QueryTasksCallback = func(query tasks.TasksQuery) ([]*tasks.Task, error) {
+		assert.Equal(t, []string{"Queued", "Executing"}, query.States)
+		return server.QueryTasks(query)
 	}
+	opts.States = []string{"queued", "EXECUTING"}
 
-	err := taskWaitCreate.WaitRun(opts)
-	assert.EqualError(t, err, "One or more deployment tasks failed: TaskID1")
-	assert.Equal(t, 2, timesCalled)
+	err := runOnFakeClock(opts)
+	assert.NoError(t, err)
 	expectedOutput := heredoc.Doc(`
-  TaskID1: Deploy Bar 1 release 0.0.2 to Foo: Executing
-  TaskID1: Deploy Bar 1 release 0.0.2 to Foo: Failed
+  ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Queued
+  ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Success
+
+  ID             NAME                               STATE    DURATION  RESULT
+  ServerTasks-1  Deploy Bar 1 release 0.0.2 to Foo  Success  -         Succeeded
+  Waited for 1 task(s)
   `)
 	assert.Equal(t, expectedOutput, out.String())
 }
+
+func TestWait_DryRun(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Queued").
+		AddTask("ServerTasks-2", "Deploy Bar 2 release 0.0.2 to Foo", "Success")
+
+	opts := newServerWaitOptions(&out, server)
+	opts.States = []string{"Queued"}
+	opts.DryRun = true
+
+	// the state filter is resolved, but the tasks it finds aren't polled
+	err := runOnFakeClock(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, server.Calls())
+	assert.Equal(t, heredoc.Doc(`
+
+  ID             NAME                               STATE   DURATION  RESULT
+  ServerTasks-1  Deploy Bar 1 release 0.0.2 to Foo  Queued  -         Running
+  Dry run: would wait for 1 task(s), 0 of which have already finished
+  `), out.String())
+
+	// given task IDs are only fetched once, and JSON output lists them as they are
+	out.Reset()
+	opts.States = nil
+	opts.TaskIDs = []string{"ServerTasks-1", "ServerTasks-2"}
+	opts.OutputFormat = constants.OutputFormatJson
+	err = runOnFakeClock(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, server.Calls())
+	var results []taskWaitCreate.TaskResult
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &results))
+	assert.Equal(t, []taskWaitCreate.TaskResult{
+		{ID: "ServerTasks-1", Name: "Deploy Bar 1 release 0.0.2 to Foo", State: "Queued"},
+		{ID: "ServerTasks-2", Name: "Deploy Bar 2 release 0.0.2 to Foo", State: "Success", FinishedSuccessfully: true},
+	}, results)
+}
+
+func TestWait_RequireRunning(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy ServerTasks-1", "Success").
+		AddTask("ServerTasks-2", "Deploy ServerTasks-2", "Executing").
+		AddTask("ServerTasks-3", "Deploy ServerTasks-3", "Canceled")
+
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1", "ServerTasks-2", "ServerTasks-3")
+	opts.RequireRunning = true
+
+	// the stale tasks are reported before anything is waited for
+	err := runOnFakeClock(opts)
+	assert.EqualError(t, err, "task(s) had already finished when the wait started: ServerTasks-1 (Success), ServerTasks-3 (Canceled)")
+	assert.Equal(t, 1, server.Calls())
+	assert.Empty(t, out.String())
+}
+
+func TestWait_TaskAge(t *testing.T) {
+	out := bytes.Buffer{}
+	started := func(id string, startedAgo time.Duration) *tasks.Task {
+		task := testutil.NewFakeTask(id, "Deploy "+id, "Executing")
+		startTime := fakeClockStart.Add(-startedAgo)
+		task.StartTime = &startTime
+		return task
+	}
+	// a queued task goes by when it was queued
+	queued := testutil.NewFakeTask("ServerTasks-4", "Deploy ServerTasks-4", "Queued")
+	queueTime := fakeClockStart.Add(-3 * time.Hour)
+	queued.QueueTime = &queueTime
+	server := testutil.NewFakeTaskServer().
+		AddTaskStates("ServerTasks-1", started("ServerTasks-1", 2*time.Hour)).
+		AddTaskStates("ServerTasks-2", started("ServerTasks-2", 10*time.Minute)).
+		AddTaskStates("ServerTasks-3", started("ServerTasks-3", 30*time.Second)).
+		AddTaskStates("ServerTasks-4", queued)
+
+	opts := newServerWaitOptions(&out, server)
+	opts.States = []string{"Executing", "Queued"}
+	opts.MinAge = 60
+	opts.MaxAge = 3600
+	opts.DryRun = true
+
+	// tasks found by state outside the limits are left out
+	err := runOnFakeClock(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, heredoc.Doc(`
+
+  ID             NAME                  STATE      DURATION  RESULT
+  ServerTasks-2  Deploy ServerTasks-2  Executing  -         Running
+  Dry run: would wait for 1 task(s), 0 of which have already finished
+  `), out.String())
+
+	// given tasks outside the limits fail the wait, as they were most likely given by mistake
+	opts.States = nil
+	opts.TaskIDs = []string{"ServerTasks-1", "ServerTasks-2", "ServerTasks-3", "ServerTasks-4"}
+	opts.DryRun = false
+	err = runOnFakeClock(opts)
+	assert.EqualError(t, err, "task(s) started outside the age limits: "+
+		"ServerTasks-1 (started 2h0m0s ago, more than --max-age 1h0m0s), "+
+		"ServerTasks-3 (started 30s ago, less than --min-age 1m0s), "+
+		"ServerTasks-4 (queued 3h0m0s ago, more than --max-age 1h0m0s)")
+}
+
+func TestWait_SinceAndNamePattern(t *testing.T) {
+	out := bytes.Buffer{}
+	now := time.Date(2024, 1, 31, 10, 0, 0, 0, time.UTC)
+	started := func(id string, description string, startedAgo time.Duration) *tasks.Task {
+		task := testutil.NewFakeTask(id, description, "Success")
+		startTime := now.Add(-startedAgo)
+		task.StartTime = &startTime
+		return task
+	}
+	server := testutil.NewFakeTaskServer().
+		AddTaskStates("ServerTasks-1", started("ServerTasks-1", "Deploy MyProject release 1.0.0", 5*time.Minute)).
+		AddTaskStates("ServerTasks-2", started("ServerTasks-2", "Deploy MyProject release 0.9.0", 20*time.Minute)).
+		AddTaskStates("ServerTasks-3", started("ServerTasks-3", "Backup database", 2*time.Minute)).
+		AddTaskStates("ServerTasks-4", started("ServerTasks-4", "deploy OtherProject release 2.0.0", time.Minute))
+
+	var queries []taskWaitCreate.RecentTasksQuery
+	opts := newServerWaitOptions(&out, server)
+	opts.QueryTasksCallback = func(query tasks.TasksQuery) ([]*tasks.Task, error) {
+		assert.Fail(t, "tasks found by --since should only be fetched as far back as it")
+		return nil, nil
+	}
+	opts.QueryRecentTasksCallback = func(query taskWaitCreate.RecentTasksQuery) ([]*tasks.Task, error) {
+		queries = append(queries, query)
+		return server.QueryTasks(tasks.TasksQuery{})
+	}
+	opts.Since = "10m"
+	opts.NamePattern = "Deploy *"
+	opts.Clock = testutil.NewFakeClock(now)
+
+	// tasks in any state are found, and those which started too long ago or are called something else are left out
+	err := taskWaitCreate.WaitRun(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []taskWaitCreate.RecentTasksQuery{{Since: now.Add(-10 * time.Minute)}}, queries)
+	assert.Contains(t, out.String(), "Found 2 task(s) matching 'Deploy *' which started since 2024-01-31T09:50:00Z: ServerTasks-1, ServerTasks-4\n")
+	assert.NotContains(t, out.String(), "ServerTasks-2")
+	assert.NotContains(t, out.String(), "ServerTasks-3")
+
+	// finding nothing isn't a failure
+	out.Reset()
+	opts.NamePattern = "Restart ?"
+	err = taskWaitCreate.WaitRun(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, "No tasks matching 'Restart ?' which started since 2024-01-31T09:50:00Z to wait for\n", out.String())
+}
+
+func TestWait_FollowChildren(t *testing.T) {
+	out := bytes.Buffer{}
+	// the parent is fetched first and then its child, and both have finished by the first poll
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy Parent", "Executing", "Success").
+		AddTask("ServerTasks-2", "Deploy Child", "Executing", "Failed")
+	// the parent and child refer to each other, which must not be followed forever
+	queuedDetails := func(taskID string, description string, queued string) *tasks.TaskDetailsResource {
+		return &tasks.TaskDetailsResource{
+			Task: testutil.NewFakeTask(taskID, description, "Executing"),
+			ActivityLogs: []*tasks.ActivityElement{{
+				ID:     taskID + "-activity",
+				Status: "Running",
+				Children: []*tasks.ActivityElement{{
+					LogElements: []*tasks.ActivityLogElement{{MessageText: "Queued " + queued}},
+				}},
+			}},
+		}
+	}
+	server.
+		AddDetails("ServerTasks-1", queuedDetails("ServerTasks-1", "Deploy Parent", "ServerTasks-2")).
+		AddDetails("ServerTasks-2", queuedDetails("ServerTasks-2", "Deploy Child", "ServerTasks-1"))
+
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1")
+	opts.GetTaskDetailsCallback = server.GetTaskDetails
+	opts.DetailWorkers = taskWaitCreate.DefaultDetailWorkers
+	opts.FollowChildren = true
+
+	err := runOnFakeClock(opts)
+	assertTaskFailedError(t, err, "One or more deployment tasks failed: ServerTasks-2\n  ServerTasks-2: Deploy Child")
+	assert.Equal(t, 2, server.Fetches("ServerTasks-1"))
+	assert.Equal(t, 2, server.Fetches("ServerTasks-2"))
+	expectedOutput := heredoc.Doc(`
+  ServerTasks-1: Deploy Parent: Executing
+  ServerTasks-2: Deploy Child: Executing
+  ServerTasks-1: Deploy Parent: Success
+  ServerTasks-2: Deploy Child: Failed
+
+  ID             NAME           STATE    DURATION  RESULT
+  ServerTasks-1  Deploy Parent  Success  -         Succeeded
+  ServerTasks-2  Deploy Child   Failed   -         Failed
+  `)
+	assert.Equal(t, expectedOutput, out.String())
+}
+
+func TestTaskFailedError(t *testing.T) {
+	err := taskWaitCreate.NewTaskFailedError([]*taskWaitCreate.TaskFailure{
+		{TaskID: "ServerTasks-1", Name: "Deploy Foo", Message: "Script returned exit code 1\nThe step failed", Duration: "40m2s"},
+		{TaskID: "ServerTasks-2", Name: "Deploy Bar", Duration: "1s"},
+		{TaskID: "ServerTasks-3", Message: "The deployment failed"},
+	})
+	err.Waited = 41*time.Minute + 12*time.Second + 300*time.Millisecond
+
+	assert.EqualError(t, err, heredoc.Doc(`
+		One or more deployment tasks failed: ServerTasks-1, ServerTasks-2, ServerTasks-3 after waiting 41m12s
+		  ServerTasks-1: Deploy Foo (failed after 40m2s): Script returned exit code 1
+		    The step failed
+		  ServerTasks-2: Deploy Bar (failed after 1s)
+		  ServerTasks-3: The deployment failed`))
+
+	// each task's failure can be picked out of the error
+	var failure *taskWaitCreate.TaskFailure
+	assert.ErrorAs(t, err, &failure)
+	assert.Equal(t, "ServerTasks-1", failure.TaskID)
+	assert.ErrorIs(t, err, taskWaitCreate.ErrTaskFailed)
+
+	// failing straight away doesn't read as taking no time at all
+	err = taskWaitCreate.NewTaskFailedError([]*taskWaitCreate.TaskFailure{{TaskID: "ServerTasks-1"}})
+	err.Waited = 250 * time.Millisecond
+	assert.EqualError(t, err, "One or more deployment tasks failed: ServerTasks-1 after waiting 250ms\n  ServerTasks-1")
+}
+
+func TestWait_FailureDetails(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer()
+	for _, id := range []string{"ServerTasks-1", "ServerTasks-2"} {
+		task := testutil.NewFakeTask(id, "Deploy "+id, "Failed")
+		task.ErrorMessage = "The deployment failed"
+		server.AddTaskStates(id, task)
+	}
+	server.AddDetails("ServerTasks-1", &tasks.TaskDetailsResource{
+		ActivityLogs: []*tasks.ActivityElement{{
+			Children: []*tasks.ActivityElement{{
+				LogElements: []*tasks.ActivityLogElement{
+					{Category: "Info", MessageText: "Running script"},
+					{Category: "Error", MessageText: "Script returned exit code 1"},
+					{Category: "Fatal", MessageText: "The step failed"},
+				},
+			}},
+		}},
+	})
+
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1", "ServerTasks-2")
+	// the server returns the tasks in a different order to the one they were asked for in, which is still the order
+	// the failures are reported in
+	opts.GetServerTasksCallback = func(taskIDs []string) ([]*tasks.Task, error) {
+		serverTasks, err := server.GetServerTasks(taskIDs)
+		slices.Reverse(serverTasks)
+		return serverTasks, err
+	}
+	// the second task's details can't be fetched, so its own error message is used instead
+	opts.GetTaskDetailsCallback = func(taskID string) (*tasks.TaskDetailsResource, error) {
+		if taskID == "ServerTasks-2" {
+			return nil, errors.New("details unavailable")
+		}
+		return server.GetTaskDetails(taskID)
+	}
+
+	err := taskWaitCreate.WaitRun(opts)
+	assertTaskFailedError(t, err, heredoc.Doc(`
+		One or more deployment tasks failed: ServerTasks-1, ServerTasks-2
+		  ServerTasks-1: Deploy ServerTasks-1: Script returned exit code 1
+		    The step failed
+		  ServerTasks-2: Deploy ServerTasks-2: The deployment failed`))
+	var taskFailedError *taskWaitCreate.TaskFailedError
+	assert.ErrorAs(t, err, &taskFailedError)
+	assert.Equal(t, []*taskWaitCreate.TaskFailure{
+		{TaskID: "ServerTasks-1", Name: "Deploy ServerTasks-1", Message: "Script returned exit code 1\nThe step failed"},
+		{TaskID: "ServerTasks-2", Name: "Deploy ServerTasks-2", Message: "The deployment failed"},
+	}, taskFailedError.Failures)
+	expectedOutput := heredoc.Doc(`
+  ServerTasks-1: Deploy ServerTasks-1: Failed
+  ServerTasks-2: Deploy ServerTasks-2: Failed
+  ServerTasks-1 failed: Script returned exit code 1
+      The step failed
+  ServerTasks-2 failed: The deployment failed
+
+  ID             NAME                  STATE   DURATION  RESULT
+  ServerTasks-1  Deploy ServerTasks-1  Failed  -         Failed
+  ServerTasks-2  Deploy ServerTasks-2  Failed  -         Failed
+  `)
+	assert.Equal(t, expectedOutput, out.String())
+}
+
+func TestWait_FailFast(t *testing.T) {
+	out := bytes.Buffer{}
+	// the first task fails while the second one keeps running
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy ServerTasks-1", "Executing", "Failed").
+		AddTask("ServerTasks-2", "Deploy ServerTasks-2", "Executing")
+
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1", "ServerTasks-2")
+	opts.FailFast = true
+
+	err := runOnFakeClock(opts)
+	assertTaskFailedError(t, err, "One or more deployment tasks failed: ServerTasks-1 (not waited for: ServerTasks-2)\n  ServerTasks-1: Deploy ServerTasks-1")
+	assert.Equal(t, 2, server.Calls())
+	var taskFailedError *taskWaitCreate.TaskFailedError
+	assert.ErrorAs(t, err, &taskFailedError)
+	assert.Equal(t, []string{"ServerTasks-2"}, taskFailedError.NotWaitedTaskIDs)
+	expectedOutput := heredoc.Doc(`
+  ServerTasks-1: Deploy ServerTasks-1: Executing
+  ServerTasks-2: Deploy ServerTasks-2: Executing
+  ServerTasks-1: Deploy ServerTasks-1: Failed
+  `)
+	assert.Equal(t, expectedOutput, out.String())
+}
+
+func TestWait_MinSuccess(t *testing.T) {
+	out := bytes.Buffer{}
+	cancelledTaskIDs := make([]string, 0)
+	// the first task succeeds and the second fails, then the third succeeds, and the fourth fails last of all
+	newOpts := func(minSuccess string) (*taskWaitCreate.WaitOptions, *testutil.FakeTaskServer) {
+		out.Reset()
+		cancelledTaskIDs = cancelledTaskIDs[:0]
+		server := testutil.NewFakeTaskServer().
+			AddTask("ServerTasks-1", "Deploy ServerTasks-1", "Executing", "Success").
+			AddTask("ServerTasks-2", "Deploy ServerTasks-2", "Executing", "Failed").
+			AddTask("ServerTasks-3", "Deploy ServerTasks-3", "Executing", "Executing", "Success").
+			AddTask("ServerTasks-4", "Deploy ServerTasks-4", "Executing", "Executing", "Executing", "Failed")
+
+		opts := newServerWaitOptions(&out, server, "ServerTasks-1", "ServerTasks-2", "ServerTasks-3", "ServerTasks-4")
+		opts.CancelTaskCallback = func(taskID string) (*tasks.Task, error) {
+			cancelledTaskIDs = append(cancelledTaskIDs, taskID)
+			return nil, nil
+		}
+		opts.MinSuccess = minSuccess
+		opts.CancelRemaining = true
+		return opts, server
+	}
+
+	// two successes are enough, so the failure and the task still running don't matter
+	opts, server := newOpts("2")
+	err := runOnFakeClock(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, server.Calls())
+	assert.Equal(t, []string{"ServerTasks-4"}, cancelledTaskIDs)
+	assert.Contains(t, out.String(), "Requested cancellation of ServerTasks-4\n")
+	assert.Contains(t, out.String(), "ServerTasks-4  Deploy ServerTasks-4  Executing  -         Running\n")
+	assert.True(t, strings.HasSuffix(out.String(), "2 of 4 task(s) succeeded, meeting --min-success 2 (2 required)\n"))
+
+	// 75% of four tasks is three, which are never going to succeed, so the wait fails once every task has finished
+	opts, server = newOpts("75%")
+	err = runOnFakeClock(opts)
+	assertTaskFailedError(t, err, "One or more deployment tasks failed: ServerTasks-2, ServerTasks-4\n  ServerTasks-2: Deploy ServerTasks-2\n  ServerTasks-4: Deploy ServerTasks-4")
+	assert.Equal(t, 4, server.Calls())
+	assert.Empty(t, cancelledTaskIDs)
+	assert.True(t, strings.HasSuffix(out.String(), "2 of 4 task(s) succeeded, short of --min-success 75% (3 required)\n"))
+}
+
+func TestWait_SuccessStates(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Canceled")
+
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1")
+	opts.Quiet = true
+	opts.SuccessStates = []string{"success", "CANCELED"}
+
+	err := taskWaitCreate.WaitRun(opts)
+	assert.NoError(t, err)
+
+	opts.SuccessStates = taskWaitCreate.DefaultSuccessStates
+	err = taskWaitCreate.WaitRun(opts)
+	assertTaskFailedError(t, err, "One or more deployment tasks failed: ServerTasks-1\n  ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo")
+	assert.Empty(t, out.String())
+}
+
+func TestWait_OutputFile(t *testing.T) {
+	out := bytes.Buffer{}
+	failed := testutil.NewFakeTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Failed")
+	failed.ErrorMessage = "Something went wrong"
+	server := testutil.NewFakeTaskServer().AddTaskStates("ServerTasks-1", failed)
+
+	outputDir := t.TempDir()
+	outputFile := filepath.Join(outputDir, "results.json")
+	// an existing file is replaced rather than appended to
+	assert.NoError(t, os.WriteFile(outputFile, []byte("stale"), 0644))
+
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1")
+	opts.Quiet = true
+	opts.OutputFile = outputFile
+
+	err := taskWaitCreate.WaitRun(opts)
+	assert.ErrorIs(t, err, taskWaitCreate.ErrTaskFailed)
+	assert.Empty(t, out.String())
+
+	data, err := os.ReadFile(outputFile)
+	assert.NoError(t, err)
+	var results []taskWaitCreate.TaskResult
+	assert.NoError(t, json.Unmarshal(data, &results))
+	assert.Equal(t, []taskWaitCreate.TaskResult{
+		{ID: "ServerTasks-1", Name: "Deploy Bar 1 release 0.0.2 to Foo", State: "Failed", FinishedSuccessfully: false, Errors: "Something went wrong"},
+	}, results)
+
+	// the temporary file has been renamed into place
+	entries, err := os.ReadDir(outputDir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestWait_TaskNotFoundInSpace(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Success")
+
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1", "ServerTasks-2", "ServerTasks-3")
+	opts.Space = spaces.NewSpace("Other Space")
+
+	err := taskWaitCreate.WaitRun(opts)
+	assert.EqualError(t, err, "server task(s) not found in space Other Space: ServerTasks-2, ServerTasks-3")
+	assert.Empty(t, out.String())
+}
+
+func TestWait_IgnoreMissing(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing", "Success")
+
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1", "ServerTasks-2", "ServerTasks-3")
+	opts.Space = spaces.NewSpace("Other Space")
+	opts.IgnoreMissing = true
+
+	err := runOnFakeClock(opts)
+	assert.NoError(t, err)
+	testutil.AssertOutputContainsLines(t, out.String(),
+		"Warning: server task(s) not found in space Other Space: ServerTasks-2, ServerTasks-3, so they won't be waited for",
+		"ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Executing",
+		"ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Success",
+		"Not found, so not waited for: ServerTasks-2, ServerTasks-3",
+	)
+
+	// with none of the tasks found there's nothing to wait for, which isn't a failure either
+	out.Reset()
+	opts.TaskIDs = []string{"ServerTasks-2"}
+	err = runOnFakeClock(opts)
+	assert.NoError(t, err)
+	testutil.AssertOutputContainsLines(t, out.String(),
+		"Warning: server task(s) not found in space Other Space: ServerTasks-2, so they won't be waited for",
+		"Not found, so not waited for: ServerTasks-2",
+	)
+}
+
+func TestWait_WarnsWhenDetailsCannotBeFetched(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing", "Executing", "Success")
+
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1")
+	opts.GetTaskDetailsCallback = func(taskID string) (*tasks.TaskDetailsResource, error) {
+		return nil, errors.New("forbidden")
+	}
+	opts.ShowProgress = true
+	opts.DetailWorkers = taskWaitCreate.DefaultDetailWorkers
+
+	err := runOnFakeClock(opts)
+	assert.NoError(t, err)
+	// the warning is only given once, however many times the details are fetched
+	assert.Equal(t, 1, strings.Count(out.String(), "Warning: failed to fetch the details of ServerTasks-1, so its progress won't be shown: forbidden\n"))
+	assert.Contains(t, out.String(), "ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Success\n")
+}
+
+func TestWaitForTasks(t *testing.T) {
+	failed := testutil.NewFakeTask("ServerTasks-1", "Deploy ServerTasks-1", "Failed")
+	failed.ErrorMessage = "Something went wrong"
+	server := testutil.NewFakeTaskServer().
+		AddTaskStates("ServerTasks-1", testutil.NewFakeTask("ServerTasks-1", "Deploy ServerTasks-1", "Executing"), failed).
+		AddTask("ServerTasks-2", "Deploy ServerTasks-2", "Success")
+
+	added := make([]string, 0)
+	completed := make([]string, 0)
+	result, err := taskWaitCreate.WaitForTasks(context.Background(), nil, []string{"ServerTasks-1", "ServerTasks-2"}, taskWaitCreate.WaitConfig{
+		PollInterval:           time.Millisecond,
+		MaxPollInterval:        time.Millisecond,
+		GetServerTasksCallback: server.GetServerTasks,
+		OnTaskAdded:            func(t *tasks.Task) { added = append(added, t.ID) },
+		OnTaskCompleted:        func(t *tasks.Task) { completed = append(completed, t.ID) },
+	})
+
+	// a failed task is part of the result rather than an error, leaving the caller to decide how to report it
+	assert.NoError(t, err)
+	assert.Equal(t, 1, server.Fetches("ServerTasks-2"))
+	assert.Equal(t, []string{"ServerTasks-1", "ServerTasks-2"}, added)
+	assert.Equal(t, []string{"ServerTasks-1"}, completed)
+	assert.Len(t, result.Tasks, 2)
+	assert.Len(t, result.CompletedTasks, 2)
+	assert.Len(t, result.FailedTasks, 1)
+	assert.Equal(t, "ServerTasks-1", result.FailedTasks[0].ID)
+	assert.Equal(t, map[string]string{"ServerTasks-1": "Something went wrong"}, result.FailureMessages)
+}
+
+// run with -race: each wait's hooks touch unsynchronised state which is read once the wait returns, so a poll
+// carrying on in the background after a timeout would be reported as a data race
+func TestWaitForTasks_ConcurrentWaits(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 1; i <= 6; i++ {
+		taskID := fmt.Sprintf("ServerTasks-%d", i)
+		// odd tasks finish after a few polls, even tasks have a poll which is still in flight when the wait times out
+		slowPoll := i%2 == 0
+		server := testutil.NewFakeTaskServer()
+		if slowPoll {
+			server.AddTask(taskID, "Deploy "+taskID, "Queued", "Success")
+		} else {
+			server.AddTask(taskID, "Deploy "+taskID, "Queued", "Executing", "Executing", "Executing", "Success")
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			polledStates := make([]string, 0)
+			result, err := taskWaitCreate.WaitForTasks(context.Background(), nil, []string{taskID}, taskWaitCreate.WaitConfig{
+				Timeout:         time.Second,
+				PollInterval:    time.Millisecond,
+				MaxPollInterval: 10 * time.Millisecond,
+				GetServerTasksCallback: func(taskIDs []string) ([]*tasks.Task, error) {
+					if slowPoll && server.Calls() > 0 {
+						time.Sleep(1500 * time.Millisecond)
+					}
+					return server.GetServerTasks(taskIDs)
+				},
+				OnTaskPolled: func(t *tasks.Task, details *tasks.TaskDetailsResource, detailsErr error) {
+					polledStates = append(polledStates, t.State)
+				},
+			})
+
+			if slowPoll {
+				// the poll which finished after the timeout doesn't count
+				assert.EqualError(t, err, fmt.Sprintf("timeout after 1s; still pending: %s (Queued)", taskID))
+				assert.Empty(t, polledStates)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, result.CompletedTasks, 1)
+			assert.Equal(t, []string{"Executing", "Executing", "Executing", "Success"}, polledStates)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestWaitForTasks_WatchUntilCancelled(t *testing.T) {
+	// a new task is queued on each of the first polls, and has finished by the next one
+	ctx, cancel := context.WithCancel(context.Background())
+	timesQueried := 0
+	queryTasksCallback := func(query tasks.TasksQuery) ([]*tasks.Task, error) {
+		timesQueried++
+		switch timesQueried {
+		case 2, 3:
+			id := fmt.Sprintf("ServerTasks-%d", timesQueried-1)
+			return []*tasks.Task{testutil.NewFakeTask(id, "Deploy "+id, "Executing")}, nil
+		case 6:
+			cancel()
+		}
+		return []*tasks.Task{}, nil
+	}
+	getServerTaskCallback := func(taskIDs []string) ([]*tasks.Task, error) {
+		return util.SliceTransform(taskIDs, func(id string) *tasks.Task { return testutil.NewFakeTask(id, "Deploy "+id, "Success") }), nil
+	}
+
+	completed := make([]string, 0)
+	result, err := taskWaitCreate.WaitForTasks(ctx, nil, nil, taskWaitCreate.WaitConfig{
+		PollInterval:           time.Millisecond,
+		MaxPollInterval:        time.Millisecond,
+		Watch:                  true,
+		GetServerTasksCallback: getServerTaskCallback,
+		QueryTasksCallback:     queryTasksCallback,
+		OnTaskCompleted:        func(t *tasks.Task) { completed = append(completed, t.ID) },
+	})
+
+	// cancelling a watch ends it like any other, with every task seen along the way
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ServerTasks-1", "ServerTasks-2"}, completed)
+	assert.Len(t, result.Tasks, 2)
+	assert.Len(t, result.CompletedTasks, 2)
+	assert.Empty(t, result.FailedTasks)
+}
+
+func TestWaitForTasks_Interruptions(t *testing.T) {
+	// the task is paused twice, the second time after the first interruption was resolved
+	states := make([]*tasks.Task, 0)
+	for _, interrupted := range []bool{false, true, true, false, true} {
+		task := testutil.NewFakeTask("ServerTasks-1", "Deploy ServerTasks-1", "Executing")
+		task.HasPendingInterruptions = interrupted
+		states = append(states, task)
+	}
+	server := testutil.NewFakeTaskServer().
+		AddTaskStates("ServerTasks-1", append(states, testutil.NewFakeTask("ServerTasks-1", "Deploy ServerTasks-1", "Success"))...)
+
+	interrupted := 0
+	result, err := taskWaitCreate.WaitForTasks(context.Background(), nil, []string{"ServerTasks-1"}, taskWaitCreate.WaitConfig{
+		PollInterval:           time.Millisecond,
+		MaxPollInterval:        time.Millisecond,
+		GetServerTasksCallback: server.GetServerTasks,
+		OnTaskInterrupted:      func(t *tasks.Task) { interrupted++ },
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, result.CompletedTasks, 1)
+	assert.Equal(t, 2, interrupted)
+}
+
+func TestWait_Notify(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the notify commands are written for sh")
+	}
+
+	newOpts := func(out io.Writer, notify string) *taskWaitCreate.WaitOptions {
+		server := testutil.NewFakeTaskServer().
+			AddTask("ServerTasks-1", "Deploy ServerTasks-1", "Success").
+			AddTask("ServerTasks-2", "Deploy ServerTasks-2", "Failed")
+		opts := newServerWaitOptions(out, server, "ServerTasks-1", "ServerTasks-2")
+		opts.Notify = notify
+		return opts
+	}
+
+	t.Run("runs the command with the outcome", func(t *testing.T) {
+		outcomeFile := filepath.Join(t.TempDir(), "outcome.txt")
+		notify := `printf '%s\n' "$OCTOPUS_WAIT_STATUS" "$OCTOPUS_WAIT_EXIT_CODE" "$OCTOPUS_WAIT_TASK_IDS" "$OCTOPUS_WAIT_FAILED_TASK_IDS" "$OCTOPUS_WAIT_PENDING_TASK_IDS" "$OCTOPUS_WAIT_DURATION_SECONDS" > ` + outcomeFile
+
+		err := taskWaitCreate.WaitRun(newOpts(&bytes.Buffer{}, notify))
+		assert.ErrorIs(t, err, taskWaitCreate.ErrTaskFailed)
+
+		outcome, readErr := os.ReadFile(outcomeFile)
+		assert.NoError(t, readErr)
+		assert.Equal(t, heredoc.Doc(`
+			failed
+			2
+			ServerTasks-1,ServerTasks-2
+			ServerTasks-2
+
+			0
+		`), string(outcome))
+	})
+
+	t.Run("a failing command doesn't change the outcome", func(t *testing.T) {
+		out := bytes.Buffer{}
+		err := taskWaitCreate.WaitRun(newOpts(&out, "exit 3"))
+
+		var taskFailedError *taskWaitCreate.TaskFailedError
+		assert.ErrorAs(t, err, &taskFailedError)
+		assert.Equal(t, taskWaitCreate.ExitCodeTaskFailed, taskFailedError.ExitCode())
+		assert.Contains(t, out.String(), "Warning: --notify command failed: exit status 3")
+	})
+}
+
+func TestWait_OutcomeHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hook commands are written for sh")
+	}
+
+	newOpts := func(out io.Writer, finalState string) *taskWaitCreate.WaitOptions {
+		server := testutil.NewFakeTaskServer().
+			AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Success").
+			AddTask("ServerTasks-2", "Deploy Bar 2 release 0.0.2 to Foo", finalState)
+		return newServerWaitOptions(out, server, "ServerTasks-1", "ServerTasks-2")
+	}
+	// each hook writes which of them ran, along with the failed tasks it was given
+	hooks := func(opts *taskWaitCreate.WaitOptions) string {
+		ranFile := filepath.Join(t.TempDir(), "ran.txt")
+		opts.OnSuccess = `printf 'success %s\n' "$OCTOPUS_WAIT_FAILED_TASK_IDS" >> ` + ranFile
+		opts.OnFailure = `printf 'failure %s\n' "$OCTOPUS_WAIT_FAILED_TASK_IDS" >> ` + ranFile
+		return ranFile
+	}
+
+	t.Run("runs only --on-success when the wait succeeds", func(t *testing.T) {
+		opts := newOpts(&bytes.Buffer{}, "Success")
+		ranFile := hooks(opts)
+		err := taskWaitCreate.WaitRun(opts)
+		assert.NoError(t, err)
+
+		ran, readErr := os.ReadFile(ranFile)
+		assert.NoError(t, readErr)
+		assert.Equal(t, "success \n", string(ran))
+	})
+
+	t.Run("runs only --on-failure with the failed tasks when the wait fails", func(t *testing.T) {
+		opts := newOpts(&bytes.Buffer{}, "Failed")
+		ranFile := hooks(opts)
+		err := taskWaitCreate.WaitRun(opts)
+		assert.ErrorIs(t, err, taskWaitCreate.ErrTaskFailed)
+
+		ran, readErr := os.ReadFile(ranFile)
+		assert.NoError(t, readErr)
+		assert.Equal(t, "failure ServerTasks-2\n", string(ran))
+	})
+
+	t.Run("a failing hook only gets a warning", func(t *testing.T) {
+		out := bytes.Buffer{}
+		opts := newOpts(&out, "Success")
+		opts.OnSuccess = "exit 3"
+		err := taskWaitCreate.WaitRun(opts)
+		assert.NoError(t, err)
+		assert.Contains(t, out.String(), "Warning: --on-success command failed: exit status 3")
+	})
+
+	t.Run("a failing --on-success command fails the wait with --hook-strict", func(t *testing.T) {
+		opts := newOpts(&bytes.Buffer{}, "Success")
+		opts.OnSuccess = "exit 3"
+		opts.HookStrict = true
+		err := taskWaitCreate.WaitRun(opts)
+		assert.EqualError(t, err, "--on-success command failed: exit status 3")
+	})
+
+	t.Run("a failing --on-failure command keeps the wait's own failure with --hook-strict", func(t *testing.T) {
+		out := bytes.Buffer{}
+		opts := newOpts(&out, "Failed")
+		opts.OnFailure = "exit 3"
+		opts.HookStrict = true
+		err := taskWaitCreate.WaitRun(opts)
+		var taskFailedError *taskWaitCreate.TaskFailedError
+		if assert.ErrorAs(t, err, &taskFailedError) {
+			assert.Equal(t, taskWaitCreate.ExitCodeTaskFailed, taskFailedError.ExitCode())
+		}
+		assert.Contains(t, out.String(), "Warning: --on-failure command failed: exit status 3")
+	})
+}
+
+func TestWait_AllWithProgressAfterTransientError(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy ServerTasks-1", "Executing", "Executing", "Success").
+		AddTask("ServerTasks-2", "Deploy ServerTasks-2", "Success").
+		AddDetails("ServerTasks-1", &tasks.TaskDetailsResource{
+			ActivityLogs: []*tasks.ActivityElement{{
+				ID:     "ServerTasks-1_step1",
+				Name:   "Step 1",
+				Status: "Success",
+				LogElements: []*tasks.ActivityLogElement{
+					{Category: "Info", MessageText: "Deploying package"},
+				},
+			}},
+		}).
+		FailCall(2, &core.APIError{StatusCode: http.StatusServiceUnavailable, ErrorMessage: "Service Unavailable"})
+
+	opts := newServerWaitOptions(&out, server)
+	opts.All = true
+	opts.GetTaskDetailsCallback = server.GetTaskDetails
+	opts.MaxRetries = 1
+	opts.DetailWorkers = taskWaitCreate.DefaultDetailWorkers
+	opts.ShowProgress = true
+	opts.NoColor = true
+
+	// only the task running when the wait starts is waited for, through the first poll failing
+	err := runOnFakeClock(opts)
+	assert.NoError(t, err)
+	assert.NotContains(t, out.String(), "ServerTasks-2")
+	assert.NotZero(t, server.DetailFetches("ServerTasks-1"))
+	testutil.AssertOutputContainsLines(t, out.String(),
+		"ServerTasks-1: Deploy ServerTasks-1: Executing",
+		"Warning: failed to check task status, retrying (attempt 1 of 1): Octopus API error: Service Unavailable []",
+		"ServerTasks-1: Deploy ServerTasks-1: Success",
+		"ServerTasks-1  Deploy ServerTasks-1  Success  -         Succeeded",
+		"Waited for 1 task(s)",
+	)
+}
+
+func TestWait_Deployments(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Success").
+		AddTask("ServerTasks-2", "Deploy Bar 2 release 0.0.2 to Foo", "Success").
+		AddTask("ServerTasks-3", "Deploy Bar 3 release 0.0.2 to Foo", "Success")
+
+	newDeployment := func(id string, taskID string) *deployments.Deployment {
+		deployment := &deployments.Deployment{TaskID: taskID}
+		deployment.ID = id
+		return deployment
+	}
+	knownDeployments := map[string]*deployments.Deployment{
+		"Deployments-11": newDeployment("Deployments-11", "ServerTasks-2"),
+		"Deployments-12": newDeployment("Deployments-12", "ServerTasks-3"),
+		"Deployments-13": newDeployment("Deployments-13", ""),
+	}
+	var requestedDeploymentIDs []string
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1", "ServerTasks-3")
+	opts.Deployments = []string{"Deployments-12", "11"}
+	opts.ResolveDeploymentsCallback = func(deploymentIDs []string) ([]*deployments.Deployment, error) {
+		requestedDeploymentIDs = deploymentIDs
+		found := make([]*deployments.Deployment, 0)
+		for _, id := range deploymentIDs {
+			if deployment, ok := knownDeployments[id]; ok {
+				found = append(found, deployment)
+			}
+		}
+		return found, nil
+	}
+
+	// the deployments' tasks are waited for along with the given task IDs, each only once
+	err := taskWaitCreate.WaitRun(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Deployments-12", "Deployments-11"}, requestedDeploymentIDs)
+	assert.Equal(t, []string{"ServerTasks-1", "ServerTasks-3", "ServerTasks-2"}, opts.TaskIDs)
+	testutil.AssertOutputContainsLines(t, out.String(),
+		"ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Success",
+		"ServerTasks-3: Deploy Bar 3 release 0.0.2 to Foo: Success",
+		"ServerTasks-2: Deploy Bar 2 release 0.0.2 to Foo: Success",
+	)
+
+	opts.TaskIDs = nil
+	opts.Deployments = []string{"Deployments-11", "Deployments-13", "Deployments-14"}
+	err = taskWaitCreate.WaitRun(opts)
+	assert.EqualError(t, err, "deployment(s) not found: Deployments-14")
+
+	opts.Deployments = []string{"Deployments-11", "Deployments-13"}
+	err = taskWaitCreate.WaitRun(opts)
+	assert.EqualError(t, err, "deployment(s) without a server task yet: Deployments-13")
+}
+
+func TestWait_PrintLinks(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing", "Success")
+	otherSpaceTask := testutil.NewFakeTask("ServerTasks-2", "Deploy Bar 2 release 0.0.2 to Foo", "Failed")
+	otherSpaceTask.SpaceID = "Spaces-2"
+	otherSpaceTask.ErrorMessage = "Something went wrong"
+	server.AddTaskStates("ServerTasks-2", otherSpaceTask)
+
+	space := spaces.NewSpace("Default")
+	space.ID = "Spaces-1"
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1", "ServerTasks-2")
+	// servers hosted under a subpath keep it in their links
+	opts.Host = "https://example.com/octopus/"
+	opts.Space = space
+	opts.PrintLinks = true
+
+	err := runOnFakeClock(opts)
+	assert.Error(t, err)
+	testutil.AssertOutputContainsLines(t, out.String(),
+		"ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Executing (https://example.com/octopus/app#/Spaces-1/tasks/ServerTasks-1)",
+		"ServerTasks-2: Deploy Bar 2 release 0.0.2 to Foo: Failed (https://example.com/octopus/app#/Spaces-2/tasks/ServerTasks-2)",
+		"ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Success (https://example.com/octopus/app#/Spaces-1/tasks/ServerTasks-1)",
+	)
+
+	// links are off by default
+	out.Reset()
+	opts.PrintLinks = false
+	server = testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Success")
+	opts.TaskIDs = []string{"ServerTasks-1"}
+	opts.GetServerTasksCallback = server.GetServerTasks
+	err = runOnFakeClock(opts)
+	assert.NoError(t, err)
+	assert.NotContains(t, out.String(), "https://")
+
+	out.Reset()
+	opts.PrintLinks = true
+	opts.OutputFormat = constants.OutputFormatJson
+	err = runOnFakeClock(opts)
+	assert.NoError(t, err)
+	var results []taskWaitCreate.TaskResult
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &results))
+	assert.Equal(t, []taskWaitCreate.TaskResult{
+		{ID: "ServerTasks-1", Name: "Deploy Bar 1 release 0.0.2 to Foo", State: "Success", FinishedSuccessfully: true, Link: "https://example.com/octopus/app#/Spaces-1/tasks/ServerTasks-1"},
+	}, results)
+}
+
+func TestWait_FormatTemplate(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing", "Success").
+		AddTask("ServerTasks-2", "Deploy Bar 2 release 0.0.2 to Foo", "Success")
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1", "ServerTasks-2")
+	opts.FormatTemplate = "{{.ID}} {{.State}}"
+	opts.Quiet = true
+
+	// with --quiet the template is all that's printed
+	err := runOnFakeClock(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, heredoc.Doc(`
+		ServerTasks-1 Success
+		ServerTasks-2 Success
+	`), out.String())
+
+	// otherwise it replaces the summary table after the progress
+	out.Reset()
+	opts.Quiet = false
+	opts.GetServerTasksCallback = testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Success").
+		AddTask("ServerTasks-2", "Deploy Bar 2 release 0.0.2 to Foo", "Success").
+		GetServerTasks
+	err = runOnFakeClock(opts)
+	assert.NoError(t, err)
+	testutil.AssertOutputLines(t, out.String(),
+		"ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Success",
+		"ServerTasks-2: Deploy Bar 2 release 0.0.2 to Foo: Success",
+		"ServerTasks-1 Success",
+		"ServerTasks-2 Success",
+	)
+
+	opts.FormatTemplate = "{{.ID"
+	err = runOnFakeClock(opts)
+	assert.ErrorContains(t, err, "invalid --format-template value {{.ID: ")
+}
+
+func TestWait_OutputFileFormat(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Success").
+		AddTask("ServerTasks-2", "Deploy Bar 2 release 0.0.2 to Foo", "Success")
+	outputFile := filepath.Join(t.TempDir(), "results.yaml")
+
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1", "ServerTasks-2")
+	opts.OutputFile = outputFile
+	opts.OutputFileFormat = "YAML"
+
+	// the console stays human readable while the file is written as yaml
+	err := taskWaitCreate.WaitRun(opts)
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Success\n")
+	data, err := os.ReadFile(outputFile)
+	assert.NoError(t, err)
+	assert.Equal(t, heredoc.Doc(`
+		- id: ServerTasks-1
+		  name: Deploy Bar 1 release 0.0.2 to Foo
+		  state: Success
+		  finishedSuccessfully: true
+		- id: ServerTasks-2
+		  name: Deploy Bar 2 release 0.0.2 to Foo
+		  state: Success
+		  finishedSuccessfully: true
+	`), string(data))
+
+	opts.OutputFileFormat = "jsonl"
+	err = taskWaitCreate.WaitRun(opts)
+	assert.NoError(t, err)
+	data, err = os.ReadFile(outputFile)
+	assert.NoError(t, err)
+	assert.Equal(t, heredoc.Doc(`
+		{"Id":"ServerTasks-1","Name":"Deploy Bar 1 release 0.0.2 to Foo","State":"Success","FinishedSuccessfully":true}
+		{"Id":"ServerTasks-2","Name":"Deploy Bar 2 release 0.0.2 to Foo","State":"Success","FinishedSuccessfully":true}
+	`), string(data))
+}
+
+func TestWait_QueuePosition(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-2", "Deploy Bar 2 release 0.0.2 to Foo", "Queued", "Executing", "Success").
+		AddTask("ServerTasks-3", "Deploy Bar 3 release 0.0.2 to Foo", "Queued", "Queued", "Success")
+	queuedBehind := map[string][]*tasks.Task{
+		"ServerTasks-2": {
+			testutil.NewFakeTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing"),
+			testutil.NewFakeTask("ServerTasks-7", "Deploy Bar 7 release 0.0.2 to Foo", "Queued"),
+		},
+	}
+	opts := newServerWaitOptions(&out, server, "ServerTasks-2", "ServerTasks-3")
+	opts.QueuedBehindCallback = func(taskID string) ([]*tasks.Task, error) {
+		if taskID == "ServerTasks-3" {
+			return nil, errors.New("not found")
+		}
+		return queuedBehind[taskID], nil
+	}
+
+	err := runOnFakeClock(opts)
+	assert.NoError(t, err)
+	testutil.AssertOutputContainsLines(t, out.String(),
+		"ServerTasks-2: Deploy Bar 2 release 0.0.2 to Foo: Queued, position 3, blocked by ServerTasks-1",
+		// a task whose place in the queue can't be found out is printed as it would be otherwise
+		"ServerTasks-3: Deploy Bar 3 release 0.0.2 to Foo: Queued",
+		"ServerTasks-2: Deploy Bar 2 release 0.0.2 to Foo: Executing",
+	)
+}
+
+func TestWait_QueuePositionOnAnOlderServer(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-2", "Deploy Bar 2 release 0.0.2 to Foo", "Queued", "Success")
+	queuedBehindCalls := 0
+	opts := newServerWaitOptions(&out, server, "ServerTasks-2")
+	opts.QueuedBehindCallback = func(taskID string) ([]*tasks.Task, error) {
+		queuedBehindCalls++
+		return nil, nil
+	}
+	opts.ServerVersionCallback = func() (string, error) {
+		return "2018.10.0", nil
+	}
+	opts.LogLevel = "debug"
+
+	// the wait carries on without the queue position, rather than failing when it can't be found out
+	err := runOnFakeClock(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, queuedBehindCalls)
+	testutil.AssertOutputContainsLines(t, out.String(),
+		"Debug: Octopus Server 2018.10.0 doesn't support the position of queued tasks, which needs 2019.1 or later, so it is left out",
+		"ServerTasks-2: Deploy Bar 2 release 0.0.2 to Foo: Queued",
+		"ServerTasks-2: Deploy Bar 2 release 0.0.2 to Foo: Success",
+	)
+	assert.Equal(t, 1, strings.Count(out.String(), "doesn't support"))
+
+	// a server whose version can't be found out is taken to support everything
+	out.Reset()
+	opts.QueuedBehindCallback = func(taskID string) ([]*tasks.Task, error) {
+		queuedBehindCalls++
+		return nil, nil
+	}
+	opts.ServerVersionCallback = func() (string, error) {
+		return "", errors.New("root document unavailable")
+	}
+	server.AddTask("ServerTasks-3", "Deploy Bar 3 release 0.0.2 to Foo", "Queued", "Success")
+	opts.TaskIDs = []string{"ServerTasks-3"}
+	err = runOnFakeClock(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, queuedBehindCalls)
+	testutil.AssertOutputContainsLines(t, out.String(),
+		"Debug: failed to find the version of the server, so it is taken to support everything: root document unavailable",
+	)
+}
+
+func TestWait_OtherSpace(t *testing.T) {
+	out := bytes.Buffer{}
+	api := testutil.NewMockHttpServer()
+	defer api.Close()
+
+	root := testutil.NewRootResource()
+	clientReceiver := testutil.GoBegin2(func() (*octopusApiClient.Client, error) {
+		return octopusApiClient.NewClient(testutil.NewMockHttpClientWithTransport(api), serverUrl, "API-XXXXXXXXXXXXXXXXXXXXXXXXXXXXX", "Spaces-1")
+	})
+	api.ExpectRequest(t, "GET", "/api/").RespondWith(root)
+	api.ExpectRequest(t, "GET", "/api/Spaces-1").RespondWith(root)
+	octopus, err := testutil.ReceivePair(clientReceiver)
+	assert.NoError(t, err)
+
+	// the task is only in the space given by --space, not in the space of the client
+	space := spaces.NewSpace("Other Space")
+	space.ID = "Spaces-2"
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-2", "Deploy Bar 2 release 0.0.2 to Foo", "Queued", "Success")
+	opts := taskWaitCreate.NewWaitOps(&cmd.Dependencies{Out: &out, Client: octopus, Space: space}, []string{"ServerTasks-2"})
+	opts.GetServerTasksCallback = server.GetServerTasks
+	opts.ServerVersionCallback = nil
+	opts.PollInterval = 1
+	opts.MaxPollInterval = 1
+	errReceiver := testutil.GoBegin(func() error { return runOnFakeClock(opts) })
+
+	executing := testutil.NewFakeTask("ServerTasks-1", "Deploy Bar 1 release 0.0.1 to Foo", "Executing")
+	api.ExpectRequest(t, "GET", "/api/Spaces-2/tasks/ServerTasks-2/queued-behind").
+		RespondWith(resources.Resources[*tasks.Task]{Items: []*tasks.Task{executing}})
+	assert.NoError(t, <-errReceiver)
+	testutil.AssertOutputContainsLines(t, out.String(),
+		"ServerTasks-2: Deploy Bar 2 release 0.0.2 to Foo: Queued, position 2, blocked by ServerTasks-1",
+		"ServerTasks-2: Deploy Bar 2 release 0.0.2 to Foo: Success",
+	)
+
+	// cancelling and rerunning the task go to its space too
+	cancelReceiver := testutil.GoBegin2(func() (*tasks.Task, error) { return opts.CancelTaskCallback("ServerTasks-2") })
+	api.ExpectRequest(t, "POST", "/api/Spaces-2/tasks/ServerTasks-2/cancel").RespondWith(executing)
+	_, err = testutil.ReceivePair(cancelReceiver)
+	assert.NoError(t, err)
+	rerunReceiver := testutil.GoBegin2(func() (*tasks.Task, error) { return opts.RerunTaskCallback("ServerTasks-2") })
+	api.ExpectRequest(t, "POST", "/api/Spaces-2/tasks/rerun/ServerTasks-2").RespondWith(executing)
+	_, err = testutil.ReceivePair(rerunReceiver)
+	assert.NoError(t, err)
+}
+
+func TestWait_MaxTasks(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer()
+	for i := 1; i <= 3; i++ {
+		server.AddTask(fmt.Sprintf("ServerTasks-%d", i), fmt.Sprintf("Deploy Bar %d release 0.0.2 to Foo", i), "Queued", "Success")
+	}
+	opts := newServerWaitOptions(&out, server)
+	opts.DetailWorkers = taskWaitCreate.DefaultDetailWorkers
+	opts.States = []string{"Queued"}
+	opts.MaxTasks = 2
+
+	err := taskWaitCreate.WaitRun(opts)
+	assert.EqualError(t, err, "3 tasks matched, more than --max-tasks 2; raise --max-tasks, or set it to 0, to wait for all of them")
+	assert.Empty(t, out.String())
+
+	// the limit applies to given task IDs as well
+	opts.States = nil
+	opts.TaskIDs = []string{"ServerTasks-1", "ServerTasks-2", "ServerTasks-3"}
+	err = taskWaitCreate.WaitRun(opts)
+	assert.EqualError(t, err, "3 tasks matched, more than --max-tasks 2; raise --max-tasks, or set it to 0, to wait for all of them")
+
+	opts.MaxTasks = 3
+	err = taskWaitCreate.WaitRun(opts)
+	assert.NoError(t, err)
+}
+
+func TestWait_ConnectionErrorHints(t *testing.T) {
+	out := bytes.Buffer{}
+	var callbackErr error
+	opts := &taskWaitCreate.WaitOptions{
+		Dependencies: &cmd.Dependencies{
+			Out: &out,
+		},
+		TaskIDs: []string{"ServerTasks-1"},
+		GetServerTasksCallback: func(taskIDs []string) ([]*tasks.Task, error) {
+			return nil, callbackErr
+		},
+		Timeout:         taskWaitCreate.DefaultTimeout,
+		PollInterval:    1,
+		MaxPollInterval: 1,
+	}
+
+	callbackErr = &url.Error{Op: "Get", URL: "https://octopus.example.com/api/Spaces-1/tasks", Err: &net.OpError{Op: "proxyconnect", Net: "tcp", Err: errors.New("connection refused")}}
+	err := taskWaitCreate.WaitRun(opts)
+	var connectionErr *taskWaitCreate.ConnectionError
+	assert.ErrorAs(t, err, &connectionErr)
+	assert.ErrorIs(t, err, callbackErr)
+	assert.Contains(t, err.Error(), "Hint: the proxy couldn't be reached or refused the connection. Check the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables")
+
+	// the go client flattens some errors to strings, which are recognised by their messages
+	callbackErr = errors.New("Get \"https://octopus.example.com/api\": tls: failed to verify certificate: x509: certificate signed by unknown authority")
+	err = taskWaitCreate.WaitRun(opts)
+	assert.Contains(t, err.Error(), "Hint: the TLS connection to the Octopus server failed.")
+
+	callbackErr = &net.DNSError{Err: "no such host", Name: "octopus.example.com"}
+	err = taskWaitCreate.WaitRun(opts)
+	assert.Contains(t, err.Error(), "Hint: the server's host name couldn't be resolved. Check OCTOPUS_URL")
+
+	// errors which aren't about reaching the server are left as they are
+	callbackErr = errors.New("Unauthorized")
+	err = taskWaitCreate.WaitRun(opts)
+	assert.EqualError(t, err, "Unauthorized")
+
+	// a malformed proxy doesn't stop the wait by itself, as it may not even be used
+	t.Setenv("HTTPS_PROXY", "http://proxy example.com")
+	err = taskWaitCreate.WaitRun(opts)
+	assert.EqualError(t, err, "Unauthorized")
+
+	// but when it fails a call, the hint says which variable it came from
+	callbackErr = &url.Error{Op: "Get", URL: "https://octopus.example.com/api/Spaces-1/tasks", Err: errors.New(`invalid proxy address "http://proxy example.com": parse "http://proxy example.com": invalid character " " in host name`)}
+	err = taskWaitCreate.WaitRun(opts)
+	assert.ErrorAs(t, err, &connectionErr)
+	assert.Contains(t, err.Error(), "Hint: the HTTPS_PROXY environment variable http://proxy example.com isn't a valid proxy URL")
+}
+
+func TestWaitForTasks_Heartbeat(t *testing.T) {
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing", "Executing", "Success")
+
+	heartbeats := 0
+	result, err := taskWaitCreate.WaitForTasks(context.Background(), nil, []string{"ServerTasks-1"}, taskWaitCreate.WaitConfig{
+		PollInterval:           200 * time.Millisecond,
+		MaxPollInterval:        200 * time.Millisecond,
+		GetServerTasksCallback: server.GetServerTasks,
+		HeartbeatInterval:      30 * time.Millisecond,
+		OnHeartbeat: func(pendingTaskIDs []string) {
+			assert.Equal(t, []string{"ServerTasks-1"}, pendingTaskIDs)
+			heartbeats++
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, result.CompletedTasks, 1)
+	// heartbeats keep coming between polls, without polling any more often
+	assert.Equal(t, 3, server.Calls())
+	assert.GreaterOrEqual(t, heartbeats, 6)
+}
+
+func TestWait_RetryOnFailure(t *testing.T) {
+	flakyFailure := func(id string) *tasks.Task {
+		task := testutil.NewFakeTask(id, "Deploy Bar 1 release 0.0.2 to Foo", "Failed")
+		task.ErrorMessage = "The remote server returned an error: connection reset by peer"
+		return task
+	}
+	newServer := func() *testutil.FakeTaskServer {
+		return testutil.NewFakeTaskServer().
+			AddTaskStates("ServerTasks-1", testutil.NewFakeTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing"), flakyFailure("ServerTasks-1")).
+			AddTaskStates("ServerTasks-11", testutil.NewFakeTask("ServerTasks-11", "Deploy Bar 1 release 0.0.2 to Foo", "Executing"), flakyFailure("ServerTasks-11")).
+			AddTask("ServerTasks-12", "Deploy Bar 1 release 0.0.2 to Foo", "Executing", "Success")
+	}
+	newOpts := func(out *bytes.Buffer, server *testutil.FakeTaskServer, reruns *[]string) *taskWaitCreate.WaitOptions {
+		rerunIDs := map[string]string{"ServerTasks-1": "ServerTasks-11", "ServerTasks-11": "ServerTasks-12"}
+		opts := newServerWaitOptions(out, server, "ServerTasks-1")
+		opts.RerunTaskCallback = func(taskID string) (*tasks.Task, error) {
+			*reruns = append(*reruns, taskID)
+			return testutil.NewFakeTask(rerunIDs[taskID], "Deploy Bar 1 release 0.0.2 to Foo", "Queued"), nil
+		}
+		opts.RetryOnFailure = 2
+		opts.RetryIf = "connection reset"
+		return opts
+	}
+
+	t.Run("reruns a matching failure until it succeeds", func(t *testing.T) {
+		out := bytes.Buffer{}
+		reruns := make([]string, 0)
+		opts := newOpts(&out, newServer(), &reruns)
+
+		err := runOnFakeClock(opts)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"ServerTasks-1", "ServerTasks-11"}, reruns)
+		testutil.AssertOutputContainsLines(t, out.String(),
+			"ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Failed",
+			"ServerTasks-1 failed, rerunning it as ServerTasks-11 (attempt 2 of 3)",
+			"ServerTasks-11: Deploy Bar 1 release 0.0.2 to Foo: Failed",
+			"ServerTasks-11 failed, rerunning it as ServerTasks-12 (attempt 3 of 3)",
+			"ServerTasks-12: Deploy Bar 1 release 0.0.2 to Foo: Success",
+			"ServerTasks-12 is attempt 3, rerunning ServerTasks-1, ServerTasks-11",
+		)
+	})
+
+	t.Run("reports the attempts in structured output", func(t *testing.T) {
+		out := bytes.Buffer{}
+		reruns := make([]string, 0)
+		opts := newOpts(&out, newServer(), &reruns)
+		opts.OutputFormat = constants.OutputFormatJson
+
+		err := runOnFakeClock(opts)
+		assert.NoError(t, err)
+		var results []*taskWaitCreate.TaskResult
+		assert.NoError(t, json.Unmarshal(out.Bytes(), &results))
+		if assert.Len(t, results, 1) {
+			assert.Equal(t, "ServerTasks-12", results[0].ID)
+			assert.Equal(t, 3, results[0].Attempts)
+			assert.Equal(t, []string{"ServerTasks-1", "ServerTasks-11"}, results[0].RetriedTaskIDs)
+		}
+	})
+
+	t.Run("stops once the retries run out", func(t *testing.T) {
+		out := bytes.Buffer{}
+		reruns := make([]string, 0)
+		opts := newOpts(&out, newServer(), &reruns)
+		opts.RetryOnFailure = 1
+
+		err := runOnFakeClock(opts)
+		var failedErr *taskWaitCreate.TaskFailedError
+		assert.ErrorAs(t, err, &failedErr)
+		assert.Equal(t, []string{"ServerTasks-1"}, reruns)
+		testutil.AssertOutputContainsLines(t, out.String(),
+			"ServerTasks-1 failed, rerunning it as ServerTasks-11 (attempt 2 of 2)",
+			"ServerTasks-11: Deploy Bar 1 release 0.0.2 to Foo: Failed",
+		)
+	})
+
+	t.Run("leaves failures not matching --retry-if alone", func(t *testing.T) {
+		out := bytes.Buffer{}
+		reruns := make([]string, 0)
+		opts := newOpts(&out, newServer(), &reruns)
+		opts.RetryIf = "(?i)timed out"
+
+		err := runOnFakeClock(opts)
+		assert.Error(t, err)
+		assert.Empty(t, reruns)
+	})
+
+	t.Run("validates the flags", func(t *testing.T) {
+		reruns := make([]string, 0)
+		opts := newOpts(&bytes.Buffer{}, newServer(), &reruns)
+		opts.RetryOnFailure = -1
+		assert.EqualError(t, runOnFakeClock(opts), "--retry-on-failure must not be negative")
+
+		opts.RetryOnFailure = 0
+		assert.EqualError(t, runOnFakeClock(opts), "--retry-if can only be used with --retry-on-failure")
+
+		opts.RetryOnFailure = 1
+		opts.RetryIf = "("
+		assert.ErrorContains(t, runOnFakeClock(opts), "invalid --retry-if value (")
+		assert.Empty(t, reruns)
+	})
+}
+
+func TestWait_Dashboard(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing", "Success").
+		AddTask("ServerTasks-2", "Deploy Bar 2 release 0.0.2 to Foo", "Queued", "Executing", "Success")
+
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1", "ServerTasks-2")
+	opts.GetTaskDetailsCallback = server.GetTaskDetails
+	opts.DetailWorkers = 1
+	opts.ShowProgress = true
+	opts.Dashboard = true
+
+	// output which isn't a terminal can't be redrawn in place, so it gets the usual lines
+	err := runOnFakeClock(opts)
+	assert.NoError(t, err)
+	testutil.AssertOutputContainsLines(t, out.String(),
+		"ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Executing",
+		"ServerTasks-2: Deploy Bar 2 release 0.0.2 to Foo: Queued",
+		"ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Success",
+		"ServerTasks-2: Deploy Bar 2 release 0.0.2 to Foo: Success",
+	)
+	assert.NotContains(t, out.String(), "\033[")
+}
+
+func TestWait_Warnings(t *testing.T) {
+	warned := testutil.NewFakeTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Success")
+	warned.HasWarningsOrErrors = true
+	newServer := func() *testutil.FakeTaskServer {
+		return testutil.NewFakeTaskServer().
+			AddTaskStates("ServerTasks-1", testutil.NewFakeTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing"), warned).
+			AddTask("ServerTasks-2", "Deploy Bar 2 release 0.0.2 to Foo", "Executing", "Success").
+			AddDetails("ServerTasks-1", &tasks.TaskDetailsResource{
+				ActivityLogs: []*tasks.ActivityElement{{
+					Children: []*tasks.ActivityElement{{
+						Name:   "Step 1: Deploy package",
+						Status: "SuccessWithWarning",
+						LogElements: []*tasks.ActivityLogElement{
+							{Category: "Info", MessageText: "Deploying package"},
+							{Category: "Warning", MessageText: "Package Bar 1 is deprecated"},
+							{Category: "Warning", MessageText: "Disk space is low"},
+						},
+					}},
+				}},
+			})
+	}
+	newOpts := func(out *bytes.Buffer, server *testutil.FakeTaskServer) *taskWaitCreate.WaitOptions {
+		opts := newServerWaitOptions(out, server, "ServerTasks-1", "ServerTasks-2")
+		opts.GetTaskDetailsCallback = server.GetTaskDetails
+		opts.DetailWorkers = 1
+		return opts
+	}
+
+	t.Run("reports the warnings of a task which succeeded", func(t *testing.T) {
+		out := bytes.Buffer{}
+		server := newServer()
+		err := runOnFakeClock(newOpts(&out, server))
+		assert.NoError(t, err)
+		testutil.AssertOutputContainsLines(t, out.String(),
+			"ServerTasks-1 succeeded with 2 warning(s):",
+			"    Package Bar 1 is deprecated",
+			"    Disk space is low",
+		)
+		assert.Regexp(t, `ServerTasks-1 .* Succeeded with 2 warning\(s\)`, out.String())
+		// only the task which the server says logged warnings has its details fetched for them
+		assert.Equal(t, 0, server.DetailFetches("ServerTasks-2"))
+	})
+
+	t.Run("includes the warning counts in structured output", func(t *testing.T) {
+		out := bytes.Buffer{}
+		opts := newOpts(&out, newServer())
+		opts.OutputFormat = constants.OutputFormatJson
+		err := runOnFakeClock(opts)
+		assert.NoError(t, err)
+		var results []*taskWaitCreate.TaskResult
+		assert.NoError(t, json.Unmarshal(out.Bytes(), &results))
+		if assert.Len(t, results, 2) {
+			assert.Equal(t, 2, results[0].Warnings)
+			assert.Equal(t, 0, results[1].Warnings)
+		}
+	})
+
+	t.Run("fails the wait with --fail-on-warning", func(t *testing.T) {
+		out := bytes.Buffer{}
+		opts := newOpts(&out, newServer())
+		opts.FailOnWarning = true
+		err := runOnFakeClock(opts)
+		var failedErr *taskWaitCreate.TaskFailedError
+		if assert.ErrorAs(t, err, &failedErr) && assert.Len(t, failedErr.Failures, 1) {
+			assert.Equal(t, "ServerTasks-1", failedErr.Failures[0].TaskID)
+		}
+		testutil.AssertOutputContainsLines(t, out.String(),
+			"ServerTasks-1 failed: 2 warning(s) with --fail-on-warning:",
+			"    Package Bar 1 is deprecated",
+		)
+	})
+}
+
+func TestWait_StrictHealth(t *testing.T) {
+	newServer := func() *testutil.FakeTaskServer {
+		check := testutil.NewFakeTask("ServerTasks-1", "Check deployment target health", "Success")
+		check.Name = "Health"
+		check.HasWarningsOrErrors = true
+		deployment := testutil.NewFakeTask("ServerTasks-2", "Deploy Bar 2 release 0.0.2 to Foo", "Success")
+		deployment.HasWarningsOrErrors = true
+		return testutil.NewFakeTaskServer().
+			AddTaskStates("ServerTasks-1", check).
+			AddTaskStates("ServerTasks-2", deployment).
+			AddDetails("ServerTasks-1", &tasks.TaskDetailsResource{
+				ActivityLogs: []*tasks.ActivityElement{{
+					Name: "Check deployment target health",
+					Children: []*tasks.ActivityElement{{
+						Name: "Check Production",
+						Children: []*tasks.ActivityElement{
+							{Name: "web01", Status: "Success"},
+							{Name: "web02", Status: "Failed"},
+							{Name: "web03", Status: "SuccessWithWarning"},
+						},
+					}},
+				}},
+			}).
+			AddDetails("ServerTasks-2", &tasks.TaskDetailsResource{
+				ActivityLogs: []*tasks.ActivityElement{{
+					Children: []*tasks.ActivityElement{{Name: "Step 1: Deploy package", Status: "SuccessWithWarning"}},
+				}},
+			})
+	}
+	newOpts := func(out *bytes.Buffer, server *testutil.FakeTaskServer) *taskWaitCreate.WaitOptions {
+		opts := newServerWaitOptions(out, server, "ServerTasks-1", "ServerTasks-2")
+		opts.GetTaskDetailsCallback = server.GetTaskDetails
+		opts.DetailWorkers = 1
+		return opts
+	}
+
+	t.Run("lets a partly healthy check pass by default", func(t *testing.T) {
+		out := bytes.Buffer{}
+		err := taskWaitCreate.WaitRun(newOpts(&out, newServer()))
+		assert.NoError(t, err)
+	})
+
+	t.Run("fails a partly healthy check with --strict-health", func(t *testing.T) {
+		out := bytes.Buffer{}
+		opts := newOpts(&out, newServer())
+		opts.StrictHealth = true
+		err := taskWaitCreate.WaitRun(opts)
+		var failedErr *taskWaitCreate.TaskFailedError
+		// only the health check fails, however the deployment's steps went
+		if assert.ErrorAs(t, err, &failedErr) && assert.Len(t, failedErr.Failures, 1) {
+			assert.Equal(t, "ServerTasks-1", failedErr.Failures[0].TaskID)
+			assert.Equal(t, "2 unhealthy deployment target(s): web02, web03", failedErr.Failures[0].Message)
+		}
+		testutil.AssertOutputContainsLines(t, out.String(), "ServerTasks-1 failed: 2 unhealthy deployment target(s): web02, web03")
+	})
+}
+
+func TestWait_PrintQueueWait(t *testing.T) {
+	queueTime := time.Date(2024, 1, 31, 18, 0, 0, 0, time.UTC)
+	startTime := queueTime.Add(90 * time.Second)
+	completedTime := startTime.Add(5 * time.Minute)
+	newServer := func() *testutil.FakeTaskServer {
+		queued := testutil.NewFakeTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Queued")
+		queued.QueueTime = &queueTime
+		finished := testutil.NewFakeTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Success")
+		finished.QueueTime, finished.StartTime, finished.CompletedTime = &queueTime, &startTime, &completedTime
+		// the server doesn't say when ServerTasks-2 was queued, so only what was seen while waiting can be reported
+		return testutil.NewFakeTaskServer().
+			AddTaskStates("ServerTasks-1", queued, finished).
+			AddTask("ServerTasks-2", "Deploy Bar 2 release 0.0.2 to Foo", "Queued", "Queued", "Success")
+	}
+	newOpts := func(out *bytes.Buffer, server *testutil.FakeTaskServer) *taskWaitCreate.WaitOptions {
+		opts := newServerWaitOptions(out, server, "ServerTasks-1", "ServerTasks-2")
+		opts.PrintQueueWait = true
+		return opts
+	}
+
+	t.Run("prints how long each task was queued and executing", func(t *testing.T) {
+		out := bytes.Buffer{}
+		err := runOnFakeClock(newOpts(&out, newServer()))
+		assert.NoError(t, err)
+		assert.Regexp(t, `ID\s+QUEUED\s+EXECUTING\n`, out.String())
+		assert.Regexp(t, `ServerTasks-1\s+1m30s\s+5m0s\n`, out.String())
+		// ServerTasks-2 was queued for the two polls it took to finish, and never seen executing
+		assert.Regexp(t, `ServerTasks-2\s+[0-9.]+m?s\*\s+0s\*\n`, out.String())
+		assert.Contains(t, out.String(), "* observed while waiting, so only counted from when the wait began\n")
+	})
+
+	t.Run("includes them in structured output", func(t *testing.T) {
+		out := bytes.Buffer{}
+		opts := newOpts(&out, newServer())
+		opts.OutputFormat = constants.OutputFormatJson
+		err := runOnFakeClock(opts)
+		assert.NoError(t, err)
+		var results []*taskWaitCreate.TaskResult
+		assert.NoError(t, json.Unmarshal(out.Bytes(), &results))
+		if assert.Len(t, results, 2) {
+			assert.Equal(t, "1m30s", results[0].QueuedFor)
+			assert.Equal(t, "5m0s", results[0].ExecutingFor)
+			assert.False(t, results[0].QueueWaitObserved)
+			assert.Equal(t, "0s", results[1].ExecutingFor)
+			assert.True(t, results[1].QueueWaitObserved)
+		}
+	})
+}
+
+func TestWait_FakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 31, 18, 0, 0, 0, time.UTC)
+
+	t.Run("times out an hour long wait without waiting an hour", func(t *testing.T) {
+		out := bytes.Buffer{}
+		clock := testutil.NewFakeClock(start)
+		server := testutil.NewFakeTaskServer().AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing")
+		opts := newServerWaitOptions(&out, server, "ServerTasks-1")
+		opts.Timeout = 3600
+		opts.PollInterval = 60
+		opts.MaxPollInterval = 60
+		opts.Clock = clock
+
+		// the wait is idle while both the timeout and the next poll are waiting to go off
+		stop := clock.AdvanceWhenWaiting(2)
+		defer stop()
+		started := time.Now()
+		err := taskWaitCreate.WaitRun(opts)
+
+		var timeoutErr *taskWaitCreate.WaitTimeoutError
+		assert.ErrorAs(t, err, &timeoutErr)
+		assert.Equal(t, start.Add(time.Hour), clock.Now())
+		assert.Less(t, time.Since(started), 10*time.Second)
+	})
+
+	t.Run("backs off between polls up to the longest poll interval", func(t *testing.T) {
+		out := bytes.Buffer{}
+		clock := testutil.NewFakeClock(start)
+		server := testutil.NewFakeTaskServer().
+			AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing", "Executing", "Executing", "Executing", "Executing", "Executing", "Executing", "Success")
+		polls := make([]time.Time, 0)
+		opts := newServerWaitOptions(&out, server, "ServerTasks-1")
+		opts.GetServerTasksCallback = func(taskIDs []string) ([]*tasks.Task, error) {
+			polls = append(polls, clock.Now())
+			return server.GetServerTasks(taskIDs)
+		}
+		opts.Timeout = 3600
+		opts.PollInterval = 10
+		opts.MaxPollInterval = 30
+		opts.Clock = clock
+
+		stop := clock.AdvanceWhenWaiting(2)
+		defer stop()
+		err := taskWaitCreate.WaitRun(opts)
+		assert.NoError(t, err)
+
+		// the first fetch is when the wait starts, and each poll after it comes later than the one before, give or
+		// take the jitter, until they're the longest poll interval apart
+		if assert.Len(t, polls, 8) {
+			assert.Equal(t, start, polls[0])
+			gaps := make([]time.Duration, 0, len(polls)-1)
+			for i := 1; i < len(polls); i++ {
+				gaps = append(gaps, polls[i].Sub(polls[i-1]))
+			}
+			assert.InDelta(t, 10*time.Second, gaps[0], float64(2*time.Second))
+			for _, gap := range gaps[3:] {
+				assert.InDelta(t, 30*time.Second, gap, float64(6*time.Second))
+			}
+		}
+	})
+}
+
+func TestWait_VerifyURL(t *testing.T) {
+	healthy := true
+	verifyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer verifyServer.Close()
+
+	newOpts := func(out *bytes.Buffer) *taskWaitCreate.WaitOptions {
+		server := testutil.NewFakeTaskServer().
+			AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing", "Success")
+		opts := newServerWaitOptions(out, server, "ServerTasks-1")
+		opts.GetTaskDetailsCallback = server.GetTaskDetails
+		opts.DetailWorkers = 1
+		opts.VerifyURL = verifyServer.URL + "/health"
+		opts.VerifyTimeout = 1
+		opts.VerifyInterval = 1
+		return opts
+	}
+
+	// the clock is moved on by hand, as the timeout of the wait is still waiting to go off while the URL is verified
+	start := time.Date(2024, 1, 31, 18, 0, 0, 0, time.UTC)
+
+	t.Run("succeeds once the URL responds", func(t *testing.T) {
+		out := bytes.Buffer{}
+		clock := testutil.NewFakeClock(start)
+		opts := newOpts(&out)
+		opts.Clock = clock
+		// the task succeeds at the first poll
+		go func() {
+			clock.BlockUntilTimers(2)
+			clock.AdvanceToNextTimer()
+		}()
+
+		err := taskWaitCreate.WaitRun(opts)
+		assert.NoError(t, err)
+		testutil.AssertOutputContainsLines(t, out.String(),
+			"ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Success",
+			"Verifying "+verifyServer.URL+"/health",
+			"Verified "+verifyServer.URL+"/health: 200 OK after 1 attempt(s)",
+		)
+	})
+
+	t.Run("fails the wait when the URL doesn't respond with 2xx even though the task succeeded", func(t *testing.T) {
+		healthy = false
+		defer func() { healthy = true }()
+		out := bytes.Buffer{}
+		clock := testutil.NewFakeClock(start)
+		opts := newOpts(&out)
+		opts.OutputFormat = taskWaitCreate.OutputFormatJsonl
+		opts.Clock = clock
+		go func() {
+			clock.BlockUntilTimers(2)
+			clock.AdvanceToNextTimer()
+			// then the first attempt is turned away, and --verify-timeout runs out before the next
+			clock.BlockUntilTimers(3)
+			clock.Advance(time.Second)
+		}()
+
+		err := taskWaitCreate.WaitRun(opts)
+		assert.ErrorIs(t, err, taskWaitCreate.ErrVerifyFailed)
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		var summary taskWaitCreate.TaskSummaryEvent
+		assert.NoError(t, json.Unmarshal([]byte(lines[len(lines)-1]), &summary))
+		assert.False(t, summary.Succeeded)
+		if assert.Len(t, summary.Tasks, 1) {
+			assert.True(t, summary.Tasks[0].FinishedSuccessfully)
+		}
+		if assert.NotNil(t, summary.Verification) {
+			assert.False(t, summary.Verification.Succeeded)
+			assert.Equal(t, http.StatusServiceUnavailable, summary.Verification.StatusCode)
+		}
+	})
+}
+
+func TestWait_ExitCodeOnly(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing", "Failed")
+	outputFile := filepath.Join(t.TempDir(), "results.json")
+
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1")
+	opts.OutputFile = outputFile
+	opts.ExitCodeOnly = true
+
+	// nothing is printed, but the exit code and the output file still say how the wait went
+	err := runOnFakeClock(opts)
+	var exitCodeErr cliErrors.ExitCodeError
+	if assert.ErrorAs(t, err, &exitCodeErr) {
+		assert.Equal(t, taskWaitCreate.ExitCodeTaskFailed, exitCodeErr.ExitCode())
+	}
+	assert.Empty(t, out.String())
+	data, err := os.ReadFile(outputFile)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"State": "Failed"`)
+
+	opts.OutputFormat = constants.OutputFormatJson
+	assert.EqualError(t, runOnFakeClock(opts), "--exit-code-only cannot be used with --output-format json; use --output-file to keep the results")
+
+	opts.OutputFormat = constants.OutputFormatTable
+	opts.ShowProgress = true
+	assert.EqualError(t, runOnFakeClock(opts), "--exit-code-only cannot be used with --progress")
+}
+
+func TestWait_StatusRequest(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing", "Executing", "Success").
+		AddTask("ServerTasks-2", "Deploy Bar 2 release 0.0.2 to Foo", "Success")
+
+	// the request is already waiting when the wait starts, so it is answered before the first poll
+	statusRequests := make(chan os.Signal, 1)
+	statusRequests <- os.Interrupt
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1", "ServerTasks-2")
+	opts.StatusRequests = statusRequests
+
+	err := runOnFakeClock(opts)
+	assert.NoError(t, err)
+	// only the task still pending is listed
+	assert.Regexp(t, `Waiting for 1 task\(s\) \(elapsed \d\d:\d\d:\d\d\)\nID +NAME +STATE +ELAPSED\nServerTasks-1 +Deploy Bar 1 release 0\.0\.2 to Foo +Executing +\d\d:\d\d:\d\d\n`, out.String())
+	assert.Less(t, strings.Index(out.String(), "Waiting for 1 task(s)"), strings.Index(out.String(), "ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Success"))
+}
+
+func TestWait_SelectLatest(t *testing.T) {
+	out := bytes.Buffer{}
+	started := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-2", "Deploy Bar 1 release 0.0.3 to Foo", "Executing", "Success")
+	previous := testutil.NewFakeTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Success")
+	previousStarted := started.Add(-time.Hour)
+	previous.StartTime = &previousStarted
+	latest := testutil.NewFakeTask("ServerTasks-2", "Deploy Bar 1 release 0.0.3 to Foo", "Executing")
+	latest.StartTime = &started
+
+	latestTasks := []*tasks.Task{latest, previous}
+	opts := newServerWaitOptions(&out, server)
+	opts.ResolveProjectCallback = func(project string) (string, error) {
+		assert.Equal(t, "MyProject", project)
+		return "Projects-1", nil
+	}
+	opts.LatestTasksCallback = func(projectID string) ([]*tasks.Task, error) {
+		assert.Equal(t, "Projects-1", projectID)
+		return latestTasks, nil
+	}
+	opts.Project = "MyProject"
+	opts.SelectLatest = true
+
+	err := runOnFakeClock(opts)
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "ServerTasks-2: Deploy Bar 1 release 0.0.3 to Foo: Success")
+	assert.NotContains(t, out.String(), "ServerTasks-1")
+
+	// the wait goes on to wait for the task it selected, as if it had been given
+	assert.Equal(t, []string{"ServerTasks-2"}, opts.TaskIDs)
+	opts.TaskIDs = nil
+	latestTasks = []*tasks.Task{}
+	assert.EqualError(t, runOnFakeClock(opts), "no tasks found for project MyProject, so there is no latest task to wait for")
+
+	opts.TaskIDs = []string{"ServerTasks-1"}
+	assert.EqualError(t, runOnFakeClock(opts), "--select-latest cannot be used with task IDs, --all, --state or --watch")
+
+	opts.TaskIDs = nil
+	opts.Project = ""
+	assert.EqualError(t, runOnFakeClock(opts), "--select-latest can only be used with --project")
+}
+
+func TestWait_ShowStep(t *testing.T) {
+	out := bytes.Buffer{}
+	steps := func(statuses ...string) *tasks.TaskDetailsResource {
+		return &tasks.TaskDetailsResource{ActivityLogs: []*tasks.ActivityElement{{
+			Name: "Deploy",
+			Children: []*tasks.ActivityElement{
+				{Name: "Step 1: Acquire packages", Status: statuses[0]},
+				{Name: "Step 2: Deploy to Production", Status: statuses[1]},
+			},
+		}}}
+	}
+	// the second poll finds the task on the same step, so it isn't printed again
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing", "Executing", "Executing", "Executing", "Success").
+		AddDetails("ServerTasks-1",
+			steps("Running", "Pending"),
+			steps("Running", "Pending"),
+			steps("Success", "Running"),
+			steps("Success", "Success"))
+
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1")
+	opts.GetTaskDetailsCallback = server.GetTaskDetails
+	opts.DetailWorkers = 1
+	opts.ShowStep = true
+
+	err := runOnFakeClock(opts)
+	assert.NoError(t, err)
+	expectedOutput := heredoc.Doc(`
+		ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Executing
+		ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Executing: Acquire packages (step 1/2)
+		ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Executing: Deploy to Production (step 2/2)
+		ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo: Success
+	`)
+	assert.True(t, strings.HasPrefix(out.String(), expectedOutput), out.String())
+
+	opts.ShowProgress = true
+	assert.EqualError(t, runOnFakeClock(opts), "--show-step cannot be used with --progress")
+
+	opts.ShowProgress = false
+	opts.Quiet = true
+	assert.EqualError(t, runOnFakeClock(opts), "--show-step cannot be used with --quiet")
+}
+
+func TestWait_StateFile(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing", "Success").
+		AddTask("ServerTasks-2", "Deploy Bar 2 release 0.0.2 to Foo", "Executing")
+
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1", "ServerTasks-2")
+	opts.Timeout = 2
+	opts.StateFile = stateFile
+
+	// the wait is stopped before the second task finishes, leaving just that one in the file
+	err := runOnFakeClock(opts)
+	assert.ErrorIs(t, err, taskWaitCreate.ErrWaitTimeout)
+	state, err := taskWaitCreate.ReadWaitState(stateFile)
+	assert.NoError(t, err)
+	assert.Equal(t, []*taskWaitCreate.WaitStateTask{{ID: "ServerTasks-2", State: "Executing"}}, state.Tasks)
+
+	// by the time the wait is resumed, another task in the file has been removed by retention
+	state.Tasks = append(state.Tasks, &taskWaitCreate.WaitStateTask{ID: "ServerTasks-3", State: "Queued"})
+	data, err := json.Marshal(state)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(stateFile, data, 0644))
+
+	out.Reset()
+	server = testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-2", "Deploy Bar 2 release 0.0.2 to Foo", "Executing", "Success")
+	opts = newServerWaitOptions(&out, server)
+	opts.ResumeFromFile = stateFile
+	err = runOnFakeClock(opts)
+	assert.NoError(t, err)
+	testutil.AssertOutputContainsLines(t, out.String(),
+		"Warning: server task(s) not found: ServerTasks-3, so they won't be waited for",
+		"ServerTasks-2: Deploy Bar 2 release 0.0.2 to Foo: Executing",
+		"ServerTasks-2: Deploy Bar 2 release 0.0.2 to Foo: Success",
+	)
+	assert.NotContains(t, out.String(), "ServerTasks-1")
+	// the resumed wait keeps the same file up to date, so once everything has finished there's nothing left in it
+	state, err = taskWaitCreate.ReadWaitState(stateFile)
+	assert.NoError(t, err)
+	assert.Empty(t, state.Tasks)
+
+	out.Reset()
+	opts.TaskIDs = nil
+	assert.NoError(t, runOnFakeClock(opts))
+	assert.Equal(t, "No tasks were still pending in "+stateFile+", so there is nothing to wait for\n", out.String())
+
+	opts.TaskIDs = []string{"ServerTasks-1"}
+	assert.EqualError(t, runOnFakeClock(opts), "--resume-from-file cannot be used with task IDs, --deployment, --all, --state, --watch, --select-latest or --since")
+}
+
+func TestWait_ShowContext(t *testing.T) {
+	newServer := func() *testutil.FakeTaskServer {
+		return testutil.NewFakeTaskServer().
+			AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing", "Success").
+			AddTask("ServerTasks-2", "Run Restart on Foo", "Executing", "Success").
+			AddTask("ServerTasks-3", "Check deployment target health", "Executing", "Success")
+	}
+	var resolved atomic.Int32
+	resolveTaskContext := func(task *tasks.Task) (*taskWaitCreate.TaskContext, error) {
+		resolved.Add(1)
+		switch task.ID {
+		case "ServerTasks-1":
+			return &taskWaitCreate.TaskContext{Project: "Bar 1", Environment: "Foo", Release: "0.0.2"}, nil
+		case "ServerTasks-2":
+			return nil, errors.New("the runbook run was not found")
+		default:
+			// such as a system task, which doesn't deploy or run anything in a project
+			return nil, nil
+		}
+	}
+	newOpts := func(out *bytes.Buffer, server *testutil.FakeTaskServer) *taskWaitCreate.WaitOptions {
+		resolved.Store(0)
+		opts := newServerWaitOptions(out, server, "ServerTasks-1", "ServerTasks-2", "ServerTasks-3")
+		opts.ResolveTaskContextCallback = resolveTaskContext
+		opts.ShowContext = true
+		return opts
+	}
+
+	t.Run("shows the context of each task, looking it up once", func(t *testing.T) {
+		out := bytes.Buffer{}
+		err := runOnFakeClock(newOpts(&out, newServer()))
+		assert.NoError(t, err)
+		assert.Contains(t, out.String(), "ServerTasks-1: Deploy Bar 1 release 0.0.2 to Foo [Bar 1, Foo, release 0.0.2]: Executing\n")
+		assert.Contains(t, out.String(), "ServerTasks-2: Run Restart on Foo: Executing\n")
+		assert.Contains(t, out.String(), "ServerTasks-3: Check deployment target health: Executing\n")
+		assert.Regexp(t, `RESULT\s+CONTEXT\n`, out.String())
+		assert.Regexp(t, `ServerTasks-1\s+Deploy Bar 1 release 0.0.2 to Foo\s+Success\s+.*Succeeded\s+Bar 1, Foo, release 0.0.2\n`, out.String())
+		assert.Regexp(t, `ServerTasks-3\s+Check deployment target health\s+Success\s+.*Succeeded\s+-\n`, out.String())
+		assert.Equal(t, int32(3), resolved.Load())
+	})
+
+	t.Run("includes it in structured output, leaving it out for tasks without one", func(t *testing.T) {
+		out := bytes.Buffer{}
+		opts := newOpts(&out, newServer())
+		opts.OutputFormat = constants.OutputFormatJson
+		err := runOnFakeClock(opts)
+		assert.NoError(t, err)
+		var results []map[string]any
+		assert.NoError(t, json.Unmarshal(out.Bytes(), &results))
+		if assert.Len(t, results, 3) {
+			assert.Equal(t, "Bar 1", results[0]["Project"])
+			assert.Equal(t, "Foo", results[0]["Environment"])
+			assert.Equal(t, "0.0.2", results[0]["Release"])
+			assert.NotContains(t, results[1], "Project")
+			assert.NotContains(t, results[2], "Project")
+		}
+	})
+
+	t.Run("isn't looked up without --show-context", func(t *testing.T) {
+		out := bytes.Buffer{}
+		opts := newOpts(&out, newServer())
+		opts.ShowContext = false
+		err := runOnFakeClock(opts)
+		assert.NoError(t, err)
+		assert.NotContains(t, out.String(), "CONTEXT")
+		assert.Equal(t, int32(0), resolved.Load())
+	})
+}
+
+func TestWait_PrintOutputs(t *testing.T) {
+	newServer := func() *testutil.FakeTaskServer {
+		return testutil.NewFakeTaskServer().
+			AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing", "Success").
+			AddTask("ServerTasks-2", "Deploy Bar 2 release 0.0.2 to Foo", "Executing", "Failed")
+	}
+	var fetched sync.Map
+	getTaskOutputs := func(taskID string) (map[string]string, error) {
+		fetched.Store(taskID, true)
+		return map[string]string{
+			"Octopus.Action[Deploy web app].Output.Url":   "https://myapp.example.com",
+			"Octopus.Action[Deploy web app].Output.Slots": "2",
+		}, nil
+	}
+	newOpts := func(out *bytes.Buffer, server *testutil.FakeTaskServer) *taskWaitCreate.WaitOptions {
+		fetched = sync.Map{}
+		opts := newServerWaitOptions(out, server, "ServerTasks-1", "ServerTasks-2")
+		opts.TaskOutputsCallback = getTaskOutputs
+		opts.PrintOutputs = true
+		return opts
+	}
+
+	t.Run("prints the output variables of the tasks which succeeded", func(t *testing.T) {
+		out := bytes.Buffer{}
+		err := runOnFakeClock(newOpts(&out, newServer()))
+		assert.Error(t, err)
+		assert.Regexp(t, `ID\s+OUTPUT\s+VALUE\n`, out.String())
+		assert.Regexp(t, `ServerTasks-1\s+Octopus.Action\[Deploy web app\].Output.Slots\s+2\nServerTasks-1\s+Octopus.Action\[Deploy web app\].Output.Url\s+https://myapp.example.com\n`, out.String())
+		_, fetchedFailed := fetched.Load("ServerTasks-2")
+		assert.False(t, fetchedFailed)
+	})
+
+	t.Run("includes them in structured output, filtered by prefix", func(t *testing.T) {
+		out := bytes.Buffer{}
+		opts := newOpts(&out, newServer())
+		opts.OutputFormat = constants.OutputFormatJson
+		opts.OutputsPrefixes = []string{"Url"}
+		err := runOnFakeClock(opts)
+		assert.Error(t, err)
+		var results []*taskWaitCreate.TaskResult
+		assert.NoError(t, json.Unmarshal(out.Bytes(), &results))
+		if assert.Len(t, results, 2) {
+			assert.Equal(t, map[string]string{"Octopus.Action[Deploy web app].Output.Url": "https://myapp.example.com"}, results[0].Outputs)
+			assert.Nil(t, results[1].Outputs)
+		}
+	})
+
+	t.Run("warns about a task whose output variables can't be fetched", func(t *testing.T) {
+		out := bytes.Buffer{}
+		opts := newOpts(&out, newServer())
+		opts.TaskOutputsCallback = func(taskID string) (map[string]string, error) {
+			return nil, errors.New("the server is unavailable")
+		}
+		opts.TaskIDs = []string{"ServerTasks-1"}
+		err := runOnFakeClock(opts)
+		assert.NoError(t, err)
+		assert.Contains(t, out.String(), "failed to fetch the output variables of ServerTasks-1: the server is unavailable")
+		assert.Contains(t, out.String(), "No output variables were set by the task(s) which succeeded\n")
+	})
+
+	t.Run("--outputs-prefix needs --print-outputs", func(t *testing.T) {
+		out := bytes.Buffer{}
+		opts := newOpts(&out, newServer())
+		opts.PrintOutputs = false
+		opts.OutputsPrefixes = []string{"Url"}
+		assert.EqualError(t, runOnFakeClock(opts), "--outputs-prefix can only be used with --print-outputs")
+	})
+}
+
+func TestWait_TimeoutCoversTheWholeWait(t *testing.T) {
+	start := time.Date(2024, 1, 31, 18, 0, 0, 0, time.UTC)
+
+	t.Run("times out while the tasks are first being fetched", func(t *testing.T) {
+		out := bytes.Buffer{}
+		clock := testutil.NewFakeClock(start)
+		// the server never answers the first request, until the test is over
+		hung := make(chan struct{})
+		defer close(hung)
+		fetching := make(chan struct{})
+		opts := &taskWaitCreate.WaitOptions{
+			Dependencies: &cmd.Dependencies{Out: &out},
+			TaskIDs:      []string{"ServerTasks-1"},
+			GetServerTasksCallback: func(taskIDs []string) ([]*tasks.Task, error) {
+				close(fetching)
+				<-hung
+				return nil, errors.New("too late")
+			},
+			Timeout:         5,
+			PollInterval:    1,
+			MaxPollInterval: 1,
+			Clock:           clock,
+		}
+
+		go func() {
+			<-fetching
+			clock.Advance(5 * time.Second)
+		}()
+		err := taskWaitCreate.WaitRun(opts)
+
+		var timeoutErr *taskWaitCreate.WaitTimeoutError
+		if assert.ErrorAs(t, err, &timeoutErr) {
+			assert.Equal(t, []string{"ServerTasks-1"}, timeoutErr.PendingTaskIDs)
+		}
+		assert.EqualError(t, err, "timeout after 5s; still pending: ServerTasks-1")
+	})
+
+	t.Run("gives up on why a task failed once the time is up", func(t *testing.T) {
+		out := bytes.Buffer{}
+		clock := testutil.NewFakeClock(start)
+		failed := testutil.NewFakeTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Failed")
+		failed.ErrorMessage = "The deployment failed"
+		server := testutil.NewFakeTaskServer().AddTaskStates("ServerTasks-1", failed)
+		hung := make(chan struct{})
+		defer close(hung)
+		fetching := make(chan struct{})
+		opts := newServerWaitOptions(&out, server, "ServerTasks-1")
+		opts.GetTaskDetailsCallback = func(taskID string) (*tasks.TaskDetailsResource, error) {
+			close(fetching)
+			<-hung
+			return nil, errors.New("too late")
+		}
+		opts.Timeout = 5
+		opts.Clock = clock
+
+		go func() {
+			<-fetching
+			clock.Advance(5 * time.Second)
+		}()
+		err := taskWaitCreate.WaitRun(opts)
+
+		// the task still fails with what the server said about it, rather than the wait hanging on its details
+		var failedErr *taskWaitCreate.TaskFailedError
+		if assert.ErrorAs(t, err, &failedErr) && assert.Len(t, failedErr.Failures, 1) {
+			assert.Equal(t, "The deployment failed", failedErr.Failures[0].Message)
+		}
+	})
+}
+
+func TestWait_OutputFormatTsv(t *testing.T) {
+	out := bytes.Buffer{}
+	server := testutil.NewFakeTaskServer().
+		AddTask("ServerTasks-1", "Deploy Bar 1 release 0.0.2 to Foo", "Executing", "Success").
+		AddTask("ServerTasks-2", "Deploy Bar 2 release 0.0.2 to Foo", "Executing", "Failed")
+	opts := newServerWaitOptions(&out, server, "ServerTasks-1", "ServerTasks-2")
+	opts.OutputFormat = taskWaitCreate.OutputFormatTsv
+
+	// only the rows are printed, without any progress to get in the way of cut and awk
+	err := runOnFakeClock(opts)
+	assert.Error(t, err)
+	assert.Equal(t, heredoc.Doc(`
+		Id	Name	State	FinishedSuccessfully	Duration
+		ServerTasks-1	Deploy Bar 1 release 0.0.2 to Foo	Success	true	
+		ServerTasks-2	Deploy Bar 2 release 0.0.2 to Foo	Failed	false	
+	`), out.String())
+}
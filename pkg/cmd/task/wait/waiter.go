@@ -0,0 +1,1005 @@
+package wait
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/OctopusDeploy/cli/pkg/util"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/client"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+)
+
+// WaitConfig controls how WaitForTasks waits. Zero poll intervals and detail workers fall back to the defaults
+// used by task wait. The callbacks default to ones using the client passed to WaitForTasks, and the On hooks
+// are all optional; they're called one at a time, so they need no locking of their own.
+type WaitConfig struct {
+	// Timeout, when set, stops the wait once it elapses, counting from when WaitForTasks is called, so that finding
+	// the tasks and finding out why any failed count against it too. Without it (or a Deadline), the wait only ends
+	// once the tasks finish or ctx is cancelled.
+	Timeout         time.Duration
+	PollInterval    time.Duration
+	MaxPollInterval time.Duration
+	MaxRetries      int
+	DetailWorkers   int
+	// Deadline, when set, stops the wait at the given time; if Timeout is set too, whichever comes first wins
+	Deadline time.Time
+	// PerTaskTimeout, when set, stops waiting for any one task which is still pending this long after it was
+	// first seen, while carrying on waiting for the others
+	PerTaskTimeout time.Duration
+	// SuccessStates are the final states which count as success. When empty, a task has succeeded if the
+	// server says it finished successfully.
+	SuccessStates  []string
+	FailFast       bool
+	FollowChildren bool
+	// FailOnIntervention stops the wait as soon as a task is paused waiting for someone to resolve a manual
+	// intervention or guided failure, rather than waiting for them to do so
+	FailOnIntervention bool
+	// MinSuccess, when set, ends the wait successfully as soon as enough tasks have succeeded, without waiting for
+	// the rest; whatever those go on to do is ignored
+	MinSuccess SuccessThreshold
+	// StrictHealth fails a deployment target health check which succeeded even though some of the targets it
+	// checked were unhealthy, naming those targets in its failure message
+	StrictHealth bool
+	// RequireRunning fails the wait before it starts if any of the given tasks has already finished
+	RequireRunning bool
+	// MinAge and MaxAge, when set, limit the tasks found when the wait starts to those which started (or were
+	// queued, if they haven't started yet) between MaxAge and MinAge ago. Given tasks outside those limits fail
+	// the wait before it starts, while those found by All or States are left out.
+	MinAge time.Duration
+	MaxAge time.Duration
+	// MaxTasks, when set, fails the wait before it starts if more tasks than this are found, so that a mistyped
+	// filter doesn't start a wait on hundreds of tasks. Tasks queued while waiting don't count towards it.
+	MaxTasks int
+	// IgnoreMissing leaves out any of the given tasks which the server doesn't have, such as tasks already removed
+	// by retention, rather than failing the wait before it starts. OnTasksMissing is told which they were.
+	IgnoreMissing  bool
+	OnTasksMissing func(taskIDs []string)
+	// RetryOnFailure, when set, reruns a task which fails while we wait for it, up to this many times, and waits for
+	// the rerun in its place. With RetryIf, only failures whose message matches it are rerun. OnTaskRetried is told
+	// about each rerun, along with why it couldn't be started if it couldn't.
+	RetryOnFailure    int
+	RetryIf           *regexp.Regexp
+	RerunTaskCallback RerunTaskCallback
+	OnTaskRetried     func(failed *tasks.Task, rerun *tasks.Task, attempt int, err error)
+	// All waits for every running task in the space rather than a list of IDs, along with any tasks queued
+	// while waiting if IncludeNew is set
+	All        bool
+	IncludeNew bool
+	// States waits for every task currently in one of the given states rather than a list of IDs
+	States []string
+	// Watch keeps polling for newly queued tasks even once every task seen so far has finished. The wait ends
+	// normally rather than as a timeout when ctx is cancelled or Timeout (or Deadline) elapses; with neither of
+	// those set, it only ends when ctx is cancelled.
+	Watch bool
+	// Since waits for every task which started (or was queued, if it hasn't started yet) no earlier than it, in any
+	// state, rather than a list of IDs. Along with All or States, it limits the tasks they find to those.
+	Since time.Time
+	// NamePattern, when set, limits the tasks found by All, States or Since to those whose name it matches
+	NamePattern *regexp.Regexp
+	// OnTasksFound is called with the tasks found by All, States or Since when the wait starts, before any are added
+	OnTasksFound func(serverTasks []*tasks.Task)
+	// ProjectID limits the tasks found by All, States, Since or Watch to a single project
+	ProjectID string
+	// FetchDetails fetches the details of every pending task on each poll, so OnTaskPolled can report progress
+	FetchDetails bool
+	// SpaceName is only used to say which space requested tasks couldn't be found in
+	SpaceName string
+	// IDBatchSize is the most task IDs GetServerTasksCallback is given at once, with more fetched in batches. Zero
+	// falls back to DefaultIDBatchSize.
+	IDBatchSize int
+
+	GetServerTasksCallback ServerTasksCallback
+	GetTaskDetailsCallback TaskDetailsCallback
+	QueryTasksCallback     TasksQueryCallback
+	// QueryRecentTasksCallback finds the tasks for Since, which only go back as far as it, in place of
+	// QueryTasksCallback
+	QueryRecentTasksCallback RecentTasksCallback
+
+	// OnPoll is called before each poll with the tasks still pending
+	OnPoll func(pendingTaskIDs []string)
+	// OnTaskAdded is called when a task is first seen, in the order the tasks are reported
+	OnTaskAdded func(t *tasks.Task)
+	// OnTaskPolled is called for each known task on every poll, and once for each task which had already finished
+	// when it was first seen. details and detailsErr are only set when details are being fetched.
+	OnTaskPolled func(t *tasks.Task, details *tasks.TaskDetailsResource, detailsErr error)
+	// OnTaskCompleted is called once when a task we were waiting for finishes
+	OnTaskCompleted func(t *tasks.Task)
+	// OnTaskTimedOut is called when we stop waiting for a task because it exceeded PerTaskTimeout
+	OnTaskTimedOut func(t *tasks.Task)
+	// OnTaskInterrupted is called when a task is paused waiting for someone to resolve a manual intervention or
+	// guided failure, and again each time it is paused after that
+	OnTaskInterrupted func(t *tasks.Task)
+	// OnPending is called after each poll which leaves tasks still pending, with those tasks and everything that
+	// poll fetched
+	OnPending func(pendingTaskIDs []string, polledTasks []*tasks.Task, polledDetails []*tasks.TaskDetailsResource)
+	// OnRetry is called before retrying a poll which failed with a transient error
+	OnRetry func(attempt int, err error)
+	// OnHeartbeat is called every HeartbeatInterval between polls with the tasks still pending, however long the
+	// polls are apart, so that something can show the wait is still alive without polling any more often
+	OnHeartbeat       func(pendingTaskIDs []string)
+	HeartbeatInterval time.Duration
+	// OnStatusRequest is called between polls with the tasks still pending, in the order they were first seen, each
+	// time StatusRequests receives a signal, such as SIGUSR1 asking what a long wait is still waiting for
+	OnStatusRequest func(pendingTasks []*tasks.Task)
+	StatusRequests  <-chan os.Signal
+	// OnTimeoutWarning is called before a poll once the wait has used up each of the TimeoutWarnings percentages
+	// of its timeout (or of the time left until its deadline), with the tasks still pending, so that something can
+	// warn the wait is running out of time before it does
+	OnTimeoutWarning func(percent int, pendingTaskIDs []string)
+	TimeoutWarnings  []int
+	// Clock tells the time and waits between polls, defaulting to the real clock
+	Clock Clock
+}
+
+// WaitResult is the outcome of the tasks waited for by WaitForTasks
+type WaitResult struct {
+	// Tasks are all the tasks waited for, in the order they were first seen
+	Tasks []*tasks.Task
+	// CompletedTasks are the tasks which finished, whether they succeeded or not
+	CompletedTasks []*tasks.Task
+	// FailedTasks are the tasks which finished in a state other than a success state
+	FailedTasks []*tasks.Task
+	// TimedOutTasks are the tasks which were still running when they exceeded the per-task timeout
+	TimedOutTasks []*tasks.Task
+	// SucceededTasks are the tasks which finished in a success state
+	SucceededTasks []*tasks.Task
+	// MinSuccess is how many tasks had to succeed under WaitConfig.MinSuccess, or 0 if every task had to
+	MinSuccess int
+	// FailureMessages explain why each failed task failed, keyed by task ID, where the reason is known
+	FailureMessages map[string]string
+	// MissingTaskIDs are the given tasks which weren't found, and so weren't waited for, with IgnoreMissing
+	MissingTaskIDs []string
+	// Warnings are the warnings logged by each task which succeeded but logged any, keyed by task ID
+	Warnings map[string][]string
+	// RetriedTaskIDs are the earlier attempts of each task which was rerun with RetryOnFailure, oldest first, keyed
+	// by the ID of the last attempt
+	RetriedTaskIDs map[string][]string
+	// Elapsed is how long the wait took, from resolving the tasks to the last poll
+	Elapsed time.Duration
+}
+
+// WaitForTasks polls the given tasks, or those selected by config.All or config.States, until all of them have
+// finished. Tasks finishing unsuccessfully don't make it return an error; they're reported in the result. An
+// error means the wait itself didn't finish, because it timed out, ctx was cancelled, the server couldn't be
+// reached or, with config.FailFast, a task failed while others were still running. With config.MinSuccess, it
+// returns as soon as enough tasks have succeeded, leaving any others still pending in the result.
+func WaitForTasks(ctx context.Context, octopus *client.Client, taskIDs []string, config WaitConfig) (WaitResult, error) {
+	config = withWaitConfigDefaults(octopus, config)
+	started := config.Clock.Now()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	timeout := config.Timeout
+	deadlineFirst := false
+	if remaining := config.Deadline.Sub(started); !config.Deadline.IsZero() && (timeout <= 0 || remaining < timeout) {
+		timeout = remaining
+		deadlineFirst = true
+	}
+	// the timeout runs from the start, so that finding the tasks and finding out why any of them failed count against
+	// it as much as polling them does. A watch ends rather than times out when its time is up, so the calls it makes
+	// are left to finish, as they always were.
+	budget, cancelBudget := startWaitBudget(ctx, config.Clock, timeout, timeout > 0 || !config.Deadline.IsZero())
+	defer cancelBudget(nil)
+	if !config.Watch {
+		addWaitBudget(&config, budget)
+	}
+	// newTimeoutError describes the wait timing out with the given tasks still pending
+	newTimeoutError := func(pendingTaskIDs []string, pendingStates map[string]string) *WaitTimeoutError {
+		timeoutErr := NewWaitTimeoutError()
+		if deadlineFirst {
+			timeoutErr.Deadline = config.Deadline
+		} else {
+			timeoutErr.Timeout = config.Timeout
+		}
+		timeoutErr.PendingTaskIDs = pendingTaskIDs
+		timeoutErr.PendingStates = pendingStates
+		return timeoutErr
+	}
+	// setupErr is why the wait failed before it started polling, which is the budget running out rather than whatever
+	// the call it cut short returned, if it did
+	setupErr := func(err error) error {
+		switch {
+		case errors.Is(context.Cause(budget), errWaitTimedOut) && config.Watch:
+			return nil
+		case errors.Is(context.Cause(budget), errWaitTimedOut):
+			return newTimeoutError(taskIDs, map[string]string{})
+		case budget.Err() != nil:
+			return ErrWaitCancelled
+		}
+		return withConnectionHint(err)
+	}
+
+	serverTasks, missingTaskIDs, err := resolveTasks(config, taskIDs)
+	if err != nil {
+		return WaitResult{}, setupErr(err)
+	}
+
+	pendingTaskIDs := make([]string, 0)
+	lastStates := make(map[string]string)
+	// taskOrder is the order in which tasks were first seen, which is the order they are reported in
+	taskOrder := make([]string, 0, len(serverTasks))
+	finalTasks := make(map[string]*tasks.Task, len(serverTasks))
+	// taskDepths is how many parents separate a child task from the tasks we were asked to wait for
+	taskDepths := make(map[string]int)
+	// taskStarted is when we started waiting for each task, which the per-task timeout runs from
+	taskStarted := make(map[string]time.Time)
+	timedOutTaskIDs := make(map[string]bool)
+	// interruptedTaskIDs are the tasks which were paused waiting for an intervention when they were last seen
+	interruptedTaskIDs := make(map[string]bool)
+	// retriedTaskIDs are the earlier attempts of each task rerun with RetryOnFailure, keyed by its latest attempt
+	retriedTaskIDs := make(map[string][]string)
+
+	// newResult sorts the tasks seen so far into the result of the wait
+	newResult := func() WaitResult {
+		result := newWaitResult(config, started, taskOrder, finalTasks, timedOutTaskIDs)
+		result.MissingTaskIDs = missingTaskIDs
+		if len(retriedTaskIDs) != 0 {
+			result.RetriedTaskIDs = retriedTaskIDs
+		}
+		return result
+	}
+
+	// finishedOnArrival are the tasks which had already finished when they were added, and so would never be
+	// polled, waiting for reportFinishedOnArrival to report their details
+	finishedOnArrival := make([]*tasks.Task, 0)
+
+	// checkInterruption reports a task which has just been paused waiting for an intervention
+	checkInterruption := func(t *tasks.Task) {
+		if !isInterruptedTask(t) {
+			delete(interruptedTaskIDs, t.ID)
+			return
+		}
+		if interruptedTaskIDs[t.ID] {
+			return
+		}
+		interruptedTaskIDs[t.ID] = true
+		if config.OnTaskInterrupted != nil {
+			config.OnTaskInterrupted(t)
+		}
+	}
+
+	// pendingInterruptions are the pending tasks which are paused waiting for an intervention, in the order they
+	// were first seen
+	pendingInterruptions := func() []string {
+		return util.SliceFilter(taskOrder, func(id string) bool {
+			return interruptedTaskIDs[id] && util.SliceContains(pendingTaskIDs, id)
+		})
+	}
+
+	// minSuccessMet reports whether enough of the tasks seen so far have succeeded to stop waiting for the others
+	minSuccessMet := func() bool {
+		if config.MinSuccess.IsZero() || len(taskOrder) == 0 {
+			return false
+		}
+		succeeded := util.SliceFilter(taskOrder, func(id string) bool {
+			return !timedOutTaskIDs[id] && isSucceededTask(finalTasks[id], config.SuccessStates)
+		})
+		return len(succeeded) >= config.MinSuccess.Required(len(taskOrder))
+	}
+
+	addTask := func(t *tasks.Task) {
+		taskOrder = append(taskOrder, t.ID)
+		lastStates[t.ID] = t.State
+		finalTasks[t.ID] = t
+		if t.IsCompleted == nil || !*t.IsCompleted {
+			pendingTaskIDs = append(pendingTaskIDs, t.ID)
+			taskStarted[t.ID] = config.Clock.Now()
+		} else if config.FetchDetails {
+			finishedOnArrival = append(finishedOnArrival, t)
+		}
+
+		if config.OnTaskAdded != nil {
+			config.OnTaskAdded(t)
+		}
+		checkInterruption(t)
+	}
+
+	// addChildTasks adds the tasks referenced by each parent's details, then follows those children in turn.
+	// Tasks we've already seen are skipped, so cycles end the walk. details may be nil to fetch them here.
+	addChildTasks := func(parents []*tasks.Task, details []*tasks.TaskDetailsResource) error {
+		for len(parents) != 0 {
+			if details == nil {
+				details, _ = fetchTaskDetails(parents, config.DetailWorkers, config.GetTaskDetailsCallback)
+			}
+
+			childTaskIDs := make([]string, 0)
+			for i, parent := range parents {
+				if details[i] == nil || taskDepths[parent.ID] >= maxChildTaskDepth {
+					continue
+				}
+				for _, id := range findChildTaskIDs(details[i]) {
+					if _, seen := finalTasks[id]; seen || util.SliceContains(childTaskIDs, id) {
+						continue
+					}
+					childTaskIDs = append(childTaskIDs, id)
+					taskDepths[id] = taskDepths[parent.ID] + 1
+				}
+			}
+			if len(childTaskIDs) == 0 {
+				return nil
+			}
+
+			children, err := config.GetServerTasksCallback(childTaskIDs)
+			if err != nil {
+				return err
+			}
+			children = util.SliceFilter(children, func(t *tasks.Task) bool {
+				_, seen := finalTasks[t.ID]
+				return !seen
+			})
+			for _, child := range children {
+				addTask(child)
+			}
+			parents, details = children, nil
+		}
+		return nil
+	}
+
+	// reportFinishedOnArrival fetches the details of the tasks which had already finished when they were added
+	// in one go, so their activity can be shown even though they never get polled
+	reportFinishedOnArrival := func() {
+		if len(finishedOnArrival) == 0 || config.OnTaskPolled == nil || config.GetTaskDetailsCallback == nil {
+			finishedOnArrival = finishedOnArrival[:0]
+			return
+		}
+		details, detailErrors := fetchTaskDetails(finishedOnArrival, config.DetailWorkers, config.GetTaskDetailsCallback)
+		for i, t := range finishedOnArrival {
+			config.OnTaskPolled(t, details[i], detailErrors[i])
+		}
+		finishedOnArrival = finishedOnArrival[:0]
+	}
+
+	// retryFailedTask reruns a task which has just failed, if config.RetryOnFailure allows, and waits for the rerun
+	// in its place. It returns whether the task was rerun.
+	retryFailedTask := func(t *tasks.Task) bool {
+		retries := len(retriedTaskIDs[t.ID])
+		if retries >= config.RetryOnFailure || config.RerunTaskCallback == nil || !isFailedTask(t, config.SuccessStates) {
+			return false
+		}
+		if config.RetryIf != nil && !config.RetryIf.MatchString(getFailureMessages(config, []*tasks.Task{t})[t.ID]) {
+			return false
+		}
+
+		rerun, err := config.RerunTaskCallback(t.ID)
+		if config.OnTaskRetried != nil {
+			config.OnTaskRetried(t, rerun, retries+2, err)
+		}
+		if err != nil {
+			return false
+		}
+
+		retriedTaskIDs[rerun.ID] = append(append([]string{}, retriedTaskIDs[t.ID]...), t.ID)
+		delete(retriedTaskIDs, t.ID)
+		// the rerun takes the place of the task it reruns, so it's reported where that one would have been
+		for i, id := range taskOrder {
+			if id == t.ID {
+				taskOrder[i] = rerun.ID
+			}
+		}
+		lastStates[rerun.ID] = rerun.State
+		finalTasks[rerun.ID] = rerun
+		taskStarted[rerun.ID] = config.Clock.Now()
+		delete(interruptedTaskIDs, t.ID)
+		pendingTaskIDs = append(removeTaskID(pendingTaskIDs, t.ID), rerun.ID)
+		return true
+	}
+
+	for _, t := range serverTasks {
+		addTask(t)
+	}
+
+	if config.FollowChildren {
+		if err := addChildTasks(serverTasks, nil); err != nil {
+			if budget.Err() != nil {
+				return WaitResult{}, setupErr(err)
+			}
+			return WaitResult{}, err
+		}
+	}
+	reportFinishedOnArrival()
+
+	if (len(pendingTaskIDs) == 0 && !config.Watch) || minSuccessMet() {
+		return newResult(), nil
+	}
+
+	if config.FailFast && hasFailedTask(taskOrder, finalTasks, config.SuccessStates) {
+		result := newResult()
+		return result, newFailFastError(result)
+	}
+
+	if interrupted := pendingInterruptions(); config.FailOnIntervention && len(interrupted) != 0 {
+		return newResult(), NewTaskInterruptedError(interrupted)
+	}
+
+	// cancelling stops the polling goroutine, as does the budget of the wait running out
+	ctx, cancel := context.WithCancel(budget)
+	defer cancel()
+
+	// the polling goroutine owns the state of the wait until it closes stopped, after which it is safe to read here.
+	// pollErr, failedFast and interrupted say why it stopped, if it didn't simply run out of pending tasks.
+	stopped := make(chan struct{})
+	var pollErr error
+	failedFast := false
+	interrupted := false
+
+	backoff := newPollBackoff(config.PollInterval, config.MaxPollInterval)
+	warnings := newTimeoutWarnings(config.TimeoutWarnings)
+
+	go func() {
+		defer close(stopped)
+		// the heartbeat is set again each time it goes off, so that it keeps going off however long a poll takes
+		var heartbeat <-chan time.Time
+		if config.OnHeartbeat != nil && config.HeartbeatInterval > 0 {
+			heartbeat = config.Clock.After(config.HeartbeatInterval)
+		}
+		retries := 0
+		// retryAfterDelay is how long the server asked us to wait before polling again, after a poll it turned away
+		var retryAfterDelay time.Duration
+		// with IncludeNew, newly queued tasks become pending as they're found, so we only finish once the space is
+		// quiet. Watch carries on even then, waiting for whatever is queued next.
+		for len(pendingTaskIDs) != 0 || config.Watch {
+			// the server knows better than the backoff how long it needs, but the backoff still grows meanwhile
+			delay := max(backoff.Next(), retryAfterDelay)
+			retryAfterDelay = 0
+			pollDue := config.Clock.After(delay)
+			for waiting := true; waiting; {
+				select {
+				case <-ctx.Done():
+					return
+				case <-heartbeat:
+					heartbeat = config.Clock.After(config.HeartbeatInterval)
+					config.OnHeartbeat(pendingTaskIDs)
+				case <-config.StatusRequests:
+					// the polling goroutine owns the state of the wait, so it is read here rather than by whoever
+					// sent the signal
+					if config.OnStatusRequest != nil {
+						pending := util.SliceFilter(taskOrder, func(id string) bool { return util.SliceContains(pendingTaskIDs, id) })
+						config.OnStatusRequest(util.SliceTransform(pending, func(id string) *tasks.Task { return finalTasks[id] }))
+					}
+				case <-pollDue:
+					waiting = false
+				}
+			}
+
+			if config.OnTimeoutWarning != nil {
+				if percent, ok := warnings.passed(config.Clock.Now().Sub(started), timeout); ok {
+					config.OnTimeoutWarning(percent, pendingTaskIDs)
+				}
+			}
+			if config.OnPoll != nil {
+				config.OnPoll(pendingTaskIDs)
+			}
+
+			var polledTasks []*tasks.Task
+			var err error
+			if config.IncludeNew || config.Watch {
+				// running tasks include both the ones we're already waiting for and any newly queued ones, but
+				// not tasks which have just finished, so those still need to be fetched by ID
+				polledTasks, err = pollRunningTasks(config, pendingTaskIDs)
+			} else {
+				polledTasks, err = config.GetServerTasksCallback(pendingTaskIDs)
+			}
+			var polledDetails []*tasks.TaskDetailsResource
+			var detailErrors []error
+			if err == nil && (config.FetchDetails || config.FollowChildren) {
+				polledDetails, detailErrors = fetchTaskDetails(polledTasks, config.DetailWorkers, config.GetTaskDetailsCallback)
+			}
+			if err == nil && config.FollowChildren {
+				err = addChildTasks(polledTasks, polledDetails)
+			}
+			// the wait ended while we were polling, so this poll is too late to count
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				if retries >= config.MaxRetries || !isTransientError(err) {
+					pollErr = err
+					return
+				}
+				// the backoff keeps growing while we retry, giving the server a chance to recover
+				retries++
+				retryAfterDelay = retryAfter(err)
+				if config.OnRetry != nil {
+					config.OnRetry(retries, err)
+				}
+				continue
+			}
+			retries = 0
+
+			for i, t := range polledTasks {
+				if _, ok := finalTasks[t.ID]; !ok {
+					addTask(t)
+					backoff.Reset()
+					continue
+				}
+
+				if lastStates[t.ID] != t.State {
+					lastStates[t.ID] = t.State
+					backoff.Reset()
+				}
+
+				if config.OnTaskPolled != nil {
+					var details *tasks.TaskDetailsResource
+					var detailsErr error
+					if polledDetails != nil {
+						details, detailsErr = polledDetails[i], detailErrors[i]
+					}
+					config.OnTaskPolled(t, details, detailsErr)
+				}
+
+				// keep the latest state of every task, so a task which times out is reported as it was last seen
+				finalTasks[t.ID] = t
+				checkInterruption(t)
+				if t.IsCompleted != nil && *t.IsCompleted {
+					if retryFailedTask(t) {
+						backoff.Reset()
+						continue
+					}
+					if config.OnTaskCompleted != nil {
+						config.OnTaskCompleted(t)
+					}
+					pendingTaskIDs = removeTaskID(pendingTaskIDs, t.ID)
+				}
+			}
+
+			if config.PerTaskTimeout > 0 {
+				// removeTaskID reorders the slice it's given, so we go through a copy
+				for _, taskID := range append([]string{}, pendingTaskIDs...) {
+					if config.Clock.Now().Sub(taskStarted[taskID]) < config.PerTaskTimeout {
+						continue
+					}
+					timedOutTaskIDs[taskID] = true
+					pendingTaskIDs = removeTaskID(pendingTaskIDs, taskID)
+					if config.OnTaskTimedOut != nil {
+						config.OnTaskTimedOut(finalTasks[taskID])
+					}
+				}
+			}
+
+			reportFinishedOnArrival()
+
+			if minSuccessMet() {
+				return
+			}
+
+			if config.FailFast && len(pendingTaskIDs) != 0 && hasFailedTask(taskOrder, finalTasks, config.SuccessStates) {
+				failedFast = true
+				return
+			}
+
+			if config.FailOnIntervention && len(pendingInterruptions()) != 0 {
+				interrupted = true
+				return
+			}
+
+			if config.OnPending != nil && len(pendingTaskIDs) != 0 {
+				config.OnPending(pendingTaskIDs, polledTasks, polledDetails)
+			}
+		}
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+	}
+	// a wait with neither a timeout nor a deadline never times out
+	timedOut := errors.Is(context.Cause(budget), errWaitTimedOut)
+	// if the goroutine is part way through a poll this waits for the API call in flight, but it then stops without
+	// touching the state of the wait or calling any more hooks, which would otherwise race with the caller
+	cancel()
+	<-stopped
+
+	if pollErr != nil {
+		return WaitResult{}, withConnectionHint(pollErr)
+	}
+	if failedFast {
+		result := newResult()
+		return result, newFailFastError(result)
+	}
+	if interrupted {
+		return newResult(), NewTaskInterruptedError(pendingInterruptions())
+	}
+	// the end of a watch is the end of the window being watched, so whatever is still running isn't a problem,
+	// and neither is it once enough tasks have succeeded
+	if len(pendingTaskIDs) == 0 || config.Watch || minSuccessMet() {
+		return newResult(), nil
+	}
+	if !timedOut {
+		return WaitResult{}, ErrWaitCancelled
+	}
+
+	pending := util.SliceFilter(taskOrder, func(id string) bool { return util.SliceContains(pendingTaskIDs, id) })
+	pendingStates := make(map[string]string, len(pending))
+	for _, taskID := range pending {
+		pendingStates[taskID] = finalTasks[taskID].State
+	}
+	return WaitResult{}, newTimeoutError(pending, pendingStates)
+}
+
+// resolveTasks fetches the tasks a wait starts with: the given tasks, or those selected by config.All, config.States,
+// config.Since or config.Watch. The matching tasks are resolved once; after that they're polled by ID like any other wait. With
+// config.IgnoreMissing, it also returns the given tasks which weren't found.
+func resolveTasks(config WaitConfig, taskIDs []string) ([]*tasks.Task, []string, error) {
+	serverTasks, missingTaskIDs, err := findTasks(config, taskIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(missingTaskIDs) != 0 && config.OnTasksMissing != nil {
+		config.OnTasksMissing(missingTaskIDs)
+	}
+	if config.MaxTasks > 0 && len(serverTasks) > config.MaxTasks {
+		return nil, nil, fmt.Errorf("%d tasks matched, more than --%s %d; raise --%s, or set it to 0, to wait for all of them", len(serverTasks), FlagMaxTasks, config.MaxTasks, FlagMaxTasks)
+	}
+	return serverTasks, missingTaskIDs, nil
+}
+
+// findTasks finds the tasks to start waiting for, either those given or those matching config.All, config.States or
+// config.Since
+func findTasks(config WaitConfig, taskIDs []string) ([]*tasks.Task, []string, error) {
+	if len(taskIDs) == 0 && !config.All && len(config.States) == 0 && !config.Watch && config.Since.IsZero() {
+		return nil, nil, fmt.Errorf("no server task IDs provided, at least one is required")
+	}
+
+	if config.All || len(config.States) != 0 || config.Watch || !config.Since.IsZero() {
+		// with just Since, tasks in any state are found, so that those which have already finished are reported too
+		states := config.States
+		if config.All || config.Watch {
+			states = runningTaskStates
+		}
+		query := tasks.TasksQuery{States: states, Project: config.ProjectID}
+		var serverTasks []*tasks.Task
+		var err error
+		if !config.Since.IsZero() && config.QueryRecentTasksCallback != nil {
+			serverTasks, err = config.QueryRecentTasksCallback(RecentTasksQuery{TasksQuery: query, Since: config.Since})
+		} else {
+			serverTasks, err = config.QueryTasksCallback(query)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		now := config.Clock.Now()
+		serverTasks = util.SliceFilter(serverTasks, func(t *tasks.Task) bool {
+			return checkTaskAge(config, t, now) == "" && matchesTaskFilter(config, t)
+		})
+		if config.OnTasksFound != nil {
+			config.OnTasksFound(serverTasks)
+		}
+		return serverTasks, nil, nil
+	}
+
+	serverTasks, err := config.GetServerTasksCallback(taskIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	missingTaskIDs := findMissingTaskIDs(taskIDs, serverTasks)
+	if len(missingTaskIDs) != 0 && !config.IgnoreMissing {
+		return nil, nil, newTasksNotFoundError(config, missingTaskIDs)
+	}
+	// the server doesn't necessarily return the tasks in the order they were asked for, which is the order they're
+	// reported in
+	order := make(map[string]int, len(taskIDs))
+	for i, taskID := range taskIDs {
+		if _, ok := order[taskID]; !ok {
+			order[taskID] = i
+		}
+	}
+	sort.SliceStable(serverTasks, func(i, j int) bool { return order[serverTasks[i].ID] < order[serverTasks[j].ID] })
+	if err := checkTasksEligible(config, serverTasks); err != nil {
+		return nil, nil, err
+	}
+	return serverTasks, missingTaskIDs, nil
+}
+
+// checkTasksEligible fails the wait for given tasks which are already finished with config.RequireRunning, or which
+// started outside config.MinAge and config.MaxAge, as they were most likely given by mistake
+func checkTasksEligible(config WaitConfig, serverTasks []*tasks.Task) error {
+	finished := make([]string, 0)
+	outOfAge := make([]string, 0)
+	now := config.Clock.Now()
+	for _, t := range serverTasks {
+		if config.RequireRunning && t.IsCompleted != nil && *t.IsCompleted {
+			finished = append(finished, fmt.Sprintf("%s (%s)", t.ID, t.State))
+		}
+		if problem := checkTaskAge(config, t, now); problem != "" {
+			outOfAge = append(outOfAge, fmt.Sprintf("%s (%s)", t.ID, problem))
+		}
+	}
+
+	if len(finished) != 0 {
+		return fmt.Errorf("task(s) had already finished when the wait started: %s", strings.Join(finished, ", "))
+	}
+	if len(outOfAge) != 0 {
+		return fmt.Errorf("task(s) started outside the age limits: %s", strings.Join(outOfAge, ", "))
+	}
+	return nil
+}
+
+// checkTaskAge says what is wrong with how long ago a task started under config.MinAge and config.MaxAge, such as
+// "started 2h0m0s ago, more than --max-age 1h0m0s", or returns an empty string if nothing is. A task which hasn't started yet goes by when it was
+// queued.
+func checkTaskAge(config WaitConfig, t *tasks.Task, now time.Time) string {
+	if config.MinAge <= 0 && config.MaxAge <= 0 {
+		return ""
+	}
+	started := t.StartTime
+	verb := "started"
+	if started == nil {
+		started = t.QueueTime
+		verb = "queued"
+	}
+	if started == nil {
+		return ""
+	}
+
+	age := now.Sub(*started)
+	if config.MinAge > 0 && age < config.MinAge {
+		return fmt.Sprintf("%s %s ago, less than --%s %s", verb, formatDuration(age), FlagMinAge, config.MinAge)
+	}
+	if config.MaxAge > 0 && age > config.MaxAge {
+		return fmt.Sprintf("%s %s ago, more than --%s %s", verb, formatDuration(age), FlagMaxAge, config.MaxAge)
+	}
+	return ""
+}
+
+func withWaitConfigDefaults(octopus *client.Client, config WaitConfig) WaitConfig {
+	if config.PollInterval <= 0 {
+		config.PollInterval = DefaultPollInterval * time.Second
+	}
+	if config.MaxPollInterval < config.PollInterval {
+		config.MaxPollInterval = max(config.PollInterval, DefaultMaxPollInterval*time.Second)
+	}
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	}
+	if config.DetailWorkers <= 0 {
+		config.DetailWorkers = DefaultDetailWorkers
+	}
+	if config.IDBatchSize <= 0 {
+		config.IDBatchSize = DefaultIDBatchSize
+	}
+	if config.Clock == nil {
+		config.Clock = realClock{}
+	}
+
+	if octopus != nil {
+		if config.GetServerTasksCallback == nil {
+			config.GetServerTasksCallback = getServerTasksCallback(octopus, nil, config.Clock.Sleep)
+		}
+		if config.GetTaskDetailsCallback == nil {
+			config.GetTaskDetailsCallback = GetTaskDetailsCallback(octopus, octopus.GetSpaceID())
+		}
+		if config.QueryTasksCallback == nil {
+			config.QueryTasksCallback = getTasksQueryCallback(octopus, nil, config.Clock.Sleep)
+		}
+		if config.QueryRecentTasksCallback == nil {
+			config.QueryRecentTasksCallback = getRecentTasksCallback(octopus, nil, config.Clock.Sleep)
+		}
+	}
+	if config.GetServerTasksCallback != nil {
+		config.GetServerTasksCallback = batchServerTasks(config.GetServerTasksCallback, config.IDBatchSize)
+	}
+	return config
+}
+
+// newWaitResult sorts the tasks seen so far into the result, fetching why any failed ones did
+func newWaitResult(config WaitConfig, started time.Time, taskOrder []string, finalTasks map[string]*tasks.Task, timedOutTaskIDs map[string]bool) WaitResult {
+	result := WaitResult{
+		Tasks:          make([]*tasks.Task, 0, len(taskOrder)),
+		CompletedTasks: make([]*tasks.Task, 0, len(taskOrder)),
+		FailedTasks:    make([]*tasks.Task, 0),
+		TimedOutTasks:  make([]*tasks.Task, 0),
+		SucceededTasks: make([]*tasks.Task, 0),
+		MinSuccess:     config.MinSuccess.Required(len(taskOrder)),
+		Elapsed:        config.Clock.Now().Sub(started),
+	}
+	for _, taskID := range taskOrder {
+		t := finalTasks[taskID]
+		result.Tasks = append(result.Tasks, t)
+		if timedOutTaskIDs[taskID] {
+			result.TimedOutTasks = append(result.TimedOutTasks, t)
+			continue
+		}
+		if t.IsCompleted != nil && *t.IsCompleted {
+			result.CompletedTasks = append(result.CompletedTasks, t)
+		}
+		if isFailedTask(t, config.SuccessStates) {
+			result.FailedTasks = append(result.FailedTasks, t)
+		} else if isSucceededTask(t, config.SuccessStates) {
+			result.SucceededTasks = append(result.SucceededTasks, t)
+		}
+	}
+	result.FailureMessages = getFailureMessages(config, result.FailedTasks)
+	if config.StrictHealth {
+		failUnhealthyChecks(config, &result)
+	}
+	result.Warnings = getTaskWarnings(config, result.SucceededTasks)
+	return result
+}
+
+// isFailedTask reports whether a task has finished in a state other than one of successStates. Without any
+// success states, we go by whether the server says the task finished successfully.
+func isFailedTask(t *tasks.Task, successStates []string) bool {
+	if t.IsCompleted == nil || !*t.IsCompleted {
+		return false
+	}
+	if len(successStates) == 0 {
+		return t.FinishedSuccessfully != nil && !*t.FinishedSuccessfully
+	}
+	return !util.SliceContains(successStates, t.State)
+}
+
+// isSucceededTask reports whether a task has finished in one of successStates, or without any, whether the server
+// says it finished successfully
+func isSucceededTask(t *tasks.Task, successStates []string) bool {
+	if t.IsCompleted == nil || !*t.IsCompleted {
+		return false
+	}
+	if len(successStates) == 0 {
+		return t.FinishedSuccessfully != nil && *t.FinishedSuccessfully
+	}
+	return util.SliceContains(successStates, t.State)
+}
+
+// isInterruptedTask reports whether a task is paused waiting for someone to act on it. Both manual intervention
+// steps and guided failure raise an interruption which has to be resolved in the Octopus web portal. While one is
+// pending the task stays Executing, so its HasPendingInterruptions flag is the only sign that it is paused, and the
+// task won't finish until someone takes responsibility for the interruption and resolves it.
+func isInterruptedTask(t *tasks.Task) bool {
+	return t.HasPendingInterruptions && (t.IsCompleted == nil || !*t.IsCompleted)
+}
+
+func hasFailedTask(taskOrder []string, finalTasks map[string]*tasks.Task, successStates []string) bool {
+	return util.SliceContainsAny(taskOrder, func(taskID string) bool {
+		return isFailedTask(finalTasks[taskID], successStates)
+	})
+}
+
+// newFailFastError reports the tasks which have failed so far, along with the pending tasks we stopped waiting for
+func newFailFastError(result WaitResult) error {
+	failedTaskIDs := make([]string, 0, len(result.FailedTasks))
+	for _, t := range result.FailedTasks {
+		failedTaskIDs = append(failedTaskIDs, t.ID)
+	}
+	timedOutTaskIDs := make([]string, 0, len(result.TimedOutTasks))
+	for _, t := range result.TimedOutTasks {
+		timedOutTaskIDs = append(timedOutTaskIDs, t.ID)
+	}
+	notWaitedTaskIDs := make([]string, 0)
+	for _, t := range result.Tasks {
+		if !util.SliceContains(failedTaskIDs, t.ID) && !util.SliceContains(timedOutTaskIDs, t.ID) && (t.IsCompleted == nil || !*t.IsCompleted) {
+			notWaitedTaskIDs = append(notWaitedTaskIDs, t.ID)
+		}
+	}
+
+	err := newTaskFailedError(result, failedTaskIDs)
+	err.TimedOutTaskIDs = timedOutTaskIDs
+	err.NotWaitedTaskIDs = notWaitedTaskIDs
+	return err
+}
+
+// newTaskFailedError reports the given tasks of result as having failed, along with how long the wait took
+func newTaskFailedError(result WaitResult, failedTaskIDs []string) *TaskFailedError {
+	err := NewTaskFailedError(newTaskFailures(result, failedTaskIDs))
+	err.Waited = result.Elapsed
+	return err
+}
+
+// newTaskFailures describes why each of the given tasks of result failed, in the order the tasks were first seen
+// so that the same failures are always reported the same way
+func newTaskFailures(result WaitResult, failedTaskIDs []string) []*TaskFailure {
+	failures := make([]*TaskFailure, 0, len(failedTaskIDs))
+	for _, t := range result.Tasks {
+		if !util.SliceContains(failedTaskIDs, t.ID) {
+			continue
+		}
+		failure := &TaskFailure{TaskID: t.ID, Name: t.Description, Message: result.FailureMessages[t.ID]}
+		if duration, ok := taskDuration(t); ok {
+			failure.Duration = formatDuration(duration)
+		}
+		failures = append(failures, failure)
+	}
+	return failures
+}
+
+// getFailureMessages fetches the details of the failed tasks in one go to find out why each of them failed,
+// keyed by task ID. Tasks whose details can't be fetched fall back to their own error message.
+func getFailureMessages(config WaitConfig, failedTasks []*tasks.Task) map[string]string {
+	messages := make(map[string]string, len(failedTasks))
+	var details []*tasks.TaskDetailsResource
+	if len(failedTasks) != 0 && config.GetTaskDetailsCallback != nil {
+		details, _ = fetchTaskDetails(failedTasks, config.DetailWorkers, config.GetTaskDetailsCallback)
+	}
+
+	for i, t := range failedTasks {
+		message := ""
+		if details != nil && details[i] != nil {
+			message = taskFailureMessage(details[i])
+		}
+		if message == "" {
+			message = strings.TrimSpace(t.ErrorMessage)
+		}
+		if message != "" {
+			messages[t.ID] = message
+		}
+	}
+	return messages
+}
+
+// getTaskWarnings fetches the details of the succeeded tasks which the server says logged warnings or errors in one
+// go, to find the warnings each of them logged, keyed by task ID. Tasks whose details can't be fetched are left out.
+func getTaskWarnings(config WaitConfig, succeededTasks []*tasks.Task) map[string][]string {
+	warnings := make(map[string][]string)
+	warned := util.SliceFilter(succeededTasks, func(t *tasks.Task) bool { return t.HasWarningsOrErrors })
+	if len(warned) == 0 || config.GetTaskDetailsCallback == nil {
+		return warnings
+	}
+
+	details, _ := fetchTaskDetails(warned, config.DetailWorkers, config.GetTaskDetailsCallback)
+	for i, t := range warned {
+		if taskWarnings := taskWarnings(details[i]); len(taskWarnings) != 0 {
+			warnings[t.ID] = taskWarnings
+		}
+	}
+	return warnings
+}
+
+// findMissingTaskIDs returns the requested tasks which the server didn't return, such as tasks from a different
+// space or which have been removed by retention
+func findMissingTaskIDs(taskIDs []string, serverTasks []*tasks.Task) []string {
+	found := make(map[string]bool, len(serverTasks))
+	for _, t := range serverTasks {
+		found[t.ID] = true
+	}
+	return util.SliceFilter(taskIDs, func(id string) bool { return !found[id] })
+}
+
+// newTasksNotFoundError names the requested tasks which the server didn't return
+func newTasksNotFoundError(config WaitConfig, missing []string) error {
+	if config.SpaceName != "" {
+		return fmt.Errorf("server task(s) not found in space %s: %s", config.SpaceName, strings.Join(missing, ", "))
+	}
+	return fmt.Errorf("server task(s) not found: %s", strings.Join(missing, ", "))
+}
+
+// pollRunningTasks fetches all running tasks in the space along with the given pending tasks, which may have
+// finished since the last poll
+func pollRunningTasks(config WaitConfig, pendingTaskIDs []string) ([]*tasks.Task, error) {
+	runningTasks, err := config.QueryTasksCallback(tasks.TasksQuery{States: runningTaskStates, Project: config.ProjectID})
+	if err != nil {
+		return nil, err
+	}
+
+	running := make(map[string]bool, len(runningTasks))
+	for _, t := range runningTasks {
+		running[t.ID] = true
+	}
+
+	finishedTaskIDs := util.SliceFilter(pendingTaskIDs, func(id string) bool { return !running[id] })
+	if len(finishedTaskIDs) == 0 {
+		return runningTasks, nil
+	}
+
+	finishedTasks, err := config.GetServerTasksCallback(finishedTaskIDs)
+	if err != nil {
+		return nil, err
+	}
+	return append(finishedTasks, runningTasks...), nil
+}
+
+func removeTaskID(taskIDs []string, taskID string) []string {
+	for i, p := range taskIDs {
+		if p == taskID {
+			taskIDs[i] = taskIDs[len(taskIDs)-1]
+			taskIDs = taskIDs[:len(taskIDs)-1]
+			break
+		}
+	}
+	return taskIDs
+}
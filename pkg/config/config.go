@@ -58,6 +58,12 @@ func bindEnvironment(v *viper.Viper) error {
 	if err := v.BindEnv(constants.ConfigNoPrompt, constants.EnvCI); err != nil {
 		return err
 	}
+	if err := v.BindEnv(constants.ConfigWaitTimeout, constants.EnvTaskWaitTimeout); err != nil {
+		return err
+	}
+	if err := v.BindEnv(constants.ConfigWaitPollInterval, constants.EnvTaskWaitPollInterval); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -37,6 +37,9 @@ const (
 	ConfigEditor       = "Editor"
 	ConfigShowOctopus  = "ShowOctopus"
 	ConfigOutputFormat = "OutputFormat"
+	// defaults for task wait, in seconds, when its flags aren't given
+	ConfigWaitTimeout      = "WaitTimeout"
+	ConfigWaitPollInterval = "WaitPollInterval"
 )
 
 const (
@@ -49,6 +52,12 @@ const (
 	EnvCI                 = "CI"
 )
 
+// environment variables task wait takes the defaults of its flags from, ahead of the config file
+const (
+	EnvTaskWaitTimeout      = "OCTOPUS_TASK_WAIT_TIMEOUT"
+	EnvTaskWaitPollInterval = "OCTOPUS_TASK_WAIT_POLL_INTERVAL"
+)
+
 const (
 	NoDescription = "No description provided"
 )
@@ -36,3 +36,20 @@ func (e *InvalidResponseError) Error() string { return e.Message }
 func NewInvalidResponseError(message string) *InvalidResponseError {
 	return &InvalidResponseError{Message: message}
 }
+
+// SilentError wraps an error which the CLI should exit with, by its exit code if it has one, without printing it,
+// such as for a command asked to report its outcome through its exit code alone
+type SilentError struct{ Err error }
+
+func (e *SilentError) Error() string { return e.Err.Error() }
+func (e *SilentError) Unwrap() error { return e.Err }
+func NewSilentError(err error) *SilentError {
+	return &SilentError{Err: err}
+}
+
+// ExitCodeError is implemented by errors which should cause the CLI process to exit with a specific
+// exit code rather than the default of 1, so scripts can tell different kinds of failure apart.
+type ExitCodeError interface {
+	error
+	ExitCode() int
+}
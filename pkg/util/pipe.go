@@ -2,7 +2,10 @@ package util
 
 import (
 	"bufio"
+	"io"
 	"os"
+	"strings"
+	"unicode"
 )
 
 func IsCalledFromPipe() bool {
@@ -11,14 +14,23 @@ func IsCalledFromPipe() bool {
 }
 
 // ReadValuesFromPipe will return an array of strings from the pipe
-// input separated by new line.
+// input separated by new lines, spaces or commas.
 func ReadValuesFromPipe() []string {
-	items := []string{}
 	if IsCalledFromPipe() {
-		scanner := bufio.NewScanner(bufio.NewReader(os.Stdin))
-		for scanner.Scan() {
-			items = append(items, scanner.Text())
-		}
+		return ReadValues(bufio.NewReader(os.Stdin))
+	}
+	return []string{}
+}
+
+// ReadValues will return an array of strings from r separated by new
+// lines, spaces or commas, dropping any empty values.
+func ReadValues(r io.Reader) []string {
+	items := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		items = append(items, strings.FieldsFunc(scanner.Text(), func(c rune) bool {
+			return c == ',' || unicode.IsSpace(c)
+		})...)
 	}
 	return items
 }
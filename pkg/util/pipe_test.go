@@ -0,0 +1,29 @@
+package util_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/OctopusDeploy/cli/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadValues_NewLines(t *testing.T) {
+	assert.Equal(t, []string{"id1", "id2", "id3"}, util.ReadValues(strings.NewReader("id1\nid2\r\nid3\n")))
+}
+
+func TestReadValues_Commas(t *testing.T) {
+	assert.Equal(t, []string{"id1", "id2", "id3"}, util.ReadValues(strings.NewReader("id1,id2,id3")))
+}
+
+func TestReadValues_MixedSeparators(t *testing.T) {
+	assert.Equal(t, []string{"id1", "id2", "id3", "id4"}, util.ReadValues(strings.NewReader("id1,id2 id3\n\tid4")))
+}
+
+func TestReadValues_DropsEmptyValues(t *testing.T) {
+	assert.Equal(t, []string{"id1", "id2"}, util.ReadValues(strings.NewReader("\n , id1,, \n\n id2 ,\n")))
+}
+
+func TestReadValues_Empty(t *testing.T) {
+	assert.Equal(t, []string{}, util.ReadValues(strings.NewReader("")))
+}
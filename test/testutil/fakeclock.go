@@ -0,0 +1,120 @@
+package testutil
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// FakeClock is a clock for task wait whose time only moves on when a test moves it, so that tests of timeouts,
+// backoff and heartbeats run instantly and always the same way. It can be passed as the Clock of task wait.
+type FakeClock struct {
+	mutex sync.Mutex
+	// changed is signalled whenever a timer is added, for tests waiting for the code under test to be waiting
+	changed *sync.Cond
+	now     time.Time
+	timers  []*fakeTimer
+}
+
+type fakeTimer struct {
+	due time.Time
+	c   chan time.Time
+}
+
+// NewFakeClock makes a clock which starts at now
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.changed = sync.NewCond(&c.mutex)
+	return c
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// Sleep blocks until the clock has been moved on by d
+func (c *FakeClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// After returns a channel which receives the time once the clock has been moved on by d. The channel is buffered,
+// as with time.After, so a timer nobody is waiting for any more doesn't hold up the clock.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	timer := &fakeTimer{due: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		timer.c <- c.now
+		return timer.c
+	}
+	c.timers = append(c.timers, timer)
+	sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].due.Before(c.timers[j].due) })
+	c.changed.Broadcast()
+	return timer.c
+}
+
+// Advance moves the clock on by d, firing every timer which is due by then
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.advanceTo(c.now.Add(d))
+}
+
+// AdvanceToNextTimer moves the clock on to when the next timer is due, firing it along with any others due then,
+// and returns how far it moved. It doesn't move if there are no timers.
+func (c *FakeClock) AdvanceToNextTimer() time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.timers) == 0 {
+		return 0
+	}
+	started := c.now
+	c.advanceTo(c.timers[0].due)
+	return c.now.Sub(started)
+}
+
+// BlockUntilTimers waits until at least n timers are waiting to fire, such as when the code under test has gone
+// back to waiting for the next of them
+func (c *FakeClock) BlockUntilTimers(n int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for len(c.timers) < n {
+		c.changed.Wait()
+	}
+}
+
+// AdvanceWhenWaiting moves the clock on to the next timer whenever at least n timers are waiting to fire, until stop
+// is called, so that a test can let the code under test run through time without stepping it along by hand. n is how
+// many timers the code under test has waiting whenever it's idle, so that it's never moved on while it's busy.
+func (c *FakeClock) AdvanceWhenWaiting(n int) (stop func()) {
+	stopped := false
+	go func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		for {
+			for !stopped && len(c.timers) < n {
+				c.changed.Wait()
+			}
+			if stopped {
+				return
+			}
+			c.advanceTo(c.timers[0].due)
+		}
+	}()
+	return func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		stopped = true
+		c.changed.Broadcast()
+	}
+}
+
+func (c *FakeClock) advanceTo(now time.Time) {
+	c.now = now
+	for len(c.timers) != 0 && !c.timers[0].due.After(now) {
+		c.timers[0].c <- now
+		c.timers = c.timers[1:]
+	}
+}
@@ -0,0 +1,181 @@
+package testutil
+
+import (
+	"sync"
+
+	"github.com/OctopusDeploy/cli/pkg/util"
+	"github.com/OctopusDeploy/go-octopusdeploy/v2/pkg/tasks"
+)
+
+// FakeTaskServer plays back scripted server tasks for the callbacks task wait uses to fetch tasks, so that tests
+// don't each have to count calls to move their tasks along. Each task goes through the states it was scripted with,
+// one each time it is returned, and stays in the last one once they run out. Its methods can be passed straight to
+// the GetServerTasksCallback, GetTaskDetailsCallback and QueryTasksCallback of task wait.
+type FakeTaskServer struct {
+	mutex sync.Mutex
+	// taskOrder is the order the tasks were added in, which is the order they're returned in
+	taskOrder []string
+	states    map[string][]*tasks.Task
+	details   map[string][]*tasks.TaskDetailsResource
+	fetches   map[string]int
+	// detailFetches is how many times the details of each task have been fetched
+	detailFetches map[string]int
+	// errs are returned instead of any tasks by the calls they're keyed by, counting from 1 across all the callbacks
+	errs  map[int]error
+	calls int
+}
+
+func NewFakeTaskServer() *FakeTaskServer {
+	return &FakeTaskServer{
+		states:        make(map[string][]*tasks.Task),
+		details:       make(map[string][]*tasks.TaskDetailsResource),
+		fetches:       make(map[string]int),
+		detailFetches: make(map[string]int),
+		errs:          make(map[int]error),
+	}
+}
+
+// NewFakeTask makes a task in the given state, which is finished (and successfully so if the state is Success) unless
+// it is Queued, Executing or Cancelling
+func NewFakeTask(id string, description string, state string) *tasks.Task {
+	isCompleted := state != "Queued" && state != "Executing" && state != "Cancelling"
+	finishedSuccessfully := state == "Success"
+
+	task := tasks.NewTask()
+	task.ID = id
+	task.Description = description
+	task.State = state
+	task.IsCompleted = &isCompleted
+	task.FinishedSuccessfully = &finishedSuccessfully
+	return task
+}
+
+// AddTask adds a task which goes through the given states, such as "Queued", "Executing", "Success"
+func (s *FakeTaskServer) AddTask(id string, description string, states ...string) *FakeTaskServer {
+	scripted := make([]*tasks.Task, 0, len(states))
+	for _, state := range states {
+		scripted = append(scripted, NewFakeTask(id, description, state))
+	}
+	return s.AddTaskStates(id, scripted...)
+}
+
+// AddTaskStates adds a task which goes through the given states, for tests which need more than NewFakeTask sets
+func (s *FakeTaskServer) AddTaskStates(id string, states ...*tasks.Task) *FakeTaskServer {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.states[id]; !ok {
+		s.taskOrder = append(s.taskOrder, id)
+	}
+	s.states[id] = states
+	return s
+}
+
+// AddDetails sets the details returned for a task, one each time they're fetched, staying on the last one once
+// they run out. Tasks without any details have empty ones.
+func (s *FakeTaskServer) AddDetails(id string, details ...*tasks.TaskDetailsResource) *FakeTaskServer {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.details[id] = details
+	return s
+}
+
+// FailCall makes the given call, counting from 1 across all the callbacks, return err. The tasks don't move on to
+// their next state on a failed call.
+func (s *FakeTaskServer) FailCall(call int, err error) *FakeTaskServer {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.errs[call] = err
+	return s
+}
+
+// GetServerTasks returns the next state of each of the given tasks, leaving out those which haven't been added,
+// as the server does for tasks which don't exist
+func (s *FakeTaskServer) GetServerTasks(taskIDs []string) ([]*tasks.Task, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.nextError(); err != nil {
+		return nil, err
+	}
+
+	result := make([]*tasks.Task, 0, len(taskIDs))
+	for _, id := range taskIDs {
+		if task := s.nextState(id); task != nil {
+			result = append(result, task)
+		}
+	}
+	return result, nil
+}
+
+// GetTaskDetails returns the next details of the given task
+func (s *FakeTaskServer) GetTaskDetails(taskID string) (*tasks.TaskDetailsResource, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.nextError(); err != nil {
+		return nil, err
+	}
+
+	details := s.details[taskID]
+	fetches := s.detailFetches[taskID]
+	s.detailFetches[taskID]++
+	if len(details) == 0 {
+		return &tasks.TaskDetailsResource{}, nil
+	}
+	return details[min(fetches, len(details)-1)], nil
+}
+
+// QueryTasks moves every task on to its next state, returning those in one of the queried states (or all of them
+// if the query has none) in the order they were added
+func (s *FakeTaskServer) QueryTasks(query tasks.TasksQuery) ([]*tasks.Task, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.nextError(); err != nil {
+		return nil, err
+	}
+
+	result := make([]*tasks.Task, 0, len(s.taskOrder))
+	for _, id := range s.taskOrder {
+		task := s.nextState(id)
+		if len(query.States) == 0 || util.SliceContains(query.States, task.State) {
+			result = append(result, task)
+		}
+	}
+	return result, nil
+}
+
+// Calls is how many calls have been made through any of the callbacks
+func (s *FakeTaskServer) Calls() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.calls
+}
+
+// Fetches is how many times a task has been fetched, by ID or by a query, whether or not a query returned it
+func (s *FakeTaskServer) Fetches(id string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.fetches[id]
+}
+
+// DetailFetches is how many times the details of a task have been fetched
+func (s *FakeTaskServer) DetailFetches(id string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.detailFetches[id]
+}
+
+// nextError counts a call, returning the error it was scripted to fail with, if any
+func (s *FakeTaskServer) nextError() error {
+	s.calls++
+	return s.errs[s.calls]
+}
+
+// nextState returns the state a task is in this time it's fetched, or nil if it hasn't been added
+func (s *FakeTaskServer) nextState(id string) *tasks.Task {
+	states := s.states[id]
+	if len(states) == 0 {
+		return nil
+	}
+	fetches := s.fetches[id]
+	s.fetches[id]++
+	return states[min(fetches, len(states)-1)]
+}
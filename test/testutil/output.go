@@ -0,0 +1,48 @@
+package testutil
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ansiEscape matches the escape sequences which color terminal output
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// StripAnsi removes any color from output, for tests which only care about the text
+func StripAnsi(output string) string {
+	return ansiEscape.ReplaceAllString(output, "")
+}
+
+// OutputLines splits output into its lines, without the spaces tables pad their last column with or the newline
+// ending the output
+func OutputLines(output string) []string {
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	return lines
+}
+
+// AssertOutputLines checks output is made up of exactly the expected lines, ignoring color and trailing spaces
+func AssertOutputLines(t *testing.T, output string, expected ...string) bool {
+	return assert.Equal(t, expected, OutputLines(StripAnsi(output)))
+}
+
+// AssertOutputContainsLines checks each of the expected lines is in output, in the given order but not necessarily
+// next to each other, ignoring color and trailing spaces
+func AssertOutputContainsLines(t *testing.T, output string, expected ...string) bool {
+	lines := OutputLines(StripAnsi(output))
+	next := 0
+	for _, line := range lines {
+		if next < len(expected) && line == expected[next] {
+			next++
+		}
+	}
+	if next < len(expected) {
+		return assert.Fail(t, "Output is missing a line", "expected line %q (or the lines before it) in output:\n%s", expected[next], strings.Join(lines, "\n"))
+	}
+	return true
+}